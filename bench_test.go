@@ -0,0 +1,137 @@
+package fixtures_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/dbh/md-tools/internal/markdown"
+	"github.com/dbh/md-tools/internal/tools"
+)
+
+// refHeavyDoc returns a document with n footnotes and n reference links,
+// with their definitions interleaved with the prose as notes often are.
+func refHeavyDoc(n int) string {
+	var b strings.Builder
+	b.WriteString("# Notes\n\n")
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&b, "Paragraph %d cites [source %d][%d] and adds a note.[^n%d] It goes on for a while.\n\n", i, i, i, i)
+		fmt.Fprintf(&b, "[^n%d]: Note %d, about [source %d][%d].\n\n", i, i, i, i)
+		fmt.Fprintf(&b, "[%d]: https://example.com/%d\n\n", i, i)
+	}
+	return b.String()
+}
+
+// sampleDoc returns a document of n sections, each with the markup the
+// tools work on: headings, wrapped prose with emphasis, links and footnotes,
+// lists, a table, a quote, code, math, comments and CriticMarkup.
+func sampleDoc(n int) string {
+	var b strings.Builder
+	b.WriteString("---\ntitle: Sample\n---\n\n# Sample document\n\n")
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&b, "## section %d: notes on the thing\n\n", i)
+		fmt.Fprintf(&b, "This paragraph is *emphasized* in places and __strong__ in others. It links to [an example](https://example.com/%d) and cites [a source][s%d].[^n%d] It goes on for a while, long enough to need wrapping at any sensible width, and then it goes on a little more. {++An addition++} and {--a deletion--} sit beside <!-- a comment --> a remark.\n", i, i, i)
+		b.WriteString("A second line of the same paragraph, with inline $x^2$ math and `inline code`.\n\n")
+		b.WriteString("* First item\n* Second item, with a longer sentence in it. And a second sentence.\n    * A nested item\n\n")
+		b.WriteString("1) One\n2) Two\n\n")
+		b.WriteString("| Name | Value |\n|---|--:|\n| alpha | 1 |\n| beta | 22 |\n\n")
+		b.WriteString("> A quoted paragraph that is also long enough to be wrapped by the tools that wrap. It has two sentences.\n\n")
+		b.WriteString("~~~go\nfunc main() {\n\tfmt.Println(\"[not a link][x]\")\n}\n~~~\n\n")
+		b.WriteString("$$\nE = mc^2\n$$\n\n")
+		fmt.Fprintf(&b, "[^n%d]: A footnote with [a link](https://example.com/note/%d).\n\n", i, i)
+		fmt.Fprintf(&b, "[s%d]: https://example.com/source/%d\n\n", i, i)
+	}
+	return b.String()
+}
+
+// sampleSizes are the sizes BenchmarkTools runs at, in sections of
+// sampleDoc: about 1 KB, 100 KB and 1 MB.
+var sampleSizes = []struct {
+	name     string
+	sections int
+}{
+	{"small", 1},
+	{"medium", 100},
+	{"large", 1000},
+}
+
+// BenchmarkTools runs every registry tool on small, medium and large
+// documents. testdata/bench/baseline.txt holds its results from the last
+// release, for scripts/bench-check and benchstat to compare against.
+func BenchmarkTools(b *testing.B) {
+	for _, size := range sampleSizes {
+		doc := sampleDoc(size.sections)
+		for _, name := range tools.Names() {
+			transform, err := tools.New(name, nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.Run(name+"/"+size.name, func(b *testing.B) {
+				b.SetBytes(int64(len(doc)))
+				for i := 0; i < b.N; i++ {
+					transform(doc)
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkRefHeavy runs the tools that remove definitions while rewriting
+// links on documents with thousands of links and footnotes.
+func BenchmarkRefHeavy(b *testing.B) {
+	for _, tool := range []string{"mdinline", "mdref", "mdsidenote"} {
+		for _, n := range []int{1000, 5000} {
+			doc := refHeavyDoc(n)
+			transform, err := tools.New(tool, nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.Run(fmt.Sprintf("%s/%d", tool, n), func(b *testing.B) {
+				b.SetBytes(int64(len(doc)))
+				for i := 0; i < b.N; i++ {
+					transform(doc)
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkExcludeRanges cuts a document into chunks between n links,
+// dropping n definitions, the way the link tools do: with ExcludeRanges for
+// each chunk, or with a RangeSet built once.
+func BenchmarkExcludeRanges(b *testing.B) {
+	for _, n := range []int{1000, 10000} {
+		doc := refHeavyDoc(n)
+		var defs []markdown.ByteRange
+		var cuts []int
+		for pos := 0; pos < len(doc); {
+			end := strings.IndexByte(doc[pos:], '\n') + pos + 1
+			if strings.HasPrefix(doc[pos:], "[") && !strings.HasPrefix(doc[pos:], "[^") {
+				defs = append(defs, markdown.ByteRange{Start: pos, End: end})
+			} else if strings.HasPrefix(doc[pos:], "Paragraph") {
+				cuts = append(cuts, pos)
+			}
+			pos = end
+		}
+		cuts = append(cuts, len(doc))
+		b.Run(fmt.Sprintf("slice/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				last := 0
+				for _, cut := range cuts {
+					markdown.ExcludeRanges(doc[last:cut], last, defs)
+					last = cut
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("set/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				set := markdown.NewRangeSet(defs)
+				last := 0
+				for _, cut := range cuts {
+					set.Exclude(doc[last:cut], last)
+					last = cut
+				}
+			}
+		})
+	}
+}
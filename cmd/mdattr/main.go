@@ -0,0 +1,125 @@
+// mdattr gives Markdown headings Pandoc and kramdown attribute blocks
+// ({#id .class key=val}) with IDs derived from their slugs.
+//
+// Usage:
+//
+//	mdattr [file...]           # give every heading an {#id} from its slug
+//	cat file.md | mdattr
+//	mdattr -levels 2-3 file.md # only add IDs to level 2 and 3 headings
+//	mdattr -check file.md      # only report duplicate IDs, writing nothing to stdout
+//	mdattr -check -output rdjson *.md   # report them for reviewdog
+//	mdattr -w file.md          # modify file in place
+//
+// Explicit IDs are never changed and generated ones avoid them. Duplicate IDs
+// are reported on stderr as "file:line: duplicate id", with "stdin" for
+// standard input, and make the exit status 1.
+// mdunattr removes attribute blocks.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/tools/mdattr"
+)
+
+var (
+	flags = cli.RegisterFlags()
+	check = flag.Bool("check", false, "only report duplicate IDs, leaving the document unchanged")
+	setup = mdattr.Flags(flag.CommandLine)
+
+	reportFormat = cli.RegisterOutputFlag()
+)
+
+var (
+	duplicates bool
+
+	// report collects the duplicate IDs for -output rdjson; inputName is
+	// the file being checked or transformed.
+	report    = &cli.Report{Source: "mdattr"}
+	inputName = "stdin"
+)
+
+func main() {
+	flag.Parse()
+	addIDs, err := setup()
+	if err == nil {
+		err = cli.CheckOutput(*reportFormat)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mdattr: %v\n", err)
+		os.Exit(1)
+	}
+	if *reportFormat == "rdjson" && !*check {
+		fmt.Fprintf(os.Stderr, "mdattr: -output rdjson requires -check\n")
+		os.Exit(1)
+	}
+	if *check {
+		if flags.PrintVersion("mdattr") {
+			return
+		}
+		err = runCheck(flag.Args())
+	} else {
+		err = cli.RunSetup("mdattr", flags, flag.Args(), func(path string) (cli.TransformFunc, error) {
+			inputName = path
+			if path == "" {
+				inputName = "stdin"
+			}
+			return func(content string) string {
+				checkIDs(content)
+				return addIDs(content)
+			}, nil
+		})
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mdattr: %v\n", err)
+		os.Exit(1)
+	}
+	if duplicates {
+		os.Exit(1)
+	}
+}
+
+// runCheck checks stdin, or each file in args, writing nothing to stdout
+// but the rdjson report.
+func runCheck(args []string) error {
+	args, err := cli.ExpandArgs(args)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		checkIDs(string(data))
+	}
+	for _, path := range args {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		inputName = path
+		checkIDs(string(data))
+	}
+	if *reportFormat == "rdjson" {
+		return report.Write(os.Stdout)
+	}
+	return nil
+}
+
+// checkIDs reports every ID content defines more than once, to stderr or
+// the rdjson report.
+func checkIDs(content string) {
+	for _, d := range mdattr.Duplicates(content) {
+		if *reportFormat == "rdjson" {
+			report.Problem(inputName, d.Line, d.String())
+		} else {
+			fmt.Fprintf(os.Stderr, "%s:%d: %s\n", inputName, d.Line, d)
+		}
+		duplicates = true
+	}
+}
@@ -0,0 +1,144 @@
+// mdbacklinks maintains a "Backlinks" section at the bottom of every note in a
+// directory, listing the other notes that link to it.
+//
+// Usage:
+//
+//	mdbacklinks [dir]         # update every note under dir (default .)
+//	mdbacklinks -check docs   # list out-of-date notes and exit 1, writing nothing
+//
+// The section is delimited by <!-- backlinks --> and <!-- /backlinks --> and
+// is removed from notes that have no inbound links.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/corpus"
+	"github.com/dbh/md-tools/internal/markdown"
+)
+
+// marker names the generated section.
+const marker = "backlinks"
+
+var (
+	flags        = cli.RegisterVersionFlags()
+	check        = flag.Bool("check", false, "report notes whose backlinks are out of date and exit 1, without writing")
+	reportFormat = cli.RegisterOutputFlag()
+)
+
+// report collects the -check diagnostics for -output rdjson.
+var report = &cli.Report{Source: "mdbacklinks"}
+
+func main() {
+	flag.Parse()
+	if flags.PrintVersion("mdbacklinks") {
+		return
+	}
+	if err := cli.CheckOutput(*reportFormat); err != nil {
+		fmt.Fprintf(os.Stderr, "mdbacklinks: %v\n", err)
+		os.Exit(1)
+	}
+	if *reportFormat == "rdjson" && !*check {
+		fmt.Fprintf(os.Stderr, "mdbacklinks: -output rdjson requires -check\n")
+		os.Exit(1)
+	}
+	stale, err := run(flag.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mdbacklinks: %v\n", err)
+		os.Exit(1)
+	}
+	if *reportFormat == "rdjson" {
+		if err := report.Write(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "mdbacklinks: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *check && len(stale) > 0 {
+		if *reportFormat == "text" {
+			for _, rel := range stale {
+				fmt.Println(rel)
+			}
+		}
+		os.Exit(1)
+	}
+}
+
+func run(args []string) ([]string, error) {
+	root := "."
+	switch len(args) {
+	case 0:
+	case 1:
+		root = args[0]
+	default:
+		return nil, fmt.Errorf("expected at most one directory argument")
+	}
+
+	c, err := corpus.Load(root)
+	if err != nil {
+		return nil, err
+	}
+
+	contents := make(map[string][]byte, len(c.Files))
+	titles := make(map[string]string, len(c.Files))
+	inbound := make(map[string]map[string]bool)
+	for _, rel := range c.Files {
+		data, err := c.Read(rel)
+		if err != nil {
+			return nil, err
+		}
+		contents[rel] = data
+		titles[rel] = corpus.Title(rel, data)
+
+		// Links inside our own generated section must not count, or every
+		// run would add backlinks for the previous run's backlinks.
+		body := markdown.StripMarkedSection(string(data), marker)
+		for _, l := range c.Links(rel, []byte(body)) {
+			if l.Image || l.Target == rel || !c.Has(l.Target) {
+				continue
+			}
+			if inbound[l.Target] == nil {
+				inbound[l.Target] = make(map[string]bool)
+			}
+			inbound[l.Target][rel] = true
+		}
+	}
+
+	var stale []string
+	for _, rel := range c.Files {
+		updated := markdown.ReplaceMarkedSection(string(contents[rel]), marker, backlinks(rel, inbound[rel], titles))
+		changed, err := c.Update(rel, contents[rel], updated, *check)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", rel, err)
+		}
+		if changed && *check {
+			report.Change(c.Abs(rel), string(contents[rel]), updated, "backlinks are out of date")
+		}
+		if changed {
+			stale = append(stale, rel)
+		}
+	}
+	return stale, nil
+}
+
+// backlinks returns the section body for note rel, or nil when nothing links
+// to it. Sources are listed by path so output is deterministic.
+func backlinks(rel string, sources map[string]bool, titles map[string]string) []string {
+	if len(sources) == 0 {
+		return nil
+	}
+	paths := make([]string, 0, len(sources))
+	for src := range sources {
+		paths = append(paths, src)
+	}
+	sort.Strings(paths)
+
+	body := []string{"## Backlinks", ""}
+	for _, src := range paths {
+		body = append(body, "- "+corpus.MarkdownLink(titles[src], rel, src))
+	}
+	return body
+}
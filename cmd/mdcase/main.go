@@ -0,0 +1,41 @@
+// mdcase normalizes the capitalization of Markdown headings to Title Case or
+// sentence case.
+//
+// Usage:
+//
+//	mdcase [file...]
+//	cat file.md | mdcase
+//	mdcase -style sentence file.md   # sentence case instead of Title Case
+//	mdcase -dict names.txt file.md   # keep these words exactly as spelled
+//	mdcase -levels 2-3 file.md       # only touch level 2 and 3 headings
+//	mdcase -w file.md                # modify file in place
+//
+// Code spans, link destinations, acronyms (API), and mixed-case words
+// (GitHub, iOS) are never changed.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/tools/mdcase"
+)
+
+var (
+	flags = cli.RegisterFlags()
+	setup = mdcase.Flags(flag.CommandLine)
+)
+
+func main() {
+	flag.Parse()
+	transform, err := setup()
+	if err == nil {
+		err = cli.Run("mdcase", flags, flag.Args(), transform)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mdcase: %v\n", err)
+		os.Exit(1)
+	}
+}
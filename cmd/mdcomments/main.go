@@ -0,0 +1,69 @@
+// mdcomments strips HTML comments for publishing, or lists them as a review
+// report.
+//
+// Usage:
+//
+//	mdcomments [file...]
+//	cat file.md | mdcomments
+//	mdcomments -w file.md                  # modify file in place
+//	mdcomments -report docs/*.md           # list comments with file:line and heading
+//	mdcomments -keep '^prettier-' file.md  # also keep comments matching a regexp
+//
+// Comments in code are text and are left alone. md-tools directives are kept
+// and never reported: generated-section markers such as <!-- nav --> and
+// <!-- /nav --> (when both are present), and comments that start with a tool
+// name, such as <!-- mdwrap: off -->.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/tools/mdcomments"
+)
+
+var (
+	flags  = cli.RegisterFlags()
+	report = flag.Bool("report", false, "print each comment as \"file:line: [heading] text\" instead of stripping")
+	setup  = mdcomments.ReportFlags(flag.CommandLine)
+)
+
+func main() {
+	flag.Parse()
+	transform, printReport, err := setup()
+	if err == nil && *report {
+		if flags.PrintVersion("mdcomments") {
+			return
+		}
+		err = runReport(flag.Args(), printReport)
+	} else if err == nil {
+		err = cli.Run("mdcomments", flags, flag.Args(), transform)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mdcomments: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// runReport prints the comments of each file, or of stdin without arguments.
+func runReport(args []string, printReport mdcomments.ReportFunc) error {
+	if len(args) == 0 {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		printReport(os.Stdout, "stdin", string(data))
+		return nil
+	}
+	for _, path := range args {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		printReport(os.Stdout, path, string(data))
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+// mdconvert converts HTML to Markdown, for migrating legacy pages into the
+// toolchain.
+//
+// Usage:
+//
+//	mdconvert page.html > page.md
+//	curl -s https://example.com | mdconvert -i page.md
+//	mdconvert -keep table,video page.html       # leave these elements as HTML
+//	mdconvert -remove nav,footer page.html      # drop these elements entirely
+//	mdconvert -domain https://example.com page.html   # absolute link URLs
+//
+// Tables become pipe tables and <del>/<s> become ~~strikethrough~~. Emphasis
+// is written as _italic_ and **bold**, matching mdemph's defaults.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/tools/mdconvert"
+)
+
+var (
+	flags = cli.RegisterFlags()
+	setup = mdconvert.Flags(flag.CommandLine)
+)
+
+func main() {
+	flag.Parse()
+	transform, err := setup()
+	if err == nil {
+		err = cli.Run("mdconvert", flags, flag.Args(), transform)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mdconvert: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,42 @@
+// mdcritic accepts or rejects CriticMarkup edits, or renders them as HTML for
+// review builds.
+//
+// Usage:
+//
+//	mdcritic [file...]             # accept every change
+//	cat file.md | mdcritic
+//	mdcritic -mode reject file.md  # reject every change
+//	mdcritic -mode html file.md    # <ins>, <del>, and <mark> for review
+//	mdcritic -w file.md            # modify file in place
+//
+// The markup is {++addition++}, {--deletion--}, {~~old~>new~~},
+// {==highlight==}, and {>>comment<<}. Accepting or rejecting drops comments
+// and keeps highlighted text; the HTML mode renders comments as
+// <span class="critic comment">. Markup in code is left alone.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/tools/mdcritic"
+)
+
+var (
+	flags = cli.RegisterFlags()
+	setup = mdcritic.Flags(flag.CommandLine)
+)
+
+func main() {
+	flag.Parse()
+	transform, err := setup()
+	if err == nil {
+		err = cli.Run("mdcritic", flags, flag.Args(), transform)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mdcritic: %v\n", err)
+		os.Exit(1)
+	}
+}
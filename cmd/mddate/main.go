@@ -0,0 +1,135 @@
+// mddate maintains the date and lastmod frontmatter fields of every Markdown
+// file in a directory from git history, falling back to file modification
+// times.
+//
+// Usage:
+//
+//	mddate [dir]                 # update every file under dir (default .)
+//	mddate -check docs           # list out-of-date files and exit 1, writing nothing
+//	mddate -mtime docs           # use modification times instead of git
+//	mddate -format 2006-01-02T15:04:05Z07:00 docs
+//
+// date is the first commit that added the file and is only set when missing;
+// lastmod is the most recent commit that touched it. Files outside a git
+// repository, or not yet committed, use their modification time for both,
+// and keep it when the fields are written.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/corpus"
+	"github.com/dbh/md-tools/internal/markdown"
+)
+
+var (
+	flags        = cli.RegisterVersionFlags()
+	check        = flag.Bool("check", false, "report files whose dates are out of date and exit 1, without writing")
+	reportFormat = cli.RegisterOutputFlag()
+	mtime        = flag.Bool("mtime", false, "use file modification times instead of git history")
+	format       = flag.String("format", "2006-01-02", "Go time `layout` for the written dates")
+)
+
+// report collects the -check diagnostics for -output rdjson.
+var report = &cli.Report{Source: "mddate"}
+
+func main() {
+	flag.Parse()
+	if flags.PrintVersion("mddate") {
+		return
+	}
+	if err := cli.CheckOutput(*reportFormat); err != nil {
+		fmt.Fprintf(os.Stderr, "mddate: %v\n", err)
+		os.Exit(1)
+	}
+	if *reportFormat == "rdjson" && !*check {
+		fmt.Fprintf(os.Stderr, "mddate: -output rdjson requires -check\n")
+		os.Exit(1)
+	}
+	stale, err := run(flag.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mddate: %v\n", err)
+		os.Exit(1)
+	}
+	if *reportFormat == "rdjson" {
+		if err := report.Write(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "mddate: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *check && len(stale) > 0 {
+		if *reportFormat == "text" {
+			for _, rel := range stale {
+				fmt.Println(rel)
+			}
+		}
+		os.Exit(1)
+	}
+}
+
+func run(args []string) ([]string, error) {
+	root := "."
+	switch len(args) {
+	case 0:
+	case 1:
+		root = args[0]
+	default:
+		return nil, fmt.Errorf("expected at most one directory argument")
+	}
+
+	c, err := corpus.Load(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var commits map[string]corpus.History
+	if !*mtime {
+		commits = corpus.GitHistory(root)
+	}
+
+	var stale []string
+	for _, rel := range c.Files {
+		data, err := c.Read(rel)
+		if err != nil {
+			return nil, err
+		}
+		h, ok := commits[rel]
+		if !ok {
+			info, err := os.Stat(c.Abs(rel))
+			if err != nil {
+				return nil, err
+			}
+			h = corpus.History{Created: info.ModTime(), Modified: info.ModTime()}
+		}
+
+		lines := strings.Split(string(data), "\n")
+		if _, has := markdown.FrontmatterField(lines, "date"); !has {
+			lines = markdown.SetFrontmatterField(lines, "date", h.Created.Format(*format))
+		}
+		lines = markdown.SetFrontmatterField(lines, "lastmod", h.Modified.Format(*format))
+
+		changed, err := c.Update(rel, data, strings.Join(lines, "\n"), *check)
+		if err != nil {
+			return nil, err
+		}
+		if changed && *check {
+			report.Change(c.Abs(rel), string(data), strings.Join(lines, "\n"), "dates are out of date")
+		}
+		if !changed {
+			continue
+		}
+		stale = append(stale, rel)
+		// Writing the fields isn't an edit: keep the modification time the
+		// dates were taken from, or the next run would move lastmod to now.
+		if !ok && !*check {
+			if err := os.Chtimes(c.Abs(rel), h.Modified, h.Modified); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return stale, nil
+}
@@ -0,0 +1,73 @@
+// mddraft removes draft material before publishing, or lists it.
+//
+// Usage:
+//
+//	mddraft [file...]
+//	cat file.md | mddraft
+//	mddraft -w file.md          # modify file in place
+//	mddraft -list docs/*.md     # print each draft as "file:line-line: title"
+//
+// Draft material is either a block between <!-- draft --> and <!-- /draft -->
+// markers on lines of their own, or a section whose heading carries the draft
+// class, as in "## Ideas {.draft}" or "## Ideas {#ideas .draft}". A section
+// runs to the next heading of the same or a higher level. Markers and
+// headings in code are text and are left alone.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/tools/mddraft"
+)
+
+var (
+	flags = cli.RegisterFlags()
+	list  = flag.Bool("list", false, "print each draft as \"file:line-line: title\" instead of removing")
+	setup = mddraft.Flags(flag.CommandLine)
+)
+
+func main() {
+	flag.Parse()
+	if *list {
+		if flags.PrintVersion("mddraft") {
+			return
+		}
+		if err := runList(flag.Args()); err != nil {
+			fmt.Fprintf(os.Stderr, "mddraft: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	transform, err := setup()
+	if err == nil {
+		err = cli.Run("mddraft", flags, flag.Args(), transform)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mddraft: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// runList prints the drafts of each file, or of stdin without arguments.
+func runList(args []string) error {
+	if len(args) == 0 {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		mddraft.List(os.Stdout, "stdin", string(data))
+		return nil
+	}
+	for _, path := range args {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		mddraft.List(os.Stdout, path, string(data))
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+// mdemph normalizes emphasis markers so italics use one delimiter and bold
+// another, e.g. _italic_ and **bold**.
+//
+// Usage:
+//
+//	mdemph [file...]
+//	cat file.md | mdemph
+//	mdemph -italic '*' file.md   # *italic* instead of _italic_
+//	mdemph -bold _ file.md       # __bold__ instead of **bold**
+//	mdemph -w file.md            # modify file in place
+//
+// Emphasis is found with the CommonMark delimiter rules, so intra-word
+// underscores (snake_case), code, math, and link destinations are never
+// touched. A pair that would parse differently with the other delimiter, such
+// as intra-word *em*phasis, is left as written.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/tools/mdemph"
+)
+
+var (
+	flags = cli.RegisterFlags()
+	setup = mdemph.Flags(flag.CommandLine)
+)
+
+func main() {
+	flag.Parse()
+	transform, err := setup()
+	if err == nil {
+		err = cli.Run("mdemph", flags, flag.Args(), transform)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mdemph: %v\n", err)
+		os.Exit(1)
+	}
+}
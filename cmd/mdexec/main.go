@@ -0,0 +1,286 @@
+// mdexec runs fenced code blocks marked exec and writes what they print into
+// an output block after each one, like a notebook.
+//
+// Usage:
+//
+//	mdexec [file...]
+//	cat file.md | mdexec
+//	mdexec -w file.md                     # modify file in place
+//	mdexec -check file.md                 # exit 1 when an output block is stale
+//	mdexec -check -output rdjson *.md     # report stale blocks for reviewdog
+//	mdexec -runner 'python=uv run -' file.md
+//
+// A block is run when its info string has the word exec after the language:
+//
+//	```sh exec
+//	echo hello
+//	```
+//
+// Its combined stdout and stderr replace the ```output block that follows it,
+// which is added when missing. The code is passed on stdin to the runner for
+// its language, run from the document's directory (the current one for
+// stdin): sh, bash, zsh, python (python3), ruby, perl, and node (js,
+// javascript) are built in, and -runner adds or replaces one with a shell
+// command. A block that exits non-zero still gets its output; one that can't
+// be run is reported as "file:line: error" and left as it is.
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/markdown"
+)
+
+var (
+	flags        = cli.RegisterFlags()
+	check        = flag.Bool("check", false, "report blocks whose output is stale and exit 1, leaving the document unchanged")
+	timeout      = flag.Duration("timeout", 30*time.Second, "time `limit` for each block")
+	reportFormat = cli.RegisterOutputFlag()
+)
+
+// runners maps languages to the shell command that runs their code from
+// stdin.
+var runners = map[string]string{
+	"sh":         "sh",
+	"bash":       "bash",
+	"zsh":        "zsh",
+	"python":     "python3",
+	"python3":    "python3",
+	"ruby":       "ruby",
+	"perl":       "perl",
+	"node":       "node",
+	"js":         "node",
+	"javascript": "node",
+}
+
+// failed is set when a block can't be run or, with -check, is stale.
+var failed bool
+
+// report collects stale blocks, with their new output as the suggested fix,
+// for -output rdjson.
+var report = &cli.Report{Source: "mdexec"}
+
+func main() {
+	flag.Func("runner", "run a language's blocks with a shell command, as `lang=command` (repeatable)", func(s string) error {
+		lang, command, ok := strings.Cut(s, "=")
+		if !ok || strings.TrimSpace(lang) == "" || strings.TrimSpace(command) == "" {
+			return fmt.Errorf("want lang=command")
+		}
+		runners[strings.TrimSpace(lang)] = command
+		return nil
+	})
+	flag.Parse()
+	if err := cli.CheckOutput(*reportFormat); err != nil {
+		fmt.Fprintf(os.Stderr, "mdexec: %v\n", err)
+		os.Exit(1)
+	}
+	if *reportFormat == "rdjson" {
+		if !*check {
+			fmt.Fprintf(os.Stderr, "mdexec: -output rdjson requires -check\n")
+			os.Exit(1)
+		}
+		if flags.PrintVersion("mdexec") {
+			return
+		}
+		if err := runReport(flag.Args()); err != nil {
+			fmt.Fprintf(os.Stderr, "mdexec: %v\n", err)
+			os.Exit(1)
+		}
+	} else if err := cli.RunSetup("mdexec", flags, flag.Args(), setup); err != nil {
+		fmt.Fprintf(os.Stderr, "mdexec: %v\n", err)
+		os.Exit(1)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// fence is a fenced code block.
+type fence struct {
+	open, close int    // line indexes of the fences
+	indent      string // indent of the opening fence
+	marker      string // the opening run of backticks or tildes
+	info        []string
+}
+
+// fenceAt returns the fenced block opening at lines[i], if there is one.
+// close is len(lines) for an unclosed block.
+func fenceAt(lines []string, i int) (fence, bool) {
+	line := lines[i]
+	trimmed := strings.TrimLeft(line, " ")
+	indent := line[:len(line)-len(trimmed)]
+	if len(indent) > 3 || !(strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~")) {
+		return fence{}, false
+	}
+	n := 0
+	for n < len(trimmed) && trimmed[n] == trimmed[0] {
+		n++
+	}
+	f := fence{open: i, indent: indent, marker: trimmed[:n], info: strings.Fields(trimmed[n:])}
+	f.close = i + 1
+	for f.close < len(lines) {
+		t := strings.TrimSpace(lines[f.close])
+		if strings.HasPrefix(t, f.marker) && strings.Trim(t, f.marker[:1]) == "" {
+			break
+		}
+		f.close++
+	}
+	return f, true
+}
+
+// isExec reports whether a block's info string asks for it to be run.
+func (f fence) isExec() bool {
+	for _, word := range f.info[min(1, len(f.info)):] {
+		if word == "exec" {
+			return true
+		}
+	}
+	return false
+}
+
+// setup returns the transform for the file at path, which runs its blocks
+// from the file's directory.
+func setup(path string) (cli.TransformFunc, error) {
+	return func(content string) string {
+		return transform(content, path)
+	}, nil
+}
+
+// transform runs the exec blocks in content, read from the file at path or
+// from stdin when path is "", and updates their output blocks. The blocks
+// run from the file's directory, or the current one for stdin.
+func transform(content, path string) string {
+	name, dir := "stdin", "."
+	if path != "" {
+		name, dir = path, filepath.Dir(path)
+	}
+	lines := strings.Split(content, "\n")
+	i := markdown.FrontmatterEnd(lines)
+	result := append([]string(nil), lines[:i]...)
+
+	for i < len(lines) {
+		f, ok := fenceAt(lines, i)
+		if !ok {
+			result = append(result, lines[i])
+			i++
+			continue
+		}
+		end := min(f.close+1, len(lines))
+		result = append(result, lines[i:end]...)
+		i = end
+		if !f.isExec() || f.close == len(lines) {
+			continue
+		}
+
+		// An existing output block follows after a blank line.
+		var existing []string
+		next := i
+		if i+1 < len(lines) && strings.TrimSpace(lines[i]) == "" {
+			if out, ok := fenceAt(lines, i+1); ok && len(out.info) == 1 && out.info[0] == "output" && out.close < len(lines) {
+				existing = lines[i : out.close+1]
+				next = out.close + 1
+			}
+		}
+
+		var code []string
+		for _, line := range lines[f.open+1 : f.close] {
+			code = append(code, strings.TrimPrefix(line, f.indent))
+		}
+		output, err := run(f.info[0], strings.Join(code, "\n"), dir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s:%d: %v\n", name, f.open+1, err)
+			failed = true
+			continue
+		}
+		block := outputBlock(f.indent, output)
+		if strings.Join(block, "\n") == strings.Join(existing, "\n") {
+			continue
+		}
+		if *check {
+			if *reportFormat == "text" {
+				fmt.Fprintf(os.Stderr, "%s:%d: output is stale\n", name, f.open+1)
+			}
+			failed = true
+		}
+		result = append(result, block...)
+		i = next
+	}
+
+	updated := strings.TrimRight(strings.Join(result, "\n"), "\n") + "\n"
+	if *check {
+		report.Change(name, content, updated, "output is stale")
+		return content
+	}
+	return updated
+}
+
+// runReport checks stdin, or each file in args, and writes the rdjson report
+// to stdout.
+func runReport(args []string) error {
+	if len(args) == 0 {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		transform(string(data), "")
+	}
+	for _, path := range args {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		transform(string(data), path)
+	}
+	return report.Write(os.Stdout)
+}
+
+// run runs code from dir with the runner for lang and returns what it
+// printed. A non-zero exit status is not an error.
+func run(lang, code, dir string) (string, error) {
+	command, ok := runners[lang]
+	if !ok {
+		return "", fmt.Errorf("no runner for %q (add one with -runner)", lang)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(code + "\n")
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("%s: timed out after %v", lang, *timeout)
+	}
+	if _, exited := err.(*exec.ExitError); err != nil && !exited {
+		return "", fmt.Errorf("%s: %v", lang, err)
+	}
+	return out.String(), nil
+}
+
+// outputBlock returns a blank line and an output block holding output, with
+// a fence longer than any backtick run in it.
+func outputBlock(indent, output string) []string {
+	marker := "```"
+	for strings.Contains(output, marker) {
+		marker += "`"
+	}
+	block := []string{"", indent + marker + "output"}
+	if output = strings.TrimRight(output, "\n"); output != "" {
+		for _, line := range strings.Split(output, "\n") {
+			block = append(block, indent+line)
+		}
+	}
+	return append(block, indent+marker)
+}
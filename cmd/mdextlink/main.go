@@ -0,0 +1,46 @@
+// mdextlink applies a policy to external links: those to an http or https
+// URL whose host isn't in the -allow list.
+//
+// Usage:
+//
+//	mdextlink [file...]
+//	cat file.md | mdextlink
+//	mdextlink -marker '↗' file.md                 # append ↗ instead of (external)
+//	mdextlink -policy redirect -prefix 'https://example.com/out?url=' file.md
+//	mdextlink -policy html -allow example.com file.md
+//	mdextlink -w file.md                          # modify file in place
+//
+// The marker policy appends the -marker text after each external link. The
+// redirect policy sends each one through the -prefix URL, with the original
+// destination query-escaped after it; a reference link's definition is
+// rewritten, and the prefix's own host is never external. The html policy
+// writes each one as an <a> tag with rel="noopener" and target="_blank", so
+// it opens in a new tab. Allowed domains include their subdomains. Links in
+// code are left alone, and running mdextlink again changes nothing.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/tools/mdextlink"
+)
+
+var (
+	flags = cli.RegisterFlags()
+	setup = mdextlink.Flags(flag.CommandLine)
+)
+
+func main() {
+	flag.Parse()
+	transform, err := setup()
+	if err == nil {
+		err = cli.Run("mdextlink", flags, flag.Args(), transform)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mdextlink: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,41 @@
+// mdfence normalizes code blocks: indented code blocks become fenced blocks,
+// and every fence uses the same character and the shortest length that can't
+// be closed early by the block's content.
+//
+// Usage:
+//
+//	mdfence [file...]
+//	cat file.md | mdfence
+//	mdfence -lang sh file.md       # info string for converted indented blocks
+//	mdfence -style tilde file.md   # fence with ~~~ instead of ```
+//	mdfence -w file.md             # modify file in place
+//
+// Indented lines that continue a list item or footnote are not code and are
+// left alone.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/tools/mdfence"
+)
+
+var (
+	flags = cli.RegisterFlags()
+	setup = mdfence.Flags(flag.CommandLine)
+)
+
+func main() {
+	flag.Parse()
+	transform, err := setup()
+	if err == nil {
+		err = cli.Run("mdfence", flags, flag.Args(), transform)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mdfence: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,509 @@
+// mdfncollect combines Markdown documents into one, renumbering their
+// footnotes in a single sequence and merging their link reference
+// definitions, so that labels reused across chapters don't collide.
+//
+// Usage:
+//
+//	mdfncollect ch1.md ch2.md ch3.md > book.md
+//	mdfncollect -o book.md chapters/*.md
+//	mdfncollect -defs each ch1.md ch2.md   # definitions after each document
+//
+// Footnotes ([^label]) are numbered in order of first reference across the
+// documents, then any that are never referenced. A link reference
+// definition that two documents share is written once; when a later
+// document defines a label differently, its label becomes label-2 (or the
+// next free number) and its links are rewritten to match. The definitions
+// go at the end of the combined document, or with -defs each, after the
+// document they came from.
+//
+// Documents are joined by a blank line. The first document's frontmatter is
+// kept and the others' dropped. Nothing in code is changed.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/markdown"
+	"github.com/dbh/md-tools/internal/markdown/links"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+var (
+	flags  = cli.RegisterVersionFlags()
+	output = flag.String("o", "", "output `file` (default: standard output)")
+	defs   = flag.String("defs", "end", "where definitions go: end (of the combined document) or each (after their document)")
+)
+
+func main() {
+	flag.Parse()
+	if flags.PrintVersion("mdfncollect") {
+		return
+	}
+	if *defs != "end" && *defs != "each" {
+		fmt.Fprintf(os.Stderr, "mdfncollect: unknown -defs %q (want end or each)\n", *defs)
+		os.Exit(1)
+	}
+	if err := run(flag.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "mdfncollect: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("expected one or more files")
+	}
+	docs := make([]string, len(args))
+	for i, name := range args {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		docs[i] = string(data)
+	}
+	combined := collect(docs, *defs == "each")
+	if *output == "" {
+		_, err := io.WriteString(os.Stdout, combined)
+		return err
+	}
+	return os.WriteFile(*output, []byte(combined), 0644)
+}
+
+// md parses documents with footnotes, so that a footnote's indented
+// paragraphs aren't taken for code and its label for a link's.
+var md = goldmark.New(goldmark.WithExtensions(extension.Footnote))
+
+var (
+	// footnoteRefRe matches a footnote reference or a definition's label.
+	footnoteRefRe = regexp.MustCompile(`\[\^([^\]\s]+)\]`)
+	// footnoteDefRe matches the start of a footnote definition's line.
+	footnoteDefRe = regexp.MustCompile(`^ {0,3}\[\^([^\]\s]+)\]:`)
+	// blankLinesRe matches a run of blank lines.
+	blankLinesRe = regexp.MustCompile(`^(?:[ \t]*\n)+`)
+)
+
+// collector holds what the documents combined so far have defined.
+type collector struct {
+	nextNote int               // the number the next footnote gets
+	links    map[string]string // normalized label → its definition, for comparison
+	notes    []string          // footnote definitions not yet written
+	refs     []string          // link reference definitions not yet written
+}
+
+// collect returns docs combined into one document, with their definitions
+// at its end, or with each after its document.
+func collect(docs []string, each bool) string {
+	c := &collector{nextNote: 1, links: make(map[string]string)}
+	var parts []string
+	for i, doc := range docs {
+		body := c.add(doc, i == 0)
+		if each || i == len(docs)-1 {
+			body = c.flush(body)
+		}
+		if body != "" {
+			parts = append(parts, body)
+		}
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return strings.Join(parts, "\n\n") + "\n"
+}
+
+// flush returns body with the definitions collected since the last flush
+// appended.
+func (c *collector) flush(body string) string {
+	var sections []string
+	if body != "" {
+		sections = append(sections, body)
+	}
+	if len(c.notes) > 0 {
+		sections = append(sections, strings.Join(c.notes, "\n"))
+	}
+	if len(c.refs) > 0 {
+		sections = append(sections, strings.Join(c.refs, "\n"))
+	}
+	c.notes, c.refs = nil, nil
+	return strings.Join(sections, "\n\n")
+}
+
+// footnote is a footnote definition in a document.
+type footnote struct {
+	label string
+	rng   markdown.ByteRange // from its [^label] through its last line
+}
+
+// linkDef is a link reference definition in a document.
+type linkDef struct {
+	label string // as written
+	rest  string // after the colon, through its last line
+	rng   markdown.ByteRange
+}
+
+// replacement replaces the bytes of a document between start and end.
+type replacement struct {
+	start, end int
+	text       string
+}
+
+// add relabels the footnotes and links of doc, collects its definitions,
+// and returns the rest of it, without trailing newlines. Unless keepMeta,
+// its frontmatter is dropped.
+func (c *collector) add(doc string, keepMeta bool) string {
+	source := []byte(doc)
+	root := md.Parser().Parse(text.NewReader(source))
+
+	lines := strings.SplitAfter(doc, "\n")
+	metaEnd := 0
+	for _, line := range lines[:markdown.FrontmatterEnd(strings.Split(doc, "\n"))] {
+		metaEnd += len(line)
+	}
+	skip := codeRanges(root, source)
+	skip = append(skip, markdown.ByteRange{Start: 0, End: metaEnd})
+	literal := markdown.NewRangeSet(skip)
+
+	notes := findFootnotes(lines, literal)
+	links := findLinkDefs(root, source, metaEnd)
+
+	var cut []markdown.ByteRange
+	if !keepMeta {
+		cut = append(cut, markdown.ByteRange{Start: 0, End: metaEnd})
+	}
+	for _, n := range notes {
+		cut = append(cut, n.rng)
+	}
+	for _, l := range links {
+		cut = append(cut, l.rng)
+	}
+	definitions := markdown.NewRangeSet(cut)
+
+	repls, number := c.numberFootnotes(doc, notes, literal, definitions)
+	renamed := c.mergeLinks(links)
+	repls = append(repls, renameLinks(doc, renamed, literal, markdown.NewRangeSet(linkRanges(links)))...)
+	sort.Slice(repls, func(i, j int) bool { return repls[i].start < repls[j].start })
+
+	// The footnotes are written in the order of their numbers, without the
+	// link definitions inside them, which are collected with the others.
+	sort.SliceStable(notes, func(i, j int) bool { return number[notes[i].label] < number[notes[j].label] })
+	for _, n := range notes {
+		var inside []markdown.ByteRange
+		for _, l := range links {
+			if l.rng.Start >= n.rng.Start && l.rng.End <= n.rng.End {
+				inside = append(inside, l.rng)
+			}
+		}
+		note := rewrite(doc, n.rng.Start, n.rng.End, repls, markdown.NewRangeSet(inside))
+		c.notes = append(c.notes, strings.TrimRight(note, "\n"))
+	}
+
+	return strings.Trim(rewrite(doc, 0, len(doc), repls, definitions), "\n")
+}
+
+// codeRanges returns the byte ranges of the code blocks and spans of doc.
+func codeRanges(doc ast.Node, source []byte) []markdown.ByteRange {
+	ranges := markdown.CodeBlockRanges(doc, source)
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if span, ok := n.(*ast.CodeSpan); ok && entering {
+			for c := span.FirstChild(); c != nil; c = c.NextSibling() {
+				if t, ok := c.(*ast.Text); ok {
+					ranges = append(ranges, markdown.ByteRange{Start: t.Segment.Start, End: t.Segment.Stop})
+				}
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	return ranges
+}
+
+// findFootnotes returns the footnote definitions of a document's lines,
+// each running from its label through its indented paragraphs and the
+// unindented lines that continue its first.
+func findFootnotes(lines []string, literal markdown.RangeSet) []footnote {
+	var notes []footnote
+	pos := 0
+	for i := 0; i < len(lines); {
+		m := footnoteDefRe.FindStringSubmatchIndex(lines[i])
+		if m == nil || literal.Contains(pos) {
+			pos += len(lines[i])
+			i++
+			continue
+		}
+		n := footnote{label: lines[i][m[2]:m[3]]}
+		n.rng.Start = pos + strings.Index(lines[i], "[")
+		pos += len(lines[i])
+		paragraph := true // an unindented line continues the line before
+		for i++; i < len(lines); i++ {
+			line := strings.TrimRight(lines[i], "\n")
+			if strings.TrimSpace(line) == "" {
+				// Blank lines belong to the footnote if an indented line
+				// follows them.
+				j := i
+				for j < len(lines) && strings.TrimSpace(lines[j]) == "" {
+					j++
+				}
+				if j == len(lines) || !isIndented(lines[j]) {
+					break
+				}
+				paragraph = false
+			} else if isIndented(line) {
+				paragraph = true
+			} else if !paragraph || !markdown.IsFootnoteContinuation(line) {
+				break
+			}
+			pos += len(lines[i])
+		}
+		n.rng.End = pos
+		notes = append(notes, n)
+	}
+	return notes
+}
+
+func isIndented(line string) bool {
+	return strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t")
+}
+
+// numberFootnotes numbers the footnotes defined in doc, continuing from the
+// documents before it, and returns the replacements of their references
+// and labels, with the number each label gets. References are numbered in
+// order, those in the body before those in other footnotes, and then
+// footnotes that are never referenced. A reference to a label doc doesn't
+// define is left as it is.
+func (c *collector) numberFootnotes(doc string, notes []footnote, literal, definitions markdown.RangeSet) ([]replacement, map[string]int) {
+	defined := make(map[string]bool)
+	labelAt := make(map[int]bool) // the positions of definitions' labels
+	for _, n := range notes {
+		defined[n.label] = true
+		labelAt[n.rng.Start] = true
+	}
+	number := make(map[string]int)
+	assign := func(label string) {
+		if _, ok := number[label]; !ok && defined[label] {
+			number[label] = c.nextNote
+			c.nextNote++
+		}
+	}
+
+	var body, inNotes, all []replacement
+	for _, m := range footnoteRefRe.FindAllStringSubmatchIndex(doc, -1) {
+		if literal.Contains(m[0]) {
+			continue
+		}
+		r := replacement{start: m[0], end: m[1], text: doc[m[2]:m[3]]}
+		all = append(all, r)
+		switch {
+		case labelAt[m[0]]:
+		case definitions.Contains(m[0]):
+			inNotes = append(inNotes, r)
+		default:
+			body = append(body, r)
+		}
+	}
+	for _, r := range body {
+		assign(r.text)
+	}
+	for _, r := range inNotes {
+		assign(r.text)
+	}
+	for _, n := range notes {
+		assign(n.label)
+	}
+
+	var repls []replacement
+	for _, r := range all {
+		if num, ok := number[r.text]; ok {
+			repls = append(repls, replacement{r.start, r.end, "[^" + strconv.Itoa(num) + "]"})
+		}
+	}
+	return repls, number
+}
+
+// findLinkDefs returns the link reference definitions of doc after its
+// frontmatter, which ends at metaEnd. Those inside a block quote stay where
+// they are and aren't returned.
+func findLinkDefs(root ast.Node, source []byte, metaEnd int) []linkDef {
+	var defs []linkDef
+	for _, def := range links.CollectRefDefs(root, source) {
+		if def.Range.End == 0 || def.Range.Start < metaEnd {
+			continue
+		}
+		written := string(source[def.Range.Start:def.Range.End])
+		open := strings.Index(written, "[")
+		end := closingBracket(written, open)
+		if open < 0 || end < 0 || !strings.HasPrefix(written[end:], ":") {
+			continue
+		}
+		defs = append(defs, linkDef{
+			label: written[open+1 : end-1],
+			rest:  strings.TrimRight(written[end+1:], "\n"),
+			rng:   def.Range,
+		})
+	}
+	return defs
+}
+
+func linkRanges(links []linkDef) []markdown.ByteRange {
+	ranges := make([]markdown.ByteRange, len(links))
+	for i, l := range links {
+		ranges[i] = l.rng
+	}
+	return ranges
+}
+
+// mergeLinks collects the link reference definitions of a document that
+// the documents before it don't already have, and returns the labels it
+// renamed, from the normalized label to the new one. A label defined again
+// later in the same document is dropped, as Markdown ignores it.
+func (c *collector) mergeLinks(links []linkDef) map[string]string {
+	renamed := make(map[string]string)
+	seen := make(map[string]bool)
+	for _, l := range links {
+		key := normalize(l.label)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		def := strings.Join(strings.Fields(l.rest), " ")
+		label := l.label
+		for n := 2; ; n++ {
+			existing, taken := c.links[normalize(label)]
+			if !taken {
+				c.links[normalize(label)] = def
+				c.refs = append(c.refs, "["+label+"]:"+l.rest)
+				break
+			}
+			if existing == def {
+				break
+			}
+			label = l.label + "-" + strconv.Itoa(n)
+		}
+		if label != l.label {
+			renamed[key] = label
+		}
+	}
+	return renamed
+}
+
+// renameLinks returns the replacements that point the reference links and
+// images of doc whose labels were renamed at their new labels. A collapsed
+// [label][] or shortcut [label] becomes [label][new], keeping its text.
+func renameLinks(doc string, renamed map[string]string, literal, definitions markdown.RangeSet) []replacement {
+	if len(renamed) == 0 {
+		return nil
+	}
+	var repls []replacement
+	for i := 0; i < len(doc); i++ {
+		if doc[i] == '\\' {
+			i++
+			continue
+		}
+		if doc[i] != '[' || literal.Contains(i) || definitions.Contains(i) {
+			continue
+		}
+		end := closingBracket(doc, i)
+		if end < 0 {
+			continue
+		}
+		label := doc[i+1 : end-1]
+		next, ok := renamed[normalize(label)]
+		after := doc[end:]
+		switch {
+		case !ok || strings.HasPrefix(label, "^"):
+		case i > 0 && doc[i-1] == ']':
+			// The label of a full reference, [text][label].
+			repls = append(repls, replacement{i + 1, end - 1, next})
+		case strings.HasPrefix(after, "[]"):
+			repls = append(repls, replacement{end, end + 2, "[" + next + "]"})
+		case strings.HasPrefix(after, "["), strings.HasPrefix(after, "("), strings.HasPrefix(after, ":"):
+			// The text of a full reference or an inline link, or a
+			// definition in a block quote.
+		default:
+			repls = append(repls, replacement{end, end, "[" + next + "]"})
+		}
+	}
+	return repls
+}
+
+// closingBracket returns the index after the bracket that closes the one at
+// s[open], or -1 if it isn't closed before a blank line.
+func closingBracket(s string, open int) int {
+	if open < 0 {
+		return -1
+	}
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '[':
+			depth++
+		case ']':
+			if depth--; depth == 0 {
+				return i + 1
+			}
+		case '\n':
+			if blankLinesRe.MatchString(s[i+1:]) {
+				return -1
+			}
+		}
+	}
+	return -1
+}
+
+// normalize returns label as Markdown matches it: case-folded, with its
+// whitespace collapsed.
+func normalize(label string) string {
+	return string(util.ToLinkReference([]byte(label)))
+}
+
+// rewrite returns doc[start:end] with repls, which are sorted, made, and
+// the ranges in cut left out. The blank lines after a cut are left out too
+// when the text before it ends in one, so a removed definition doesn't
+// leave a gap.
+func rewrite(doc string, start, end int, repls []replacement, cut markdown.RangeSet) string {
+	var b strings.Builder
+	r := sort.Search(len(repls), func(i int) bool { return repls[i].start >= start })
+	c := 0
+	for pos := start; pos < end; {
+		for c < len(cut) && cut[c].End <= pos {
+			c++
+		}
+		if c < len(cut) && cut[c].Start <= pos {
+			pos = cut[c].End
+			if s := b.String(); pos < end && (s == "" || strings.HasSuffix(s, "\n\n")) {
+				pos += len(blankLinesRe.FindString(doc[pos:end]))
+			}
+			continue
+		}
+		for r < len(repls) && repls[r].start < pos {
+			r++
+		}
+		if r < len(repls) && repls[r].start == pos {
+			b.WriteString(repls[r].text)
+			pos = repls[r].end
+			r++
+			continue
+		}
+		next := end
+		if c < len(cut) && cut[c].Start < next {
+			next = cut[c].Start
+		}
+		if r < len(repls) && repls[r].start < next {
+			next = repls[r].start
+		}
+		b.WriteString(doc[pos:next])
+		pos = next
+	}
+	return b.String()
+}
@@ -0,0 +1,223 @@
+// mdgraph prints the link graph of a directory of Markdown files as DOT,
+// Mermaid, or JSON. Nodes are files (and optionally their headings); edges
+// are links between them.
+//
+// Usage:
+//
+//	mdgraph [dir]                   # DOT graph of dir (default .)
+//	mdgraph -format mermaid docs    # Mermaid flowchart
+//	mdgraph -format json -headings  # JSON, with heading nodes
+//
+// External links and links to missing files are left out; use mdorphans to
+// find the latter.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/corpus"
+	"github.com/dbh/md-tools/internal/markdown"
+)
+
+var (
+	flags    = cli.RegisterVersionFlags()
+	format   = flag.String("format", "dot", "output `format`: dot, mermaid, or json")
+	headings = flag.Bool("headings", false, "add a node per heading; links with a matching #fragment point to it")
+)
+
+// node is a file or heading in the graph.
+type node struct {
+	ID    string `json:"id"`
+	Type  string `json:"type"` // "file" or "heading"
+	Label string `json:"label"`
+	File  string `json:"file,omitempty"` // containing file, for headings
+}
+
+// edge is a link (or, with -headings, file-contains-heading) relationship.
+type edge struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Type  string `json:"type"`  // "link" or "contains"
+	Count int    `json:"count"` // number of links collapsed into this edge
+}
+
+type graph struct {
+	Nodes []node `json:"nodes"`
+	Edges []edge `json:"edges"`
+}
+
+func main() {
+	flag.Parse()
+	if flags.PrintVersion("mdgraph") {
+		return
+	}
+	if err := run(flag.Args(), os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "mdgraph: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, w io.Writer) error {
+	root := "."
+	switch len(args) {
+	case 0:
+	case 1:
+		root = args[0]
+	default:
+		return fmt.Errorf("expected at most one directory argument")
+	}
+
+	var write func(io.Writer, *graph) error
+	switch *format {
+	case "dot":
+		write = writeDOT
+	case "mermaid":
+		write = writeMermaid
+	case "json":
+		write = writeJSON
+	default:
+		return fmt.Errorf("unknown format %q (want dot, mermaid, or json)", *format)
+	}
+
+	g, err := build(root)
+	if err != nil {
+		return err
+	}
+	return write(w, g)
+}
+
+// build loads the corpus under root and assembles its link graph.
+func build(root string) (*graph, error) {
+	c, err := corpus.Load(root)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &graph{}
+	anchors := make(map[string]bool) // "file#slug" IDs of heading nodes
+	contents := make(map[string][]byte, len(c.Files))
+	for _, rel := range c.Files {
+		data, err := c.Read(rel)
+		if err != nil {
+			return nil, err
+		}
+		// The section mdbacklinks generates mirrors the links to a
+		// document, which the graph has already.
+		data = []byte(markdown.StripMarkedSection(string(data), "backlinks"))
+		contents[rel] = data
+		g.Nodes = append(g.Nodes, node{ID: rel, Type: "file", Label: corpus.Title(rel, data)})
+		if !*headings {
+			continue
+		}
+		for _, h := range corpus.Headings(data) {
+			id := rel + "#" + h.Slug
+			anchors[id] = true
+			g.Nodes = append(g.Nodes, node{ID: id, Type: "heading", Label: h.Text, File: rel})
+			g.Edges = append(g.Edges, edge{From: rel, To: id, Type: "contains", Count: 1})
+		}
+	}
+
+	counts := make(map[[2]string]int)
+	var order [][2]string
+	for _, rel := range c.Files {
+		for _, l := range c.Links(rel, contents[rel]) {
+			if l.Image || !c.Has(l.Target) {
+				continue
+			}
+			to := l.Target
+			if id := to + "#" + l.Fragment; l.Fragment != "" && anchors[id] {
+				to = id
+			}
+			if to == rel {
+				continue
+			}
+			key := [2]string{rel, to}
+			if counts[key] == 0 {
+				order = append(order, key)
+			}
+			counts[key]++
+		}
+	}
+	for _, key := range order {
+		g.Edges = append(g.Edges, edge{From: key[0], To: key[1], Type: "link", Count: counts[key]})
+	}
+	sort.SliceStable(g.Edges, func(i, j int) bool {
+		if g.Edges[i].From != g.Edges[j].From {
+			return g.Edges[i].From < g.Edges[j].From
+		}
+		return g.Edges[i].To < g.Edges[j].To
+	})
+	return g, nil
+}
+
+func writeDOT(w io.Writer, g *graph) error {
+	var b strings.Builder
+	b.WriteString("digraph links {\n")
+	for _, n := range g.Nodes {
+		shape := "box"
+		if n.Type == "heading" {
+			shape = "ellipse"
+		}
+		fmt.Fprintf(&b, "  %s [label=%s, shape=%s];\n", dotQuote(n.ID), dotQuote(n.Label), shape)
+	}
+	for _, e := range g.Edges {
+		if e.Type == "contains" {
+			fmt.Fprintf(&b, "  %s -> %s [style=dashed];\n", dotQuote(e.From), dotQuote(e.To))
+		} else {
+			fmt.Fprintf(&b, "  %s -> %s;\n", dotQuote(e.From), dotQuote(e.To))
+		}
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// dotQuote returns s as a double-quoted DOT ID.
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func writeMermaid(w io.Writer, g *graph) error {
+	// Mermaid IDs must be simple identifiers, so number the nodes and carry
+	// the file name or heading in the label.
+	ids := make(map[string]string, len(g.Nodes))
+	var b strings.Builder
+	b.WriteString("graph LR\n")
+	for i, n := range g.Nodes {
+		ids[n.ID] = fmt.Sprintf("n%d", i)
+		label := strings.ReplaceAll(n.Label, `"`, "#quot;")
+		if n.Type == "heading" {
+			fmt.Fprintf(&b, "  %s(\"%s\")\n", ids[n.ID], label)
+		} else {
+			fmt.Fprintf(&b, "  %s[\"%s\"]\n", ids[n.ID], label)
+		}
+	}
+	for _, e := range g.Edges {
+		arrow := "-->"
+		if e.Type == "contains" {
+			arrow = "-.->"
+		}
+		fmt.Fprintf(&b, "  %s %s %s\n", ids[e.From], arrow, ids[e.To])
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeJSON(w io.Writer, g *graph) error {
+	if g.Nodes == nil {
+		g.Nodes = []node{}
+	}
+	if g.Edges == nil {
+		g.Edges = []edge{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(g)
+}
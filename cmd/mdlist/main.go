@@ -0,0 +1,44 @@
+// mdlist normalizes list formatting: the bullet marker used by unordered
+// lists, ordered versus unordered items, and loose versus tight spacing.
+//
+// Usage:
+//
+//	mdlist [file...]
+//	cat file.md | mdlist
+//	mdlist -bullet '*' file.md        # use * for every bullet (default: keep)
+//	mdlist -type ordered file.md      # number every list item
+//	mdlist -type unordered file.md    # turn numbered items into bullets
+//	mdlist -spacing tight file.md     # remove blank lines between items
+//	mdlist -spacing loose file.md     # separate items with a blank line
+//	mdlist -w file.md                 # modify file in place
+//
+// Nesting and continuation content (paragraphs, code blocks) are kept with
+// their item; when a marker changes width, the item's content is re-indented
+// to stay aligned with it.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/tools/mdlist"
+)
+
+var (
+	flags = cli.RegisterFlags()
+	setup = mdlist.Flags(flag.CommandLine)
+)
+
+func main() {
+	flag.Parse()
+	transform, err := setup()
+	if err == nil {
+		err = cli.Run("mdlist", flags, flag.Args(), transform)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mdlist: %v\n", err)
+		os.Exit(1)
+	}
+}
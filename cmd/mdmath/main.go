@@ -0,0 +1,44 @@
+// mdmath converts math delimiters between $...$/$$...$$, \(...\)/\[...\],
+// and fenced math blocks, so one source can target KaTeX, MathJax, or
+// GitHub.
+//
+// Usage:
+//
+//	mdmath [file...]                 # $...$ inline, $$...$$ display
+//	cat file.md | mdmath
+//	mdmath -inline paren -display bracket file.md   # \(...\) and \[...\]
+//	mdmath -display fence file.md    # ```math blocks
+//	mdmath -inline backtick file.md  # $`...`$ (GitHub, GitLab)
+//	mdmath -w file.md                # modify file in place
+//
+// Every recognized form is converted to the chosen one; math already in that
+// form is left exactly as written. Display math inside a paragraph can't be
+// a fenced block and becomes $$...$$ instead. Code is never touched, and
+// \$ is a literal dollar sign.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/tools/mdmath"
+)
+
+var (
+	flags = cli.RegisterFlags()
+	setup = mdmath.Flags(flag.CommandLine)
+)
+
+func main() {
+	flag.Parse()
+	transform, err := setup()
+	if err == nil {
+		err = cli.Run("mdmath", flags, flag.Args(), transform)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mdmath: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,213 @@
+// mdnav maintains previous/next navigation links in every file of a
+// book-style documentation tree.
+//
+// Usage:
+//
+//	mdnav [dir]                      # files in directory order (default .)
+//	mdnav -order SUMMARY.md docs     # order taken from the links in a file
+//	mdnav -order chapters.txt docs   # or from a list of paths, one per line
+//	mdnav -position both docs        # links at the top and bottom
+//	mdnav -check docs                # list out-of-date files and exit 1
+//
+// Links are kept between <!-- nav --> markers at the bottom of each file and
+// <!-- nav-top --> markers at the top. Files that aren't in the order lose
+// their navigation. The directory order leaves out SUMMARY.md and the other
+// tables of contents mdsummary generates.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/corpus"
+	"github.com/dbh/md-tools/internal/markdown"
+)
+
+const (
+	markerBottom = "nav"
+	markerTop    = "nav-top"
+)
+
+var (
+	flags        = cli.RegisterVersionFlags()
+	check        = flag.Bool("check", false, "report files whose navigation is out of date and exit 1, without writing")
+	reportFormat = cli.RegisterOutputFlag()
+	order        = flag.String("order", "", "`file` listing the reading order: Markdown links (e.g. SUMMARY.md) or one path per line")
+	position     = flag.String("position", "bottom", "where the links go: top, bottom, or both")
+)
+
+// report collects the -check diagnostics for -output rdjson.
+var report = &cli.Report{Source: "mdnav"}
+
+func main() {
+	flag.Parse()
+	if flags.PrintVersion("mdnav") {
+		return
+	}
+	if err := cli.CheckOutput(*reportFormat); err != nil {
+		fmt.Fprintf(os.Stderr, "mdnav: %v\n", err)
+		os.Exit(1)
+	}
+	if *reportFormat == "rdjson" && !*check {
+		fmt.Fprintf(os.Stderr, "mdnav: -output rdjson requires -check\n")
+		os.Exit(1)
+	}
+	if *position != "top" && *position != "bottom" && *position != "both" {
+		fmt.Fprintf(os.Stderr, "mdnav: unknown -position %q (want top, bottom, or both)\n", *position)
+		os.Exit(1)
+	}
+	stale, err := run(flag.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mdnav: %v\n", err)
+		os.Exit(1)
+	}
+	if *reportFormat == "rdjson" {
+		if err := report.Write(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "mdnav: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *check && len(stale) > 0 {
+		if *reportFormat == "text" {
+			for _, rel := range stale {
+				fmt.Println(rel)
+			}
+		}
+		os.Exit(1)
+	}
+}
+
+func run(args []string) ([]string, error) {
+	root := "."
+	switch len(args) {
+	case 0:
+	case 1:
+		root = args[0]
+	default:
+		return nil, fmt.Errorf("expected at most one directory argument")
+	}
+
+	c, err := corpus.Load(root)
+	if err != nil {
+		return nil, err
+	}
+
+	contents := make(map[string][]byte, len(c.Files))
+	titles := make(map[string]string, len(c.Files))
+	for _, rel := range c.Files {
+		data, err := c.Read(rel)
+		if err != nil {
+			return nil, err
+		}
+		contents[rel] = data
+		titles[rel] = corpus.Title(rel, data)
+	}
+
+	var files []string
+	if *order != "" {
+		if files, err = readOrder(c, *order); err != nil {
+			return nil, err
+		}
+	} else {
+		// Tables of contents, such as the ones mdsummary generates, aren't
+		// pages to read through.
+		for _, rel := range corpus.BookOrder(c.Files) {
+			lines := strings.Split(string(contents[rel]), "\n")
+			if _, _, generated := markdown.FindMarkedSection(lines, "summary"); !corpus.IsSummary(rel) && !generated {
+				files = append(files, rel)
+			}
+		}
+	}
+
+	bodies := make(map[string][]string)
+	for i, rel := range files {
+		var parts []string
+		if i > 0 {
+			prev := files[i-1]
+			parts = append(parts, "← "+corpus.MarkdownLink(titles[prev], rel, prev))
+		}
+		if i < len(files)-1 {
+			next := files[i+1]
+			parts = append(parts, corpus.MarkdownLink(titles[next], rel, next)+" →")
+		}
+		if len(parts) > 0 {
+			bodies[rel] = []string{strings.Join(parts, " · ")}
+		}
+	}
+
+	var stale []string
+	for _, rel := range c.Files {
+		body := bodies[rel]
+		var top, bottom []string
+		if *position != "bottom" {
+			top = body
+		}
+		if *position != "top" {
+			bottom = body
+		}
+		content := markdown.ReplaceMarkedSectionTop(string(contents[rel]), markerTop, top)
+		content = markdown.ReplaceMarkedSection(content, markerBottom, bottom)
+		changed, err := c.Update(rel, contents[rel], content, *check)
+		if err != nil {
+			return nil, err
+		}
+		if changed && *check {
+			report.Change(c.Abs(rel), string(contents[rel]), content, "navigation is out of date")
+		}
+		if changed {
+			stale = append(stale, rel)
+		}
+	}
+	return stale, nil
+}
+
+// readOrder reads the reading order from file: the local link destinations of
+// a Markdown file, or one path per line ("#" starts a comment) otherwise.
+// Paths that aren't corpus files are skipped.
+func readOrder(c *corpus.Corpus, file string) ([]string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	if corpus.IsMarkdown(file) {
+		paths = corpus.Destinations(data)
+	} else {
+		for _, line := range strings.Split(string(data), "\n") {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+				paths = append(paths, line)
+			}
+		}
+	}
+
+	// Relative paths are relative to the order file when it is inside the
+	// tree, and to the root otherwise.
+	dir := ""
+	if absRoot, err := filepath.Abs(c.Root); err == nil {
+		if absFile, err := filepath.Abs(file); err == nil {
+			if d, err := filepath.Rel(absRoot, filepath.Dir(absFile)); err == nil && !strings.HasPrefix(d, "..") {
+				dir = filepath.ToSlash(d)
+			}
+		}
+	}
+
+	var files []string
+	seen := make(map[string]bool)
+	for _, p := range paths {
+		p, _, _ = strings.Cut(p, "#")
+		rel := path.Join(dir, p)
+		if strings.HasPrefix(p, "/") {
+			rel = path.Clean(p[1:])
+		}
+		if c.Has(rel) && !seen[rel] {
+			seen[rel] = true
+			files = append(files, rel)
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,151 @@
+// mdorphans reports orphaned documents (no inbound links from the rest of the
+// directory) and dangling links (local targets or #anchors that don't exist).
+//
+// Usage:
+//
+//	mdorphans [dir]              # report problems under dir (default .)
+//	mdorphans -dangling=false    # only report orphans
+//	mdorphans -roots index.md    # entry points that need no inbound links
+//
+// Exit status is 0 when nothing is reported, 1 when problems are found, and
+// 2 on error, so the tool can gate a docs repository in CI.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/corpus"
+	"github.com/dbh/md-tools/internal/markdown"
+)
+
+var (
+	flags        = cli.RegisterVersionFlags()
+	orphans      = flag.Bool("orphans", true, "report documents with no inbound links")
+	dangling     = flag.Bool("dangling", true, "report links to missing files or headings")
+	roots        = flag.String("roots", "README.md,index.md", "comma-separated file `names` treated as entry points, never orphans")
+	reportFormat = cli.RegisterOutputFlag()
+)
+
+func main() {
+	flag.Parse()
+	if flags.PrintVersion("mdorphans") {
+		return
+	}
+	if err := cli.CheckOutput(*reportFormat); err != nil {
+		fmt.Fprintf(os.Stderr, "mdorphans: %v\n", err)
+		os.Exit(2)
+	}
+	problems, err := run(flag.Args(), os.Stdout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mdorphans: %v\n", err)
+		os.Exit(2)
+	}
+	if problems > 0 {
+		os.Exit(1)
+	}
+}
+
+// problem is a reported orphan or dangling link.
+type problem struct {
+	rel     string
+	line    int // 0 for the whole file
+	message string
+}
+
+// run writes one line per problem to w, or an rdjson report with -output
+// rdjson, and returns the number of problems.
+func run(args []string, w io.Writer) (int, error) {
+	root := "."
+	switch len(args) {
+	case 0:
+	case 1:
+		root = args[0]
+	default:
+		return 0, fmt.Errorf("expected at most one directory argument")
+	}
+
+	c, err := corpus.Load(root)
+	if err != nil {
+		return 0, err
+	}
+
+	entry := make(map[string]bool)
+	for _, name := range strings.Split(*roots, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			entry[name] = true
+		}
+	}
+
+	links := make(map[string][]corpus.Link, len(c.Files))
+	anchors := make(map[string]map[string]bool, len(c.Files))
+	for _, rel := range c.Files {
+		data, err := c.Read(rel)
+		if err != nil {
+			return 0, err
+		}
+		// The links mdbacklinks generates only mirror the links to a
+		// document; they don't make it reachable.
+		body := markdown.StripMarkedSection(string(data), "backlinks")
+		links[rel] = c.Links(rel, []byte(body))
+		anchors[rel] = make(map[string]bool)
+		for _, h := range corpus.Headings(data) {
+			anchors[rel][h.Slug] = true
+		}
+	}
+
+	var problems []problem
+	inbound := make(map[string]bool)
+	for _, rel := range c.Files {
+		for _, l := range links[rel] {
+			if l.Target == "" {
+				continue // external
+			}
+			if l.Target != rel {
+				inbound[l.Target] = true
+			}
+			if !*dangling {
+				continue
+			}
+			switch {
+			case !c.Exists(l.Target):
+				problems = append(problems, problem{rel, l.Line, "dangling link to " + l.Dest})
+			case l.Fragment != "" && c.Has(l.Target) && !anchors[l.Target][l.Fragment]:
+				problems = append(problems, problem{rel, l.Line, "dangling link to " + l.Dest + " (no such heading)"})
+			}
+		}
+	}
+
+	if *orphans {
+		for _, rel := range c.Files {
+			if !inbound[rel] && !entry[path.Base(rel)] {
+				problems = append(problems, problem{rel, 0, "orphan (no inbound links)"})
+			}
+		}
+	}
+
+	if *reportFormat == "rdjson" {
+		report := &cli.Report{Source: "mdorphans"}
+		for _, p := range problems {
+			report.Problem(c.Abs(p.rel), p.line, p.message)
+		}
+		return len(problems), report.Write(w)
+	}
+	for _, p := range problems {
+		var err error
+		if p.line > 0 {
+			_, err = fmt.Fprintf(w, "%s:%d: %s\n", p.rel, p.line, p.message)
+		} else {
+			_, err = fmt.Fprintf(w, "%s: %s\n", p.rel, p.message)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(problems), nil
+}
@@ -0,0 +1,41 @@
+// mdpaste turns rich text copied from Google Docs, Word, or a web page into
+// tidy Markdown.
+//
+// Usage:
+//
+//	xclip -o -selection clipboard -t text/html | mdpaste
+//	wl-paste -t text/html | mdpaste -top 2    # headings start at level 2
+//	mdpaste -inline < clip.html               # keep links inline
+//	mdpaste -i notes.md < clip.html           # write the result to a file
+//
+// Bold, italic, and strikethrough set with inline styles become real
+// emphasis and every other style is dropped. Word's fake bullet paragraphs
+// become nested lists, heading levels are renumbered so they start at -top
+// and don't skip, and links become numbered references at the end.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/tools/mdpaste"
+)
+
+var (
+	flags = cli.RegisterFlags()
+	setup = mdpaste.Flags(flag.CommandLine)
+)
+
+func main() {
+	flag.Parse()
+	transform, err := setup()
+	if err == nil {
+		err = cli.Run("mdpaste", flags, flag.Args(), transform)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mdpaste: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,43 @@
+// mdreading annotates a document with its estimated reading time, as a
+// reading_time frontmatter field or as an inline badge.
+//
+// Usage:
+//
+//	mdreading [file...]
+//	cat file.md | mdreading
+//	mdreading -badge file.md       # badge under the title instead of frontmatter
+//	mdreading -sections 2 file.md  # also badge every level 2 section
+//	mdreading -wpm 250 file.md     # reading speed in words per minute
+//	mdreading -w file.md           # modify file in place
+//
+// Badges are single lines between <!-- reading-time --> markers, so running
+// the tool again replaces them. With -badge, a reading_time field already in
+// the frontmatter is updated too, but none is added. Code blocks, URLs, and
+// markup don't count as words.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/tools/mdreading"
+)
+
+var (
+	flags = cli.RegisterFlags()
+	setup = mdreading.Flags(flag.CommandLine)
+)
+
+func main() {
+	flag.Parse()
+	transform, err := setup()
+	if err == nil {
+		err = cli.Run("mdreading", flags, flag.Args(), transform)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mdreading: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,167 @@
+// mdrename moves a Markdown file and rewrites every relative link to it across
+// the directory tree, so reorganizing docs doesn't break navigation.
+//
+// Usage:
+//
+//	mdrename old.md new.md              # move and fix links under .
+//	mdrename -root docs a.md b/a.md     # links are searched under docs
+//	mdrename -n old.md new.md           # print the files that would change
+//
+// Links keep their #fragment and their style: root-absolute links stay
+// absolute, extensionless links stay extensionless, "./" links keep their
+// "./", and percent-encoded links stay encoded. Other links to a name with
+// a space are enclosed in angle brackets. The moved file's own
+// relative links are rewritten for its new location.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/corpus"
+)
+
+var (
+	flags  = cli.RegisterVersionFlags()
+	root   = flag.String("root", ".", "directory whose files are searched for links")
+	dryRun = flag.Bool("n", false, "print the files that would change without writing or moving anything")
+)
+
+func main() {
+	flag.Parse()
+	if flags.PrintVersion("mdrename") {
+		return
+	}
+	if err := run(flag.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "mdrename: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("expected two arguments: old.md new.md")
+	}
+	oldRel, err := corpusPath(args[0])
+	if err != nil {
+		return err
+	}
+	newRel, err := corpusPath(args[1])
+	if err != nil {
+		return err
+	}
+
+	c, err := corpus.Load(*root)
+	if err != nil {
+		return err
+	}
+	if !c.Has(oldRel) {
+		return fmt.Errorf("%s: not a Markdown file under %s", args[0], *root)
+	}
+	if _, err := os.Stat(c.Abs(newRel)); err == nil {
+		return fmt.Errorf("%s: already exists", args[1])
+	}
+
+	for _, rel := range c.Files {
+		data, err := c.Read(rel)
+		if err != nil {
+			return err
+		}
+		updated := rewriteLinks(c, rel, data, oldRel, newRel)
+		if updated == string(data) {
+			continue
+		}
+		if *dryRun {
+			fmt.Println(rel)
+			continue
+		}
+		if err := os.WriteFile(c.Abs(rel), []byte(updated), 0644); err != nil {
+			return fmt.Errorf("%s: %w", rel, err)
+		}
+	}
+
+	if *dryRun {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(c.Abs(newRel)), 0755); err != nil {
+		return err
+	}
+	return os.Rename(c.Abs(oldRel), c.Abs(newRel))
+}
+
+// corpusPath converts a command-line path to a slash path relative to -root.
+func corpusPath(p string) (string, error) {
+	absRoot, err := filepath.Abs(*root)
+	if err != nil {
+		return "", err
+	}
+	absPath, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(absRoot, absPath)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("%s: not under %s", p, *root)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// rewriteLinks returns the content of file rel with links to oldRel pointed at
+// newRel. When rel is the file being moved, its other relative links are
+// recomputed from newRel's directory.
+func rewriteLinks(c *corpus.Corpus, rel string, data []byte, oldRel, newRel string) string {
+	from := rel
+	if rel == oldRel {
+		from = newRel
+	}
+
+	return corpus.RewriteDests(string(data), func(dest string) string {
+		// External links and same-document #anchors never change; neither
+		// do root-absolute links, unless they point at the moved file.
+		target, _ := c.Resolve(rel, dest)
+		if target == "" || strings.HasPrefix(dest, "#") {
+			return dest
+		}
+		if strings.HasPrefix(dest, "/") && target != oldRel {
+			return dest
+		}
+		switch {
+		case target == oldRel:
+			return newDest(dest, from, newRel)
+		case rel == oldRel:
+			return newDest(dest, from, target)
+		}
+		return dest
+	})
+}
+
+// newDest returns the destination from file from to target, carrying over
+// the style of the original destination dest.
+func newDest(dest, from, target string) string {
+	var suffix string
+	if i := strings.IndexAny(dest, "?#"); i >= 0 {
+		dest, suffix = dest[:i], dest[i:]
+	}
+	var d string
+	if strings.HasPrefix(dest, "/") {
+		d = "/" + target
+	} else {
+		d = corpus.RelLink(from, target)
+	}
+	if path.Ext(dest) == "" {
+		d = strings.TrimSuffix(d, path.Ext(d))
+	}
+	if strings.HasPrefix(dest, "./") && !strings.HasPrefix(d, "../") {
+		d = "./" + d
+	}
+	if strings.Contains(dest, "%") {
+		d = (&url.URL{Path: d}).EscapedPath()
+	}
+	return d + suffix
+}
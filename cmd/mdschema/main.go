@@ -0,0 +1,129 @@
+// mdschema validates the frontmatter of every Markdown file in a directory
+// against a JSON Schema, reporting each missing or mistyped field with its
+// file, line, and key path.
+//
+// Usage:
+//
+//	mdschema -schema schema.json [dir]   # check files under dir (default .)
+//	mdschema -schema schema.json -output rdjson
+//
+// A file without frontmatter is checked as if it had no fields, so required
+// fields are reported for it. The schema's validation keywords are
+// supported, from type, enum, and required to allOf and if/then/else, along
+// with $ref to definitions in the same file.
+//
+// Exit status is 0 when every file is valid, 1 when problems are found, and
+// 2 on error, so the tool can gate a docs repository in CI.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/corpus"
+	"github.com/dbh/md-tools/internal/markdown"
+)
+
+var (
+	flags        = cli.RegisterVersionFlags()
+	schemaPath   = flag.String("schema", "", "JSON Schema `file` the frontmatter must match (required)")
+	reportFormat = cli.RegisterOutputFlag()
+)
+
+func main() {
+	flag.Parse()
+	if flags.PrintVersion("mdschema") {
+		return
+	}
+	if err := cli.CheckOutput(*reportFormat); err != nil {
+		fmt.Fprintf(os.Stderr, "mdschema: %v\n", err)
+		os.Exit(2)
+	}
+	problems, err := run(flag.Args(), os.Stdout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mdschema: %v\n", err)
+		os.Exit(2)
+	}
+	if problems > 0 {
+		os.Exit(1)
+	}
+}
+
+// problem is a field that doesn't match the schema, or frontmatter that
+// can't be parsed.
+type problem struct {
+	rel     string
+	line    int
+	message string
+}
+
+// run writes one line per problem to w, or an rdjson report with -output
+// rdjson, and returns the number of problems.
+func run(args []string, w io.Writer) (int, error) {
+	if *schemaPath == "" {
+		return 0, fmt.Errorf("-schema is required")
+	}
+	root := "."
+	switch len(args) {
+	case 0:
+	case 1:
+		root = args[0]
+	default:
+		return 0, fmt.Errorf("expected at most one directory argument")
+	}
+
+	s, err := loadSchema(*schemaPath)
+	if err != nil {
+		return 0, err
+	}
+	c, err := corpus.Load(root)
+	if err != nil {
+		return 0, err
+	}
+
+	var problems []problem
+	for _, rel := range c.Files {
+		data, err := c.Read(rel)
+		if err != nil {
+			return 0, err
+		}
+		fields, lineOf, err := markdown.ParseFrontmatter(strings.Split(string(data), "\n"))
+		var yamlErr *markdown.YAMLError
+		if errors.As(err, &yamlErr) {
+			problems = append(problems, problem{rel, yamlErr.Line, "invalid frontmatter: " + yamlErr.Msg})
+			continue
+		} else if err != nil {
+			return 0, err
+		}
+		var found []problem
+		for _, v := range s.validate(s.root, fields, "") {
+			message := v.message
+			if v.path != "" {
+				message = v.path + ": " + message
+			}
+			found = append(found, problem{rel, lineOf[v.path], message})
+		}
+		sort.SliceStable(found, func(i, j int) bool { return found[i].line < found[j].line })
+		problems = append(problems, found...)
+	}
+
+	if *reportFormat == "rdjson" {
+		report := &cli.Report{Source: "mdschema"}
+		for _, p := range problems {
+			report.Problem(c.Abs(p.rel), p.line, p.message)
+		}
+		return len(problems), report.Write(w)
+	}
+	for _, p := range problems {
+		if _, err := fmt.Fprintf(w, "%s:%d: %s\n", p.rel, p.line, p.message); err != nil {
+			return 0, err
+		}
+	}
+	return len(problems), nil
+}
@@ -0,0 +1,512 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/mail"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dbh/md-tools/internal/markdown"
+)
+
+// schema is a JSON Schema, as decoded from JSON, with its regular
+// expressions compiled. It implements the validation keywords of draft-07
+// through 2020-12 that apply to frontmatter, and $ref to definitions in the
+// same file.
+type schema struct {
+	root     any
+	patterns map[string]*regexp.Regexp
+}
+
+// violation is a way a value doesn't match a schema.
+type violation struct {
+	path    string // of the value, as markdown.FieldPath writes it
+	message string
+}
+
+// loadSchema reads the JSON Schema in the file p.
+func loadSchema(p string) (*schema, error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	var root any
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("%s: %v", p, err)
+	}
+	s := &schema{root: root, patterns: make(map[string]*regexp.Regexp)}
+	if err := s.compile(root); err != nil {
+		return nil, fmt.Errorf("%s: %v", p, err)
+	}
+	return s, nil
+}
+
+// compile checks the schema node v and those inside it, compiling their
+// patterns and checking that their references resolve.
+func (s *schema) compile(v any) error {
+	switch v := v.(type) {
+	case map[string]any:
+		if p, ok := v["pattern"].(string); ok {
+			if err := s.compilePattern(p); err != nil {
+				return err
+			}
+		}
+		if props, ok := v["patternProperties"].(map[string]any); ok {
+			for p := range props {
+				if err := s.compilePattern(p); err != nil {
+					return err
+				}
+			}
+		}
+		if ref, ok := v["$ref"].(string); ok {
+			if _, err := s.resolve(ref); err != nil {
+				return err
+			}
+		}
+		for _, child := range v {
+			if err := s.compile(child); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, child := range v {
+			if err := s.compile(child); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *schema) compilePattern(p string) error {
+	if _, ok := s.patterns[p]; ok {
+		return nil
+	}
+	re, err := regexp.Compile(p)
+	if err != nil {
+		return fmt.Errorf("pattern %q: %v", p, err)
+	}
+	s.patterns[p] = re
+	return nil
+}
+
+// resolve returns the schema a $ref names: a JSON pointer into this file,
+// such as "#/$defs/author".
+func (s *schema) resolve(ref string) (any, error) {
+	if ref != "#" && !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("$ref %q: only references within the schema are supported", ref)
+	}
+	v := s.root
+	for _, token := range strings.Split(ref, "/")[1:] {
+		token, err := url.PathUnescape(token)
+		if err != nil {
+			return nil, fmt.Errorf("$ref %q: %v", ref, err)
+		}
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		switch node := v.(type) {
+		case map[string]any:
+			v = node[token]
+		case []any:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(node) {
+				v = nil
+			} else {
+				v = node[i]
+			}
+		default:
+			v = nil
+		}
+		if v == nil {
+			return nil, fmt.Errorf("$ref %q doesn't resolve", ref)
+		}
+	}
+	return v, nil
+}
+
+// validate returns the ways v, the value at path, doesn't match the schema
+// node sch.
+func (s *schema) validate(sch, v any, path string) []violation {
+	switch sch := sch.(type) {
+	case bool:
+		if !sch {
+			return []violation{{path, "not allowed by the schema"}}
+		}
+		return nil
+	case map[string]any:
+		return s.validateObject(sch, v, path)
+	}
+	return nil
+}
+
+func (s *schema) validateObject(sch map[string]any, v any, path string) []violation {
+	var out []violation
+	fail := func(format string, args ...any) {
+		out = append(out, violation{path, fmt.Sprintf(format, args...)})
+	}
+
+	if ref, ok := sch["$ref"].(string); ok {
+		target, _ := s.resolve(ref) // checked by compile
+		out = append(out, s.validate(target, v, path)...)
+	}
+
+	if t, ok := sch["type"]; ok && !hasType(t, v) {
+		fail("expected %s, got %s", typeNames(t), jsonType(v))
+		return out
+	}
+	if enum, ok := sch["enum"].([]any); ok && !containsValue(enum, v) {
+		fail("must be one of %s", jsonList(enum))
+	}
+	if c, ok := sch["const"]; ok && !equalValues(c, v) {
+		fail("must be %s", jsonText(c))
+	}
+
+	switch v := v.(type) {
+	case string:
+		n := utf8.RuneCountInString(v)
+		if min, ok := number(sch["minLength"]); ok && float64(n) < min {
+			fail("must be at least %s characters long", formatNumber(min))
+		}
+		if max, ok := number(sch["maxLength"]); ok && float64(n) > max {
+			fail("must be at most %s characters long", formatNumber(max))
+		}
+		if p, ok := sch["pattern"].(string); ok && !s.patterns[p].MatchString(v) {
+			fail("must match %s", p)
+		}
+		if format, ok := sch["format"].(string); ok && !validFormat(format, v) {
+			fail("must be a valid %s", format)
+		}
+	case float64:
+		if min, ok := number(sch["minimum"]); ok && v < min {
+			fail("must be at least %s", formatNumber(min))
+		}
+		if max, ok := number(sch["maximum"]); ok && v > max {
+			fail("must be at most %s", formatNumber(max))
+		}
+		if min, ok := number(sch["exclusiveMinimum"]); ok && v <= min {
+			fail("must be greater than %s", formatNumber(min))
+		}
+		if max, ok := number(sch["exclusiveMaximum"]); ok && v >= max {
+			fail("must be less than %s", formatNumber(max))
+		}
+		if m, ok := number(sch["multipleOf"]); ok && m > 0 {
+			if q := v / m; math.Abs(q-math.Round(q)) > 1e-9 {
+				fail("must be a multiple of %s", formatNumber(m))
+			}
+		}
+	case []any:
+		out = append(out, s.validateArray(sch, v, path)...)
+	case map[string]any:
+		out = append(out, s.validateMapping(sch, v, path)...)
+	}
+
+	if all, ok := sch["allOf"].([]any); ok {
+		for _, sub := range all {
+			out = append(out, s.validate(sub, v, path)...)
+		}
+	}
+	if anyOf, ok := sch["anyOf"].([]any); ok && s.matching(anyOf, v, path) == 0 {
+		fail("must match at least one of the anyOf schemas")
+	}
+	if oneOf, ok := sch["oneOf"].([]any); ok {
+		if n := s.matching(oneOf, v, path); n != 1 {
+			fail("must match exactly one of the oneOf schemas, not %d", n)
+		}
+	}
+	if not, ok := sch["not"]; ok && len(s.validate(not, v, path)) == 0 {
+		fail("must not match the schema under not")
+	}
+	if cond, ok := sch["if"]; ok {
+		branch := "else"
+		if len(s.validate(cond, v, path)) == 0 {
+			branch = "then"
+		}
+		if sub, ok := sch[branch]; ok {
+			out = append(out, s.validate(sub, v, path)...)
+		}
+	}
+	return out
+}
+
+// matching returns how many of schemas v matches.
+func (s *schema) matching(schemas []any, v any, path string) int {
+	n := 0
+	for _, sub := range schemas {
+		if len(s.validate(sub, v, path)) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *schema) validateArray(sch map[string]any, v []any, path string) []violation {
+	var out []violation
+	fail := func(format string, args ...any) {
+		out = append(out, violation{path, fmt.Sprintf(format, args...)})
+	}
+	if min, ok := number(sch["minItems"]); ok && float64(len(v)) < min {
+		fail("must have at least %s items", formatNumber(min))
+	}
+	if max, ok := number(sch["maxItems"]); ok && float64(len(v)) > max {
+		fail("must have at most %s items", formatNumber(max))
+	}
+	if unique, _ := sch["uniqueItems"].(bool); unique {
+	dups:
+		for i := range v {
+			for j := 0; j < i; j++ {
+				if equalValues(v[i], v[j]) {
+					fail("items %d and %d are the same", j, i)
+					break dups
+				}
+			}
+		}
+	}
+
+	// prefixItems, or draft-07's array form of items, validates the first
+	// items; items (or additionalItems after an array) the rest.
+	prefix, _ := sch["prefixItems"].([]any)
+	rest, hasRest := sch["items"]
+	if tuple, ok := rest.([]any); ok {
+		prefix = tuple
+		rest, hasRest = sch["additionalItems"]
+	}
+	for i, item := range v {
+		switch {
+		case i < len(prefix):
+			out = append(out, s.validate(prefix[i], item, markdown.IndexPath(path, i))...)
+		case hasRest:
+			out = append(out, s.validate(rest, item, markdown.IndexPath(path, i))...)
+		}
+	}
+	if contains, ok := sch["contains"]; ok {
+		n := 0
+		for i, item := range v {
+			if len(s.validate(contains, item, markdown.IndexPath(path, i))) == 0 {
+				n++
+			}
+		}
+		min, ok := number(sch["minContains"])
+		if !ok {
+			min = 1
+		}
+		if float64(n) < min {
+			fail("must contain an item that matches the schema under contains")
+		}
+		if max, ok := number(sch["maxContains"]); ok && float64(n) > max {
+			fail("must contain at most %s items that match the schema under contains", formatNumber(max))
+		}
+	}
+	return out
+}
+
+func (s *schema) validateMapping(sch map[string]any, v map[string]any, path string) []violation {
+	var out []violation
+	fail := func(format string, args ...any) {
+		out = append(out, violation{path, fmt.Sprintf(format, args...)})
+	}
+	if min, ok := number(sch["minProperties"]); ok && float64(len(v)) < min {
+		fail("must have at least %s fields", formatNumber(min))
+	}
+	if max, ok := number(sch["maxProperties"]); ok && float64(len(v)) > max {
+		fail("must have at most %s fields", formatNumber(max))
+	}
+	if required, ok := sch["required"].([]any); ok {
+		for _, r := range required {
+			if name, ok := r.(string); ok {
+				if _, present := v[name]; !present {
+					fail("missing required field %q", name)
+				}
+			}
+		}
+	}
+	if deps, ok := sch["dependentRequired"].(map[string]any); ok {
+		for _, key := range sortedKeys(deps) {
+			if _, present := v[key]; !present {
+				continue
+			}
+			list, _ := deps[key].([]any)
+			for _, r := range list {
+				if name, ok := r.(string); ok {
+					if _, present := v[name]; !present {
+						fail("missing field %q, required with %q", name, key)
+					}
+				}
+			}
+		}
+	}
+
+	props, _ := sch["properties"].(map[string]any)
+	patternProps, _ := sch["patternProperties"].(map[string]any)
+	additional, hasAdditional := sch["additionalProperties"]
+	names, hasNames := sch["propertyNames"]
+	for _, key := range sortedKeys(v) {
+		child := markdown.FieldPath(path, key)
+		if hasNames && len(s.validate(names, key, child)) > 0 {
+			out = append(out, violation{child, "field name not allowed by propertyNames"})
+		}
+		matched := false
+		if sub, ok := props[key]; ok {
+			matched = true
+			out = append(out, s.validate(sub, v[key], child)...)
+		}
+		for _, p := range sortedKeys(patternProps) {
+			if s.patterns[p].MatchString(key) {
+				matched = true
+				out = append(out, s.validate(patternProps[p], v[key], child)...)
+			}
+		}
+		if !matched && hasAdditional {
+			if allowed, ok := additional.(bool); ok && !allowed {
+				out = append(out, violation{child, "unknown field"})
+			} else {
+				out = append(out, s.validate(additional, v[key], child)...)
+			}
+		}
+	}
+	return out
+}
+
+// hasType reports whether v is of the JSON Schema type, or one of the
+// types, t. An integer is a number without a fraction.
+func hasType(t, v any) bool {
+	if list, ok := t.([]any); ok {
+		for _, item := range list {
+			if hasType(item, v) {
+				return true
+			}
+		}
+		return false
+	}
+	name, _ := t.(string)
+	actual := jsonType(v)
+	return name == actual || name == "number" && actual == "integer"
+}
+
+// jsonType returns the JSON Schema type of v.
+func jsonType(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) && !math.IsInf(v, 0) {
+			return "integer"
+		}
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// typeNames lists the type or types t for a message: "string or array".
+func typeNames(t any) string {
+	list, ok := t.([]any)
+	if !ok {
+		return fmt.Sprint(t)
+	}
+	names := make([]string, len(list))
+	for i, item := range list {
+		names[i] = fmt.Sprint(item)
+	}
+	if len(names) > 1 {
+		return strings.Join(names[:len(names)-1], ", ") + " or " + names[len(names)-1]
+	}
+	return strings.Join(names, "")
+}
+
+// validFormat reports whether s is in the format, of those it knows;
+// others are annotations, and anything passes.
+func validFormat(format, s string) bool {
+	switch format {
+	case "date":
+		_, err := time.Parse("2006-01-02", s)
+		return err == nil
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, s)
+		return err == nil
+	case "time":
+		_, err := time.Parse("15:04:05Z07:00", s)
+		return err == nil
+	case "email":
+		a, err := mail.ParseAddress(s)
+		return err == nil && a.Address == s
+	case "uri":
+		u, err := url.Parse(s)
+		return err == nil && u.Scheme != ""
+	case "uri-reference":
+		_, err := url.Parse(s)
+		return err == nil
+	case "regex":
+		_, err := regexp.Compile(s)
+		return err == nil
+	}
+	return true
+}
+
+// number returns v as a number, if it is one.
+func number(v any) (float64, bool) {
+	f, ok := v.(float64)
+	return f, ok
+}
+
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// equalValues reports whether a and b are the same JSON value.
+func equalValues(a, b any) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+func containsValue(list []any, v any) bool {
+	for _, item := range list {
+		if equalValues(item, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonText writes v as JSON for a message.
+func jsonText(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+// jsonList lists values for a message: "draft", "published", or "archived".
+func jsonList(values []any) string {
+	items := make([]string, len(values))
+	for i, v := range values {
+		items[i] = jsonText(v)
+	}
+	if len(items) > 2 {
+		return strings.Join(items[:len(items)-1], ", ") + ", or " + items[len(items)-1]
+	}
+	return strings.Join(items, " or ")
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
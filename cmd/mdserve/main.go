@@ -0,0 +1,321 @@
+// mdserve previews Markdown files as HTML in the browser, reloading the page
+// whenever a file changes.
+//
+// Usage:
+//
+//	mdserve [dir]                          # serve dir (default .) on localhost:8000
+//	mdserve notes/essay.md                 # open on one file
+//	mdserve -pipe mdsidenote docs          # filter each page through md-tools first
+//	mdserve -template plain docs           # plain page instead of Tufte CSS
+//	mdserve -template page.html docs       # custom html/template file
+//	mdserve -addr :8080 docs
+//
+// A request for a .md file, or a directory with an index.md or README.md,
+// is rendered as GitHub Flavored Markdown with footnotes; anything else is
+// served as is. -pipe is a shell command every page is passed through before
+// rendering, such as "mdsidenote" for Tufte sidenotes or "mdfnt | mdsidenote".
+//
+// A custom template is executed with .Title, .Body (the rendered HTML), and
+// .Reload (the live-reload script, to put before </body>).
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/corpus"
+	"github.com/dbh/md-tools/internal/markdown"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer/html"
+)
+
+var (
+	flags    = cli.RegisterVersionFlags()
+	addr     = flag.String("addr", "localhost:8000", "`address` to listen on")
+	pipe     = flag.String("pipe", "", "shell `command` to filter each page through before rendering")
+	tmplName = flag.String("template", "tufte", "page `template`: tufte, plain, or the path of an html/template file")
+)
+
+// eventsPath is where pages listen for reloads.
+const eventsPath = "/_mdserve/events"
+
+const reloadScript = `<script>new EventSource("` + eventsPath + `").onmessage = () => location.reload();</script>`
+
+// templates are the built-in page templates.
+var templates = map[string]string{
+	"tufte": `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<link rel="stylesheet" href="https://cdnjs.cloudflare.com/ajax/libs/tufte-css/1.8.0/tufte.min.css">
+</head>
+<body>
+<article>
+<section>
+{{.Body}}
+</section>
+</article>
+{{.Reload}}
+</body>
+</html>
+`,
+	"plain": `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>body { max-width: 42em; margin: 2em auto; padding: 0 1em; font-family: sans-serif; line-height: 1.5; }</style>
+</head>
+<body>
+{{.Body}}
+{{.Reload}}
+</body>
+</html>
+`,
+}
+
+// page is the data a template is executed with.
+type page struct {
+	Title  string
+	Body   template.HTML
+	Reload template.HTML
+}
+
+func main() {
+	flag.Parse()
+	if flags.PrintVersion("mdserve") {
+		return
+	}
+	if err := run(flag.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "mdserve: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	target := "."
+	switch len(args) {
+	case 0:
+	case 1:
+		target = args[0]
+	default:
+		return fmt.Errorf("expected at most one file or directory argument")
+	}
+
+	root, start := target, "/"
+	info, err := os.Stat(target)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		root = filepath.Dir(target)
+		start = "/" + filepath.Base(target)
+	}
+
+	tmpl, err := loadTemplate(*tmplName)
+	if err != nil {
+		return err
+	}
+
+	s := &server{root: root, tmpl: tmpl, md: goldmark.New(
+		goldmark.WithExtensions(extension.GFM, extension.Footnote),
+		goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+		goldmark.WithRendererOptions(html.WithUnsafe()),
+	)}
+	go s.watch(300 * time.Millisecond)
+
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "mdserve: serving %s at http://%s%s\n", root, ln.Addr(), start)
+	return http.Serve(ln, s)
+}
+
+// loadTemplate returns the named built-in template, or parses the file at
+// name.
+func loadTemplate(name string) (*template.Template, error) {
+	if text, ok := templates[name]; ok {
+		return template.New(name).Parse(text)
+	}
+	if _, err := os.Stat(name); err != nil {
+		return nil, fmt.Errorf("unknown -template %q (want tufte, plain, or a file)", name)
+	}
+	return template.ParseFiles(name)
+}
+
+// server renders Markdown under root and tells open pages when it changes.
+type server struct {
+	root string
+	tmpl *template.Template
+	md   goldmark.Markdown
+
+	mu      sync.Mutex
+	clients map[chan struct{}]bool
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == eventsPath {
+		s.events(w, r)
+		return
+	}
+	rel := path.Clean("/" + r.URL.Path)[1:]
+	name := filepath.Join(s.root, filepath.FromSlash(rel))
+	if info, err := os.Stat(name); err == nil && info.IsDir() {
+		for _, index := range []string{"index.md", "README.md"} {
+			if _, err := os.Stat(filepath.Join(name, index)); err == nil {
+				rel, name = path.Join(rel, index), filepath.Join(name, index)
+				break
+			}
+		}
+	}
+	if !corpus.IsMarkdown(name) {
+		http.FileServer(http.Dir(s.root)).ServeHTTP(w, r)
+		return
+	}
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	body, err := s.render(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var out bytes.Buffer
+	err = s.tmpl.Execute(&out, page{
+		Title:  corpus.Title(rel, data),
+		Body:   template.HTML(body),
+		Reload: template.HTML(reloadScript),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(out.Bytes())
+}
+
+// render filters data through -pipe and renders it without its frontmatter.
+func (s *server) render(data []byte) ([]byte, error) {
+	if *pipe != "" {
+		cmd := exec.Command("sh", "-c", *pipe)
+		cmd.Stdin = bytes.NewReader(data)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("-pipe %q: %v\n%s", *pipe, err, stderr.Bytes())
+		}
+		data = out
+	}
+	lines := strings.Split(string(data), "\n")
+	body := strings.Join(lines[markdown.FrontmatterEnd(lines):], "\n")
+
+	var out bytes.Buffer
+	if err := s.md.Convert([]byte(body), &out); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// events streams a message to the page each time a file changes.
+func (s *server) events(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	changed := make(chan struct{}, 1)
+	s.mu.Lock()
+	if s.clients == nil {
+		s.clients = make(map[chan struct{}]bool)
+	}
+	s.clients[changed] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, changed)
+		s.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher.Flush()
+	for {
+		select {
+		case <-changed:
+			fmt.Fprint(w, "data: reload\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// watch polls the tree under root every interval and notifies the open
+// pages when a file is added, removed, or modified.
+func (s *server) watch(interval time.Duration) {
+	last := s.snapshot()
+	for range time.Tick(interval) {
+		current := s.snapshot()
+		if current == last {
+			continue
+		}
+		last = current
+		s.mu.Lock()
+		for c := range s.clients {
+			select {
+			case c <- struct{}{}:
+			default:
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// snapshot summarizes the files under root: their number and latest
+// modification time.
+func (s *server) snapshot() string {
+	var n int
+	var latest time.Time
+	filepath.WalkDir(s.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if p != s.root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			n++
+			if info.ModTime().After(latest) {
+				latest = info.ModTime()
+			}
+		}
+		return nil
+	})
+	return fmt.Sprintf("%d %d", n, latest.UnixNano())
+}
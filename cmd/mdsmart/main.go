@@ -0,0 +1,45 @@
+// mdsmart replaces straight quotes with typographic ones in the style of a
+// locale, apostrophes with ’, -- and --- with en and em dashes, and ... with
+// an ellipsis.
+//
+// Usage:
+//
+//	mdsmart [file...]
+//	cat file.md | mdsmart
+//	mdsmart -locale de file.md    # „German“ and ‚inner‘ quotes
+//	mdsmart -locale fr file.md    # « French » with narrow no-break spaces
+//	mdsmart -w file.md            # modify file in place
+//
+// Quotation marks already written in another style, curly or guillemets,
+// are rewritten too, so translated documents can be brought into line with
+// one command. With -locale fr, the spaces inside guillemets and before
+// ; : ! and ? become narrow no-break spaces; other locales drop no-break
+// spaces there. Code, math, HTML, link destinations, and frontmatter are
+// never touched, and -- before a word, like a --flag, is left alone.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/tools/mdsmart"
+)
+
+var (
+	flags = cli.RegisterFlags()
+	setup = mdsmart.Flags(flag.CommandLine)
+)
+
+func main() {
+	flag.Parse()
+	transform, err := setup()
+	if err == nil {
+		err = cli.Run("mdsmart", flags, flag.Args(), transform)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mdsmart: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,290 @@
+// mdstats exports metrics for every Markdown file in a directory, and with
+// -sections for each section of them, as CSV or JSON for documentation
+// dashboards.
+//
+// Usage:
+//
+//	mdstats [dir]                  # CSV, a row per file (default .)
+//	mdstats -sections docs         # and a row per section after each file
+//	mdstats -format json docs      # JSON, sections nested in their files
+//	mdstats -mtime docs            # modification times instead of git
+//
+// Each file and section has its word count, its links (and how many of
+// them are external), images, footnote references, and footnotes per
+// thousand words. A section runs from its heading to the next heading of
+// any level; the text before the first heading only counts toward the file.
+// Words are counted in prose, headings, tables, and link text, but not in
+// code, HTML, or frontmatter.
+//
+// A file's last_modified is the last commit that touched it, or its
+// modification time outside git and for uncommitted files.
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/corpus"
+	"github.com/dbh/md-tools/internal/markdown"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	extast "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+var (
+	flags    = cli.RegisterVersionFlags()
+	format   = flag.String("format", "csv", "output `format`: csv or json")
+	sections = flag.Bool("sections", false, "add the metrics of each section")
+	mtime    = flag.Bool("mtime", false, "use file modification times instead of git history")
+)
+
+// md parses with the footnote extension, whose references are counted, and
+// GFM, whose bare URLs are links.
+var md = goldmark.New(goldmark.WithExtensions(extension.GFM, extension.Footnote))
+
+// metrics are the counts for a file or section.
+type metrics struct {
+	Words           int     `json:"words"`
+	Links           int     `json:"links"`
+	ExternalLinks   int     `json:"external_links"`
+	Images          int     `json:"images"`
+	Footnotes       int     `json:"footnotes"`
+	FootnoteDensity float64 `json:"footnote_density"` // per 1,000 words
+}
+
+// section is a section of a file.
+type section struct {
+	Heading string `json:"heading"`
+	Anchor  string `json:"anchor"`
+	Level   int    `json:"level"`
+	Line    int    `json:"line"`
+	metrics
+}
+
+// file is a file's metrics.
+type file struct {
+	File         string    `json:"file"`
+	LastModified time.Time `json:"last_modified"`
+	metrics
+	Sections []section `json:"sections,omitempty"`
+}
+
+func main() {
+	flag.Parse()
+	if flags.PrintVersion("mdstats") {
+		return
+	}
+	if *format != "csv" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "mdstats: unknown -format %q (want csv or json)\n", *format)
+		os.Exit(1)
+	}
+	if err := run(flag.Args(), os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "mdstats: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, w io.Writer) error {
+	root := "."
+	switch len(args) {
+	case 0:
+	case 1:
+		root = args[0]
+	default:
+		return fmt.Errorf("expected at most one directory argument")
+	}
+
+	c, err := corpus.Load(root)
+	if err != nil {
+		return err
+	}
+	var commits map[string]corpus.History
+	if !*mtime {
+		commits = corpus.GitHistory(root)
+	}
+
+	files := []file{}
+	for _, rel := range c.Files {
+		data, err := c.Read(rel)
+		if err != nil {
+			return err
+		}
+		f := measure(string(data))
+		f.File = rel
+		if h, ok := commits[rel]; ok {
+			f.LastModified = h.Modified
+		} else {
+			info, err := os.Stat(c.Abs(rel))
+			if err != nil {
+				return err
+			}
+			f.LastModified = info.ModTime().Truncate(time.Second)
+		}
+		if !*sections {
+			f.Sections = nil
+		}
+		files = append(files, f)
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(files)
+	}
+	return writeCSV(w, files)
+}
+
+// measure counts the metrics of content and of each of its sections.
+func measure(content string) file {
+	// Blank the frontmatter, keeping its lines so that line numbers hold.
+	lines := strings.Split(content, "\n")
+	for i := range lines[:markdown.FrontmatterEnd(lines)] {
+		lines[i] = ""
+	}
+	source := []byte(strings.Join(lines, "\n"))
+
+	var f file
+	for _, h := range corpus.Headings(source) {
+		f.Sections = append(f.Sections, section{Heading: h.Text, Anchor: h.Slug, Level: h.Level, Line: h.Line})
+	}
+	lineStarts := []int{0}
+	for i, b := range source {
+		if b == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+	// at returns the metrics of the section holding source position pos, and
+	// those of the file.
+	at := func(pos int) []*metrics {
+		line := sort.Search(len(lineStarts), func(i int) bool { return lineStarts[i] > pos })
+		i := sort.Search(len(f.Sections), func(i int) bool { return f.Sections[i].Line > line }) - 1
+		if i < 0 {
+			return []*metrics{&f.metrics}
+		}
+		return []*metrics{&f.metrics, &f.Sections[i].metrics}
+	}
+	count := func(pos int, add func(m *metrics)) {
+		for _, m := range at(pos) {
+			add(m)
+		}
+	}
+
+	doc := md.Parser().Parse(text.NewReader(source))
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.CodeBlock, *ast.FencedCodeBlock, *ast.HTMLBlock, *ast.CodeSpan, *ast.RawHTML:
+			return ast.WalkSkipChildren, nil
+		case *ast.Text:
+			words := countWords(string(n.Segment.Value(source)))
+			count(n.Segment.Start, func(m *metrics) { m.Words += words })
+		case *ast.Link:
+			external := isExternal(string(n.Destination))
+			count(inlineStart(n), func(m *metrics) { m.addLink(external) })
+		case *ast.AutoLink:
+			external := n.AutoLinkType == ast.AutoLinkURL && isExternal(string(n.URL(source)))
+			count(inlineStart(n), func(m *metrics) { m.addLink(external) })
+			return ast.WalkSkipChildren, nil
+		case *ast.Image:
+			count(inlineStart(n), func(m *metrics) { m.Images++ })
+			return ast.WalkSkipChildren, nil
+		case *extast.FootnoteLink:
+			count(inlineStart(n), func(m *metrics) { m.Footnotes++ })
+		}
+		return ast.WalkContinue, nil
+	})
+
+	f.density()
+	for i := range f.Sections {
+		f.Sections[i].density()
+	}
+	return f
+}
+
+// addLink counts a link.
+func (m *metrics) addLink(external bool) {
+	m.Links++
+	if external {
+		m.ExternalLinks++
+	}
+}
+
+// density sets the footnote density from the counts, rounded to two places.
+func (m *metrics) density() {
+	if m.Words > 0 {
+		m.FootnoteDensity = math.Round(float64(m.Footnotes)*1000/float64(m.Words)*100) / 100
+	}
+}
+
+// inlineStart returns a source position in the block holding the inline
+// n, which is enough to place it in a section: sections change at headings.
+func inlineStart(n ast.Node) int {
+	for b := n.Parent(); b != nil; b = b.Parent() {
+		if lines := b.Lines(); b.Type() == ast.TypeBlock && lines != nil && lines.Len() > 0 {
+			return lines.At(0).Start
+		}
+	}
+	return 0
+}
+
+// countWords counts the words in s: the runs of non-space characters with a
+// letter or digit in them, so that markup such as "-" isn't a word.
+func countWords(s string) int {
+	n := 0
+	for _, field := range strings.Fields(s) {
+		if strings.IndexFunc(field, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) >= 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// isExternal reports whether a link destination leaves the site: whether it
+// has a scheme or a host.
+func isExternal(dest string) bool {
+	u, err := url.Parse(dest)
+	return err == nil && (u.Scheme != "" || u.Host != "")
+}
+
+// writeCSV writes a row per file, each followed by its sections' rows. A
+// file's row has no section, anchor, level, or line.
+func writeCSV(w io.Writer, files []file) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"file", "section", "anchor", "level", "line", "words", "links", "external_links", "images", "footnotes", "footnote_density", "last_modified"})
+	row := func(f file, s section, m metrics) {
+		level, line := "", ""
+		if s.Level > 0 {
+			level, line = strconv.Itoa(s.Level), strconv.Itoa(s.Line)
+		}
+		cw.Write([]string{
+			f.File, s.Heading, s.Anchor, level, line,
+			strconv.Itoa(m.Words), strconv.Itoa(m.Links), strconv.Itoa(m.ExternalLinks), strconv.Itoa(m.Images),
+			strconv.Itoa(m.Footnotes), strconv.FormatFloat(m.FootnoteDensity, 'f', -1, 64),
+			f.LastModified.Format(time.RFC3339),
+		})
+	}
+	for _, f := range files {
+		row(f, section{}, f.metrics)
+		for _, s := range f.Sections {
+			row(f, s, s.metrics)
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,308 @@
+// mdsummary generates a table of contents for a documentation tree from its
+// directory structure and the first "# " heading of each file: an mdBook
+// SUMMARY.md, a MkDocs nav, or a list in a plain index.md.
+//
+// Usage:
+//
+//	mdsummary [dir]                      # write dir/SUMMARY.md (default .)
+//	mdsummary -format index docs         # list in docs/index.md
+//	mdsummary -format mkdocs docs        # nav: in ./mkdocs.yml
+//	mdsummary -o book/SUMMARY.md docs    # choose the output file
+//	mdsummary -check docs                # report a stale output and exit 1
+//
+// In Markdown output the list lives between <!-- summary --> markers, so the
+// rest of the file is yours to edit. In mkdocs.yml only the top-level nav key
+// is replaced.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/corpus"
+	"github.com/dbh/md-tools/internal/markdown"
+)
+
+const marker = "summary"
+
+var (
+	flags        = cli.RegisterVersionFlags()
+	check        = flag.Bool("check", false, "report the output file if it is out of date and exit 1, without writing")
+	reportFormat = cli.RegisterOutputFlag()
+	format       = flag.String("format", "mdbook", "output `format`: mdbook, mkdocs, or index")
+	output       = flag.String("o", "", "output `file` (default: SUMMARY.md or index.md in dir, or ./mkdocs.yml)")
+)
+
+// report collects the -check diagnostics for -output rdjson.
+var report = &cli.Report{Source: "mdsummary"}
+
+func main() {
+	flag.Parse()
+	if flags.PrintVersion("mdsummary") {
+		return
+	}
+	if err := cli.CheckOutput(*reportFormat); err != nil {
+		fmt.Fprintf(os.Stderr, "mdsummary: %v\n", err)
+		os.Exit(1)
+	}
+	if *reportFormat == "rdjson" && !*check {
+		fmt.Fprintf(os.Stderr, "mdsummary: -output rdjson requires -check\n")
+		os.Exit(1)
+	}
+	stale, err := run(flag.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mdsummary: %v\n", err)
+		os.Exit(1)
+	}
+	if *reportFormat == "rdjson" {
+		if err := report.Write(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "mdsummary: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *check && stale != "" {
+		if *reportFormat == "text" {
+			fmt.Println(stale)
+		}
+		os.Exit(1)
+	}
+}
+
+// entry is a file or directory in the table of contents.
+type entry struct {
+	title    string
+	rel      string // file, or the directory's index file; "" for none
+	children []*entry
+}
+
+func run(args []string) (string, error) {
+	root := "."
+	switch len(args) {
+	case 0:
+	case 1:
+		root = args[0]
+	default:
+		return "", fmt.Errorf("expected at most one directory argument")
+	}
+
+	out := *output
+	switch *format {
+	case "mdbook":
+		if out == "" {
+			out = filepath.Join(root, "SUMMARY.md")
+		}
+	case "index":
+		if out == "" {
+			out = filepath.Join(root, "index.md")
+		}
+	case "mkdocs":
+		if out == "" {
+			out = "mkdocs.yml"
+		}
+	default:
+		return "", fmt.Errorf("unknown -format %q (want mdbook, mkdocs, or index)", *format)
+	}
+
+	c, err := corpus.Load(root)
+	if err != nil {
+		return "", err
+	}
+	// The output file doesn't list itself, in any format, nor does it list
+	// a SUMMARY.md.
+	self := ""
+	if rel, err := relTo(root, out); err == nil {
+		self = rel
+	}
+	tree, err := buildTree(c, self)
+	if err != nil {
+		return "", err
+	}
+
+	old, err := os.ReadFile(out)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	var content string
+	if *format == "mkdocs" {
+		content = replaceNav(string(old), mkdocsNav(tree))
+	} else {
+		link := func(rel string) string {
+			target := filepath.Join(root, filepath.FromSlash(rel))
+			if l, err := filepath.Rel(filepath.Dir(out), target); err == nil {
+				return filepath.ToSlash(l)
+			}
+			return rel
+		}
+		body := markdownList(tree, 0, link)
+		if old == nil {
+			heading := "# Summary"
+			if *format == "index" {
+				heading = "# Contents"
+			}
+			old = []byte(heading + "\n")
+		}
+		content = markdown.ReplaceMarkedSection(string(old), marker, body)
+	}
+
+	if content == string(old) {
+		return "", nil
+	}
+	if *check {
+		report.Change(out, string(old), content, "table of contents is out of date")
+		return out, nil
+	}
+	return out, os.WriteFile(out, []byte(content), 0644)
+}
+
+// relTo returns p as a slash path relative to root, or an error if it isn't
+// under root.
+func relTo(root, p string) (string, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	absPath, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(absRoot, absPath)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("%s is not under %s", p, root)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// buildTree arranges the corpus files, except skip and SUMMARY.md, into
+// entries in book order. A directory's index.md or README.md becomes the directory entry.
+func buildTree(c *corpus.Corpus, skip string) (*entry, error) {
+	top := &entry{}
+	dirs := map[string]*entry{"": top}
+	var dirOf func(dir string) *entry
+	dirOf = func(dir string) *entry {
+		if e, ok := dirs[dir]; ok {
+			return e
+		}
+		parent := dirOf(parentDir(dir))
+		e := &entry{title: path.Base(dir)}
+		parent.children = append(parent.children, e)
+		dirs[dir] = e
+		return e
+	}
+
+	for _, rel := range corpus.BookOrder(c.Files) {
+		if rel == skip || corpus.IsSummary(rel) {
+			continue
+		}
+		data, err := c.Read(rel)
+		if err != nil {
+			return nil, err
+		}
+		dir, base := path.Split(rel)
+		dir = strings.TrimSuffix(dir, "/")
+		title := corpus.Title(rel, data)
+		if corpus.IsIndex(base) && dir != "" {
+			e := dirOf(dir)
+			e.title, e.rel = title, rel
+			continue
+		}
+		parent := dirOf(dir)
+		parent.children = append(parent.children, &entry{title: title, rel: rel})
+	}
+	return top, nil
+}
+
+func parentDir(dir string) string {
+	if i := strings.LastIndexByte(dir, '/'); i >= 0 {
+		return dir[:i]
+	}
+	return ""
+}
+
+// markdownList renders the children of e as a nested Markdown list. A
+// directory without an index file is an mdBook draft chapter, "[Title]()",
+// or plain text in an index.
+func markdownList(e *entry, depth int, link func(string) string) []string {
+	var lines []string
+	indent := strings.Repeat("  ", depth)
+	for _, child := range e.children {
+		switch {
+		case child.rel != "":
+			lines = append(lines, fmt.Sprintf("%s- [%s](%s)", indent, corpus.LinkText(child.title), markdown.Destination(link(child.rel))))
+		case *format == "mdbook":
+			lines = append(lines, fmt.Sprintf("%s- [%s]()", indent, corpus.LinkText(child.title)))
+		default:
+			lines = append(lines, fmt.Sprintf("%s- %s", indent, child.title))
+		}
+		lines = append(lines, markdownList(child, depth+1, link)...)
+	}
+	return lines
+}
+
+// mkdocsNav renders the tree as a MkDocs nav block. A directory becomes a
+// section whose first page is its index file.
+func mkdocsNav(top *entry) []string {
+	lines := []string{"nav:"}
+	var walk func(e *entry, depth int)
+	walk = func(e *entry, depth int) {
+		indent := strings.Repeat("  ", depth)
+		for _, child := range e.children {
+			if len(child.children) == 0 {
+				lines = append(lines, fmt.Sprintf("%s- %s: %s", indent, yamlString(child.title), child.rel))
+				continue
+			}
+			lines = append(lines, fmt.Sprintf("%s- %s:", indent, yamlString(child.title)))
+			if child.rel != "" {
+				lines = append(lines, fmt.Sprintf("%s  - %s", indent, child.rel))
+			}
+			walk(child, depth+1)
+		}
+	}
+	walk(top, 1)
+	return lines
+}
+
+// yamlString quotes s when it isn't safe as a plain YAML scalar.
+func yamlString(s string) string {
+	if s == "" || strings.ContainsAny(s, ":#{}[],&*!|>'\"%@`") || strings.TrimSpace(s) != s {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// replaceNav returns the YAML document config with its top-level nav key set
+// to nav, appending the key when it is missing.
+func replaceNav(config string, nav []string) string {
+	lines := strings.Split(strings.TrimRight(config, "\n"), "\n")
+	if config == "" {
+		lines = nil
+	}
+	start := -1
+	for i, line := range lines {
+		if line == "nav:" || strings.HasPrefix(line, "nav:") && strings.TrimSpace(line[4:]) == "" {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return strings.Join(append(lines, nav...), "\n") + "\n"
+	}
+	// The nav block runs until the next line at column zero.
+	end := start + 1
+	for end < len(lines) && (lines[end] == "" || lines[end][0] == ' ' || lines[end][0] == '-' || lines[end][0] == '#') {
+		end++
+	}
+	// Keep blank lines and comments that belong to what follows.
+	for end > start+1 && (strings.TrimSpace(lines[end-1]) == "" || strings.HasPrefix(lines[end-1], "#")) {
+		end--
+	}
+	result := append([]string(nil), lines[:start]...)
+	result = append(result, nav...)
+	result = append(result, lines[end:]...)
+	return strings.Join(result, "\n") + "\n"
+}
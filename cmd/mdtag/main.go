@@ -0,0 +1,481 @@
+// mdtag manages the tags frontmatter field of every Markdown file in a
+// directory.
+//
+// Usage:
+//
+//	mdtag [dir]                        # list tags by number of files (default .)
+//	mdtag -add draft docs/notes        # add a tag to every file under a directory
+//	mdtag -remove wip,old docs         # remove tags
+//	mdtag -rename golang=go docs       # rename tags, merging with existing ones
+//	mdtag -check -rename golang=go .   # list files that would change and exit 1
+//	mdtag -require type docs           # list files missing a required tag and exit 1
+//
+// Tags may be written as a flow list (tags: [a, b]), a block list of "- a"
+// items, or a single comma-separated value, and are read as YAML reads them:
+// quotes and comments aren't part of a tag. Rewritten lists keep their form,
+// their comments, and the quoting of the tags they keep; a scalar becomes a
+// flow list, as does a field that is added. A field left with no tags is
+// removed.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/corpus"
+	"github.com/dbh/md-tools/internal/markdown"
+)
+
+var (
+	flags        = cli.RegisterVersionFlags()
+	field        = flag.String("field", "tags", "frontmatter `field` holding the tags")
+	add          = flag.String("add", "", "comma-separated `tags` to add to every file")
+	remove       = flag.String("remove", "", "comma-separated `tags` to remove")
+	rename       = flag.String("rename", "", "comma-separated `old=new` tag renames")
+	require      = flag.String("require", "", "comma-separated `tags` every file must have")
+	check        = flag.Bool("check", false, "list files that would change and exit 1, without writing")
+	reportFormat = cli.RegisterOutputFlag()
+)
+
+// report collects the -check and -require diagnostics for -output rdjson.
+var report = &cli.Report{Source: "mdtag"}
+
+func main() {
+	flag.Parse()
+	if flags.PrintVersion("mdtag") {
+		return
+	}
+	if err := cli.CheckOutput(*reportFormat); err != nil {
+		fmt.Fprintf(os.Stderr, "mdtag: %v\n", err)
+		os.Exit(1)
+	}
+	if *reportFormat == "rdjson" && !*check && *require == "" {
+		fmt.Fprintf(os.Stderr, "mdtag: -output rdjson requires -check or -require\n")
+		os.Exit(1)
+	}
+	w := io.Writer(os.Stdout)
+	if *reportFormat == "rdjson" {
+		w = io.Discard
+	}
+	failed, err := run(flag.Args(), w)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mdtag: %v\n", err)
+		os.Exit(1)
+	}
+	if *reportFormat == "rdjson" {
+		if err := report.Write(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "mdtag: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// edits are the changes to make to each file's tags.
+type edits struct {
+	add, remove []string
+	rename      map[string]string
+}
+
+func (e edits) empty() bool {
+	return len(e.add) == 0 && len(e.remove) == 0 && len(e.rename) == 0
+}
+
+// apply returns tags with the edits made, in their original order with added
+// tags last and without duplicates.
+func (e edits) apply(tags []string) []string {
+	var result []string
+	seen := make(map[string]bool)
+	keep := func(tag string) {
+		if !seen[tag] {
+			seen[tag] = true
+			result = append(result, tag)
+		}
+	}
+	for _, tag := range tags {
+		if to, ok := e.rename[tag]; ok {
+			tag = to
+		}
+		if !contains(e.remove, tag) {
+			keep(tag)
+		}
+	}
+	for _, tag := range e.add {
+		keep(tag)
+	}
+	return result
+}
+
+// run edits, reports on, or lists the tags of the files under the directory
+// in args. It reports whether -check or -require found files to list.
+func run(args []string, w io.Writer) (bool, error) {
+	root := "."
+	switch len(args) {
+	case 0:
+	case 1:
+		root = args[0]
+	default:
+		return false, fmt.Errorf("expected at most one directory argument")
+	}
+
+	e := edits{add: splitList(*add), remove: splitList(*remove), rename: make(map[string]string)}
+	for _, pair := range splitList(*rename) {
+		from, to, ok := strings.Cut(pair, "=")
+		from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+		if !ok || from == "" || to == "" {
+			return false, fmt.Errorf("invalid -rename %q (want old=new)", pair)
+		}
+		e.rename[from] = to
+	}
+	required := splitList(*require)
+
+	c, err := corpus.Load(root)
+	if err != nil {
+		return false, err
+	}
+
+	counts := make(map[string]int)
+	failed := false
+	for _, rel := range c.Files {
+		data, err := c.Read(rel)
+		if err != nil {
+			return false, err
+		}
+		lines := strings.Split(string(data), "\n")
+		f, err := readTags(lines, *field)
+		if err != nil {
+			return false, fmt.Errorf("%s: %v", rel, err)
+		}
+		tags := f.tags
+
+		if !e.empty() {
+			tags = e.apply(tags)
+			if !slicesEqual(tags, f.tags) {
+				content := strings.Join(f.write(lines, *field, tags), "\n")
+				changed, err := c.Update(rel, data, content, *check)
+				if err != nil {
+					return false, err
+				}
+				if changed && *check {
+					report.Change(c.Abs(rel), string(data), content, "tags would change")
+					fmt.Fprintln(w, rel)
+					failed = true
+				}
+			}
+		}
+
+		if len(required) > 0 {
+			var missing []string
+			for _, tag := range required {
+				if !contains(tags, tag) {
+					missing = append(missing, tag)
+				}
+			}
+			if len(missing) > 0 {
+				report.Problem(c.Abs(rel), 1, "missing "+strings.Join(missing, ", "))
+				fmt.Fprintf(w, "%s: missing %s\n", rel, strings.Join(missing, ", "))
+				failed = true
+			}
+		}
+		for _, tag := range tags {
+			counts[tag]++
+		}
+	}
+
+	if e.empty() && len(required) == 0 {
+		return false, writeCounts(w, counts)
+	}
+	return failed, nil
+}
+
+// writeCounts lists the tags by descending count, then name.
+func writeCounts(w io.Writer, counts map[string]int) error {
+	tags := make([]string, 0, len(counts))
+	width := 1
+	for tag, n := range counts {
+		tags = append(tags, tag)
+		width = max(width, len(strconv.Itoa(n)))
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if counts[tags[i]] != counts[tags[j]] {
+			return counts[tags[i]] > counts[tags[j]]
+		}
+		return tags[i] < tags[j]
+	})
+	for _, tag := range tags {
+		if _, err := fmt.Fprintf(w, "%*d %s\n", width, counts[tag], tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tagField is the tags field as found in a file's frontmatter.
+type tagField struct {
+	tags        []string
+	start, end  int    // line range of the field, end exclusive; start < 0 when absent
+	block       bool   // whether the tags are a block list of "- " items
+	blockIndent string // indent of the items of a block list
+	comment     string // comment after a flow list or scalar, with its "#"
+	raw         map[string]string
+}
+
+// readTags finds the named field in the frontmatter of lines and parses its
+// tags. The values are the ones markdown.ParseFrontmatter reads; the lines
+// give their spelling, so that a rewritten field keeps it.
+func readTags(lines []string, name string) (tagField, error) {
+	f := tagField{start: -1, raw: make(map[string]string)}
+	fields, lineOf, err := markdown.ParseFrontmatter(lines)
+	if err != nil {
+		return f, err
+	}
+	v, ok := fields[name]
+	if !ok {
+		return f, nil
+	}
+	path := markdown.FieldPath("", name)
+	f.start = lineOf[path] - 1
+	f.end = f.start + 1
+	_, rest, _ := strings.Cut(lines[f.start], ":")
+	rest, f.comment = cutComment(rest)
+
+	var values []any
+	var spellings []string
+	switch v := v.(type) {
+	case []any:
+		values = v
+		if strings.HasPrefix(rest, "[") {
+			// A flow list may go on over more lines, up to its "]".
+			for depth := bracketDepth(rest); depth > 0 && f.end < len(lines); f.end++ {
+				value, comment := cutComment(lines[f.end])
+				rest += " " + value
+				if comment != "" {
+					f.comment = comment
+				}
+				depth += bracketDepth(value)
+			}
+			spellings = splitFlow(strings.TrimSuffix(strings.TrimPrefix(rest, "["), "]"))
+			break
+		}
+		f.block = true
+		for i := range v {
+			j := lineOf[markdown.IndexPath(path, i)] - 1
+			trimmed := strings.TrimLeft(lines[j], " \t")
+			if f.blockIndent == "" {
+				f.blockIndent = lines[j][:len(lines[j])-len(trimmed)]
+			}
+			// An item keeps its comment: it stays on the item's line.
+			spellings = append(spellings, strings.TrimSpace(strings.TrimPrefix(trimmed, "-")))
+			f.end = j + 1
+		}
+	case string:
+		// A plain scalar is a comma-separated list; a quoted one is one tag.
+		if strings.HasPrefix(rest, "\"") || strings.HasPrefix(rest, "'") {
+			values, spellings = []any{v}, []string{rest}
+			break
+		}
+		for _, item := range strings.Split(v, ",") {
+			values = append(values, strings.TrimSpace(item))
+		}
+		spellings = splitFlow(rest)
+	default:
+		values = []any{v}
+	}
+
+	for i, value := range values {
+		tag, ok := tagString(value)
+		if !ok || tag == "" {
+			continue
+		}
+		if _, dup := f.raw[tag]; dup {
+			continue
+		}
+		f.raw[tag] = quote(tag)
+		if len(spellings) == len(values) {
+			f.raw[tag] = spellings[i]
+		}
+		f.tags = append(f.tags, tag)
+	}
+	return f, nil
+}
+
+// tagString returns the tag a frontmatter value names, or false if it isn't
+// a scalar.
+func tagString(v any) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
+
+// cutComment splits the value after a field's colon into the value, trimmed,
+// and the comment after it, if any: a "#" after a space, outside quotes.
+func cutComment(s string) (value, comment string) {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' {
+				i++
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t'):
+			return strings.TrimSpace(s[:i]), s[i:]
+		}
+	}
+	return strings.TrimSpace(s), ""
+}
+
+// bracketDepth returns the number of brackets s opens, less those it
+// closes, outside quotes.
+func bracketDepth(s string) int {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' {
+				i++
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		}
+	}
+	return depth
+}
+
+// splitFlow splits the items of a flow list, without its brackets, at the
+// commas outside quotes, and trims them.
+func splitFlow(s string) []string {
+	var items []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' {
+				i++
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			items = append(items, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	if last := strings.TrimSpace(s[start:]); last != "" || len(items) > 0 {
+		items = append(items, last)
+	}
+	return items
+}
+
+// write returns lines with the field holding tags, keeping the spelling of
+// tags that were already there.
+func (f tagField) write(lines []string, name string, tags []string) []string {
+	items := make([]string, len(tags))
+	for i, tag := range tags {
+		if raw, ok := f.raw[tag]; ok {
+			items[i] = raw
+		} else {
+			items[i] = quote(tag)
+		}
+	}
+	if f.start < 0 {
+		if len(tags) == 0 {
+			return lines
+		}
+		return markdown.SetFrontmatterField(lines, name, "["+strings.Join(items, ", ")+"]")
+	}
+
+	var field []string
+	switch {
+	case len(tags) == 0:
+		// Drop frontmatter that held nothing else, which would otherwise
+		// read as two thematic breaks.
+		fm := markdown.FrontmatterEnd(lines)
+		if strings.TrimSpace(strings.Join(lines[:f.start], "")) == strings.Repeat("-", 3*f.start) && f.end == fm-1 {
+			rest := lines[fm:]
+			for len(rest) > 1 && strings.TrimSpace(rest[0]) == "" {
+				rest = rest[1:]
+			}
+			return rest
+		}
+	case f.block:
+		field = append(field, name+":")
+		for _, item := range items {
+			field = append(field, f.blockIndent+"- "+item)
+		}
+	default:
+		line := name + ": [" + strings.Join(items, ", ") + "]"
+		if f.comment != "" {
+			line += " " + f.comment
+		}
+		field = append(field, line)
+	}
+	result := append([]string(nil), lines[:f.start]...)
+	result = append(result, field...)
+	return append(result, lines[f.end:]...)
+}
+
+// quote double-quotes a tag that YAML wouldn't read as a plain string.
+func quote(tag string) string {
+	if strings.ContainsAny(tag, ",[]{}:#\"'&*!|>%@`") || strings.TrimSpace(tag) != tag || strings.HasPrefix(tag, "-") {
+		return strconv.Quote(tag)
+	}
+	return tag
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func slicesEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
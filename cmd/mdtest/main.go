@@ -0,0 +1,273 @@
+// mdtest runs the Go and shell examples in Markdown files and reports the
+// ones that fail, so README examples keep working.
+//
+// Usage:
+//
+//	mdtest README.md docs/*.md
+//	cat README.md | mdtest
+//	mdtest -module . README.md    # Go examples may import this module
+//
+// A block is tested when its info string has the word test after the
+// language: ```go test, ```sh test, or ```bash test. A Go block without a
+// package clause is wrapped in package main, and one without a main function
+// also has its statements wrapped in func main, after any import
+// declarations it starts with. Go blocks are run with "go run" in a temporary
+// directory, inside the -module directory when one is given; shell blocks
+// are run with -e from the file's directory.
+//
+// A block fails when it doesn't compile or exits non-zero, and when it is
+// followed by an ```output block, as mdexec writes, that doesn't match what
+// it printed. Failures are reported as "file:line: message" followed by the
+// output, and the exit status is 1.
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/markdown"
+)
+
+var (
+	flags   = cli.RegisterVersionFlags()
+	module  = flag.String("module", "", "run Go examples inside the module in `dir`, so they can import it")
+	timeout = flag.Duration("timeout", time.Minute, "time `limit` for each example")
+)
+
+func main() {
+	flag.Parse()
+	if flags.PrintVersion("mdtest") {
+		return
+	}
+	passed, failed, err := run(flag.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mdtest: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("%d passed, %d failed\n", passed, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func run(args []string) (passed, failed int, err error) {
+	if len(args) == 0 {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return 0, 0, err
+		}
+		return testFile("stdin", ".", string(data))
+	}
+	for _, path := range args {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return passed, failed, err
+		}
+		p, f, err := testFile(path, filepath.Dir(path), string(data))
+		passed, failed = passed+p, failed+f
+		if err != nil {
+			return passed, failed, err
+		}
+	}
+	return passed, failed, nil
+}
+
+// example is a testable block.
+type example struct {
+	line     int // 1-based line of the opening fence
+	lang     string
+	code     string
+	expected *string // contents of the following output block, if any
+}
+
+// testFile runs the examples in content, reporting failures under name.
+func testFile(name, dir, content string) (passed, failed int, err error) {
+	for _, ex := range findExamples(strings.Split(content, "\n")) {
+		var out string
+		var runErr error
+		switch ex.lang {
+		case "go":
+			out, runErr = runGo(ex.code)
+		case "sh", "bash":
+			out, runErr = runShell(ex.lang, ex.code, dir)
+		default:
+			return passed, failed, fmt.Errorf("%s:%d: can't test %q blocks (want go, sh, or bash)", name, ex.line, ex.lang)
+		}
+
+		out = strings.TrimRight(out, "\n")
+		switch {
+		case runErr != nil:
+			fmt.Printf("%s:%d: %s example: %v\n", name, ex.line, ex.lang, runErr)
+			if out != "" {
+				fmt.Println(indent(out))
+			}
+		case ex.expected != nil && out != strings.TrimRight(*ex.expected, "\n"):
+			fmt.Printf("%s:%d: %s example: output differs\n", name, ex.line, ex.lang)
+			fmt.Printf("\t--- expected\n%s\n\t--- actual\n%s\n", indent(strings.TrimRight(*ex.expected, "\n")), indent(out))
+		default:
+			passed++
+			continue
+		}
+		failed++
+	}
+	return passed, failed, nil
+}
+
+// findExamples returns the testable blocks in lines, outside frontmatter.
+func findExamples(lines []string) []example {
+	var examples []example
+	for i := markdown.FrontmatterEnd(lines); i < len(lines); i++ {
+		open, ok := fenceOpen(lines[i])
+		if !ok {
+			continue
+		}
+		close := fenceClose(lines, i, open.marker)
+		if len(open.info) >= 2 && open.info[1] == "test" && close < len(lines) {
+			ex := example{line: i + 1, lang: open.info[0], code: blockText(lines[i+1:close], open.indent)}
+			// An output block follows after a blank line.
+			if j := close + 2; j < len(lines) && strings.TrimSpace(lines[close+1]) == "" {
+				if out, ok := fenceOpen(lines[j]); ok && len(out.info) == 1 && out.info[0] == "output" {
+					if end := fenceClose(lines, j, out.marker); end < len(lines) {
+						expected := blockText(lines[j+1:end], out.indent)
+						ex.expected = &expected
+					}
+				}
+			}
+			examples = append(examples, ex)
+		}
+		i = close
+	}
+	return examples
+}
+
+// opening is an opening code fence.
+type opening struct {
+	indent, marker string
+	info           []string
+}
+
+func fenceOpen(line string) (opening, bool) {
+	trimmed := strings.TrimLeft(line, " ")
+	indent := line[:len(line)-len(trimmed)]
+	if len(indent) > 3 || !(strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~")) {
+		return opening{}, false
+	}
+	n := 0
+	for n < len(trimmed) && trimmed[n] == trimmed[0] {
+		n++
+	}
+	return opening{indent: indent, marker: trimmed[:n], info: strings.Fields(trimmed[n:])}, true
+}
+
+// fenceClose returns the index of the line closing the fence opened at
+// lines[open], or len(lines).
+func fenceClose(lines []string, open int, marker string) int {
+	for i := open + 1; i < len(lines); i++ {
+		t := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(t, marker) && strings.Trim(t, marker[:1]) == "" {
+			return i
+		}
+	}
+	return len(lines)
+}
+
+// blockText joins the lines of a block without the fence's indent.
+func blockText(lines []string, indent string) string {
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString(strings.TrimPrefix(line, indent))
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// goProgram makes a complete program of a Go example.
+func goProgram(code string) string {
+	if hasLinePrefix(code, "package ") {
+		return code
+	}
+	if hasLinePrefix(code, "func main()") {
+		return "package main\n\n" + code
+	}
+	// Keep the leading import declarations at the top level.
+	lines := strings.Split(code, "\n")
+	i := 0
+	for i < len(lines) {
+		t := strings.TrimSpace(lines[i])
+		switch {
+		case t == "":
+		case t == "import (":
+			for i < len(lines) && strings.TrimSpace(lines[i]) != ")" {
+				i++
+			}
+		case strings.HasPrefix(t, "import "):
+		default:
+			return "package main\n\n" + strings.Join(lines[:i], "\n") + "\nfunc main() {\n" + strings.Join(lines[i:], "\n") + "}\n"
+		}
+		i++
+	}
+	return "package main\n\n" + code + "\nfunc main() {}\n"
+}
+
+func hasLinePrefix(code, prefix string) bool {
+	for _, line := range strings.Split(code, "\n") {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// runGo compiles and runs a Go example and returns what it printed.
+func runGo(code string) (string, error) {
+	dir, err := os.MkdirTemp(*module, "mdtest-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte(goProgram(code)), 0644); err != nil {
+		return "", err
+	}
+	if *module == "" {
+		if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example\n"), 0644); err != nil {
+			return "", err
+		}
+	}
+	return output(dir, "", "go", "run", ".")
+}
+
+// runShell runs a shell example from dir and returns what it printed.
+func runShell(shell, code, dir string) (string, error) {
+	return output(dir, code, shell, "-e")
+}
+
+// output runs a command in dir with stdin and the -timeout, and returns its
+// combined stdout and stderr.
+func output(dir, stdin, name string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(stdin)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		return out.String(), fmt.Errorf("timed out after %v", *timeout)
+	}
+	return out.String(), err
+}
+
+func indent(s string) string {
+	return "\t" + strings.ReplaceAll(s, "\n", "\n\t")
+}
@@ -0,0 +1,46 @@
+// mdtoadoc converts Markdown to AsciiDoc, for documentation moving into an
+// Antora site while it is still written in Markdown.
+//
+// Usage:
+//
+//	mdtoadoc [file...]
+//	cat file.md | mdtoadoc > file.adoc
+//
+// A leading # heading becomes the document title, followed by simple
+// "key: value" frontmatter as attribute entries; the other headings become
+// sections with an explicit ID, the slug GitHub gives them, so links to
+// #fragments become <<cross-references>>. Links to other Markdown files
+// become xref: macros to the .adoc page, GFM alerts ([!NOTE] and the rest)
+// become admonition blocks, footnotes become footnote: macros at their
+// first reference, and tables, lists, quotes, code, and HTML blocks become
+// their delimited or marked-up AsciiDoc equivalents.
+//
+// Characters that would start AsciiDoc markup where the Markdown has none
+// are written as character references, like {asterisk}.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/tools/mdtoadoc"
+)
+
+var (
+	flags = cli.RegisterFlags()
+	setup = mdtoadoc.Flags(flag.CommandLine)
+)
+
+func main() {
+	flag.Parse()
+	transform, err := setup()
+	if err == nil {
+		err = cli.Run("mdtoadoc", flags, flag.Args(), transform)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mdtoadoc: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,53 @@
+// mdtodjot converts Markdown to Djot, rewriting only the syntax that differs
+// between the two.
+//
+// Usage:
+//
+//	mdtodjot [file...]
+//	cat file.md | mdtodjot > file.dj
+//	mdtodjot -w file.md    # modify file in place
+//
+// The conversions are:
+//
+//	*em* and _em_          _em_
+//	**strong**, __strong__ *strong*
+//	~~deleted~~            {-deleted-}
+//	<b>raw HTML</b>        `<b>`{=html}raw HTML`</b>`{=html}, and ```=html blocks
+//	[shortcut]             [shortcut][]
+//	[a](url "title")       [a](url){title="title"}
+//	two trailing spaces    a backslash hard break
+//	setext and closed ATX  ATX headings without closing #s
+//	indented code          fenced code
+//	___                    ---
+//	a | b                  | a | b |  (table rows get outer pipes)
+//
+// Djot paragraphs and headings only end at blank lines, so a blank line is
+// added before a block that directly follows one. Footnotes, task lists,
+// autolinks, and everything else are the same in both and are left alone.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/tools/mdtodjot"
+)
+
+var (
+	flags = cli.RegisterFlags()
+	setup = mdtodjot.Flags(flag.CommandLine)
+)
+
+func main() {
+	flag.Parse()
+	transform, err := setup()
+	if err == nil {
+		err = cli.Run("mdtodjot", flags, flag.Args(), transform)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mdtodjot: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,236 @@
+// mdtodo collects TODO, FIXME, and HACK markers from the prose and HTML
+// comments of every Markdown file in a directory into one report.
+//
+// Usage:
+//
+//	mdtodo [dir]                   # Markdown report of dir (default .)
+//	mdtodo -format json docs       # JSON, for other tools
+//	mdtodo -tags TODO,XXX docs     # markers to look for
+//
+// A marker is an upper-case tag with an optional "(owner)", followed by a
+// colon or standing at the start of a line, list item, or comment:
+// "TODO: check this", "FIXME(dan): broken link", "<!-- HACK until v2 -->".
+// Each item carries its file, line, and the heading it falls under. Code is
+// never searched.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/corpus"
+	"github.com/dbh/md-tools/internal/markdown"
+)
+
+var (
+	flags  = cli.RegisterVersionFlags()
+	format = flag.String("format", "markdown", "output `format`: markdown or json")
+	tags   = flag.String("tags", "TODO,FIXME,HACK", "comma-separated marker `tags`")
+)
+
+// leadRe matches what may precede a marker on its line without a colon.
+var leadRe = regexp.MustCompile(`^[ \t]*(?:>[ \t]*)*(?:(?:[-*+]|\d{1,9}[.)])[ \t]+)?(?:<!--[ \t]*)?$`)
+
+// item is a marker found in a file.
+type item struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Tag     string `json:"tag"`
+	Owner   string `json:"owner,omitempty"`
+	Text    string `json:"text"`
+	Section string `json:"section,omitempty"` // nearest heading above
+	Anchor  string `json:"anchor,omitempty"`  // its slug
+	Comment bool   `json:"comment"`           // inside an HTML comment
+}
+
+func main() {
+	flag.Parse()
+	if flags.PrintVersion("mdtodo") {
+		return
+	}
+	if *format != "markdown" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "mdtodo: unknown -format %q (want markdown or json)\n", *format)
+		os.Exit(1)
+	}
+	if err := run(flag.Args(), os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "mdtodo: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, w io.Writer) error {
+	root := "."
+	switch len(args) {
+	case 0:
+	case 1:
+		root = args[0]
+	default:
+		return fmt.Errorf("expected at most one directory argument")
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", root)
+	}
+
+	var names []string
+	for _, tag := range strings.Split(*tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			names = append(names, regexp.QuoteMeta(tag))
+		}
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("-tags is empty")
+	}
+	markerRe := regexp.MustCompile(`\b(` + strings.Join(names, "|") + `)\b(?:\(([^)\n]*)\))?`)
+
+	c, err := corpus.Load(root)
+	if err != nil {
+		return err
+	}
+	items := []item{}
+	for _, rel := range c.Files {
+		data, err := c.Read(rel)
+		if err != nil {
+			return err
+		}
+		items = append(items, findItems(rel, string(data), markerRe)...)
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(items)
+	}
+	return writeMarkdown(w, items)
+}
+
+// findItems returns the markers in content outside frontmatter and code.
+func findItems(rel, content string, markerRe *regexp.Regexp) []item {
+	lines := strings.Split(content, "\n")
+	start := 0
+	for _, line := range lines[:markdown.FrontmatterEnd(lines)] {
+		start += len(line) + 1
+	}
+	start = min(start, len(content)) // no newline after frontmatter at the end
+	code := corpus.CodeRanges([]byte(content))
+	comments := commentRanges(content, start, code)
+	headings := corpus.Headings([]byte(content))
+
+	var items []item
+	for _, m := range markerRe.FindAllStringSubmatchIndex(content, -1) {
+		if m[0] < start || inRanges(m[0], code) {
+			continue
+		}
+		// A tag is a marker when a colon follows it or it starts a line,
+		// list item, quote, or comment; "a TODO list" is prose.
+		lineStart := strings.LastIndexByte(content[:m[0]], '\n') + 1
+		if !strings.HasPrefix(content[m[1]:], ":") && !leadRe.MatchString(content[lineStart:m[0]]) {
+			continue
+		}
+		it := item{
+			File: rel,
+			Line: strings.Count(content[:m[0]], "\n") + 1,
+			Tag:  content[m[2]:m[3]],
+		}
+		if m[4] >= 0 {
+			it.Owner = strings.TrimSpace(content[m[4]:m[5]])
+		}
+
+		// The text runs to the end of the line, or of the comment the marker
+		// is in.
+		rest := content[m[1]:]
+		if r, ok := rangeAt(m[0], comments); ok {
+			it.Comment = true
+			rest = content[m[1] : r.End-3]
+		} else if i := strings.IndexByte(rest, '\n'); i >= 0 {
+			rest = rest[:i]
+		}
+		rest = strings.TrimPrefix(rest, ":")
+		it.Text = strings.Join(strings.Fields(rest), " ")
+
+		for _, h := range headings {
+			if h.Line > it.Line {
+				break
+			}
+			it.Section, it.Anchor = h.Text, h.Slug
+		}
+		items = append(items, it)
+	}
+	return items
+}
+
+// commentRanges returns the byte ranges of the HTML comments in content from
+// start on, skipping those in code.
+func commentRanges(content string, start int, code []markdown.ByteRange) []markdown.ByteRange {
+	var ranges []markdown.ByteRange
+	pos := start
+	for {
+		i := strings.Index(content[pos:], "<!--")
+		if i < 0 {
+			return ranges
+		}
+		open := pos + i
+		if inRanges(open, code) {
+			pos = open + 4
+			continue
+		}
+		j := strings.Index(content[open+4:], "-->")
+		if j < 0 {
+			return ranges
+		}
+		pos = open + 4 + j + 3
+		ranges = append(ranges, markdown.ByteRange{Start: open, End: pos})
+	}
+}
+
+func rangeAt(pos int, ranges []markdown.ByteRange) (markdown.ByteRange, bool) {
+	for _, r := range ranges {
+		if pos >= r.Start && pos < r.End {
+			return r, true
+		}
+	}
+	return markdown.ByteRange{}, false
+}
+
+func inRanges(pos int, ranges []markdown.ByteRange) bool {
+	_, ok := rangeAt(pos, ranges)
+	return ok
+}
+
+// writeMarkdown writes the items as a Markdown list grouped by file, linking
+// each item to its section.
+func writeMarkdown(w io.Writer, items []item) error {
+	var b strings.Builder
+	b.WriteString("# TODO\n")
+	if len(items) == 0 {
+		b.WriteString("\nNothing to do.\n")
+	}
+	for i, it := range items {
+		if i == 0 || items[i-1].File != it.File {
+			fmt.Fprintf(&b, "\n## [%s](%s)\n\n", it.File, it.File)
+		}
+		fmt.Fprintf(&b, "- **%s**", it.Tag)
+		if it.Owner != "" {
+			fmt.Fprintf(&b, " (%s)", it.Owner)
+		}
+		fmt.Fprintf(&b, " line %d", it.Line)
+		if it.Section != "" {
+			fmt.Fprintf(&b, ", [%s](%s#%s)", it.Section, it.File, it.Anchor)
+		}
+		if it.Text != "" {
+			fmt.Fprintf(&b, ": %s", it.Text)
+		}
+		b.WriteString("\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/config"
+	"github.com/dbh/md-tools/internal/markdown"
+	"github.com/dbh/md-tools/internal/tools"
+)
+
+// doctorCommand reports what decides how the tools format a file: the
+// versions installed, the configuration files found and which of them are
+// used, the pipeline's steps with their settings, and what .editorconfig
+// says about the file. It exits 1 if it finds a problem, such as a tool
+// from another release or two widths for the same file.
+func doctorCommand(args []string) (int, error) {
+	fs := flag.NewFlagSet("mdtools doctor", flag.ExitOnError)
+	configPath := fs.String("config", "", "configuration `file` (default: the nearest "+config.FileName+")")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: mdtools doctor [-config file] [file]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return 2, fmt.Errorf("expected at most one file")
+	}
+
+	d := &doctor{w: os.Stdout}
+	fmt.Fprintf(d.w, "mdtools %s (%s %s/%s)\n", cli.Version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+
+	dir := "."
+	if fs.NArg() == 1 {
+		dir = filepath.Dir(fs.Arg(0))
+	}
+	fmt.Fprintf(d.w, "\nConfiguration files:\n")
+	cfg := d.config(*configPath)
+	d.editorConfigFiles(dir)
+
+	widths := make(map[string]int) // the width each mdwrap step wraps to
+	if cfg != nil {
+		fmt.Fprintf(d.w, "\nPipeline:\n")
+		for _, step := range cfg.Steps {
+			if width, ok := d.step(cfg, step); ok {
+				widths[step] = width
+			}
+		}
+		if len(cfg.Steps) == 0 {
+			fmt.Fprintf(d.w, "  (no steps)\n")
+		}
+	}
+
+	if fs.NArg() == 1 {
+		d.file(fs.Arg(0), cfg, widths)
+	}
+
+	fmt.Fprintf(d.w, "\n")
+	if len(d.problems) == 0 {
+		fmt.Fprintf(d.w, "No problems found.\n")
+		return 0, nil
+	}
+	fmt.Fprintf(d.w, "Problems:\n")
+	for _, p := range d.problems {
+		fmt.Fprintf(d.w, "  - %s\n", p)
+	}
+	return 1, nil
+}
+
+// doctor collects the problems it finds while printing its report to w.
+type doctor struct {
+	w        io.Writer
+	problems []string
+}
+
+func (d *doctor) problem(format string, args ...any) {
+	d.problems = append(d.problems, fmt.Sprintf(format, args...))
+}
+
+// config prints the configuration file mdtools pipe would use, with the
+// ones further up that it doesn't, and returns it, or nil if there is none
+// or it can't be read.
+func (d *doctor) config(p string) *config.Config {
+	var shadowed []string
+	if p == "" {
+		var err error
+		p, err = config.Find(".")
+		if errors.Is(err, config.ErrNotFound) {
+			fmt.Fprintf(d.w, "  %s  none found\n", config.FileName)
+			return nil
+		} else if err != nil {
+			d.problem("%v", err)
+			return nil
+		}
+		for dir := filepath.Dir(p); dir != filepath.Dir(dir); {
+			other, err := config.Find(filepath.Dir(dir))
+			if err != nil {
+				break
+			}
+			shadowed = append(shadowed, other)
+			dir = filepath.Dir(other)
+		}
+	}
+	fmt.Fprintf(d.w, "  %s  %s\n", config.FileName, p)
+	for _, other := range shadowed {
+		fmt.Fprintf(d.w, "  %s  %s (not used: only the nearest one is read)\n", config.FileName, other)
+	}
+	cfg, err := config.Load(p)
+	if err != nil {
+		d.problem("%v", err)
+		return nil
+	}
+	return cfg
+}
+
+// editorConfigFiles prints the .editorconfig files that apply to the files
+// in dir, and those above a root = true file that don't.
+func (d *doctor) editorConfigFiles(dir string) {
+	used, unused, err := cli.EditorConfigFiles(dir)
+	if err != nil {
+		d.problem("%v", err)
+		return
+	}
+	if len(used) == 0 {
+		fmt.Fprintf(d.w, "  .editorconfig  none found\n")
+	}
+	// Farthest first, the order they're applied in.
+	for i := len(used) - 1; i >= 0; i-- {
+		fmt.Fprintf(d.w, "  .editorconfig  %s\n", used[i])
+	}
+	for _, name := range unused {
+		fmt.Fprintf(d.w, "  .editorconfig  %s (not used: above root = true)\n", name)
+	}
+}
+
+// step prints the command or plugin a pipeline step runs and, for a tool
+// in the registry, the value of each of its flags. It returns the width an
+// mdwrap step wraps to.
+func (d *doctor) step(cfg *config.Config, step string) (width int, isWrap bool) {
+	fields := strings.Fields(step)
+	if len(fields) == 0 {
+		d.problem("pipe.steps has an empty step")
+		return 0, false
+	}
+	name := fields[0]
+	fmt.Fprintf(d.w, "  %s\n", step)
+	if p, ok := cfg.Plugins[name]; ok {
+		path, err := exec.LookPath(toolPath(p.Command))
+		if err != nil {
+			fmt.Fprintf(d.w, "    plugin  %s (not found)\n", p.Command)
+			d.problem("%s: plugin command %s not found", step, p.Command)
+			return 0, false
+		}
+		fmt.Fprintf(d.w, "    plugin  %s\n", path)
+		return 0, false
+	}
+
+	path, err := exec.LookPath(toolPath(name))
+	if err != nil {
+		fmt.Fprintf(d.w, "    command  %s (not found)\n", name)
+		d.problem("%s: %s is not installed next to mdtools or in $PATH", step, name)
+		return 0, false
+	}
+	version := toolVersion(path)
+	fmt.Fprintf(d.w, "    command  %s %s\n", path, version)
+	if version != "" && version != cli.Version {
+		d.problem("%s: %s is version %s, but mdtools is %s", step, path, version, cli.Version)
+	}
+
+	flags, ok := tools.Lookup(name)
+	if !ok || !strings.HasPrefix(name, "md") {
+		return 0, false
+	}
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	setup := flags(fs)
+	if err := fs.Parse(fields[1:]); err != nil {
+		d.problem("%s: %v", step, err)
+		return 0, false
+	}
+	if _, err := setup(); err != nil {
+		d.problem("%s: %v", step, err)
+	}
+	var settings []string
+	fs.VisitAll(func(f *flag.Flag) {
+		settings = append(settings, fmt.Sprintf("-%s=%s", f.Name, f.Value))
+	})
+	fmt.Fprintf(d.w, "    flags    %s\n", strings.Join(settings, " "))
+	if name != "mdwrap" {
+		return 0, false
+	}
+	width, _ = strconv.Atoi(fs.Lookup("c").Value.String())
+	return width, true
+}
+
+// toolVersion returns the version the tool at path reports, or "" if it
+// doesn't.
+func toolVersion(path string) string {
+	out, err := exec.Command(path, "-version").Output()
+	if err != nil {
+		return ""
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) != 2 {
+		return ""
+	}
+	return fields[1]
+}
+
+// file prints the settings for the file at path: whether the pipeline
+// applies to it and what its .editorconfig says, and checks them against
+// the pipeline's mdwrap steps, whose width is widths.
+func (d *doctor) file(path string, cfg *config.Config, widths map[string]int) {
+	fmt.Fprintf(d.w, "\nSettings for %s:\n", path)
+	if cfg != nil {
+		applies := "yes"
+		if !cfg.Matches(path) {
+			applies = "no (not matched by pipe.files)"
+		}
+		fmt.Fprintf(d.w, "  pipeline                  %s\n", applies)
+	}
+	c, err := cli.LoadEditorConfig(path)
+	if err != nil {
+		d.problem("%v", err)
+		return
+	}
+	orUnset := func(s string) string {
+		if s == "" {
+			return "unset"
+		}
+		return s
+	}
+	finalNewline := ""
+	if c.InsertFinalNewline != nil {
+		finalNewline = strconv.FormatBool(*c.InsertFinalNewline)
+	}
+	lineLength := ""
+	if c.MaxLineLength > 0 {
+		lineLength = strconv.Itoa(c.MaxLineLength)
+	}
+	fmt.Fprintf(d.w, "  end_of_line               %s\n", orUnset(c.EndOfLine))
+	fmt.Fprintf(d.w, "  insert_final_newline      %s\n", orUnset(finalNewline))
+	fmt.Fprintf(d.w, "  trim_trailing_whitespace  %t\n", c.TrimTrailingWhitespace)
+	fmt.Fprintf(d.w, "  max_line_length           %s\n", orUnset(lineLength))
+
+	if cfg != nil && cfg.Matches(path) {
+		steps := make([]string, 0, len(widths))
+		for step := range widths {
+			steps = append(steps, step)
+		}
+		sort.Strings(steps)
+		for _, step := range steps {
+			// Pipeline steps read stdin, so .editorconfig doesn't reach them.
+			if c.MaxLineLength > 0 && widths[step] == 0 {
+				d.problem("pipeline step %q joins the paragraphs of %s onto one line, but its .editorconfig max_line_length, which mdwrap -w uses, is %d", step, path, c.MaxLineLength)
+			} else if c.MaxLineLength > 0 && widths[step] != c.MaxLineLength {
+				d.problem("pipeline step %q wraps %s to %d, but its .editorconfig max_line_length, which mdwrap -w uses, is %d", step, path, widths[step], c.MaxLineLength)
+			}
+		}
+	}
+
+	if c.TrimTrailingWhitespace {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				d.problem("%v", err)
+			}
+			return
+		}
+		for i, line := range strings.Split(string(data), "\n") {
+			if _, brk := markdown.CutHardBreak(strings.TrimSuffix(line, "\r")); brk == "  " {
+				d.problem("%s:%d: a two-space hard break, which editors that trim_trailing_whitespace remove on save; mdwrap -breaks backslash rewrites them", path, i+1)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dbh/md-tools/internal/config"
+)
+
+// hookMarker marks a hook as written by install-hooks, so it can be replaced.
+const hookMarker = "# Installed by mdtools install-hooks."
+
+// preCommitHook checks the staged Markdown files against the pipeline.
+const preCommitHook = `#!/bin/sh
+` + hookMarker + `
+# Fails the commit if the pipeline in ` + config.FileName + ` would change a staged
+# Markdown file; run "mdtools pipe -w <file>" to fix it.
+exec mdtools pipe -check -staged
+`
+
+// Git configuration for the merge and diff drivers.
+const (
+	driverName    = "markdown"
+	mergeCommand  = "mdtools merge-driver -marker-size %L %O %A %B"
+	diffTextconv  = "mdtools normalize"
+	attributeTail = " merge=" + driverName + " diff=" + driverName
+)
+
+// installHooks writes a pre-commit hook that runs the project's pipeline,
+// and with -drivers registers the merge and diff drivers.
+func installHooks(args []string) (int, error) {
+	fs := flag.NewFlagSet("mdtools install-hooks", flag.ExitOnError)
+	drivers := fs.Bool("drivers", false, "also set up the merge and diff drivers in .git/config and .gitattributes")
+	force := fs.Bool("force", false, "replace a pre-commit hook that mdtools didn't install")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: mdtools install-hooks [-drivers] [-force]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return 2, fmt.Errorf("unexpected arguments")
+	}
+	root, err := git("rev-parse", "--show-toplevel")
+	if err != nil {
+		return 2, err
+	}
+	p, err := config.Find(".")
+	if err != nil {
+		return 2, fmt.Errorf("%w; create one with a [pipe] section first", err)
+	}
+	cfg, err := config.Load(p)
+	if err != nil {
+		return 2, err
+	}
+
+	hook, err := git("rev-parse", "--git-path", "hooks/pre-commit")
+	if err != nil {
+		return 2, err
+	}
+	if existing, err := os.ReadFile(hook); err == nil && !strings.Contains(string(existing), hookMarker) && !*force {
+		return 2, fmt.Errorf("%s exists; use -force to replace it", hook)
+	}
+	if err := os.MkdirAll(filepath.Dir(hook), 0755); err != nil {
+		return 2, err
+	}
+	if err := os.WriteFile(hook, []byte(preCommitHook), 0755); err != nil {
+		return 2, err
+	}
+	// WriteFile keeps the mode of a file that exists.
+	if err := os.Chmod(hook, 0755); err != nil {
+		return 2, err
+	}
+
+	if !*drivers {
+		return 0, nil
+	}
+	for _, kv := range [][2]string{
+		{"merge." + driverName + ".name", "sentence-aware Markdown merge"},
+		{"merge." + driverName + ".driver", mergeCommand},
+		{"diff." + driverName + ".textconv", diffTextconv},
+	} {
+		if _, err := git("config", kv[0], kv[1]); err != nil {
+			return 2, err
+		}
+	}
+	attributes := filepath.Join(root, ".gitattributes")
+	if err := addAttributes(attributes, cfg.Files); err != nil {
+		return 2, err
+	}
+	return 0, nil
+}
+
+// addAttributes adds a line routing each pattern to the drivers to the
+// .gitattributes file at p, unless it has that line already.
+func addAttributes(p string, patterns []string) error {
+	data, err := os.ReadFile(p)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	content := string(data)
+	have := make(map[string]bool)
+	for _, line := range strings.Split(content, "\n") {
+		have[strings.Join(strings.Fields(line), " ")] = true
+	}
+	var add []string
+	for _, pattern := range patterns {
+		if line := pattern + attributeTail; !have[line] {
+			add = append(add, line)
+		}
+	}
+	if len(add) == 0 {
+		return nil
+	}
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	content += strings.Join(add, "\n") + "\n"
+	return os.WriteFile(p, []byte(content), 0644)
+}
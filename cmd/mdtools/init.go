@@ -0,0 +1,314 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dbh/md-tools/internal/config"
+	"github.com/dbh/md-tools/internal/corpus"
+	"github.com/dbh/md-tools/internal/markdown"
+)
+
+// initCommand writes a .mdtools.toml for the Markdown files under a
+// directory, with a pipeline that keeps them the way most of them are
+// already written, and comments saying what it found.
+func initCommand(args []string) (int, error) {
+	fs := flag.NewFlagSet("mdtools init", flag.ExitOnError)
+	force := fs.Bool("force", false, "replace an existing "+config.FileName)
+	printOnly := fs.Bool("print", false, "print the configuration instead of writing it")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: mdtools init [-force | -print] [dir]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	dir := "."
+	switch fs.NArg() {
+	case 0:
+	case 1:
+		dir = fs.Arg(0)
+	default:
+		fs.Usage()
+		return 2, fmt.Errorf("expected at most one directory")
+	}
+
+	c, err := corpus.Load(dir)
+	if err != nil {
+		return 2, err
+	}
+	if len(c.Files) == 0 {
+		return 2, fmt.Errorf("no Markdown files under %s", dir)
+	}
+	s := &survey{bullets: make(map[byte]int), extensions: make(map[string]bool)}
+	for _, rel := range c.Files {
+		data, err := c.Read(rel)
+		if err != nil {
+			return 2, err
+		}
+		s.extensions[strings.ToLower(path.Ext(rel))] = true
+		s.add(string(data))
+	}
+	out := s.config(len(c.Files))
+
+	if *printOnly {
+		_, err := io.WriteString(os.Stdout, out)
+		return 0, err
+	}
+	p := filepath.Join(dir, config.FileName)
+	if _, err := os.Stat(p); err == nil && !*force {
+		return 2, fmt.Errorf("%s exists; use -force to replace it", p)
+	}
+	return 0, os.WriteFile(p, []byte(out), 0644)
+}
+
+// survey counts the conventions a set of documents follow.
+type survey struct {
+	extensions map[string]bool // of the files, lowercased: ".md", ".markdown"
+
+	// Paragraphs of more than one line, hard wrapped or one sentence per
+	// line, and those of one line too long to be wrapped.
+	wrapped, sentences, unwrapped int
+	width                         int // the longest line of a wrapped one
+
+	inline            int // inline links, not counting images
+	numbered, labeled int // reference definitions with numbers and other labels
+
+	bullets map[byte]int // list items by marker
+
+	footnotes, namedFootnotes int // footnote definitions, and those not numbered
+}
+
+var (
+	// inlineLinkRe matches the start of an inline link or image.
+	inlineLinkRe = regexp.MustCompile(`(!?)\[[^\]\n]*\]\(`)
+	// definitionLabelRe captures a definition's label.
+	definitionLabelRe = regexp.MustCompile(`^ {0,3}\[\^?([^\]]+)\]:`)
+	// sentenceEndRe matches a line that ends a sentence.
+	sentenceEndRe = regexp.MustCompile(`[.!?:]["'’”)*_]*$`)
+)
+
+// unwrappedLength is how many characters a line must have to show that
+// its paragraph isn't hard wrapped: more than any wrap width in common use.
+const unwrappedLength = 100
+
+// add counts the conventions content follows.
+func (s *survey) add(content string) {
+	code := markdown.NewRangeSet(corpus.CodeRanges([]byte(content)))
+	for _, m := range inlineLinkRe.FindAllStringSubmatchIndex(content, -1) {
+		if m[2] == m[3] && !code.Contains(m[0]) {
+			s.inline++
+		}
+	}
+
+	lines := strings.Split(content, "\n")
+	fence := ""
+	for _, line := range lines[markdown.FrontmatterEnd(lines):] {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case fence != "":
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			fence = trimmed[:3]
+		case markdown.IsFootnoteDefinition(line):
+			s.footnotes++
+			if m := definitionLabelRe.FindStringSubmatch(line); m != nil && !isNumber(m[1]) {
+				s.namedFootnotes++
+			}
+		case markdown.IsLinkRefDefinition(line):
+			if m := definitionLabelRe.FindStringSubmatch(line); m != nil && isNumber(m[1]) {
+				s.numbered++
+			} else {
+				s.labeled++
+			}
+		case markdown.IsListItem(line) && strings.ContainsAny(trimmed[:1], "-*+") && !markdown.IsHorizontalRule(line):
+			s.bullets[trimmed[0]]++
+		}
+	}
+
+	markdown.RewriteProse(content, func(block string) string {
+		// The wrapping tools leave lists as they are, so only the lines
+		// before a list count.
+		var para []string
+		for _, line := range strings.Split(block, "\n") {
+			if markdown.IsListItem(line) {
+				break
+			}
+			para = append(para, line)
+		}
+		if len(para) > 0 {
+			s.paragraph(para)
+		}
+		return block
+	})
+}
+
+// paragraph counts how the lines of a paragraph are broken.
+func (s *survey) paragraph(lines []string) {
+	first := strings.TrimSpace(lines[0])
+	if strings.HasPrefix(first, "#") || markdown.IsTableRow(first) || markdown.IsFootnoteDefinition(first) {
+		return // not wrapped, or only with mdwrap -f
+	}
+	if len(lines) == 1 {
+		if utf8.RuneCountInString(first) > unwrappedLength && strings.Contains(first, " ") {
+			s.unwrapped++
+		}
+		return
+	}
+	sentences := true
+	for _, line := range lines[:len(lines)-1] {
+		if markdown.HasHardBreak(line) {
+			return // verse, or an address: broken by hand
+		}
+		if !sentenceEndRe.MatchString(strings.TrimSpace(line)) {
+			sentences = false
+		}
+	}
+	if sentences {
+		s.sentences++
+		return
+	}
+	s.wrapped++
+	for _, line := range lines {
+		if n := utf8.RuneCountInString(strings.TrimRight(line, " \t")); n > s.width && strings.Contains(strings.TrimSpace(line), " ") {
+			s.width = n
+		}
+	}
+}
+
+// config returns the configuration for the n files surveyed: a pipeline
+// step for each convention most of them follow, and a comment for each they
+// don't agree on.
+func (s *survey) config(n int) string {
+	var b strings.Builder
+	var steps []string
+	note := func(format string, args ...any) {
+		fmt.Fprintf(&b, "# "+format+"\n", args...)
+	}
+	note("Written by mdtools init from the %d Markdown %s it found.", n, plural(n, "file", "files"))
+	note("Each step keeps a convention most of them already follow; check")
+	note("what the pipeline would change with: mdtools pipe -check <files>")
+	b.WriteString("\n")
+
+	// Bullets: mdlist makes every marker the same.
+	if marker, count, total := s.bullet(); total == 0 {
+		note("Lists: no bulleted lists found.")
+	} else if count*4 >= total*3 {
+		note("Lists: %d of %d bullets are %q.", count, total, string(marker))
+		steps = append(steps, "mdlist -bullet "+string(marker))
+	} else {
+		note("Lists: bullets are mixed (%s); no step.", s.bulletCounts())
+	}
+
+	// Links: mdref numbers references, and mdinline removes them.
+	switch references := s.numbered + s.labeled; {
+	case s.inline == 0 && references == 0:
+		note("Links: none found.")
+	case references == 0:
+		note("Links: all %d are inline.", s.inline)
+		steps = append(steps, "mdinline")
+	case s.inline == 0 && s.labeled == 0:
+		note("Links: all %d are numbered references.", s.numbered)
+		steps = append(steps, "mdref")
+	case s.inline == 0:
+		note("Links: references with their own labels, which mdref would")
+		note("renumber; no step.")
+	default:
+		note("Links: %d inline and %d by reference; no step. Add mdref to", s.inline, references)
+		note("number them all as references, or mdinline to write them inline.")
+	}
+
+	// Footnotes: mdfnt numbers them in order.
+	switch {
+	case s.footnotes == 0:
+		note("Footnotes: none found.")
+	case s.namedFootnotes == 0:
+		note("Footnotes: %d, all numbered.", s.footnotes)
+		steps = append(steps, "mdfnt")
+	default:
+		note("Footnotes: %d, %d with their own labels, which mdfnt would", s.footnotes, s.namedFootnotes)
+		note("renumber; no step.")
+	}
+
+	// Paragraphs: the wrapping step goes last, after the steps that change
+	// the length of lines.
+	switch total := s.wrapped + s.sentences + s.unwrapped; {
+	case total == 0:
+		note("Paragraphs: none long enough to tell how they're wrapped.")
+	case s.wrapped*3 >= total*2 && s.width > 0:
+		note("Paragraphs: %d of %d are hard wrapped, at most %d characters wide.", s.wrapped, total, s.width)
+		steps = append(steps, "mdwrap -c "+strconv.Itoa(s.width))
+	case s.sentences*3 >= total*2:
+		note("Paragraphs: %d of %d are one sentence per line.", s.sentences, total)
+		steps = append(steps, "mdsplit")
+	case s.unwrapped*3 >= total*2:
+		note("Paragraphs: %d of %d are on one line.", s.unwrapped, total)
+		steps = append(steps, "mdunwrap")
+	default:
+		note("Paragraphs: %d hard wrapped, %d one sentence per line, and %d on", s.wrapped, s.sentences, s.unwrapped)
+		note("one line; no step. Add mdwrap, mdsplit, or mdunwrap to choose.")
+	}
+
+	var files []string
+	for _, ext := range []string{".md", ".markdown"} {
+		if s.extensions[ext] {
+			files = append(files, "*"+ext)
+		}
+	}
+	fmt.Fprintf(&b, "\n[pipe]\nfiles = %s\nsteps = %s\n", tomlList(files), tomlList(steps))
+	return b.String()
+}
+
+// bullet returns the most common bullet marker, how many items use it, and
+// how many bulleted items there are.
+func (s *survey) bullet() (marker byte, count, total int) {
+	for _, m := range []byte("-*+") {
+		if s.bullets[m] > count {
+			marker, count = m, s.bullets[m]
+		}
+		total += s.bullets[m]
+	}
+	return marker, count, total
+}
+
+// bulletCounts lists the bullet markers in use with their counts.
+func (s *survey) bulletCounts() string {
+	var counts []string
+	for m, count := range s.bullets {
+		counts = append(counts, fmt.Sprintf("%d %q", count, string(m)))
+	}
+	sort.Strings(counts)
+	return strings.Join(counts, ", ")
+}
+
+// tomlList writes list as a TOML array of strings.
+func tomlList(list []string) string {
+	quoted := make([]string, len(list))
+	for i, s := range list {
+		quoted[i] = strconv.Quote(s)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+// isNumber reports whether label is a number, as mdref and mdfnt write them.
+func isNumber(label string) bool {
+	_, err := strconv.Atoi(label)
+	return err == nil
+}
+
+// plural returns one if n is 1, and many otherwise.
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
@@ -0,0 +1,83 @@
+// mdtools hooks the md-tools suite into git and editors. It is not a
+// transform: each command connects git, or a long-running client, to the
+// single-purpose tools.
+//
+// Usage:
+//
+//	mdtools merge-driver %O %A %B    # three-way merge of Markdown prose
+//	mdtools normalize file.md         # canonical form for git diff textconv
+//	mdtools pipe -w *.md              # run the pipeline in .mdtools.toml
+//	mdtools install-hooks -drivers    # set all of the above up in a repository
+//	mdtools server -socket md.sock    # run the tools for editors over JSON
+//	mdtools doctor notes/a.md         # explain how a file will be formatted
+//	mdtools init docs                 # write a .mdtools.toml that fits docs/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/config"
+)
+
+var flags = cli.RegisterVersionFlags()
+
+// command is an mdtools subcommand. It returns the exit status: 0 for
+// success, and 1 for a result the caller must act on (such as conflicts).
+type command struct {
+	summary string
+	run     func(args []string) (int, error)
+}
+
+var commands = map[string]command{
+	"doctor":        {"report the configuration, versions, and settings that decide how a file is formatted", doctorCommand},
+	"init":          {"write a " + config.FileName + " whose pipeline keeps the conventions the Markdown files follow", initCommand},
+	"install-hooks": {"install a pre-commit hook that checks Markdown against .mdtools.toml", installHooks},
+	"merge-driver":  {"merge Markdown sentence by sentence, for git's merge.<driver>.driver", mergeDriver},
+	"normalize":     {"print Markdown in a canonical form, for git's diff.<driver>.textconv", normalizeCommand},
+	"pipe":          {"run files through the pipeline in .mdtools.toml", pipeCommand},
+	"server":        {"run the tools on JSON requests from stdin or a unix socket", serverCommand},
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flags.PrintVersion("mdtools") {
+		return
+	}
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	name := flag.Arg(0)
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "mdtools: unknown command %q\n", name)
+		usage()
+		os.Exit(2)
+	}
+	status, err := cmd.run(flag.Args()[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mdtools %s: %v\n", name, err)
+		os.Exit(2)
+	}
+	os.Exit(status)
+}
+
+// usage lists the commands.
+func usage() {
+	w := flag.CommandLine.Output()
+	fmt.Fprintf(w, "Usage: mdtools <command> [arguments]\n\nCommands:\n")
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-14s  %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintf(w, "\nRun 'mdtools <command> -h' for a command's flags.\n")
+}
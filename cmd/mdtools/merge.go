@@ -0,0 +1,152 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dbh/md-tools/internal/diff"
+	"github.com/dbh/md-tools/internal/markdown"
+)
+
+// mergeDriver merges the changes from the base %O to theirs %B into ours %A,
+// writing the result to %A as git's merge drivers must. It exits 1 when the
+// result has conflicts.
+func mergeDriver(args []string) (int, error) {
+	fs := flag.NewFlagSet("mdtools merge-driver", flag.ExitOnError)
+	markerSize := fs.Int("marker-size", 7, "conflict marker `length` (git's %L)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: mdtools merge-driver [-marker-size n] base ours theirs\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 3 {
+		fs.Usage()
+		return 2, fmt.Errorf("want base, ours, and theirs files, got %d arguments", fs.NArg())
+	}
+	var content [3]string
+	for i, path := range fs.Args() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return 2, err
+		}
+		content[i] = string(data)
+	}
+	merged, conflicts := mergeMarkdown(content[0], content[1], content[2], *markerSize)
+	if err := os.WriteFile(fs.Arg(1), []byte(merged), 0644); err != nil {
+		return 2, err
+	}
+	if conflicts > 0 {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// mergeMarkdown merges the changes from base to theirs into ours and returns
+// the result with its number of conflicts. Paragraphs are compared one
+// sentence per line, so rewrapping a paragraph on one side doesn't conflict
+// with editing it on the other. When only one side changed its sentences, that
+// side is returned as it was written; otherwise the merge is written one
+// sentence per line, as mdsplit does.
+func mergeMarkdown(base, ours, theirs string, markerSize int) (string, int) {
+	switch {
+	case ours == theirs || theirs == base:
+		return ours, 0
+	case ours == base:
+		return theirs, 0
+	}
+	o := markdown.SentencePerLine(base)
+	a := markdown.SentencePerLine(ours)
+	b := markdown.SentencePerLine(theirs)
+	switch {
+	case a == b || b == o:
+		return ours, 0
+	case a == o:
+		return theirs, 0
+	}
+	lines, conflicts := merge3(diff.SplitLines(o), diff.SplitLines(a), diff.SplitLines(b), markerSize)
+	return strings.Join(lines, "\n") + "\n", conflicts
+}
+
+// merge3 merges the changes from o to b into a, line by line. Where both
+// sides changed the same or touching lines differently, the result has both
+// between conflict markers.
+func merge3(o, a, b []string, markerSize int) ([]string, int) {
+	ha, hb := diff.Lines(o, a), diff.Lines(o, b)
+	var out []string
+	conflicts := 0
+	pos := 0       // next line of o to copy
+	da, db := 0, 0 // offset of a and b lines from o lines outside hunks
+	i, j := 0, 0
+	for i < len(ha) || j < len(hb) {
+		// The chunk o[lo:hi] takes every hunk on either side that overlaps
+		// it, or touches it when one of them only inserts.
+		lo := len(o)
+		if i < len(ha) {
+			lo = ha[i].AStart
+		}
+		if j < len(hb) {
+			lo = min(lo, hb[j].AStart)
+		}
+		hi := lo
+		ia, jb := i, j
+		for grew := true; grew; {
+			grew = false
+			if i < len(ha) && touches(ha[i], lo, hi) {
+				hi = max(hi, ha[i].AEnd)
+				i++
+				grew = true
+			}
+			if j < len(hb) && touches(hb[j], lo, hi) {
+				hi = max(hi, hb[j].AEnd)
+				j++
+				grew = true
+			}
+		}
+		out = append(out, o[pos:lo]...)
+		aLo, bLo := lo+da, lo+db
+		for _, h := range ha[ia:i] {
+			da += (h.BEnd - h.BStart) - (h.AEnd - h.AStart)
+		}
+		for _, h := range hb[jb:j] {
+			db += (h.BEnd - h.BStart) - (h.AEnd - h.AStart)
+		}
+		ours, theirs := a[aLo:hi+da], b[bLo:hi+db]
+		switch {
+		case ia == i:
+			out = append(out, theirs...)
+		case jb == j || equal(ours, theirs):
+			out = append(out, ours...)
+		default:
+			conflicts++
+			out = append(out, strings.Repeat("<", markerSize)+" ours")
+			out = append(out, ours...)
+			out = append(out, strings.Repeat("=", markerSize))
+			out = append(out, theirs...)
+			out = append(out, strings.Repeat(">", markerSize)+" theirs")
+		}
+		pos = hi
+	}
+	out = append(out, o[pos:]...)
+	return out, conflicts
+}
+
+// touches reports whether hunk h overlaps the chunk o[lo:hi], or meets it
+// when either of them is an insertion.
+func touches(h diff.Hunk, lo, hi int) bool {
+	return h.AStart < hi || h.AStart == hi && (lo == hi || h.AStart == h.AEnd)
+}
+
+// equal reports whether a and b hold the same lines.
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/dbh/md-tools/internal/markdown"
+	"github.com/dbh/md-tools/internal/markdown/links"
+)
+
+// normalizeCommand writes a file, or stdin, in the canonical form of
+// normalize, for git's diff.<driver>.textconv.
+func normalizeCommand(args []string) (int, error) {
+	fs := flag.NewFlagSet("mdtools normalize", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: mdtools normalize [file]\n")
+	}
+	fs.Parse(args)
+	var data []byte
+	var err error
+	switch fs.NArg() {
+	case 0:
+		data, err = io.ReadAll(os.Stdin)
+	case 1:
+		data, err = os.ReadFile(fs.Arg(0))
+	default:
+		fs.Usage()
+		return 2, fmt.Errorf("want at most one file, got %d", fs.NArg())
+	}
+	if err != nil {
+		return 2, err
+	}
+	_, err = io.WriteString(os.Stdout, normalize(string(data)))
+	return 0, err
+}
+
+// normalize rewrites content so that edits which don't change what it says
+// don't change it either: reference links become inline links, as mdinline
+// writes them, and paragraphs are joined and split one sentence per line, as
+// mdjoin and mdsplit write them.
+func normalize(content string) string {
+	return markdown.SentencePerLine(links.Inline(content, false))
+}
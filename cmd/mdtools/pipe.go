@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/config"
+	"github.com/dbh/md-tools/internal/plugin"
+)
+
+// pipeCommand runs files, or stdin, through the pipeline in .mdtools.toml.
+func pipeCommand(args []string) (int, error) {
+	fs := flag.NewFlagSet("mdtools pipe", flag.ExitOnError)
+	write := fs.Bool("w", false, "write the result to each file instead of stdout")
+	check := fs.Bool("check", false, "list files the pipeline would change and exit 1, without writing")
+	staged := fs.Bool("staged", false, "run on the Markdown files staged in git, as the pre-commit hook does")
+	configPath := fs.String("config", "", "configuration `file` (default: the nearest "+config.FileName+")")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: mdtools pipe [-w | -check] [-staged] [file...]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *write && *check {
+		return 2, fmt.Errorf("-w and -check are mutually exclusive")
+	}
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return 2, err
+	}
+	if len(cfg.Steps) == 0 {
+		return 2, fmt.Errorf("%s: pipe.steps is empty", cfg.Path)
+	}
+
+	files, err := cli.ExpandArgs(fs.Args())
+	if err != nil {
+		return 2, err
+	}
+	read := os.ReadFile
+	if *staged {
+		if len(files) > 0 {
+			return 2, fmt.Errorf("-staged takes no file arguments")
+		}
+		if !*write && !*check {
+			return 2, fmt.Errorf("-staged requires -w or -check")
+		}
+		if files, err = stagedFiles(cfg); err != nil {
+			return 2, err
+		}
+		if *check {
+			// Check what is being committed, not the working tree.
+			read = readStaged
+		}
+	}
+
+	if len(files) == 0 && !*staged {
+		if *write || *check {
+			return 2, fmt.Errorf("-w and -check require file arguments")
+		}
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return 2, err
+		}
+		out, err := runPipeline(cfg, "", string(data))
+		if err != nil {
+			return 2, err
+		}
+		_, err = io.WriteString(os.Stdout, out)
+		return 0, err
+	}
+
+	stale := 0
+	for _, file := range files {
+		data, err := read(file)
+		if err != nil {
+			return 2, err
+		}
+		out, err := runPipeline(cfg, file, string(data))
+		if err != nil {
+			return 2, fmt.Errorf("%s: %w", file, err)
+		}
+		switch {
+		case *check:
+			if out != string(data) {
+				fmt.Println(file)
+				stale++
+			}
+		case *write:
+			if out != string(data) {
+				if err := os.WriteFile(file, []byte(out), 0644); err != nil {
+					return 2, err
+				}
+			}
+		default:
+			if _, err := io.WriteString(os.Stdout, out); err != nil {
+				return 2, err
+			}
+		}
+	}
+	if stale > 0 {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// loadConfig loads the configuration file at p, or the nearest one when p is
+// empty.
+func loadConfig(p string) (*config.Config, error) {
+	if p == "" {
+		var err error
+		if p, err = config.Find("."); err != nil {
+			return nil, err
+		}
+	}
+	return config.Load(p)
+}
+
+// runPipeline pipes content, read from path, through each step of cfg in
+// turn. A step is a command or plugin name and its arguments, separated by
+// spaces.
+func runPipeline(cfg *config.Config, path, content string) (string, error) {
+	for _, step := range cfg.Steps {
+		fields := strings.Fields(step)
+		if len(fields) == 0 {
+			return "", fmt.Errorf("empty pipeline step")
+		}
+		if p, ok := cfg.Plugins[fields[0]]; ok {
+			out, err := plugin.Run(toolPath(p.Command), p.Args, plugin.Request{
+				Path:    path,
+				Content: content,
+				Args:    fields[1:],
+				Options: p.Options,
+			})
+			if err != nil {
+				return "", fmt.Errorf("%s: %w", step, err)
+			}
+			content = out
+			continue
+		}
+		cmd := exec.Command(toolPath(fields[0]), fields[1:]...)
+		cmd.Stdin = strings.NewReader(content)
+		var out bytes.Buffer
+		cmd.Stdout = &out
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return "", fmt.Errorf("%s: %w", step, err)
+		}
+		content = out.String()
+	}
+	return content, nil
+}
+
+// toolPath returns the path of the tool name: the one installed next to
+// mdtools if there is one, so that the suite's tools match its version, and
+// otherwise name, to be found in $PATH.
+func toolPath(name string) string {
+	if strings.ContainsRune(name, os.PathSeparator) {
+		return name
+	}
+	if exe, err := os.Executable(); err == nil {
+		p := filepath.Join(filepath.Dir(exe), name)
+		if info, err := os.Stat(p); err == nil && !info.IsDir() {
+			return p
+		}
+	}
+	return name
+}
+
+// stagedFiles returns the files added, copied, modified, or renamed in the
+// git index that the pipeline applies to, relative to the current directory.
+func stagedFiles(cfg *config.Config) ([]string, error) {
+	root, err := git("rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	out, err := git("-C", root, "diff", "--cached", "--name-only", "--diff-filter=ACMR", "-z")
+	if err != nil {
+		return nil, err
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, name := range strings.Split(out, "\x00") {
+		if name == "" || !cfg.Matches(name) {
+			continue
+		}
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if rel, err := filepath.Rel(wd, p); err == nil {
+			p = rel
+		}
+		files = append(files, p)
+	}
+	return files, nil
+}
+
+// readStaged returns the content of file in the git index.
+func readStaged(file string) ([]byte, error) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return nil, err
+	}
+	root, err := git("rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	rel, err := filepath.Rel(root, abs)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command("git", "-C", root, "show", ":"+filepath.ToSlash(rel))
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, gitError(err)
+	}
+	return out, nil
+}
+
+// git runs git with args and returns its output without the final newline.
+func git(args ...string) (string, error) {
+	out, err := exec.Command("git", args...).Output()
+	if err != nil {
+		return "", gitError(err)
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+// gitError adds what git printed to err.
+func gitError(err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+		return fmt.Errorf("git: %s", strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return err
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/dbh/md-tools/internal/tools"
+)
+
+// serverRequest asks for content to be run through a tool, configured by
+// options as if they were its flags: {"tool": "wrap", "options": {"c": 72}}.
+// The id, if any, is copied to the response.
+type serverRequest struct {
+	ID      json.RawMessage `json:"id,omitempty"`
+	Tool    string          `json:"tool"`
+	Content string          `json:"content"`
+	Options map[string]any  `json:"options,omitempty"`
+}
+
+// serverResponse carries either the transformed content or an error.
+type serverResponse struct {
+	ID      json.RawMessage `json:"id,omitempty"`
+	Content *string         `json:"content,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// serverCommand answers transform requests on stdin, or on a unix socket,
+// until the input ends, so editors and build daemons can run the tools
+// without starting a process per file.
+func serverCommand(args []string) (int, error) {
+	fs := flag.NewFlagSet("mdtools server", flag.ExitOnError)
+	socket := fs.String("socket", "", "listen on the unix socket at `path` instead of stdin and stdout")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: mdtools server [-socket path]\n\n")
+		fmt.Fprintf(fs.Output(), "Each line of input is a JSON request, or an array of them, such as\n")
+		fmt.Fprintf(fs.Output(), "  {\"id\": 1, \"tool\": \"wrap\", \"content\": \"...\", \"options\": {\"c\": 72}}\n")
+		fmt.Fprintf(fs.Output(), "and gets one line of output: {\"id\": 1, \"content\": \"...\"} or {\"id\": 1, \"error\": \"...\"}.\n")
+		fmt.Fprintf(fs.Output(), "Tools: %s\n\n", strings.Join(tools.Names(), ", "))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return 2, fmt.Errorf("unexpected arguments %q", fs.Args())
+	}
+	if *socket == "" {
+		return 0, serve(os.Stdin, os.Stdout)
+	}
+	return 0, listen(*socket)
+}
+
+// listen serves each connection to the unix socket at path concurrently,
+// until the process is interrupted. A socket left behind by an earlier
+// server is replaced.
+func listen(path string) error {
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-interrupt
+		l.Close()
+	}()
+	defer os.Remove(path)
+	for {
+		conn, err := l.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			if err := serve(conn, conn); err != nil {
+				fmt.Fprintf(os.Stderr, "mdtools server: %v\n", err)
+			}
+		}()
+	}
+}
+
+// serve answers each line of r with a line on w.
+func serve(r io.Reader, w io.Writer) error {
+	br := bufio.NewReader(r)
+	bw := bufio.NewWriter(w)
+	for {
+		line, err := br.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			out, merr := json.Marshal(answer(line))
+			if merr != nil {
+				return merr
+			}
+			bw.Write(append(out, '\n'))
+			if ferr := bw.Flush(); ferr != nil {
+				return ferr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// answer returns the response to a request line: a response for a single
+// request, or an array of them for an array of requests.
+func answer(line []byte) any {
+	if line[0] == '[' {
+		var batch []serverRequest
+		if err := json.Unmarshal(line, &batch); err != nil {
+			return serverResponse{Error: err.Error()}
+		}
+		responses := make([]serverResponse, len(batch))
+		for i, req := range batch {
+			responses[i] = handle(req)
+		}
+		return responses
+	}
+	var req serverRequest
+	if err := json.Unmarshal(line, &req); err != nil {
+		return serverResponse{Error: err.Error()}
+	}
+	return handle(req)
+}
+
+// handle runs one request. A tool that panics fails its request, not the
+// server.
+func handle(req serverRequest) (resp serverResponse) {
+	resp.ID = req.ID
+	defer func() {
+		if r := recover(); r != nil {
+			resp.Content = nil
+			resp.Error = fmt.Sprintf("%s: %v", req.Tool, r)
+		}
+	}()
+	transform, err := tools.New(req.Tool, req.Options)
+	if err != nil {
+		resp.Error = err.Error()
+		return resp
+	}
+	out := transform(req.Content)
+	resp.Content = &out
+	return resp
+}
@@ -0,0 +1,45 @@
+// mdtorst converts Markdown to reStructuredText, so Markdown contributions
+// can join a Sphinx project.
+//
+// Usage:
+//
+//	mdtorst [file...]
+//	cat file.md | mdtorst > file.rst
+//
+// Headings are underlined with = - ~ ^ " ' by level. Links become anonymous
+// hyperlinks (`text <url>`__), images become image directives, fenced code
+// becomes a code-block directive (or a :: literal block without a language),
+// tables become list-table directives, footnotes become auto-numbered
+// footnotes ([#label]_), and HTML blocks become raw directives. Simple
+// "key: value" frontmatter becomes a field list.
+//
+// reST inline markup can't nest, so markup inside emphasis or a link is
+// reduced to its text, as are strikethrough and inline HTML, which reST has
+// no syntax for.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/tools/mdtorst"
+)
+
+var (
+	flags = cli.RegisterFlags()
+	setup = mdtorst.Flags(flag.CommandLine)
+)
+
+func main() {
+	flag.Parse()
+	transform, err := setup()
+	if err == nil {
+		err = cli.Run("mdtorst", flags, flag.Args(), transform)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mdtorst: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,39 @@
+// mdunattr removes Pandoc and kramdown attribute blocks ({#id .class key=val})
+// from Markdown, for renderers that don't understand them.
+//
+// Usage:
+//
+//	mdunattr [file...]
+//	cat file.md | mdunattr
+//	mdunattr -w file.md    # modify file in place
+//
+// It removes trailing heading attributes, span attributes such as
+// [text]{.mark} (keeping the text), and kramdown {: ...} lines. Code is left
+// alone.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/tools/mdunattr"
+)
+
+var (
+	flags = cli.RegisterFlags()
+	setup = mdunattr.Flags(flag.CommandLine)
+)
+
+func main() {
+	flag.Parse()
+	transform, err := setup()
+	if err == nil {
+		err = cli.Run("mdunattr", flags, flag.Args(), transform)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mdunattr: %v\n", err)
+		os.Exit(1)
+	}
+}
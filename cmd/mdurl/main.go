@@ -0,0 +1,43 @@
+// mdurl normalizes the URLs of links: it strips tracking parameters, upgrades
+// http to https for hosts known to serve it, and optionally resolves
+// redirects and canonicalizes trailing slashes.
+//
+// Usage:
+//
+//	mdurl [file...]
+//	cat file.md | mdurl
+//	mdurl -https example.org file.md   # also upgrade these hosts to https
+//	mdurl -slash strip file.md         # drop trailing slashes from paths
+//	mdurl -resolve file.md             # replace redirecting URLs with their target
+//	mdurl -report file.md              # list rewritten URLs on stderr
+//	mdurl -w file.md                   # modify file in place
+//
+// Only link, image, and autolink destinations are rewritten; URLs in code and
+// plain text are left alone.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/tools/mdurl"
+)
+
+var (
+	flags = cli.RegisterFlags()
+	setup = mdurl.Flags(flag.CommandLine)
+)
+
+func main() {
+	flag.Parse()
+	transform, err := setup()
+	if err == nil {
+		err = cli.Run("mdurl", flags, flag.Args(), transform)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mdurl: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,827 @@
+package fixtures_test
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTree creates files (relative path → content) under a new temp dir and
+// returns its path.
+func writeTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for rel, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// readTree returns the content of a file under root.
+func readTree(t *testing.T, root, rel string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(rel)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// TestBacklinks verifies mdbacklinks adds, updates, and removes the generated
+// section, ignores links in code blocks, and is stable on a second run.
+func TestBacklinks(t *testing.T) {
+	binary := buildTool(t, "mdbacklinks")
+	root := writeTree(t, map[string]string{
+		"alpha.md":    "# Alpha\n\nSee [beta](sub/beta.md) and [gamma](gamma).\n",
+		"sub/beta.md": "# Beta\n\nBack to [alpha](../alpha.md#top).\n",
+		"gamma.md":    "Gamma.\n\n```\n[not a link](alpha.md)\n```\n",
+	})
+
+	if out, err := exec.Command(binary, root).CombinedOutput(); err != nil {
+		t.Fatalf("mdbacklinks failed: %v\n%s", err, out)
+	}
+
+	wantBeta := "# Beta\n\nBack to [alpha](../alpha.md#top).\n\n<!-- backlinks -->\n## Backlinks\n\n- [Alpha](../alpha.md)\n<!-- /backlinks -->\n"
+	if got := readTree(t, root, "sub/beta.md"); got != wantBeta {
+		t.Errorf("sub/beta.md:\n--- expected\n%s\n--- actual\n%s", wantBeta, got)
+	}
+	if got := readTree(t, root, "alpha.md"); !strings.Contains(got, "- [Beta](sub/beta.md)\n") || strings.Contains(got, "gamma.md)") {
+		t.Errorf("alpha.md should list only beta (code block links ignored):\n%s", got)
+	}
+
+	// A second run is a no-op, so -check passes.
+	if out, err := exec.Command(binary, "-check", root).CombinedOutput(); err != nil {
+		t.Errorf("expected -check to pass after update: %v\n%s", err, out)
+	}
+
+	// Removing gamma's only inbound link removes its section (alpha.md is
+	// also stale, having been rewritten without its own section).
+	if err := os.WriteFile(filepath.Join(root, "alpha.md"), []byte("# Alpha\n\nSee [beta](sub/beta.md).\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command(binary, "-check", root).Output()
+	if err == nil {
+		t.Fatalf("expected -check to fail when gamma.md is stale")
+	}
+	if got := strings.Fields(string(out)); len(got) != 2 || got[0] != "alpha.md" || got[1] != "gamma.md" {
+		t.Errorf("expected -check to list alpha.md and gamma.md, got %q", out)
+	}
+	if out, err := exec.Command(binary, root).CombinedOutput(); err != nil {
+		t.Fatalf("mdbacklinks failed: %v\n%s", err, out)
+	}
+	if got, want := readTree(t, root, "gamma.md"), "Gamma.\n\n```\n[not a link](alpha.md)\n```\n"; got != want {
+		t.Errorf("gamma.md:\n--- expected\n%s\n--- actual\n%s", want, got)
+	}
+
+	// A title with brackets and a file name with a space still make a link.
+	root = writeTree(t, map[string]string{
+		"my note.md": "# Alpha [x]\n\nSee [beta](beta.md).\n",
+		"beta.md":    "# Beta\n",
+	})
+	if out, err := exec.Command(binary, root).CombinedOutput(); err != nil {
+		t.Fatalf("mdbacklinks failed: %v\n%s", err, out)
+	}
+	wantBeta = "# Beta\n\n<!-- backlinks -->\n## Backlinks\n\n- [Alpha \\[x\\]](<my note.md>)\n<!-- /backlinks -->\n"
+	if got := readTree(t, root, "beta.md"); got != wantBeta {
+		t.Errorf("beta.md:\n--- expected\n%s\n--- actual\n%s", wantBeta, got)
+	}
+	if out, err := exec.Command(binary, "-check", root).CombinedOutput(); err != nil {
+		t.Errorf("expected -check to pass after update: %v\n%s", err, out)
+	}
+}
+
+// TestGraphAfterBacklinks verifies that mdgraph leaves out the links
+// mdbacklinks generates, and the heading of their section.
+func TestGraphAfterBacklinks(t *testing.T) {
+	backlinks := buildTool(t, "mdbacklinks")
+	graph := buildTool(t, "mdgraph")
+	root := writeTree(t, map[string]string{
+		"a.md": "# A\n\nSee [b](b.md).\n",
+		"b.md": "# B\n",
+	})
+	if out, err := exec.Command(backlinks, root).CombinedOutput(); err != nil {
+		t.Fatalf("mdbacklinks failed: %v\n%s", err, out)
+	}
+
+	out, err := exec.Command(graph, "-format", "json", "-headings", root).Output()
+	if err != nil {
+		t.Fatalf("mdgraph failed: %v", err)
+	}
+	var g struct {
+		Nodes []struct{ Label string }
+		Edges []struct {
+			From, To, Type string
+			Count          int
+		}
+	}
+	if err := json.Unmarshal(out, &g); err != nil {
+		t.Fatal(err)
+	}
+	var links []string
+	for _, e := range g.Edges {
+		if e.Type == "link" {
+			links = append(links, e.From+" -> "+e.To+" "+strconv.Itoa(e.Count))
+		}
+	}
+	if len(links) != 1 || links[0] != "a.md -> b.md 1" {
+		t.Errorf("expected only the link a.md -> b.md, once, got %q", links)
+	}
+	for _, n := range g.Nodes {
+		if n.Label == "Backlinks" {
+			t.Errorf("expected no node for the generated Backlinks heading")
+		}
+	}
+}
+
+// TestOrphansAfterBacklinks verifies that the links mdbacklinks generates
+// don't count as inbound links for mdorphans.
+func TestOrphansAfterBacklinks(t *testing.T) {
+	backlinks := buildTool(t, "mdbacklinks")
+	orphans := buildTool(t, "mdorphans")
+	root := writeTree(t, map[string]string{
+		"a.md":      "# A\n\nSee [lonely](lonely.md).\n",
+		"lonely.md": "# Lonely\n",
+	})
+	if out, err := exec.Command(backlinks, root).CombinedOutput(); err != nil {
+		t.Fatalf("mdbacklinks failed: %v\n%s", err, out)
+	}
+	if got := readTree(t, root, "lonely.md"); !strings.Contains(got, "- [A](a.md)") {
+		t.Fatalf("expected a backlink to a.md in lonely.md:\n%s", got)
+	}
+
+	out, err := exec.Command(orphans, root).Output()
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 1 {
+		t.Fatalf("expected exit status 1, got %v", err)
+	}
+	if want := "a.md: orphan (no inbound links)\n"; string(out) != want {
+		t.Errorf("report:\n--- expected\n%s\n--- actual\n%s", want, out)
+	}
+}
+
+// TestGraph verifies mdgraph's DOT output and that -headings routes links with
+// a matching #fragment to the heading node.
+func TestGraph(t *testing.T) {
+	binary := buildTool(t, "mdgraph")
+	root := writeTree(t, map[string]string{
+		"a.md":     "# Alpha\n\nSee [b](sub/b.md#usage), [c](c), and [ext](https://example.com).\n",
+		"sub/b.md": "# Beta\n\n## Usage\n\nBack to [a](../a.md) and [missing](nope.md).\n",
+		"c.md":     "Gamma.\n",
+	})
+
+	out, err := exec.Command(binary, root).Output()
+	if err != nil {
+		t.Fatalf("mdgraph failed: %v", err)
+	}
+	want := `digraph links {
+  "a.md" [label="Alpha", shape=box];
+  "c.md" [label="c", shape=box];
+  "sub/b.md" [label="Beta", shape=box];
+  "a.md" -> "c.md";
+  "a.md" -> "sub/b.md";
+  "sub/b.md" -> "a.md";
+}
+`
+	if string(out) != want {
+		t.Errorf("dot output:\n--- expected\n%s\n--- actual\n%s", want, out)
+	}
+
+	out, err = exec.Command(binary, "-format", "json", "-headings", root).Output()
+	if err != nil {
+		t.Fatalf("mdgraph -format json failed: %v", err)
+	}
+	var g struct {
+		Edges []struct{ From, To, Type string }
+	}
+	if err := json.Unmarshal(out, &g); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out)
+	}
+	found := false
+	for _, e := range g.Edges {
+		if e.From == "a.md" && e.To == "sub/b.md#usage" && e.Type == "link" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected link edge a.md -> sub/b.md#usage, got %+v", g.Edges)
+	}
+
+	if err := exec.Command(binary, "-format", "svg", root).Run(); err == nil {
+		t.Errorf("expected an unknown -format to fail")
+	}
+}
+
+// TestOrphans verifies mdorphans reports orphans and dangling links and uses
+// exit status 1 for findings and 0 for a clean tree.
+func TestOrphans(t *testing.T) {
+	binary := buildTool(t, "mdorphans")
+	root := writeTree(t, map[string]string{
+		"README.md":  "# Home\n\nSee [a](a.md) and [img](img.png).\n",
+		"a.md":       "# A\n\n## Setup\n\n[Home](README.md), [setup](#setup), [gone](gone.md),\nand [bad anchor](README.md#nope).\n",
+		"lonely.md":  "Nobody links here, [except itself](lonely.md).\n",
+		"img.png":    "",
+		"code.md":    "[a](a.md)\n\n    [ignored](missing.md)\n",
+		"sub/ext.md": "[ext](https://example.com/missing.md) [code](../code.md)\n",
+	})
+
+	cmd := exec.Command(binary, root)
+	out, err := cmd.Output()
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 1 {
+		t.Fatalf("expected exit status 1, got %v", err)
+	}
+	want := "a.md:5: dangling link to gone.md\n" +
+		"a.md:6: dangling link to README.md#nope (no such heading)\n" +
+		"lonely.md: orphan (no inbound links)\n" +
+		"sub/ext.md: orphan (no inbound links)\n"
+	if string(out) != want {
+		t.Errorf("report:\n--- expected\n%s\n--- actual\n%s", want, out)
+	}
+
+	// -output rdjson reports the same problems for reviewdog.
+	out, err = exec.Command(binary, "-output", "rdjson", root).Output()
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 1 {
+		t.Fatalf("expected exit status 1 with -output rdjson, got %v", err)
+	}
+	var result struct {
+		Source      struct{ Name string }
+		Diagnostics []struct {
+			Message  string
+			Location struct {
+				Path  string
+				Range *struct{ Start struct{ Line int } }
+			}
+		}
+	}
+	if err := json.Unmarshal(out, &result); err != nil {
+		t.Fatalf("invalid rdjson: %v\n%s", err, out)
+	}
+	var got []string
+	for _, d := range result.Diagnostics {
+		rel, _ := filepath.Rel(root, d.Location.Path)
+		line := 0
+		if d.Location.Range != nil {
+			line = d.Location.Range.Start.Line
+		}
+		got = append(got, filepath.ToSlash(rel)+":"+strconv.Itoa(line)+": "+d.Message)
+	}
+	wantRD := []string{
+		"a.md:5: dangling link to gone.md",
+		"a.md:6: dangling link to README.md#nope (no such heading)",
+		"lonely.md:0: orphan (no inbound links)",
+		"sub/ext.md:0: orphan (no inbound links)",
+	}
+	if result.Source.Name != "mdorphans" || strings.Join(got, "\n") != strings.Join(wantRD, "\n") {
+		t.Errorf("rdjson report:\n--- expected\n%s\n--- actual\n%s", strings.Join(wantRD, "\n"), out)
+	}
+
+	clean := writeTree(t, map[string]string{
+		"index.md": "[a](a.md)\n",
+		"a.md":     "[home](index.md)\n",
+	})
+	if out, err := exec.Command(binary, clean).CombinedOutput(); err != nil {
+		t.Errorf("expected clean tree to pass: %v\n%s", err, out)
+	}
+}
+
+// TestSchema verifies mdschema reports each field that doesn't match the
+// schema with its line and key path, checks files without frontmatter as
+// having no fields, and reports frontmatter it can't parse.
+func TestSchema(t *testing.T) {
+	binary := buildTool(t, "mdschema")
+	root := writeTree(t, map[string]string{
+		"schema.json": `{
+  "type": "object",
+  "required": ["title"],
+  "additionalProperties": false,
+  "properties": {
+    "title": {"type": "string", "minLength": 1},
+    "date": {"type": "string", "format": "date"},
+    "tags": {"type": "array", "items": {"type": "string"}, "uniqueItems": true},
+    "status": {"enum": ["draft", "published"]},
+    "author": {"$ref": "#/$defs/author"}
+  },
+  "$defs": {
+    "author": {"type": "object", "required": ["name"], "properties": {"name": {"type": "string"}}}
+  }
+}`,
+		"good.md":     "---\ntitle: Good\ndate: 2024-01-02\ntags: [a, b]\nauthor: {name: Ann}\n---\n# Good\n",
+		"bad.md":      "---\ntitle: 3\ndate: 2024-13-02\ntags:\n  - a\n  - 4\nstatus: wip\nauthor:\n  email: ann@example.com\n\"my key\": 1\n---\n",
+		"sub/none.md": "# No frontmatter\n",
+		"broken.md":   "---\ntitle: [unclosed\n---\n",
+	})
+
+	out, err := exec.Command(binary, "-schema", filepath.Join(root, "schema.json"), root).Output()
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 1 {
+		t.Fatalf("expected exit status 1, got %v", err)
+	}
+	want := "bad.md:2: title: expected string, got integer\n" +
+		"bad.md:3: date: must be a valid date\n" +
+		"bad.md:6: tags[1]: expected string, got integer\n" +
+		"bad.md:7: status: must be one of \"draft\" or \"published\"\n" +
+		"bad.md:8: author: missing required field \"name\"\n" +
+		"bad.md:10: [\"my key\"]: unknown field\n" +
+		"broken.md:2: invalid frontmatter: expected ]\n" +
+		"sub/none.md:1: missing required field \"title\"\n"
+	if string(out) != want {
+		t.Errorf("report:\n--- expected\n%s\n--- actual\n%s", want, out)
+	}
+
+	if out, err := exec.Command(binary, "-schema", filepath.Join(root, "missing.json"), root).CombinedOutput(); err == nil {
+		t.Errorf("expected a missing schema to fail\n%s", out)
+	}
+}
+
+// TestFnCollect verifies mdfncollect numbers the footnotes of combined
+// documents in one sequence, writes a link definition they share once,
+// renames a label a later document defines differently, and keeps only the
+// first document's frontmatter.
+func TestFnCollect(t *testing.T) {
+	binary := buildTool(t, "mdfncollect")
+	root := writeTree(t, map[string]string{
+		"a.md": "---\ntitle: Book\n---\n# One\n\nText[^note] and [Go][go] and [docs].[^2]\n\n`[^note]` stays.\n\n" +
+			"[^note]: First, with [docs].\n[^2]: Second.\n\n    More.\n\n[go]: https://go.dev\n[docs]: https://example.com/docs\n",
+		"b.md": "---\ntitle: Two\n---\n# Two\n\nAgain[^note] with [Go][go], [docs], and [more][docs].\n\n" +
+			"[^note]: Two's note.\n[^unused]: Never referenced.\n\n[go]: https://go.dev\n[docs]: https://other.example/docs\n",
+	})
+	a, b := filepath.Join(root, "a.md"), filepath.Join(root, "b.md")
+
+	out, err := exec.Command(binary, a, b).Output()
+	if err != nil {
+		t.Fatalf("mdfncollect failed: %v", err)
+	}
+	want := "---\ntitle: Book\n---\n# One\n\nText[^1] and [Go][go] and [docs].[^2]\n\n`[^note]` stays.\n\n" +
+		"# Two\n\nAgain[^3] with [Go][go], [docs][docs-2], and [more][docs-2].\n\n" +
+		"[^1]: First, with [docs].\n[^2]: Second.\n\n    More.\n[^3]: Two's note.\n[^4]: Never referenced.\n\n" +
+		"[go]: https://go.dev\n[docs]: https://example.com/docs\n[docs-2]: https://other.example/docs\n"
+	if string(out) != want {
+		t.Errorf("--- expected\n%s\n--- actual\n%s", want, out)
+	}
+
+	// -defs each puts each document's definitions after it.
+	out, err = exec.Command(binary, "-defs", "each", a, b).Output()
+	if err != nil {
+		t.Fatalf("mdfncollect -defs each failed: %v", err)
+	}
+	want = "---\ntitle: Book\n---\n# One\n\nText[^1] and [Go][go] and [docs].[^2]\n\n`[^note]` stays.\n\n" +
+		"[^1]: First, with [docs].\n[^2]: Second.\n\n    More.\n\n[go]: https://go.dev\n[docs]: https://example.com/docs\n\n" +
+		"# Two\n\nAgain[^3] with [Go][go], [docs][docs-2], and [more][docs-2].\n\n" +
+		"[^3]: Two's note.\n[^4]: Never referenced.\n\n[docs-2]: https://other.example/docs\n"
+	if string(out) != want {
+		t.Errorf("-defs each:\n--- expected\n%s\n--- actual\n%s", want, out)
+	}
+}
+
+// TestRename verifies mdrename moves the file, rewrites inbound links
+// (keeping fragments, style, and code samples), and fixes the moved file's
+// own relative links.
+func TestRename(t *testing.T) {
+	binary := buildTool(t, "mdrename")
+	root := writeTree(t, map[string]string{
+		"a.md": "See [old](old.md), [section](old.md#usage), [bare](old), and [abs](/old.md).\n\n" +
+			"[ref]: old.md \"Old\"\n\n```\n[sample](old.md)\n```\n",
+		"old.md":       "# Old\n\nBack to [a](a.md) or [sibling](sub/c.md) or [self](#old).\n",
+		"sub/c.md":     "[up](../old.md)\n",
+		"unrelated.md": "[other](a.md)\n",
+	})
+
+	cmd := exec.Command(binary, "-root", root, filepath.Join(root, "old.md"), filepath.Join(root, "guide", "new.md"))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("mdrename failed: %v\n%s", err, out)
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "old.md")); err == nil {
+		t.Errorf("old.md should have been moved")
+	}
+	cases := map[string]string{
+		"a.md": "See [old](guide/new.md), [section](guide/new.md#usage), [bare](guide/new), and [abs](/guide/new.md).\n\n" +
+			"[ref]: guide/new.md \"Old\"\n\n```\n[sample](old.md)\n```\n",
+		"guide/new.md": "# Old\n\nBack to [a](../a.md) or [sibling](../sub/c.md) or [self](#old).\n",
+		"sub/c.md":     "[up](../guide/new.md)\n",
+		"unrelated.md": "[other](a.md)\n",
+	}
+	for rel, want := range cases {
+		if got := readTree(t, root, rel); got != want {
+			t.Errorf("%s:\n--- expected\n%s\n--- actual\n%s", rel, want, got)
+		}
+	}
+
+	if err := exec.Command(binary, "-root", root, filepath.Join(root, "a.md"), filepath.Join(root, "sub", "c.md")).Run(); err == nil {
+		t.Errorf("expected renaming onto an existing file to fail")
+	}
+
+	// A new name with a space is bracketed or encoded as the link was
+	// written, and "./" links keep their "./".
+	root = writeTree(t, map[string]string{
+		"a.md":    "[b](./b.md), [plain](b.md), [c](./my%20c.md#top), and [angle](<my c.md>).\n",
+		"b.md":    "[a](./a.md)\n",
+		"my c.md": "# C\n",
+	})
+	for _, names := range [][2]string{{"b.md", "sub/new b.md"}, {"my c.md", "new c.md"}} {
+		cmd := exec.Command(binary, "-root", root, filepath.Join(root, names[0]), filepath.Join(root, names[1]))
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("mdrename failed: %v\n%s", err, out)
+		}
+	}
+	cases = map[string]string{
+		"a.md":         "[b](<./sub/new b.md>), [plain](<sub/new b.md>), [c](./new%20c.md#top), and [angle](<new c.md>).\n",
+		"sub/new b.md": "[a](../a.md)\n",
+	}
+	for rel, want := range cases {
+		if got := readTree(t, root, rel); got != want {
+			t.Errorf("%s:\n--- expected\n%s\n--- actual\n%s", rel, want, got)
+		}
+	}
+}
+
+// TestDate verifies mddate takes date and lastmod from git history, keeps an
+// existing date, falls back to the modification time for uncommitted files,
+// and that -check reports nothing after an update.
+func TestDate(t *testing.T) {
+	binary := buildTool(t, "mddate")
+	root := writeTree(t, map[string]string{
+		"a.md": "---\ntitle: A\n---\n# A\n",
+		"b.md": "---\ndate: 2020-01-01\n---\n# B\n",
+	})
+	git := func(date string, args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = root
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=t", "GIT_AUTHOR_EMAIL=t@example.com", "GIT_COMMITTER_NAME=t", "GIT_COMMITTER_EMAIL=t@example.com",
+			"GIT_AUTHOR_DATE="+date, "GIT_COMMITTER_DATE="+date)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	git("", "init", "-q")
+	git("2024-03-01T12:00:00Z", "add", "a.md", "b.md")
+	git("2024-03-01T12:00:00Z", "commit", "-q", "-m", "add")
+	if err := os.WriteFile(filepath.Join(root, "a.md"), []byte("---\ntitle: A\n---\n# A\n\nMore.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	git("2024-05-09T12:00:00Z", "commit", "-q", "-am", "edit")
+
+	// c.md is never committed.
+	if err := os.WriteFile(filepath.Join(root, "c.md"), []byte("# C\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mod := time.Date(2025, 7, 4, 12, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(root, "c.md"), mod, mod); err != nil {
+		t.Fatal(err)
+	}
+
+	if out, err := exec.Command(binary, root).CombinedOutput(); err != nil {
+		t.Fatalf("mddate failed: %v\n%s", err, out)
+	}
+	want := map[string]string{
+		"a.md": "---\ntitle: A\ndate: 2024-03-01\nlastmod: 2024-05-09\n---\n# A\n\nMore.\n",
+		"b.md": "---\ndate: 2020-01-01\nlastmod: 2024-03-01\n---\n# B\n",
+		"c.md": "---\ndate: 2025-07-04\nlastmod: 2025-07-04\n---\n# C\n",
+	}
+	for rel, w := range want {
+		if got := readTree(t, root, rel); got != w {
+			t.Errorf("%s:\n--- expected\n%s\n--- actual\n%s", rel, w, got)
+		}
+	}
+
+	if out, err := exec.Command(binary, "-check", root).CombinedOutput(); err != nil {
+		t.Errorf("-check after update should pass: %v\n%s", err, out)
+	}
+}
+
+// TestNav verifies mdnav links files in directory order or in the order of a
+// SUMMARY.md, places the links at the top and bottom, and removes them from
+// files that drop out of the order.
+func TestNav(t *testing.T) {
+	binary := buildTool(t, "mdnav")
+	root := writeTree(t, map[string]string{
+		"index.md":      "---\ntitle: Home\n---\n\n# Home\n",
+		"b.md":          "# Bee\n",
+		"a.md":          "# Ay\n",
+		"part/index.md": "# Part\n",
+	})
+
+	if out, err := exec.Command(binary, "-position", "both", root).CombinedOutput(); err != nil {
+		t.Fatalf("mdnav failed: %v\n%s", err, out)
+	}
+	want := map[string]string{
+		"index.md":      "---\ntitle: Home\n---\n\n<!-- nav-top -->\n[Ay](a.md) →\n<!-- /nav-top -->\n\n# Home\n\n<!-- nav -->\n[Ay](a.md) →\n<!-- /nav -->\n",
+		"a.md":          "<!-- nav-top -->\n← [Home](index.md) · [Bee](b.md) →\n<!-- /nav-top -->\n\n# Ay\n\n<!-- nav -->\n← [Home](index.md) · [Bee](b.md) →\n<!-- /nav -->\n",
+		"part/index.md": "<!-- nav-top -->\n← [Bee](../b.md)\n<!-- /nav-top -->\n\n# Part\n\n<!-- nav -->\n← [Bee](../b.md)\n<!-- /nav -->\n",
+	}
+	for rel, w := range want {
+		if got := readTree(t, root, rel); got != w {
+			t.Errorf("%s:\n--- expected\n%s\n--- actual\n%s", rel, w, got)
+		}
+	}
+
+	// Reorder with a summary that leaves b.md out.
+	summary := filepath.Join(root, "SUMMARY.md")
+	if err := os.WriteFile(summary, []byte("- [Part](part/index.md)\n- [Ay](a.md)\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command(binary, "-order", summary, root).CombinedOutput(); err != nil {
+		t.Fatalf("mdnav -order failed: %v\n%s", err, out)
+	}
+	want = map[string]string{
+		"index.md": "---\ntitle: Home\n---\n\n# Home\n",
+		"b.md":     "# Bee\n",
+		"a.md":     "# Ay\n\n<!-- nav -->\n← [Part](part/index.md)\n<!-- /nav -->\n",
+	}
+	for rel, w := range want {
+		if got := readTree(t, root, rel); got != w {
+			t.Errorf("%s:\n--- expected\n%s\n--- actual\n%s", rel, w, got)
+		}
+	}
+
+	if out, err := exec.Command(binary, "-check", "-order", summary, root).CombinedOutput(); err != nil {
+		t.Errorf("-check after update should pass: %v\n%s", err, out)
+	}
+
+	// In directory order, SUMMARY.md and the contents pages mdsummary
+	// generates are left out.
+	root = writeTree(t, map[string]string{
+		"SUMMARY.md":   "# Summary\n\n<!-- summary -->\n- [Ay](a.md)\n- [Bee](b.md)\n<!-- /summary -->\n",
+		"a.md":         "# Ay\n",
+		"b.md":         "# Bee\n",
+		"sub/index.md": "# Contents\n\n<!-- summary -->\n- [Ay](../a.md)\n<!-- /summary -->\n",
+	})
+	if out, err := exec.Command(binary, root).CombinedOutput(); err != nil {
+		t.Fatalf("mdnav failed: %v\n%s", err, out)
+	}
+	want = map[string]string{
+		"SUMMARY.md":   "# Summary\n\n<!-- summary -->\n- [Ay](a.md)\n- [Bee](b.md)\n<!-- /summary -->\n",
+		"a.md":         "# Ay\n\n<!-- nav -->\n[Bee](b.md) →\n<!-- /nav -->\n",
+		"b.md":         "# Bee\n\n<!-- nav -->\n← [Ay](a.md)\n<!-- /nav -->\n",
+		"sub/index.md": "# Contents\n\n<!-- summary -->\n- [Ay](../a.md)\n<!-- /summary -->\n",
+	}
+	for rel, w := range want {
+		if got := readTree(t, root, rel); got != w {
+			t.Errorf("%s:\n--- expected\n%s\n--- actual\n%s", rel, w, got)
+		}
+	}
+}
+
+// TestSummary verifies mdsummary builds an mdBook SUMMARY.md and a MkDocs nav
+// from the tree, keeps the rest of the output file, and that -check passes
+// once the output is current.
+func TestSummary(t *testing.T) {
+	binary := buildTool(t, "mdsummary")
+	root := writeTree(t, map[string]string{
+		"docs/index.md":           "# Welcome\n",
+		"docs/start.md":           "# Getting Started\n",
+		"docs/guide/README.md":    "# The Guide\n",
+		"docs/guide/basics.md":    "# Basics\n",
+		"docs/ref/api.md":         "# API: Reference\n",
+		"docs/ref/my notes.md":    "# Notes on [links](api.md)\n",
+		"docs/SUMMARY.md":         "# Summary\n\n[Preface](index.md)\n",
+		"mkdocs.yml":              "site_name: Test\nnav:\n  - Old: old.md\n\ntheme: material\n",
+		"docs/.hidden/ignored.md": "# Ignored\n",
+	})
+	docs := filepath.Join(root, "docs")
+
+	if out, err := exec.Command(binary, docs).CombinedOutput(); err != nil {
+		t.Fatalf("mdsummary failed: %v\n%s", err, out)
+	}
+	wantSummary := "# Summary\n\n[Preface](index.md)\n\n<!-- summary -->\n" +
+		"- [Welcome](index.md)\n- [Getting Started](start.md)\n- [The Guide](guide/README.md)\n  - [Basics](guide/basics.md)\n- [ref]()\n  - [API: Reference](ref/api.md)\n  - [Notes on \\[links\\](api.md)](<ref/my notes.md>)\n" +
+		"<!-- /summary -->\n"
+	if got := readTree(t, root, "docs/SUMMARY.md"); got != wantSummary {
+		t.Errorf("SUMMARY.md:\n--- expected\n%s\n--- actual\n%s", wantSummary, got)
+	}
+
+	cmd := exec.Command(binary, "-format", "mkdocs", "docs")
+	cmd.Dir = root
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("mdsummary -format mkdocs failed: %v\n%s", err, out)
+	}
+	wantNav := "site_name: Test\nnav:\n  - Welcome: index.md\n  - Getting Started: start.md\n" +
+		"  - The Guide:\n    - guide/README.md\n    - Basics: guide/basics.md\n  - ref:\n    - \"API: Reference\": ref/api.md\n    - \"Notes on [links](api.md)\": ref/my notes.md\n\ntheme: material\n"
+	if got := readTree(t, root, "mkdocs.yml"); got != wantNav {
+		t.Errorf("mkdocs.yml:\n--- expected\n%s\n--- actual\n%s", wantNav, got)
+	}
+	cmd = exec.Command(binary, "-check", "-format", "mkdocs", "docs")
+	cmd.Dir = root
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("-check -format mkdocs after update should pass: %v\n%s", err, out)
+	}
+
+	if out, err := exec.Command(binary, "-check", docs).CombinedOutput(); err != nil {
+		t.Errorf("-check after update should pass: %v\n%s", err, out)
+	}
+	if err := os.WriteFile(filepath.Join(docs, "new.md"), []byte("# New\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command(binary, "-check", docs).Output()
+	if err == nil || !strings.Contains(string(out), "SUMMARY.md") {
+		t.Errorf("-check should report SUMMARY.md after adding a file, got %v: %s", err, out)
+	}
+}
+
+// TestTodo verifies mdtodo finds markers in prose and comments, but not in
+// frontmatter, code, or plain prose mentions, and reports their sections.
+func TestTodo(t *testing.T) {
+	binary := buildTool(t, "mdtodo")
+	root := writeTree(t, map[string]string{
+		"index.md": "---\nnote: TODO: not this\n---\n\n# Home\n\nTODO: write an intro.\n\nA TODO list is prose.\n\n## Setup\n\n" +
+			"Run it. FIXME(dan): fails on Windows\n\n<!-- HACK the screenshot\n     is old -->\n\n```sh\n# TODO: not in code\n```\n",
+		"guide/basics.md": "# Basics\n\nUse `TODO: code span` carefully.\n\n- XXX: not a default tag\n",
+	})
+
+	out, err := exec.Command(binary, root).Output()
+	if err != nil {
+		t.Fatalf("mdtodo failed: %v", err)
+	}
+	want := "# TODO\n\n## [index.md](index.md)\n\n" +
+		"- **TODO** line 7, [Home](index.md#home): write an intro.\n" +
+		"- **FIXME** (dan) line 13, [Setup](index.md#setup): fails on Windows\n" +
+		"- **HACK** line 15, [Setup](index.md#setup): the screenshot is old\n"
+	if string(out) != want {
+		t.Errorf("--- expected\n%s\n--- actual\n%s", want, out)
+	}
+
+	out, err = exec.Command(binary, "-format", "json", "-tags", "XXX", root).Output()
+	if err != nil {
+		t.Fatalf("mdtodo -format json failed: %v", err)
+	}
+	var items []struct {
+		File, Tag, Text, Section string
+		Line                     int
+		Comment                  bool
+	}
+	if err := json.Unmarshal(out, &items); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out)
+	}
+	if len(items) != 1 || items[0].File != "guide/basics.md" || items[0].Line != 5 || items[0].Text != "not a default tag" || items[0].Section != "Basics" {
+		t.Errorf("unexpected items: %+v", items)
+	}
+
+	out, err = exec.Command(binary, filepath.Join(root, "index.md")).CombinedOutput()
+	if err == nil || !strings.Contains(string(out), "is not a directory") {
+		t.Errorf("a file argument should be rejected, got %v: %s", err, out)
+	}
+}
+
+// TestStats verifies mdstats counts words, links, images, and footnotes per
+// file and per section, leaving out code and frontmatter, and takes
+// last_modified from git history.
+func TestStats(t *testing.T) {
+	binary := buildTool(t, "mdstats")
+	root := writeTree(t, map[string]string{
+		"guide.md": "---\ntitle: Not counted\n---\nIntro words here.\n\n# Guide\n\nSee [setup](setup.md), <https://go.dev>, and ![a logo](logo.png).[^1]\n\n" +
+			"## Part *two*\n\n- [Go](https://go.dev) item\n\n```\nnot counted\n```\n\n[^1]: A note.\n",
+		"setup.md": "# Setup\n\nRun it.\n",
+	})
+	cmd := exec.Command("git", "init", "-q")
+	cmd.Dir = root
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v\n%s", err, out)
+	}
+	for _, args := range [][]string{{"add", "guide.md"}, {"commit", "-q", "-m", "add"}} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = root
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=t", "GIT_AUTHOR_EMAIL=t@example.com", "GIT_COMMITTER_NAME=t", "GIT_COMMITTER_EMAIL=t@example.com",
+			"GIT_AUTHOR_DATE=2024-05-09T12:00:00Z", "GIT_COMMITTER_DATE=2024-05-09T12:00:00Z")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+
+	out, err := exec.Command(binary, "-sections", root).Output()
+	if err != nil {
+		t.Fatalf("mdstats failed: %v", err)
+	}
+	// setup.md isn't committed, so its time varies.
+	lines := strings.Split(strings.TrimRight(string(out), "\n"), "\n")
+	want := []string{
+		"file,section,anchor,level,line,words,links,external_links,images,footnotes,footnote_density,last_modified",
+		"guide.md,,,,,13,3,2,1,1,76.92,2024-05-09T12:00:00Z",
+		"guide.md,Guide,guide,1,6,4,2,1,1,1,250,2024-05-09T12:00:00Z",
+		"guide.md,Part two,part-two,2,10,6,1,1,0,0,0,2024-05-09T12:00:00Z",
+	}
+	if len(lines) != 6 || strings.Join(lines[:4], "\n") != strings.Join(want, "\n") || !strings.HasPrefix(lines[4], "setup.md,,,,,3,0,0,0,0,0,") {
+		t.Errorf("--- expected\n%s\nsetup.md...\n--- actual\n%s", strings.Join(want, "\n"), out)
+	}
+
+	out, err = exec.Command(binary, "-format", "json", root).Output()
+	if err != nil {
+		t.Fatalf("mdstats -format json failed: %v", err)
+	}
+	var files []struct {
+		File     string
+		Words    int
+		Sections []any
+	}
+	if err := json.Unmarshal(out, &files); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out)
+	}
+	if len(files) != 2 || files[0].File != "guide.md" || files[0].Words != 13 || files[0].Sections != nil {
+		t.Errorf("unexpected files: %+v", files)
+	}
+}
+
+// TestTag verifies mdtag lists tag counts, renames, removes, and adds tags in
+// each list form, and reports files missing required tags.
+func TestTag(t *testing.T) {
+	binary := buildTool(t, "mdtag")
+	root := writeTree(t, map[string]string{
+		"a.md":     "---\ntitle: A\ntags: [golang, web]\n---\n# A\n",
+		"b.md":     "---\ntags:\n  - golang\n  - \"c++\"\n---\n# B\n",
+		"c.md":     "---\ntags: wip\n---\n\n# C\n",
+		"sub/d.md": "# D\n",
+	})
+
+	out, err := exec.Command(binary, root).Output()
+	if err != nil {
+		t.Fatalf("mdtag failed: %v", err)
+	}
+	if want := "2 golang\n1 c++\n1 web\n1 wip\n"; string(out) != want {
+		t.Errorf("--- expected\n%s\n--- actual\n%s", want, out)
+	}
+
+	out, err = exec.Command(binary, "-check", "-rename", "golang=go", root).Output()
+	if err == nil {
+		t.Error("-check with changes to make should exit 1")
+	}
+	if want := "a.md\nb.md\n"; string(out) != want {
+		t.Errorf("--- expected\n%s\n--- actual\n%s", want, out)
+	}
+	if got := readTree(t, root, "a.md"); !strings.Contains(got, "golang") {
+		t.Errorf("-check wrote a.md:\n%s", got)
+	}
+
+	if out, err := exec.Command(binary, "-rename", "golang=go", "-remove", "wip", root).CombinedOutput(); err != nil {
+		t.Fatalf("mdtag -rename -remove failed: %v\n%s", err, out)
+	}
+	if out, err := exec.Command(binary, "-add", "go", filepath.Join(root, "sub")).CombinedOutput(); err != nil {
+		t.Fatalf("mdtag -add failed: %v\n%s", err, out)
+	}
+	want := map[string]string{
+		"a.md":     "---\ntitle: A\ntags: [go, web]\n---\n# A\n",
+		"b.md":     "---\ntags:\n  - go\n  - \"c++\"\n---\n# B\n",
+		"c.md":     "# C\n",
+		"sub/d.md": "---\ntags: [go]\n---\n# D\n",
+	}
+	for rel, w := range want {
+		if got := readTree(t, root, rel); got != w {
+			t.Errorf("%s:\n--- expected\n%s\n--- actual\n%s", rel, w, got)
+		}
+	}
+
+	out, err = exec.Command(binary, "-require", "go,web", root).Output()
+	if err == nil {
+		t.Error("-require with missing tags should exit 1")
+	}
+	if want := "b.md: missing web\nc.md: missing go, web\nsub/d.md: missing web\n"; string(out) != want {
+		t.Errorf("--- expected\n%s\n--- actual\n%s", want, out)
+	}
+}
+
+// TestTagYAML verifies that mdtag reads tags as YAML does, comments and
+// quoting included, and keeps both when it rewrites them.
+func TestTagYAML(t *testing.T) {
+	binary := buildTool(t, "mdtag")
+	root := writeTree(t, map[string]string{
+		"a.md": "---\ntags:\n  - docs # the manual\n  - 'c++' # quoted\n---\n# A\n",
+		"b.md": "---\ntags: [docs, b] # c\n---\n# B\n",
+		"c.md": "---\ntags: [\"docs, too\", 'it''s', docs]\n---\n# C\n",
+		"d.md": "---\ntags: [docs,\n  b] # wrapped\ntitle: D\n---\n# D\n",
+	})
+
+	out, err := exec.Command(binary, root).Output()
+	if err != nil {
+		t.Fatalf("mdtag failed: %v", err)
+	}
+	if want := "4 docs\n2 b\n1 c++\n1 docs, too\n1 it's\n"; string(out) != want {
+		t.Errorf("--- expected\n%s\n--- actual\n%s", want, out)
+	}
+	if out, err := exec.Command(binary, "-require", "docs", root).CombinedOutput(); err != nil {
+		t.Errorf("-require docs failed: %v\n%s", err, out)
+	}
+
+	if out, err := exec.Command(binary, "-rename", "b=beta,c++=cpp", root).CombinedOutput(); err != nil {
+		t.Fatalf("mdtag -rename failed: %v\n%s", err, out)
+	}
+	want := map[string]string{
+		"a.md": "---\ntags:\n  - docs # the manual\n  - cpp\n---\n# A\n",
+		"b.md": "---\ntags: [docs, beta] # c\n---\n# B\n",
+		"c.md": "---\ntags: [\"docs, too\", 'it''s', docs]\n---\n# C\n",
+		"d.md": "---\ntags: [docs, beta] # wrapped\ntitle: D\n---\n# D\n",
+	}
+	for rel, w := range want {
+		if got := readTree(t, root, rel); got != w {
+			t.Errorf("%s:\n--- expected\n%s\n--- actual\n%s", rel, w, got)
+		}
+	}
+}
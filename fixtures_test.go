@@ -2,122 +2,241 @@ package fixtures_test
 
 import (
 	"bytes"
+	"flag"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/dbh/md-tools/internal/tools"
 )
 
-// TestFixtures discovers and runs all fixture tests.
-// Fixtures are organized as fixtures/<tool>/<name>.in.md and fixtures/<tool>/<name>.out.md
-func TestFixtures(t *testing.T) {
-	// Find all .in.md files
+var update = flag.Bool("update", false, "rewrite fixtures' .out.md files with the tools' output")
+
+// runFunc runs a tool on input and returns its output.
+type runFunc func(input []byte) ([]byte, error)
+
+// fixture is a pair of fixtures/<tool>/<name>.in.md and <name>.out.md files.
+// The tool runs with the flags in <name>.args, if there is one, separated
+// by whitespace; a value with spaces is written in double quotes.
+type fixture struct {
+	tool, name string
+	in, out    string
+	args       []string
+}
+
+// fixtures returns all the fixtures, or those for the named tools.
+func fixtures(t *testing.T, only ...string) []fixture {
+	t.Helper()
 	inputs, err := filepath.Glob("fixtures/*/*.in.md")
 	if err != nil {
 		t.Fatalf("failed to glob fixtures: %v", err)
 	}
-
-	if len(inputs) == 0 {
+	var found []fixture
+	for _, inputPath := range inputs {
+		dir := filepath.Dir(inputPath)
+		f := fixture{
+			tool: filepath.Base(dir),
+			name: strings.TrimSuffix(filepath.Base(inputPath), ".in.md"),
+			in:   inputPath,
+		}
+		f.out = filepath.Join(dir, f.name+".out.md")
+		if data, err := os.ReadFile(filepath.Join(dir, f.name+".args")); err == nil {
+			f.args = splitArgs(string(data))
+		} else if !os.IsNotExist(err) {
+			t.Fatalf("failed to read args: %v", err)
+		}
+		if len(only) > 0 && !contains(only, f.tool) {
+			continue
+		}
+		found = append(found, f)
+	}
+	if len(found) == 0 {
 		t.Fatal("no fixtures found")
 	}
+	return found
+}
 
-	// Build all tools first
-	tools := make(map[string]string) // tool name -> binary path
-	toolDirs, err := filepath.Glob("cmd/*")
-	if err != nil {
-		t.Fatalf("failed to glob cmd: %v", err)
+// splitArgs splits s at whitespace outside double quotes, and drops the
+// quotes.
+func splitArgs(s string) []string {
+	var args []string
+	var arg strings.Builder
+	inArg, quoted := false, false
+	for _, r := range s {
+		switch {
+		case r == '"':
+			inArg, quoted = true, !quoted
+		case !quoted && (r == ' ' || r == '\t' || r == '\n' || r == '\r'):
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, arg.String())
 	}
+	return args
+}
 
-	for _, toolDir := range toolDirs {
-		toolName := filepath.Base(toolDir)
-		mainFile := filepath.Join(toolDir, "main.go")
-		if _, err := os.Stat(mainFile); err != nil {
-			continue
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
 		}
+	}
+	return false
+}
 
-		// Build to temp location
-		binary := filepath.Join(t.TempDir(), toolName)
-		cmd := exec.Command("go", "build", "-o", binary, "./"+toolDir)
-		if output, err := cmd.CombinedOutput(); err != nil {
-			t.Fatalf("failed to build %s: %v\n%s", toolName, err, output)
+// inProcess returns a runFunc for the named tool's transform, configured by
+// args as its command line would be, or nil if the tool isn't in the
+// registry.
+func inProcess(t *testing.T, name string, args []string) runFunc {
+	t.Helper()
+	flags, ok := tools.Lookup(name)
+	if !ok {
+		return nil
+	}
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	setup := flags(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatalf("%s %s: %v", name, strings.Join(args, " "), err)
+	}
+	transform, err := setup()
+	if err != nil {
+		t.Fatalf("%s %s: %v", name, strings.Join(args, " "), err)
+	}
+	return func(input []byte) ([]byte, error) {
+		return []byte(transform(string(input))), nil
+	}
+}
+
+// binaryRun returns a runFunc that pipes input through binary, run with args.
+func binaryRun(binary string, args []string) runFunc {
+	return func(input []byte) ([]byte, error) {
+		cmd := exec.Command(binary, args...)
+		cmd.Stdin = bytes.NewReader(input)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		output, err := cmd.Output()
+		if err != nil && stderr.Len() > 0 {
+			return nil, &toolError{err, stderr.String()}
 		}
-		tools[toolName] = binary
+		return output, err
 	}
+}
 
-	for _, inputPath := range inputs {
-		// Extract tool name and test name
-		dir := filepath.Dir(inputPath)
-		toolName := filepath.Base(dir)
-		baseName := filepath.Base(inputPath)
-		testName := strings.TrimSuffix(baseName, ".in.md")
+// toolError is a failed binary's error with what it wrote to stderr.
+type toolError struct {
+	err    error
+	stderr string
+}
 
-		// Construct expected output path
-		outputPath := filepath.Join(dir, testName+".out.md")
+func (e *toolError) Error() string {
+	return e.err.Error() + "\nstderr: " + e.stderr
+}
 
-		t.Run(toolName+"/"+testName, func(t *testing.T) {
-			binary, ok := tools[toolName]
+// TestFixtures discovers and runs all fixture tests.
+// Fixtures are organized as fixtures/<tool>/<name>.in.md and fixtures/<tool>/<name>.out.md
+// Tools in the registry run in-process; the rest, which report through their
+// exit status or run code, are built and run as binaries.
+//
+// With -update, each fixture's .out.md is rewritten with the tool's output
+// instead of being compared with it: go test -run TestFixtures -update.
+func TestFixtures(t *testing.T) {
+	binaries := make(map[string]string)
+	for _, f := range fixtures(t) {
+		run := inProcess(t, f.tool, f.args)
+		if run == nil {
+			binary, ok := binaries[f.tool]
 			if !ok {
-				t.Skipf("no binary for tool %s", toolName)
+				if _, err := os.Stat(filepath.Join("cmd", f.tool, "main.go")); err == nil {
+					binary = buildTool(t, f.tool)
+				}
+				binaries[f.tool] = binary
 			}
-
-			// Read input
-			input, err := os.ReadFile(inputPath)
-			if err != nil {
-				t.Fatalf("failed to read input: %v", err)
+			if binary != "" {
+				run = binaryRun(binary, f.args)
 			}
+		}
+		testFixture(t, f, run, *update)
+	}
+}
 
-			// Read expected output
-			expected, err := os.ReadFile(outputPath)
-			if err != nil {
-				t.Fatalf("failed to read expected output: %v", err)
-			}
+// TestFixtureBinaries runs some of the fixtures through the built binaries,
+// checking that a command passes its input to the transform and writes back
+// what it returns. mdwrap streams; mdtable reads its input whole.
+func TestFixtureBinaries(t *testing.T) {
+	binaries := map[string]string{
+		"mdtable": buildTool(t, "mdtable"),
+		"mdwrap":  buildTool(t, "mdwrap"),
+	}
+	for _, f := range fixtures(t, "mdtable", "mdwrap") {
+		testFixture(t, f, binaryRun(binaries[f.tool], f.args), false)
+	}
+}
 
-			// Run tool
-			cmd := exec.Command(binary)
-			cmd.Stdin = bytes.NewReader(input)
-			actual, err := cmd.Output()
-			if err != nil {
-				if exitErr, ok := err.(*exec.ExitError); ok {
-					t.Fatalf("tool failed: %v\nstderr: %s", err, exitErr.Stderr)
-				}
-				t.Fatalf("tool failed: %v", err)
-			}
+// testFixture checks that run turns f's input into its output, and that
+// running it again on the output changes nothing: T(T(input)) == T(input).
+// A converter's output is in another format, so it only checks the first.
+// With write, the output is written to the .out.md file instead of being
+// compared with it.
+func testFixture(t *testing.T, f fixture, run runFunc, write bool) {
+	t.Run(f.tool+"/"+f.name, func(t *testing.T) {
+		if run == nil {
+			t.Skipf("no binary for tool %s", f.tool)
+		}
 
-			// Compare
-			if !bytes.Equal(actual, expected) {
-				t.Errorf("output mismatch\n--- expected\n%s\n--- actual\n%s", expected, actual)
+		input, err := os.ReadFile(f.in)
+		if err != nil {
+			t.Fatalf("failed to read input: %v", err)
+		}
+		actual, err := run(input)
+		if err != nil {
+			t.Fatalf("tool failed: %v", err)
+		}
+		if write {
+			if err := os.WriteFile(f.out, actual, 0644); err != nil {
+				t.Fatalf("failed to update expected output: %v", err)
 			}
-		})
+			return
+		}
 
-		// Also test idempotency: T(T(input)) == T(input)
-		t.Run(toolName+"/"+testName+"/idempotent", func(t *testing.T) {
-			binary, ok := tools[toolName]
-			if !ok {
-				t.Skipf("no binary for tool %s", toolName)
-			}
+		expected, err := os.ReadFile(f.out)
+		if err != nil {
+			t.Fatalf("failed to read expected output: %v", err)
+		}
+		if !bytes.Equal(actual, expected) {
+			t.Errorf("output mismatch\n--- expected\n%s\n--- actual\n%s", expected, actual)
+		}
+	})
 
-			// Read expected output (which is T(input))
-			firstPass, err := os.ReadFile(outputPath)
-			if err != nil {
-				t.Fatalf("failed to read expected output: %v", err)
-			}
+	if converters[f.tool] {
+		return
+	}
+	t.Run(f.tool+"/"+f.name+"/idempotent", func(t *testing.T) {
+		if run == nil {
+			t.Skipf("no binary for tool %s", f.tool)
+		}
 
-			// Run tool on expected output
-			cmd := exec.Command(binary)
-			cmd.Stdin = bytes.NewReader(firstPass)
-			secondPass, err := cmd.Output()
-			if err != nil {
-				if exitErr, ok := err.(*exec.ExitError); ok {
-					t.Fatalf("tool failed on second pass: %v\nstderr: %s", err, exitErr.Stderr)
-				}
-				t.Fatalf("tool failed on second pass: %v", err)
-			}
+		// The expected output is T(input).
+		firstPass, err := os.ReadFile(f.out)
+		if err != nil {
+			t.Fatalf("failed to read expected output: %v", err)
+		}
 
-			// T(T(input)) should equal T(input)
-			if !bytes.Equal(secondPass, firstPass) {
-				t.Errorf("not idempotent\n--- first pass\n%s\n--- second pass\n%s", firstPass, secondPass)
-			}
-		})
-	}
+		secondPass, err := run(firstPass)
+		if err != nil {
+			t.Fatalf("tool failed on second pass: %v", err)
+		}
+		if !bytes.Equal(secondPass, firstPass) {
+			t.Errorf("not idempotent\n--- first pass\n%s\n--- second pass\n%s", firstPass, secondPass)
+		}
+	})
 }
@@ -1,14 +1,27 @@
 package fixtures_test
 
 import (
+	"bufio"
 	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 	"unicode/utf8"
+
+	"github.com/dbh/md-tools/internal/tools"
+	"github.com/dbh/md-tools/internal/tools/mdcomments"
+	"github.com/dbh/md-tools/internal/tools/mddraft"
+	"github.com/dbh/md-tools/mdtools"
 )
 
 // buildTool builds a single tool and returns its binary path.
@@ -25,7 +38,7 @@ func buildTool(t *testing.T, name string) string {
 // TestInPlaceFlag verifies the -i FILE flag across the standard tools.
 // -i reads stdin, applies the transform, and writes the result to FILE.
 func TestInPlaceFlag(t *testing.T) {
-	tools := []string{"mdsplit", "mdtable"}
+	tools := []string{"mdsplit", "mdtable", "mdwrap"}
 
 	for _, tool := range tools {
 		tool := tool
@@ -180,6 +193,374 @@ func TestFootnoteWrapFlag(t *testing.T) {
 	})
 }
 
+// TestWrapWidth verifies mdwrap's -width: the same as -c, ahead of the
+// .editorconfig max_line_length, with 0 joining each paragraph onto one line.
+func TestWrapWidth(t *testing.T) {
+	mdwrap := buildTool(t, "mdwrap")
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, ".editorconfig"), []byte("root = true\n\n[*.md]\nmax_line_length = 30\n"), 0644)
+	path := filepath.Join(dir, "doc.md")
+	os.WriteFile(path, []byte("Some words that the wrapping\ntools break into lines.\n\n> A quote that is\n> also wrapped.\n"), 0644)
+
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-width", "0"}, "Some words that the wrapping tools break into lines.\n\n> A quote that is also wrapped.\n"},
+		{[]string{"-width", "20"}, "Some words that the\nwrapping tools break\ninto lines.\n\n> A quote that is\n> also wrapped.\n"},
+		{[]string{"-c", "20"}, "Some words that the\nwrapping tools break\ninto lines.\n\n> A quote that is\n> also wrapped.\n"},
+		{nil, "Some words that the wrapping\ntools break into lines.\n\n> A quote that is also\n> wrapped.\n"},
+	}
+	for _, tc := range cases {
+		out, err := exec.Command(mdwrap, append(tc.args, path)...).Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != tc.want {
+			t.Errorf("mdwrap %s:\n--- expected\n%s\n--- actual\n%s", strings.Join(tc.args, " "), tc.want, out)
+		}
+	}
+
+	if err := exec.Command(mdwrap, "-width", "-1", path).Run(); err == nil {
+		t.Errorf("expected a negative -width to fail")
+	}
+
+	// Each file wraps to its own directory's width, with -w and to stdout.
+	text := "Some words that the wrapping tools break into lines.\n"
+	want := map[string]string{
+		"a": "Some words that the\nwrapping tools break\ninto lines.\n",
+		"b": text,
+	}
+	var paths []string
+	for _, sub := range []string{"a", "b"} {
+		width := map[string]string{"a": "20", "b": "70"}[sub]
+		os.Mkdir(filepath.Join(dir, sub), 0755)
+		os.WriteFile(filepath.Join(dir, sub, ".editorconfig"), []byte("[*.md]\nmax_line_length = "+width+"\n"), 0644)
+		path := filepath.Join(dir, sub, "doc.md")
+		os.WriteFile(path, []byte(text), 0644)
+		paths = append(paths, path)
+	}
+	out, err := exec.Command(mdwrap, paths...).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != want["a"]+want["b"] {
+		t.Errorf("mdwrap a/doc.md b/doc.md:\n--- expected\n%s%s\n--- actual\n%s", want["a"], want["b"], out)
+	}
+	if err := exec.Command(mdwrap, append([]string{"-w"}, paths...)...).Run(); err != nil {
+		t.Fatal(err)
+	}
+	for i, sub := range []string{"a", "b"} {
+		if got, _ := os.ReadFile(paths[i]); string(got) != want[sub] {
+			t.Errorf("mdwrap -w %s/doc.md:\n--- expected\n%s\n--- actual\n%s", sub, want[sub], got)
+		}
+	}
+}
+
+// TestWrapStream checks that mdwrap, which wraps its input as a stream,
+// writes the same output as the in-memory transform for every fixture input,
+// and that -w only replaces files it changes.
+func TestWrapStream(t *testing.T) {
+	mdwrap := buildTool(t, "mdwrap")
+	transform, err := tools.New("mdwrap", map[string]any{"c": 30, "f": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs, err := filepath.Glob("fixtures/*/*.in.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, input := range inputs {
+		data, err := os.ReadFile(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := exec.Command(mdwrap, "-c", "30", "-f", input).Output()
+		if err != nil {
+			t.Fatalf("%s: %v", input, err)
+		}
+		if want := transform(string(data)); string(out) != want {
+			t.Errorf("%s:\n--- expected\n%s\n--- actual\n%s", input, want, out)
+		}
+	}
+
+	dir := t.TempDir()
+	wrapped := filepath.Join(dir, "wrapped.md")
+	unwrapped := filepath.Join(dir, "unwrapped.md")
+	os.WriteFile(wrapped, []byte("Short.\n"), 0600)
+	os.WriteFile(unwrapped, []byte("A paragraph long enough to need wrapping at thirty columns.\n"), 0600)
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(wrapped, old, old)
+	if out, err := exec.Command(mdwrap, "-c", "30", "-w", wrapped, unwrapped).CombinedOutput(); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	if info, err := os.Stat(wrapped); err != nil || !info.ModTime().Equal(old) {
+		t.Errorf("expected the unchanged file not to be rewritten")
+	}
+	got, _ := os.ReadFile(unwrapped)
+	if want := "A paragraph long enough to\nneed wrapping at thirty\ncolumns.\n"; string(got) != want {
+		t.Errorf("--- expected\n%s\n--- actual\n%s", want, got)
+	}
+	if info, err := os.Stat(unwrapped); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("expected the rewritten file to keep its mode")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("expected no temporary files left, got %d entries", len(entries))
+	}
+}
+
+// TestTransform checks that mdtools.Transform, the public entry point,
+// writes what each tool's transform returns, and that mdwrap writes as it
+// reads rather than waiting for the end of its input.
+func TestTransform(t *testing.T) {
+	input := "# Title\n\nA paragraph long enough to need wrapping at thirty columns, with a [link](https://example.com).\n"
+	for _, name := range mdtools.Names() {
+		transform, err := mdtools.New(name, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out strings.Builder
+		if err := mdtools.Transform(name, strings.NewReader(input), &out, nil); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if want := transform(input); out.String() != want {
+			t.Errorf("%s:\n--- expected\n%s\n--- actual\n%s", name, want, out.String())
+		}
+	}
+	if err := mdtools.Transform("nope", strings.NewReader(input), io.Discard, nil); err == nil {
+		t.Error("expected an error for an unknown tool")
+	}
+	if err := mdtools.Transform("wrap", strings.NewReader(input), io.Discard, map[string]any{"x": 1}); err == nil {
+		t.Error("expected an error for an unknown option")
+	}
+
+	r, w := io.Pipe()
+	out := make(chan string)
+	go func() {
+		var b strings.Builder
+		mdtools.Transform("wrap", r, &lineWriter{&b, out}, map[string]any{"c": 30})
+		close(out)
+	}()
+	go func() {
+		for i := 0; i < 1000; i++ {
+			io.WriteString(w, "A paragraph long enough to need wrapping at thirty columns.\n\n")
+		}
+	}()
+	select {
+	case line := <-out:
+		if line != "A paragraph long enough to\n" {
+			t.Errorf("first line = %q", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected output before the end of the input")
+	}
+	w.Close()
+	for range out {
+	}
+}
+
+// lineWriter sends each line written to it on lines.
+type lineWriter struct {
+	b     *strings.Builder
+	lines chan<- string
+}
+
+func (l *lineWriter) Write(p []byte) (int, error) {
+	for _, c := range p {
+		l.b.WriteByte(c)
+		if c == '\n' {
+			l.lines <- l.b.String()
+			l.b.Reset()
+		}
+	}
+	return len(p), nil
+}
+
+// TestEditorConfig checks that the tools follow .editorconfig: line endings,
+// the final newline, and trailing whitespace, but for a Markdown hard break,
+// whether they read their input whole (mdtable) or as a stream (mdwrap), and
+// mdwrap's width.
+func TestEditorConfig(t *testing.T) {
+	mdtable := buildTool(t, "mdtable")
+	mdwrap := buildTool(t, "mdwrap")
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "notes", "raw"), 0755)
+	os.WriteFile(filepath.Join(dir, ".editorconfig"), []byte("root = true\n\n[*]\nend_of_line = crlf\ntrim_trailing_whitespace = true\n\n[*.md]\nmax_line_length = 30\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "notes", ".editorconfig"), []byte("[raw/**]\nend_of_line = unset\ninsert_final_newline = false\n"), 0644)
+
+	table := "| a | bb |\r\n|-|-|\r\n| ccc | d |\r\n"
+	paragraph := "A paragraph long enough to need wrapping at thirty columns.\n\n```\ncode   \n```"
+	tests := []struct {
+		tool, path, input string
+		args              []string
+		want              string
+	}{
+		{"mdtable", "table.md", table, nil, "| a   | bb  |\r\n| --- | --- |\r\n| ccc | d   |\r\n"},
+		{"mdwrap", "notes/wrap.md", paragraph, nil, "A paragraph long enough to\r\nneed wrapping at thirty\r\ncolumns.\r\n\r\n```\r\ncode\r\n```\r\n"},
+		{"mdwrap", "notes/wrap.md", paragraph, []string{"-c", "40"}, "A paragraph long enough to need wrapping\r\nat thirty columns.\r\n\r\n```\r\ncode\r\n```\r\n"},
+		{"mdwrap", "notes/raw/wrap.md", paragraph, nil, "A paragraph long enough to\nneed wrapping at thirty\ncolumns.\n\n```\ncode\n```"},
+		{"mdtable", "notes/raw/table.md", "| a |\n|-|\n", nil, "| a   |\n| --- |\n"},
+		{"mdtable", "poem.md", "Roses are red  \nviolets are blue. \n\n```\ncode  \n```\n", nil, "Roses are red  \r\nviolets are blue.\r\n\r\n```\r\ncode\r\n```\r\n"},
+		{"mdwrap", "poem.md", "Roses are red  \nviolets are blue. \n", nil, "Roses are red  \r\nviolets are blue.\r\n"},
+	}
+	for _, tt := range tests {
+		binary := map[string]string{"mdtable": mdtable, "mdwrap": mdwrap}[tt.tool]
+		path := filepath.Join(dir, tt.path)
+		for _, mode := range []string{"stdout", "-w", "-i"} {
+			os.WriteFile(path, []byte(tt.input), 0644)
+			args := append([]string{}, tt.args...)
+			cmd := exec.Command(binary)
+			switch mode {
+			case "stdout":
+				cmd.Args = append(cmd.Args, append(args, path)...)
+			case "-w":
+				cmd.Args = append(cmd.Args, append(args, "-w", path)...)
+			case "-i":
+				cmd.Args = append(cmd.Args, append(args, "-i", path)...)
+				cmd.Stdin = strings.NewReader(tt.input)
+			}
+			out, err := cmd.Output()
+			if err != nil {
+				t.Fatalf("%s %s: %v", tt.tool, strings.Join(cmd.Args[1:], " "), err)
+			}
+			if mode != "stdout" {
+				out, _ = os.ReadFile(path)
+			}
+			if string(out) != tt.want {
+				t.Errorf("%s %s:\n--- expected\n%q\n--- actual\n%q", tt.tool, strings.Join(cmd.Args[1:], " "), tt.want, out)
+			}
+		}
+	}
+}
+
+// TestGlobArgs verifies that the tools expand glob patterns the shell
+// passed through, as cmd.exe does, with ** matching any depth but not
+// hidden directories, whether they read their input whole or as a stream.
+func TestGlobArgs(t *testing.T) {
+	unwrapped := "A paragraph long enough to need wrapping at sixty columns, or so it is hoped.\n"
+	wrapped := "A paragraph long enough to need wrapping at sixty columns,\nor so it is hoped.\n"
+	for _, tool := range []string{"mdtable", "mdwrap"} {
+		t.Run(tool, func(t *testing.T) {
+			binary := buildTool(t, tool)
+			input := map[string]string{"mdtable": "| a | bb |\n|-|-|\n", "mdwrap": unwrapped}[tool]
+			want := map[string]string{"mdtable": "| a   | bb  |\n| --- | --- |\n", "mdwrap": wrapped}[tool]
+			root := writeTree(t, map[string]string{
+				"docs/a.md":         input,
+				"docs/sub/b.md":     input,
+				"docs/.hidden/c.md": input,
+				"docs/d.txt":        input,
+				"e.md":              input,
+			})
+
+			cmd := exec.Command(binary, "-w", "docs/**/*.md", "e.m?")
+			cmd.Dir = root
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Fatalf("%v: %s", err, out)
+			}
+			for rel, expect := range map[string]string{
+				"docs/a.md": want, "docs/sub/b.md": want, "e.md": want,
+				"docs/.hidden/c.md": input, "docs/d.txt": input,
+			} {
+				if got := readTree(t, root, rel); got != expect {
+					t.Errorf("%s:\n--- expected\n%s\n--- actual\n%s", rel, expect, got)
+				}
+			}
+
+			cmd = exec.Command(binary, "-w", "docs/*.rst")
+			cmd.Dir = root
+			if out, err := cmd.CombinedOutput(); err == nil || !strings.Contains(string(out), "no files match docs/*.rst") {
+				t.Errorf("expected a pattern matching nothing to fail, got %v: %s", err, out)
+			}
+		})
+	}
+}
+
+// TestMultipleFiles verifies that the tools transform each file argument on
+// its own and write the results to stdout in order, whether they read their
+// input whole or as a stream: references are numbered from 1 in each file.
+func TestMultipleFiles(t *testing.T) {
+	unwrapped := "A paragraph long enough to need wrapping at sixty columns, or so it is hoped.\n"
+	wrapped := "A paragraph long enough to need wrapping at sixty columns,\nor so it is hoped.\n"
+	for _, tc := range []struct {
+		tool string
+		a, b string
+		want string
+	}{
+		{
+			tool: "mdref",
+			a:    "See [a](https://a.example).\n",
+			b:    "See [b](https://b.example).\n",
+			want: "See [a][1].\n\n[1]: https://a.example\nSee [b][1].\n\n[1]: https://b.example\n",
+		},
+		{tool: "mdwrap", a: unwrapped, b: unwrapped, want: wrapped + wrapped},
+	} {
+		t.Run(tc.tool, func(t *testing.T) {
+			binary := buildTool(t, tc.tool)
+			root := writeTree(t, map[string]string{"a.md": tc.a, "b.md": tc.b})
+			cmd := exec.Command(binary, "a.md", "b.md")
+			cmd.Dir = root
+			out, err := cmd.Output()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tc.want {
+				t.Errorf("--- expected\n%s\n--- actual\n%s", tc.want, out)
+			}
+			if got := readTree(t, root, "a.md"); got != tc.a {
+				t.Errorf("a.md was changed:\n%s", got)
+			}
+		})
+	}
+}
+
+// TestBatch verifies -batch transforms each JSON record on stdin, following
+// the .editorconfig for its path, and reports a bad record in its place
+// with exit status 1.
+func TestBatch(t *testing.T) {
+	dir := writeTree(t, map[string]string{".editorconfig": "root = true\n\n[crlf/*.md]\nend_of_line = crlf\n"})
+	unwrapped := "A paragraph long enough to need wrapping at sixty columns, or so it is hoped."
+	records := []string{
+		`{"path": "a.md", "content": ` + strconv.Quote(unwrapped) + `}`,
+		`{"path": "crlf/b.md", "content": ` + strconv.Quote(unwrapped) + `}`,
+		`{"path": "c.md"}`,
+		`{"content": "Short."}`,
+	}
+	want := []string{
+		`{"path":"a.md","content":"A paragraph long enough to need wrapping at sixty columns,\nor so it is hoped.\n"}`,
+		`{"path":"crlf/b.md","content":"A paragraph long enough to need wrapping at sixty columns,\r\nor so it is hoped.\r\n"}`,
+		`{"path":"c.md","error":"content is missing"}`,
+		`{"path":"","content":"Short.\n"}`,
+	}
+	for _, tool := range []string{"mdwrap", "mdunwrap"} {
+		cmd := exec.Command(buildTool(t, tool), "-batch")
+		cmd.Dir = dir
+		cmd.Stdin = strings.NewReader(strings.Join(records, "\n") + "\n")
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 1 {
+			t.Errorf("%s: expected exit status 1, got %v", tool, err)
+		}
+		if !strings.Contains(stderr.String(), "1 of 4 records failed") {
+			t.Errorf("%s: unexpected stderr %q", tool, stderr.String())
+		}
+		got := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n")
+		if tool == "mdunwrap" {
+			want[0] = `{"path":"a.md","content":"` + unwrapped + `\n"}`
+			want[1] = `{"path":"crlf/b.md","content":"` + unwrapped + `\r\n"}`
+		}
+		if strings.Join(got, "\n") != strings.Join(want, "\n") {
+			t.Errorf("%s:\n--- expected\n%s\n--- actual\n%s", tool, strings.Join(want, "\n"), out)
+		}
+	}
+
+	cmd := exec.Command(buildTool(t, "mdwrap"), "-batch", "-w", "a.md")
+	cmd.Dir = dir
+	if err := cmd.Run(); err == nil {
+		t.Error("expected -batch with -w to fail")
+	}
+}
+
 // TestInPlaceFlagChain verifies the canonical mdsplit X | mdtable -i X form:
 // stdin from the upstream pipe is captured and written to the target file.
 func TestInPlaceFlagChain(t *testing.T) {
@@ -224,3 +605,472 @@ func TestInPlaceFlagChain(t *testing.T) {
 		t.Errorf("expected mdtable transform applied (padded columns); got:\n%s", got)
 	}
 }
+
+// TestSmartLocales verifies that an unknown mdsmart -locale is an error;
+// the fixtures cover the locales themselves.
+func TestSmartLocales(t *testing.T) {
+	mdsmart := buildTool(t, "mdsmart")
+	if err := exec.Command(mdsmart, "-locale", "xx").Run(); err == nil {
+		t.Errorf("expected an unknown -locale to fail")
+	}
+}
+
+// TestExtlinkFlags verifies mdextlink's flag errors; the fixtures cover the
+// flags themselves.
+func TestExtlinkFlags(t *testing.T) {
+	mdextlink := buildTool(t, "mdextlink")
+	for _, args := range [][]string{
+		{"-policy", "tracking"},
+		{"-policy", "redirect"},
+		{"-policy", "redirect", "-prefix", "/out?url="},
+		{"-marker", " "},
+	} {
+		if err := exec.Command(mdextlink, args...).Run(); err == nil {
+			t.Errorf("mdextlink %s: expected an error", strings.Join(args, " "))
+		}
+	}
+}
+
+// TestURLFlags verifies mdurl's -https, -slash, -report, and -resolve flags.
+func TestURLFlags(t *testing.T) {
+	mdurl := buildTool(t, "mdurl")
+
+	mux := http.NewServeMux()
+	mux.Handle("/old", http.RedirectHandler("/new/", http.StatusMovedPermanently))
+	mux.HandleFunc("/new/", func(w http.ResponseWriter, r *http.Request) {})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	input := "[a](http://example.org/docs/?utm_source=feed) [b](" + server.URL + "/old#usage)\n"
+
+	cases := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"https", []string{"-https", "example.org"}, "[a](https://example.org/docs/) [b](" + server.URL + "/old#usage)\n"},
+		{"strip", []string{"-slash", "strip"}, "[a](http://example.org/docs) [b](" + server.URL + "/old#usage)\n"},
+		{"add", []string{"-slash", "add"}, "[a](http://example.org/docs/) [b](" + server.URL + "/old/#usage)\n"},
+		{"resolve", []string{"-resolve"}, "[a](http://example.org/docs/) [b](" + server.URL + "/new/#usage)\n"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cmd := exec.Command(mdurl, tc.args...)
+			cmd.Stdin = strings.NewReader(input)
+			out, err := cmd.Output()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tc.want {
+				t.Errorf("--- expected\n%s\n--- actual\n%s", tc.want, out)
+			}
+		})
+	}
+
+	t.Run("report", func(t *testing.T) {
+		cmd := exec.Command(mdurl, "-report")
+		cmd.Stdin = strings.NewReader(input)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			t.Fatal(err)
+		}
+		want := "http://example.org/docs/?utm_source=feed -> http://example.org/docs/\n"
+		if stderr.String() != want {
+			t.Errorf("report = %q, want %q", stderr.String(), want)
+		}
+	})
+}
+
+// TestCommentsReport verifies mdcomments -report, with and without -keep;
+// the fixtures cover stripping.
+func TestCommentsReport(t *testing.T) {
+	input := "Intro <!-- who wrote this? -->.\n\n# One\n\n<!-- prettier-ignore -->\n| a |\n\n## Two\n\n<!--\n  check\n  numbers\n-->\n\n<!-- summary -->\n- x\n<!-- /summary -->\n"
+
+	cases := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"report", nil, "stdin:1: who wrote this?\nstdin:5: [One] prettier-ignore\nstdin:10: [Two] check numbers\n"},
+		{"keep", []string{"-keep", "^prettier-"}, "stdin:1: who wrote this?\nstdin:10: [Two] check numbers\n"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("mdcomments", flag.ContinueOnError)
+			setup := mdcomments.ReportFlags(fs)
+			if err := fs.Parse(tc.args); err != nil {
+				t.Fatal(err)
+			}
+			_, report, err := setup()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out strings.Builder
+			report(&out, "stdin", input)
+			if out.String() != tc.want {
+				t.Errorf("--- expected\n%s\n--- actual\n%s", tc.want, out.String())
+			}
+		})
+	}
+}
+
+// TestAttrCheck verifies that mdattr fails on duplicate IDs, with -check
+// and without, and that -check writes nothing to stdout; the fixtures cover
+// adding IDs.
+func TestAttrCheck(t *testing.T) {
+	mdattr := buildTool(t, "mdattr")
+	input := "# A {#x}\n\nText [span]{#x}.\n\n## B\n"
+	file := filepath.Join(t.TempDir(), "doc.md")
+	if err := os.WriteFile(file, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"check", []string{"-check"}, ""},
+		{"add", nil, "# A {#x}\n\nText [span]{#x}.\n\n## B {#b}\n"},
+		{"check file", []string{"-check", file}, ""},
+		{"add file", []string{file}, "# A {#x}\n\nText [span]{#x}.\n\n## B {#b}\n"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cmd := exec.Command(mdattr, tc.args...)
+			name := "stdin"
+			if len(tc.args) > 0 && tc.args[len(tc.args)-1] == file {
+				name = file
+			} else {
+				cmd.Stdin = strings.NewReader(input)
+			}
+			var stderr strings.Builder
+			cmd.Stderr = &stderr
+			out, err := cmd.Output()
+			if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 1 {
+				t.Fatalf("exit error = %v, want exit status 1", err)
+			}
+			if want := name + ":3: duplicate id \"x\" (first at line 1)\n"; stderr.String() != want {
+				t.Errorf("stderr = %q, want %q", stderr.String(), want)
+			}
+			if string(out) != tc.want {
+				t.Errorf("--- expected\n%s\n--- actual\n%s", tc.want, out)
+			}
+		})
+	}
+}
+
+// TestDraftList verifies mddraft -list; the fixtures cover removing drafts.
+func TestDraftList(t *testing.T) {
+	input := "# Guide\n\n<!-- draft -->\nNot ready.\n<!-- /draft -->\n\n## Ideas {.draft}\n\nSome ideas.\n\n## Usage\n"
+	want := "stdin:3-5: Not ready.\nstdin:7-9: Ideas\n"
+	var out strings.Builder
+	mddraft.List(&out, "stdin", input)
+	if out.String() != want {
+		t.Errorf("--- expected\n%s\n--- actual\n%s", want, out.String())
+	}
+}
+
+// TestServe verifies mdserve renders Markdown through -pipe and the chosen
+// template, serves other files as is, and tells open pages to reload when a
+// file changes.
+func TestServe(t *testing.T) {
+	mdserve := buildTool(t, "mdserve")
+	root := t.TempDir()
+	files := map[string]string{
+		"index.md":  "---\ntitle: Home\n---\n# Home\n\nSee [notes](notes.md).\n",
+		"notes.md":  "# Notes\n\nA claim.[^1]\n\n[^1]: A source.\n",
+		"style.css": "body {}\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cmd := exec.Command(mdserve, "-addr", "127.0.0.1:0", "-template", "plain", "-pipe", "sed s/claim/CLAIM/", root)
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Process.Kill()
+	line, err := bufio.NewReader(stderr).ReadString('\n')
+	if err != nil {
+		t.Fatalf("reading startup message: %v", err)
+	}
+	base := regexp.MustCompile(`http://[^/\s]+`).FindString(line)
+	if base == "" {
+		t.Fatalf("no URL in startup message %q", line)
+	}
+
+	get := func(path string) (int, string) {
+		t.Helper()
+		resp, err := http.Get(base + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var b bytes.Buffer
+		b.ReadFrom(resp.Body)
+		return resp.StatusCode, b.String()
+	}
+
+	status, body := get("/")
+	for _, want := range []string{"<title>Home</title>", `<h1 id="home">Home</h1>`, `<a href="notes.md">notes</a>`, "EventSource"} {
+		if status != http.StatusOK || !strings.Contains(body, want) {
+			t.Errorf("GET / = %d, missing %q:\n%s", status, want, body)
+		}
+	}
+	if strings.Contains(body, "title: Home") {
+		t.Errorf("GET / rendered the frontmatter:\n%s", body)
+	}
+	if _, body := get("/notes.md"); !strings.Contains(body, "A CLAIM.") || !strings.Contains(body, "A source.") {
+		t.Errorf("GET /notes.md didn't go through -pipe or lost the footnote:\n%s", body)
+	}
+	if _, body := get("/style.css"); body != "body {}\n" {
+		t.Errorf("GET /style.css = %q", body)
+	}
+	if status, _ := get("/missing.md"); status != http.StatusNotFound {
+		t.Errorf("GET /missing.md = %d, want 404", status)
+	}
+
+	resp, err := http.Get(base + "/_mdserve/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(filepath.Join(root, "notes.md"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	events := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(resp.Body).ReadString('\n')
+		events <- line
+	}()
+	select {
+	case line := <-events:
+		if line != "data: reload\n" {
+			t.Errorf("event = %q, want a reload", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("no reload event after a file changed")
+	}
+}
+
+func TestExecFlags(t *testing.T) {
+	mdexec := buildTool(t, "mdexec")
+	fresh := "```sh exec\necho hi\n```\n\n```output\nhi\n```\n"
+	stale := "```sh exec\necho hi\n```\n\n```output\nbye\n```\n"
+
+	cases := []struct {
+		name     string
+		args     []string
+		input    string
+		want     string
+		wantFail bool
+	}{
+		{"check fresh", []string{"-check"}, fresh, fresh, false},
+		{"check stale", []string{"-check"}, stale, stale, true},
+		{"runner", []string{"-runner", "upper=tr a-z A-Z"}, "```upper exec\nshout\n```\n", "```upper exec\nshout\n```\n\n```output\nSHOUT\n```\n", false},
+		{"no runner", nil, "```ocaml exec\nx\n```\n", "```ocaml exec\nx\n```\n", true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cmd := exec.Command(mdexec, tc.args...)
+			cmd.Stdin = strings.NewReader(tc.input)
+			out, err := cmd.Output()
+			if failed := err != nil; failed != tc.wantFail {
+				t.Errorf("failed = %v, want %v (%v)", failed, tc.wantFail, err)
+			}
+			if string(out) != tc.want {
+				t.Errorf("--- expected\n%s\n--- actual\n%s", tc.want, out)
+			}
+		})
+	}
+}
+
+// TestExecDir verifies that mdexec runs a file's blocks from its directory.
+func TestExecDir(t *testing.T) {
+	mdexec := buildTool(t, "mdexec")
+	root := writeTree(t, map[string]string{
+		"docs/guide.md": "```sh exec\ncat data.txt\n```\n",
+		"docs/data.txt": "from docs\n",
+	})
+	if out, err := exec.Command(mdexec, "-w", filepath.Join(root, "docs", "guide.md")).CombinedOutput(); err != nil {
+		t.Fatalf("mdexec failed: %v\n%s", err, out)
+	}
+	want := "```sh exec\ncat data.txt\n```\n\n```output\nfrom docs\n```\n"
+	if got := readTree(t, root, "docs/guide.md"); got != want {
+		t.Errorf("--- expected\n%s\n--- actual\n%s", want, got)
+	}
+}
+
+// TestExecMessages verifies that mdexec names the file in what it reports.
+func TestExecMessages(t *testing.T) {
+	mdexec := buildTool(t, "mdexec")
+	root := writeTree(t, map[string]string{
+		"stale.md": "# Stale\n\n```sh exec\necho hi\n```\n\n```output\nbye\n```\n",
+		"ocaml.md": "```ocaml exec\nx\n```\n",
+	})
+	cases := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"stale", []string{"-check", "stale.md"}, "stale.md:3: output is stale\n"},
+		{"no runner", []string{"ocaml.md"}, "ocaml.md:1: no runner for \"ocaml\" (add one with -runner)\n"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cmd := exec.Command(mdexec, tc.args...)
+			cmd.Dir = root
+			var stderr strings.Builder
+			cmd.Stderr = &stderr
+			if err := cmd.Run(); err == nil {
+				t.Error("expected mdexec to fail")
+			}
+			if stderr.String() != tc.want {
+				t.Errorf("stderr = %q, want %q", stderr.String(), tc.want)
+			}
+		})
+	}
+}
+
+// TestRDJSONOutput verifies that -check -output rdjson reports problems in the
+// Reviewdog Diagnostic Format, with suggested fixes for stale content.
+func TestRDJSONOutput(t *testing.T) {
+	cases := []struct {
+		tool  string
+		input string
+		want  string
+	}{
+		{
+			"mdexec",
+			"```sh exec\necho hi\n```\n\n```output\nbye\n```\n",
+			`{"source":{"name":"mdexec"},"diagnostics":[{"message":"output is stale","location":{"path":"stdin","range":{"start":{"line":6,"column":1},"end":{"line":7,"column":1}}},"severity":"ERROR","suggestions":[{"range":{"start":{"line":6,"column":1},"end":{"line":7,"column":1}},"text":"hi\n"}]}]}`,
+		},
+		{
+			"mdattr",
+			"## A {#a}\n\n## B {#a}\n",
+			`{"source":{"name":"mdattr"},"diagnostics":[{"message":"duplicate id \"a\" (first at line 1)","location":{"path":"stdin","range":{"start":{"line":3},"end":{"line":3}}},"severity":"ERROR"}]}`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.tool, func(t *testing.T) {
+			cmd := exec.Command(buildTool(t, tc.tool), "-check", "-output", "rdjson")
+			cmd.Stdin = strings.NewReader(tc.input)
+			out, err := cmd.Output()
+			if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 1 {
+				t.Fatalf("expected exit status 1, got %v", err)
+			}
+			var got bytes.Buffer
+			if err := json.Compact(&got, out); err != nil {
+				t.Fatalf("invalid JSON: %v\n%s", err, out)
+			}
+			if got.String() != tc.want {
+				t.Errorf("--- expected\n%s\n--- actual\n%s", tc.want, got.String())
+			}
+		})
+	}
+}
+
+func TestTestFlags(t *testing.T) {
+	mdtest := buildTool(t, "mdtest")
+
+	cases := []struct {
+		name     string
+		input    string
+		want     string
+		wantFail bool
+	}{
+		{
+			"pass",
+			"# Example\n\n```go test\nimport \"fmt\"\n\nfmt.Println(1 + 1)\n```\n\n```output\n2\n```\n\n```sh test\necho ok\n```\n\n```go\nnot tested\n```\n",
+			"2 passed, 0 failed\n",
+			false,
+		},
+		{
+			"fail",
+			"```sh test\necho one\n```\n\n```output\ntwo\n```\n\n```sh test\necho before\nfalse\necho after\n```\n",
+			"stdin:1: sh example: output differs\n\t--- expected\n\ttwo\n\t--- actual\n\tone\nstdin:9: sh example: exit status 1\n\tbefore\n0 passed, 2 failed\n",
+			true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cmd := exec.Command(mdtest)
+			cmd.Stdin = strings.NewReader(tc.input)
+			out, err := cmd.Output()
+			if failed := err != nil; failed != tc.wantFail {
+				t.Errorf("failed = %v, want %v (%v)", failed, tc.wantFail, err)
+			}
+			if string(out) != tc.want {
+				t.Errorf("--- expected\n%s\n--- actual\n%s", tc.want, out)
+			}
+		})
+	}
+}
+
+// TestSidenoteSourceMap verifies that mdsidenote's -sourcemap ranges pick
+// out each footnote in the input and its sidenote in the output, inline and
+// Markua endnotes included.
+func TestSidenoteSourceMap(t *testing.T) {
+	mdsidenote := buildTool(t, "mdsidenote")
+	dir := t.TempDir()
+	path := filepath.Join(dir, "map.json")
+	input := "Text[^a] and ^[an *inline* note] and [^^e] more[^a].\n\n[^a]: A note.\n[^^e]: End.\n"
+
+	cmd := exec.Command(mdsidenote, "-dialect", "markua", "-sourcemap", path)
+	cmd.Stdin = strings.NewReader(input)
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type span struct{ Start, End int }
+	var m struct {
+		Version   int
+		Sidenotes []struct {
+			ID, Label      string
+			Source, Output span
+			Definition     *span
+		}
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct{ id, label, source, definition string }{
+		{"sidenote-1", "a", "[^a]", "[^a]: A note.\n"},
+		{"sidenote-2", "", "^[an *inline* note]", ""},
+		{"sidenote-3", "e", "[^^e]", "[^^e]: End.\n"},
+		{"sidenote-1", "a", "[^a]", "[^a]: A note.\n"},
+	}
+	if m.Version != 1 || len(m.Sidenotes) != len(want) {
+		t.Fatalf("unexpected source map:\n%s", data)
+	}
+	for i, w := range want {
+		got := m.Sidenotes[i]
+		if got.ID != w.id || got.Label != w.label || input[got.Source.Start:got.Source.End] != w.source {
+			t.Errorf("sidenote %d: got %s %q %q, want %s %q %q", i, got.ID, got.Label, input[got.Source.Start:got.Source.End], w.id, w.label, w.source)
+		}
+		switch {
+		case w.definition == "" && got.Definition != nil:
+			t.Errorf("sidenote %d: unexpected definition %+v", i, *got.Definition)
+		case w.definition != "" && (got.Definition == nil || input[got.Definition.Start:got.Definition.End] != w.definition):
+			t.Errorf("sidenote %d: definition %+v, want %q", i, got.Definition, w.definition)
+		}
+		html := string(out[got.Output.Start:got.Output.End])
+		if !strings.HasPrefix(html, "\n<label for=\""+w.id+"\"") || !strings.HasSuffix(html, "</span></span>") {
+			t.Errorf("sidenote %d: output range %q", i, html)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package fixtures_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/dbh/md-tools/internal/tools"
+)
+
+// Each registry tool has a fuzz target. go test runs them on their seeds,
+// the fixture inputs, and on any failures saved in testdata/fuzz; fuzz one
+// tool with
+//
+//	go test -run '^$' -fuzz '^FuzzMdref$' .
+
+func FuzzMdattr(f *testing.F)     { fuzzTool(f, "mdattr") }
+func FuzzMdcase(f *testing.F)     { fuzzTool(f, "mdcase") }
+func FuzzMdcomments(f *testing.F) { fuzzTool(f, "mdcomments") }
+func FuzzMdconvert(f *testing.F)  { fuzzTool(f, "mdconvert") }
+func FuzzMdcritic(f *testing.F)   { fuzzTool(f, "mdcritic") }
+func FuzzMddraft(f *testing.F)    { fuzzTool(f, "mddraft") }
+func FuzzMdemph(f *testing.F)     { fuzzTool(f, "mdemph") }
+func FuzzMdextlink(f *testing.F)  { fuzzTool(f, "mdextlink") }
+func FuzzMdfence(f *testing.F)    { fuzzTool(f, "mdfence") }
+func FuzzMdfnt(f *testing.F)      { fuzzTool(f, "mdfnt") }
+func FuzzMdfootnote(f *testing.F) { fuzzTool(f, "mdfootnote") }
+func FuzzMdinline(f *testing.F)   { fuzzTool(f, "mdinline") }
+func FuzzMdjoin(f *testing.F)     { fuzzTool(f, "mdjoin") }
+func FuzzMdlist(f *testing.F)     { fuzzTool(f, "mdlist") }
+func FuzzMdmath(f *testing.F)     { fuzzTool(f, "mdmath") }
+func FuzzMdpaste(f *testing.F)    { fuzzTool(f, "mdpaste") }
+func FuzzMdreading(f *testing.F)  { fuzzTool(f, "mdreading") }
+func FuzzMdref(f *testing.F)      { fuzzTool(f, "mdref") }
+func FuzzMdsidenote(f *testing.F) { fuzzTool(f, "mdsidenote") }
+func FuzzMdsmart(f *testing.F)    { fuzzTool(f, "mdsmart") }
+func FuzzMdsplit(f *testing.F)    { fuzzTool(f, "mdsplit") }
+func FuzzMdtable(f *testing.F)    { fuzzTool(f, "mdtable") }
+func FuzzMdtoadoc(f *testing.F)   { fuzzTool(f, "mdtoadoc") }
+func FuzzMdtodjot(f *testing.F)   { fuzzTool(f, "mdtodjot") }
+func FuzzMdtorst(f *testing.F)    { fuzzTool(f, "mdtorst") }
+func FuzzMdunattr(f *testing.F)   { fuzzTool(f, "mdunattr") }
+func FuzzMdunwrap(f *testing.F)   { fuzzTool(f, "mdunwrap") }
+func FuzzMdurl(f *testing.F)      { fuzzTool(f, "mdurl") }
+func FuzzMdwrap(f *testing.F)     { fuzzTool(f, "mdwrap") }
+
+// converters turn Markdown or HTML into another format, so running them on
+// their own output isn't expected to change nothing.
+var converters = map[string]bool{
+	"mdconvert": true,
+	"mdpaste":   true,
+	"mdtoadoc":  true,
+	"mdtodjot":  true,
+	"mdtorst":   true,
+}
+
+// fuzzTool runs the named tool on arbitrary input, checking that it doesn't
+// panic, that valid UTF-8 stays valid, and, unless it's a converter, that
+// its output is stable: T(T(x)) == T(x). Every fixture input seeds it, not
+// just the tool's own.
+func fuzzTool(f *testing.F, name string) {
+	transform, err := tools.New(name, nil)
+	if err != nil {
+		f.Fatalf("%s: %v", name, err)
+	}
+	inputs, err := filepath.Glob("fixtures/*/*.in.md")
+	if err != nil {
+		f.Fatalf("failed to glob fixtures: %v", err)
+	}
+	for _, path := range inputs {
+		input, err := os.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(string(input))
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		output := transform(input)
+		if utf8.ValidString(input) && !utf8.ValidString(output) {
+			t.Fatalf("invalid UTF-8 output\n--- input\n%q\n--- output\n%q", input, output)
+		}
+		if converters[name] {
+			return
+		}
+		if again := transform(output); again != output {
+			t.Fatalf("not idempotent\n--- input\n%q\n--- first pass\n%q\n--- second pass\n%q", input, output, again)
+		}
+	})
+}
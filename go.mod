@@ -5,9 +5,7 @@ go 1.25.0
 require (
 	github.com/JohannesKaufmann/html-to-markdown/v2 v2.5.2
 	github.com/yuin/goldmark v1.8.4
+	golang.org/x/net v0.57.0
 )
 
-require (
-	github.com/JohannesKaufmann/dom v0.3.1 // indirect
-	golang.org/x/net v0.57.0 // indirect
-)
+require github.com/JohannesKaufmann/dom v0.3.1 // indirect
@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// batchRecord is a line of -batch input or output.
+type batchRecord struct {
+	Path    string  `json:"path"`
+	Content *string `json:"content,omitempty"`
+	Error   string  `json:"error,omitempty"`
+}
+
+// runBatch reads newline-delimited JSON records, {"path": "...", "content":
+// "..."}, from r and writes each one to w with its content transformed.
+// The path is only used to look up what .editorconfig says about it; no
+// file is read or written. A record that can't be decoded, or whose
+// transform panics, is written back with an "error" instead of its content,
+// and the batch goes on; runBatch then returns an error counting them.
+func runBatch(r io.Reader, w io.Writer, transform TransformFunc) error {
+	br := bufio.NewReader(r)
+	bw := bufio.NewWriter(w)
+	records, failed := 0, 0
+	for {
+		line, err := br.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			records++
+			out := batchTransform(line, transform)
+			if out.Error != "" {
+				failed++
+			}
+			data, merr := json.Marshal(out)
+			if merr != nil {
+				return merr
+			}
+			bw.Write(append(data, '\n'))
+			// Flush each record, so a caller can feed the next one
+			// after reading its answer.
+			if ferr := bw.Flush(); ferr != nil {
+				return ferr
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d records failed", failed, records)
+	}
+	return nil
+}
+
+// batchTransform returns the output record for the input record line.
+func batchTransform(line []byte, transform TransformFunc) (out batchRecord) {
+	var in batchRecord
+	if err := json.Unmarshal(line, &in); err != nil {
+		out.Error = err.Error()
+		return out
+	}
+	out.Path = in.Path
+	if in.Content == nil {
+		out.Error = "content is missing"
+		return out
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			out.Content = nil
+			out.Error = fmt.Sprint(r)
+		}
+	}()
+	t := transform
+	if in.Path != "" {
+		c, err := LoadEditorConfig(in.Path)
+		if err != nil {
+			out.Error = err.Error()
+			return out
+		}
+		t = c.transform(transform)
+	}
+	result := t(*in.Content)
+	out.Content = &result
+	return out
+}
+
+// streamTransform returns stream as a TransformFunc, for -batch, which
+// holds each record's content whole anyway.
+func streamTransform(stream StreamFunc) TransformFunc {
+	return func(content string) string {
+		var b strings.Builder
+		if err := stream(strings.NewReader(content), &b); err != nil {
+			panic(err)
+		}
+		return b.String()
+	}
+}
@@ -0,0 +1,429 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// EditorConfig holds the .editorconfig properties the tools honor for a
+// file, so their output follows the conventions editors already enforce.
+type EditorConfig struct {
+	// EndOfLine is "lf", "crlf", or "cr", or "" to leave line endings
+	// alone. When it is set, input lines may end in any of them.
+	EndOfLine string
+	// InsertFinalNewline ends the output with a newline when true, and
+	// keeps the input's lack of one when false. Nil leaves it to the tool.
+	InsertFinalNewline *bool
+	// TrimTrailingWhitespace removes whitespace at the ends of lines.
+	TrimTrailingWhitespace bool
+	// MaxLineLength is the width to wrap to, or 0 for none.
+	MaxLineLength int
+}
+
+// LoadEditorConfig returns the properties the .editorconfig files in path's
+// directory and the directories above it, up to one marked root = true,
+// give path. Closer files and later sections take precedence.
+func LoadEditorConfig(path string) (EditorConfig, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return EditorConfig{}, err
+	}
+	files, _, err := EditorConfigFiles(filepath.Dir(abs))
+	if err != nil {
+		return EditorConfig{}, err
+	}
+
+	props := make(map[string]string)
+	for i := len(files) - 1; i >= 0; i-- {
+		if err := readEditorConfig(files[i], abs, props); err != nil {
+			return EditorConfig{}, err
+		}
+	}
+
+	var c EditorConfig
+	switch eol := props["end_of_line"]; eol {
+	case "lf", "crlf", "cr":
+		c.EndOfLine = eol
+	}
+	switch props["insert_final_newline"] {
+	case "true":
+		v := true
+		c.InsertFinalNewline = &v
+	case "false":
+		v := false
+		c.InsertFinalNewline = &v
+	}
+	c.TrimTrailingWhitespace = props["trim_trailing_whitespace"] == "true"
+	if n, err := strconv.Atoi(props["max_line_length"]); err == nil && n > 0 {
+		c.MaxLineLength = n
+	}
+	return c, nil
+}
+
+// EditorConfigFiles returns the .editorconfig files LoadEditorConfig reads
+// for the files in dir, nearest first, and those further up that it
+// doesn't, because they're above one marked root = true.
+func EditorConfigFiles(dir string) (used, unused []string, err error) {
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	root := false
+	for {
+		name := filepath.Join(dir, ".editorconfig")
+		isRoot, err := editorConfigRoot(name)
+		switch {
+		case root:
+			if _, err := os.Stat(name); err == nil {
+				unused = append(unused, name)
+			}
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			return nil, nil, err
+		default:
+			used = append(used, name)
+			root = isRoot
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return used, unused, nil
+		}
+		dir = parent
+	}
+}
+
+// editorConfigRoot reads just the preamble of the .editorconfig file name
+// and reports whether it has root = true.
+func editorConfigRoot(name string) (bool, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			break
+		}
+		if key, value, ok := editorConfigPair(line); ok && key == "root" {
+			return value == "true", nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// readEditorConfig sets props to the values the sections of the
+// .editorconfig file name give the file at path. "unset" removes a value.
+func readEditorConfig(name, path string, props map[string]string) error {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(filepath.Dir(name), path)
+	if err != nil {
+		return err
+	}
+	rel = filepath.ToSlash(rel)
+
+	matches := false
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			matches = editorConfigGlob(line[1 : len(line)-1]).MatchString(rel)
+			continue
+		}
+		key, value, ok := editorConfigPair(line)
+		if !ok || !matches {
+			continue
+		}
+		if value == "unset" {
+			delete(props, key)
+		} else {
+			props[key] = value
+		}
+	}
+	return nil
+}
+
+// editorConfigPair splits a "key = value" line, lowercasing both, as
+// .editorconfig names and values are case-insensitive. Comments and other
+// lines aren't pairs.
+func editorConfigPair(line string) (key, value string, ok bool) {
+	if line == "" || line[0] == '#' || line[0] == ';' {
+		return "", "", false
+	}
+	key, value, ok = strings.Cut(line, "=")
+	if !ok {
+		return "", "", false
+	}
+	return strings.ToLower(strings.TrimSpace(key)), strings.ToLower(strings.TrimSpace(value)), true
+}
+
+// numberRangeRe matches the {n1..n2} glob, which matches the integers from
+// n1 to n2.
+var numberRangeRe = regexp.MustCompile(`^\{(-?\d+)\.\.(-?\d+)\}`)
+
+// editorConfigGlob compiles a section's glob to a regexp matching paths
+// relative to the .editorconfig file's directory. A glob without a slash
+// matches a file name in any directory below it.
+func editorConfigGlob(glob string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	if strings.Contains(glob, "/") {
+		glob = strings.TrimPrefix(glob, "/")
+	} else {
+		b.WriteString("(?:.*/)?")
+	}
+	braces := 0
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case c == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		case c == '*' && strings.HasPrefix(glob[i:], "**"):
+			i++
+			b.WriteString(".*")
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end
+		case c == '{':
+			if m := numberRangeRe.FindStringSubmatch(glob[i:]); m != nil {
+				lo, _ := strconv.Atoi(m[1])
+				hi, _ := strconv.Atoi(m[2])
+				var nums []string
+				for n := lo; n <= hi && len(nums) < 1000; n++ {
+					nums = append(nums, strconv.Itoa(n))
+				}
+				b.WriteString("(?:" + strings.Join(nums, "|") + ")")
+				i += len(m[0]) - 1
+				continue
+			}
+			braces++
+			b.WriteString("(?:")
+		case c == '}' && braces > 0:
+			braces--
+			b.WriteString(")")
+		case c == ',' && braces > 0:
+			b.WriteString("|")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString(strings.Repeat(")", braces) + "$")
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return regexp.MustCompile(`^\b$`) // a section that matches nothing
+	}
+	return re
+}
+
+// LineLength returns a StreamSetup that builds the stream for each file
+// with setup, after setting the flag name on fs to the max_line_length that
+// .editorconfig gives the file, or back to the flag's value when it gives
+// none. A flag given on the command line, under that name or another one
+// for the same value, is left as it is. Call it once fs is parsed.
+func LineLength(fs *flag.FlagSet, name string, setup func() (StreamFunc, error)) StreamSetup {
+	target := fs.Lookup(name)
+	set := target == nil
+	fs.Visit(func(f *flag.Flag) {
+		// Flags defined on the same variable share a Value.
+		if f.Name == name || target != nil && f.Value == target.Value {
+			set = true
+		}
+	})
+	if set {
+		return func(string) (StreamFunc, error) { return setup() }
+	}
+	value := target.Value.String()
+	return func(path string) (StreamFunc, error) {
+		width := value
+		if path != "" {
+			c, err := LoadEditorConfig(path)
+			if err != nil {
+				return nil, err
+			}
+			if c.MaxLineLength > 0 {
+				width = strconv.Itoa(c.MaxLineLength)
+			}
+		}
+		if err := target.Value.Set(width); err != nil {
+			return nil, err
+		}
+		return setup()
+	}
+}
+
+// eol returns the line ending c writes.
+func (c EditorConfig) eol() string {
+	switch c.EndOfLine {
+	case "crlf":
+		return "\r\n"
+	case "cr":
+		return "\r"
+	}
+	return "\n"
+}
+
+// transform wraps t so that it reads and writes content the way c says.
+func (c EditorConfig) transform(t TransformFunc) TransformFunc {
+	if c == (EditorConfig{}) {
+		return t
+	}
+	return func(content string) string {
+		if c.EndOfLine != "" {
+			content = strings.ReplaceAll(content, "\r\n", "\n")
+			content = strings.ReplaceAll(content, "\r", "\n")
+		}
+		var out strings.Builder
+		w := &editorWriter{w: &out, c: c}
+		io.WriteString(w, t(content))
+		w.close(strings.HasSuffix(content, "\n"))
+		return out.String()
+	}
+}
+
+// stream wraps s so that it reads and writes content the way c says.
+func (c EditorConfig) stream(s StreamFunc) StreamFunc {
+	if c == (EditorConfig{}) {
+		return s
+	}
+	return func(r io.Reader, w io.Writer) error {
+		in := &eolReader{r: bufio.NewReader(r), normalize: c.EndOfLine != ""}
+		out := &editorWriter{w: w, c: c}
+		if err := s(in, out); err != nil {
+			return err
+		}
+		if out.err != nil {
+			return out.err
+		}
+		return out.close(in.last == '\n' || in.last == '\r')
+	}
+}
+
+// eolReader reads r, turning CRLF and CR line endings into LF when
+// normalize is set, and keeps the last byte it read.
+type eolReader struct {
+	r         *bufio.Reader
+	normalize bool
+	last      byte
+}
+
+func (e *eolReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if n > 0 && e.r.Buffered() == 0 {
+			break // return what there is rather than block
+		}
+		c, err := e.r.ReadByte()
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, err
+		}
+		e.last = c
+		if c == '\r' && e.normalize {
+			if next, err := e.r.Peek(1); err == nil && next[0] == '\n' {
+				e.r.ReadByte()
+				e.last = '\n'
+			}
+			c = '\n'
+		}
+		p[n] = c
+		n++
+	}
+	return n, nil
+}
+
+// editorWriter writes lines to w with c's line ending, trimming trailing
+// whitespace if c says to. The final line ending is held back until close,
+// which knows whether the input had one.
+type editorWriter struct {
+	w       io.Writer
+	c       EditorConfig
+	line    []byte // the line being written
+	pending bool   // a line ending is owed before the next line
+	inCode  bool   // the line is in a fenced code block
+	err     error
+}
+
+func (e *editorWriter) Write(p []byte) (int, error) {
+	for _, c := range p {
+		if c != '\n' {
+			e.line = append(e.line, c)
+			continue
+		}
+		e.writeLine()
+		e.pending = true
+	}
+	return len(p), e.err
+}
+
+// writeLine writes the owed line ending and the line so far.
+func (e *editorWriter) writeLine() {
+	line := e.line
+	trimmed := strings.TrimSpace(string(line))
+	fence := strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~")
+	// Two or more spaces ending a line of text are a Markdown hard break,
+	// which trimming them would turn into a soft one. In code they're
+	// only whitespace.
+	hardBreak := !e.inCode && !fence && trimmed != "" && strings.HasSuffix(string(line), "  ")
+	if e.c.TrimTrailingWhitespace && !hardBreak {
+		line = []byte(strings.TrimRight(string(line), " \t"))
+	}
+	if fence {
+		e.inCode = !e.inCode
+	}
+	if e.pending {
+		e.write(e.c.eol())
+	}
+	e.write(string(line))
+	e.line = e.line[:0]
+	e.pending = false
+}
+
+func (e *editorWriter) write(s string) {
+	if e.err == nil && s != "" {
+		_, e.err = io.WriteString(e.w, s)
+	}
+}
+
+// close writes what is left, ending it with a newline as c says: always,
+// only if the input ended with one (inputNewline), or, when c doesn't say,
+// as the tool wrote it.
+func (e *editorWriter) close(inputNewline bool) error {
+	final := e.pending
+	if len(e.line) > 0 {
+		e.writeLine()
+		final = false
+	}
+	if f := e.c.InsertFinalNewline; f != nil {
+		final = *f || inputNewline && final
+	}
+	if final {
+		e.write(e.c.eol())
+	}
+	return e.err
+}
@@ -0,0 +1,126 @@
+package cli
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ExpandArgs returns args with each glob pattern replaced by the files it
+// matches, sorted, so that a pattern works the same whether or not the
+// shell expanded it: cmd.exe and PowerShell pass *.md through as it is
+// written. An argument that names a file is kept even if it looks like a
+// pattern, and a pattern that matches nothing is an error.
+func ExpandArgs(args []string) ([]string, error) {
+	var expanded []string
+	for _, arg := range args {
+		if !hasMeta(arg) {
+			expanded = append(expanded, arg)
+			continue
+		}
+		if _, err := os.Stat(arg); err == nil {
+			expanded = append(expanded, arg)
+			continue
+		}
+		matches, err := Glob(arg)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %s", arg)
+		}
+		expanded = append(expanded, matches...)
+	}
+	return expanded, nil
+}
+
+// Glob returns the files that pattern matches, sorted. Its syntax is
+// filepath.Match's, with either slash as a separator on Windows, and a **
+// element matches any number of directories, including none. As in a
+// shell, * and ? don't match a leading dot: .git is only matched by a
+// pattern that spells out the dot.
+func Glob(pattern string) ([]string, error) {
+	elems := strings.Split(filepath.ToSlash(pattern), "/")
+	for _, elem := range elems {
+		if _, err := path.Match(elem, ""); err != nil {
+			return nil, fmt.Errorf("bad pattern %s", pattern)
+		}
+	}
+	// Search from the directory named by the elements before the first
+	// pattern.
+	n := 0
+	for n < len(elems)-1 && !hasMeta(elems[n]) {
+		n++
+	}
+	dir := strings.Join(elems[:n], "/")
+	if n > 0 && dir == "" {
+		dir = "/"
+	}
+	start := dir
+	if start == "" {
+		start = "."
+	}
+
+	var matches []string
+	err := filepath.WalkDir(filepath.FromSlash(start), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == filepath.FromSlash(start) {
+				return nil // no such directory: nothing matches
+			}
+			return err
+		}
+		rel, err := filepath.Rel(filepath.FromSlash(start), p)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if !matchElems(elems[n:], strings.Split(rel, "/"), true) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if matchElems(elems[n:], strings.Split(rel, "/"), false) {
+			matches = append(matches, filepath.FromSlash(path.Join(dir, rel)))
+		}
+		return nil
+	})
+	return matches, err
+}
+
+// matchElems reports whether the path elements elems match the pattern
+// elements, or with prefix, whether a path they begin could.
+func matchElems(pattern, elems []string, prefix bool) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(elems); i++ {
+				if matchElems(pattern[1:], elems[i:], prefix) {
+					return true
+				}
+				if i < len(elems) && strings.HasPrefix(elems[i], ".") {
+					break
+				}
+			}
+			return false
+		}
+		if len(elems) == 0 {
+			return prefix
+		}
+		if strings.HasPrefix(elems[0], ".") && !strings.HasPrefix(pattern[0], ".") {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], elems[0]); !ok {
+			return false
+		}
+		pattern, elems = pattern[1:], elems[1:]
+	}
+	return len(elems) == 0
+}
+
+// hasMeta reports whether s has any of the characters of a glob pattern.
+func hasMeta(s string) bool {
+	return strings.ContainsAny(s, "*?[")
+}
@@ -0,0 +1,118 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/dbh/md-tools/internal/diff"
+)
+
+// RegisterOutputFlag registers -output, the format of a tool's -check or lint
+// report, and returns its value: "text" or "rdjson".
+func RegisterOutputFlag() *string {
+	return flag.String("output", "text", "report `format`: text, or rdjson for reviewdog")
+}
+
+// CheckOutput returns an error if format isn't a -output format.
+func CheckOutput(format string) error {
+	if format != "text" && format != "rdjson" {
+		return fmt.Errorf("unknown -output %q (want text or rdjson)", format)
+	}
+	return nil
+}
+
+// Report collects diagnostics and writes them in the Reviewdog Diagnostic
+// Format (rdjson), so CI can post them as review comments.
+type Report struct {
+	Source      string
+	Diagnostics []Diagnostic
+}
+
+// Diagnostic is one rdjson diagnostic.
+type Diagnostic struct {
+	Message     string       `json:"message"`
+	Location    Location     `json:"location"`
+	Severity    string       `json:"severity,omitempty"`
+	Suggestions []Suggestion `json:"suggestions,omitempty"`
+}
+
+// Location is the file and range a diagnostic applies to.
+type Location struct {
+	Path  string `json:"path"`
+	Range *Range `json:"range,omitempty"`
+}
+
+// Range is a span of a file. Lines and columns are 1-based, and End is
+// exclusive.
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+// Position is a line and column in a file.
+type Position struct {
+	Line   int `json:"line"`
+	Column int `json:"column,omitempty"`
+}
+
+// Suggestion is a fix that replaces a range with text.
+type Suggestion struct {
+	Range Range  `json:"range"`
+	Text  string `json:"text"`
+}
+
+// Problem adds a diagnostic for line (1-based) of path, or for the whole file
+// when line is 0.
+func (r *Report) Problem(path string, line int, message string) {
+	d := Diagnostic{Message: message, Location: Location{Path: path}, Severity: "ERROR"}
+	if line > 0 {
+		d.Location.Range = &Range{Start: Position{Line: line}, End: Position{Line: line}}
+	}
+	r.Diagnostics = append(r.Diagnostics, d)
+}
+
+// Change adds a diagnostic with a suggested fix for each run of lines that
+// differs between the content of path before and after a change.
+func (r *Report) Change(path, before, after, message string) {
+	a, b := diff.SplitLines(before), diff.SplitLines(after)
+	for _, h := range diff.Lines(a, b) {
+		// An insertion replaces a neighbouring line too, so that its range
+		// is on a line of the file.
+		if h.AStart == h.AEnd {
+			if h.AStart > 0 {
+				h.AStart, h.BStart = h.AStart-1, h.BStart-1
+			} else if h.AEnd < len(a) {
+				h.AEnd, h.BEnd = h.AEnd+1, h.BEnd+1
+			}
+		}
+		rng := Range{Start: Position{Line: h.AStart + 1, Column: 1}, End: Position{Line: h.AEnd + 1, Column: 1}}
+		text := ""
+		if h.BEnd > h.BStart {
+			text = strings.Join(b[h.BStart:h.BEnd], "\n") + "\n"
+		}
+		d := Diagnostic{
+			Message:     message,
+			Location:    Location{Path: path, Range: &rng},
+			Severity:    "ERROR",
+			Suggestions: []Suggestion{{Range: rng, Text: text}},
+		}
+		r.Diagnostics = append(r.Diagnostics, d)
+	}
+}
+
+// Write writes the report as an rdjson DiagnosticResult.
+func (r *Report) Write(w io.Writer) error {
+	result := struct {
+		Source      map[string]string `json:"source"`
+		Diagnostics []Diagnostic      `json:"diagnostics"`
+	}{map[string]string{"name": r.Source}, r.Diagnostics}
+	if result.Diagnostics == nil {
+		result.Diagnostics = []Diagnostic{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(result)
+}
@@ -1,3 +1,4 @@
+// Package cli provides common I/O utilities for md-tools binaries.
 package cli
 
 import (
@@ -15,21 +16,39 @@ type TransformFunc func(string) string
 type Flags struct {
 	WriteInPlace bool
 	InPlace      bool
+	Batch        bool
 	ShowVersion  bool
 }
 
-// RegisterFlags registers -w, -i, -v, and -version on the default flag set
-// and returns a Flags whose fields are populated by flag.Parse().
+// RegisterFlags registers -w, -i, -batch, -v, and -version on the default
+// flag set and returns a Flags whose fields are populated by flag.Parse().
 func RegisterFlags() *Flags {
-	f := &Flags{}
+	f := RegisterVersionFlags()
 	flag.BoolVar(&f.WriteInPlace, "w", false, "write result to file instead of stdout")
 	flag.BoolVar(&f.InPlace, "i", false, "read stdin and write result to the file argument")
+	flag.BoolVar(&f.Batch, "batch", false, "read JSON {\"path\", \"content\"} records from stdin, one per line, and write them back transformed")
+	return f
+}
+
+// RegisterVersionFlags registers only -v and -version, for tools that operate
+// on a directory tree rather than following the filter interface of Run.
+func RegisterVersionFlags() *Flags {
+	f := &Flags{}
 	flag.BoolVar(&f.ShowVersion, "v", false, "print version and exit")
 	flag.BoolVar(&f.ShowVersion, "version", false, "print version and exit")
 	flag.Usage = alignedUsage
 	return f
 }
 
+// PrintVersion prints "<toolName> <version>" if -v or -version was given and
+// reports whether it did, so callers can exit early.
+func (f *Flags) PrintVersion(toolName string) bool {
+	if f.ShowVersion {
+		fmt.Println(toolName, Version)
+	}
+	return f.ShowVersion
+}
+
 // alignedUsage prints flag descriptions with all flag names padded to the same
 // column, so help output stays visually consistent across long and short names.
 func alignedUsage() {
@@ -50,7 +69,8 @@ func alignedUsage() {
 		if _, isBool := f.Value.(interface{ IsBoolFlag() bool }); !isBool {
 			name += " " + flagTypeName(f)
 		}
-		fmt.Fprintf(w, "  %-*s  %s", widest, name, f.Usage)
+		_, usage := flag.UnquoteUsage(f)
+		fmt.Fprintf(w, "  %-*s  %s", widest, name, usage)
 		if f.DefValue != "" && f.DefValue != "false" && f.DefValue != "0" {
 			fmt.Fprintf(w, " (default %s)", f.DefValue)
 		}
@@ -71,17 +91,50 @@ func flagTypeName(f *flag.Flag) string {
 // Run executes a CLI tool with the standard md-tools interface. It dispatches
 // on the parsed flags: -v prints the version; -w writes the result back to each
 // file argument; -i reads stdin and writes the result to the single file
-// argument. The default reads from files (or stdin) and writes to stdout.
+// argument; -batch transforms the JSON records on stdin, as runBatch
+// describes. The default transforms stdin, or else each file argument on its
+// own, and writes the results to stdout one after another; files are never
+// joined into one document, so each keeps its own references and footnotes.
+// The output for a file follows what .editorconfig says about it, and glob
+// patterns among args are expanded with ExpandArgs.
 func Run(toolName string, flags *Flags, args []string, transform TransformFunc) error {
-	if flags.ShowVersion {
-		fmt.Println(toolName, Version)
+	return RunSetup(toolName, flags, args, func(string) (TransformFunc, error) {
+		return transform, nil
+	})
+}
+
+// TransformSetup returns the transform for the file at path, or for stdin
+// when path is "".
+type TransformSetup func(path string) (TransformFunc, error)
+
+// RunSetup is Run for a tool whose transform depends on the file it
+// transforms, such as one that runs code from the file's directory; setup
+// builds the transform for each file in turn.
+func RunSetup(toolName string, flags *Flags, args []string, setup TransformSetup) error {
+	if flags.PrintVersion(toolName) {
 		return nil
 	}
 
+	args, err := ExpandArgs(args)
+	if err != nil {
+		return err
+	}
+
 	if flags.WriteInPlace && flags.InPlace {
 		return fmt.Errorf("-w and -i are mutually exclusive")
 	}
 
+	if flags.Batch {
+		if err := checkBatch(flags, args); err != nil {
+			return err
+		}
+		transform, err := setup("")
+		if err != nil {
+			return err
+		}
+		return runBatch(os.Stdin, os.Stdout, transform)
+	}
+
 	if flags.InPlace {
 		if len(args) != 1 {
 			return fmt.Errorf("-i requires exactly one file argument")
@@ -89,11 +142,19 @@ func Run(toolName string, flags *Flags, args []string, transform TransformFunc)
 		if isStdinTerminal() {
 			return fmt.Errorf("-i requires data on stdin")
 		}
+		c, err := LoadEditorConfig(args[0])
+		if err != nil {
+			return err
+		}
+		transform, err := setup(args[0])
+		if err != nil {
+			return err
+		}
 		data, err := io.ReadAll(os.Stdin)
 		if err != nil {
 			return err
 		}
-		result := transform(string(data))
+		result := c.transform(transform)(string(data))
 		return os.WriteFile(args[0], []byte(result), 0644)
 	}
 
@@ -102,34 +163,44 @@ func Run(toolName string, flags *Flags, args []string, transform TransformFunc)
 			return fmt.Errorf("-w requires at least one file argument")
 		}
 		for _, path := range args {
-			if err := processFile(path, transform); err != nil {
+			if err := processFile(path, setup); err != nil {
 				return fmt.Errorf("%s: %w", path, err)
 			}
 		}
 		return nil
 	}
 
-	// Default: read from files or stdin, write to stdout
-	var input io.ReadCloser
+	// Default: transform stdin or each file, and write to stdout
 	if len(args) == 0 {
-		input = os.Stdin
-	} else {
-		f, err := os.Open(args[0])
+		transform, err := setup("")
 		if err != nil {
 			return err
 		}
-		input = f
-	}
-	defer input.Close()
-
-	data, err := io.ReadAll(input)
-	if err != nil {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.WriteString(transform(string(data)))
 		return err
 	}
-
-	result := transform(string(data))
-	_, err = os.Stdout.WriteString(result)
-	return err
+	for _, path := range args {
+		c, err := LoadEditorConfig(path)
+		if err != nil {
+			return err
+		}
+		transform, err := setup(path)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stdout.WriteString(c.transform(transform)(string(data))); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // isStdinTerminal reports whether stdin is attached to a terminal (no piped data).
@@ -142,13 +213,21 @@ func isStdinTerminal() bool {
 }
 
 // processFile transforms a file in place, only writing if content changed.
-func processFile(path string, transform TransformFunc) error {
+func processFile(path string, setup TransformSetup) error {
+	c, err := LoadEditorConfig(path)
+	if err != nil {
+		return err
+	}
+	transform, err := setup(path)
+	if err != nil {
+		return err
+	}
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return err
 	}
 
-	result := transform(string(data))
+	result := c.transform(transform)(string(data))
 
 	// Only write if content changed
 	if result == string(data) {
@@ -157,3 +236,15 @@ func processFile(path string, transform TransformFunc) error {
 
 	return os.WriteFile(path, []byte(result), 0644)
 }
+
+// checkBatch returns an error if -batch was given with the flags or
+// arguments for files.
+func checkBatch(flags *Flags, args []string) error {
+	if flags.WriteInPlace || flags.InPlace {
+		return fmt.Errorf("-batch can't be used with -w or -i")
+	}
+	if len(args) > 0 {
+		return fmt.Errorf("-batch reads its documents from stdin, not file arguments")
+	}
+	return nil
+}
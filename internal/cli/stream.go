@@ -0,0 +1,221 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// StreamFunc transforms the content read from r and writes the result to w,
+// holding as little of it in memory as the transformation allows.
+type StreamFunc func(r io.Reader, w io.Writer) error
+
+// RunStream is Run for a tool that can transform its input as a stream, so
+// files far larger than memory can be processed. Files written with -w are
+// first written next to the original and only replace it if they differ.
+// The output for a file follows what .editorconfig says about it, each file
+// argument is transformed on its own, and glob patterns among args are
+// expanded, as they are for Run.
+func RunStream(toolName string, flags *Flags, args []string, stream StreamFunc) error {
+	return RunStreamSetup(toolName, flags, args, func(string) (StreamFunc, error) {
+		return stream, nil
+	})
+}
+
+// StreamSetup returns the stream to transform the file at path with, or
+// stdin when path is "".
+type StreamSetup func(path string) (StreamFunc, error)
+
+// RunStreamSetup is RunStream for a tool whose stream depends on the file
+// it transforms, such as one that follows the file's .editorconfig
+// max_line_length; setup builds the stream for each file in turn.
+func RunStreamSetup(toolName string, flags *Flags, args []string, setup StreamSetup) error {
+	if flags.PrintVersion(toolName) {
+		return nil
+	}
+
+	args, err := ExpandArgs(args)
+	if err != nil {
+		return err
+	}
+
+	if flags.WriteInPlace && flags.InPlace {
+		return fmt.Errorf("-w and -i are mutually exclusive")
+	}
+
+	if flags.Batch {
+		if err := checkBatch(flags, args); err != nil {
+			return err
+		}
+		stream, err := setup("")
+		if err != nil {
+			return err
+		}
+		return runBatch(os.Stdin, os.Stdout, streamTransform(stream))
+	}
+
+	if flags.InPlace {
+		if len(args) != 1 {
+			return fmt.Errorf("-i requires exactly one file argument")
+		}
+		if isStdinTerminal() {
+			return fmt.Errorf("-i requires data on stdin")
+		}
+		c, err := LoadEditorConfig(args[0])
+		if err != nil {
+			return err
+		}
+		stream, err := setup(args[0])
+		if err != nil {
+			return err
+		}
+		// The file may still be feeding the pipeline into stdin, so it is
+		// only replaced once stdin is used up.
+		tmp, err := streamTemp(args[0], os.Stdin, c.stream(stream))
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp)
+		mode := os.FileMode(0644)
+		if info, err := os.Stat(args[0]); err == nil {
+			mode = info.Mode().Perm()
+		}
+		if err := os.Chmod(tmp, mode); err != nil {
+			return err
+		}
+		return os.Rename(tmp, args[0])
+	}
+
+	if flags.WriteInPlace {
+		if len(args) == 0 {
+			return fmt.Errorf("-w requires at least one file argument")
+		}
+		for _, path := range args {
+			if err := streamFile(path, setup); err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+		}
+		return nil
+	}
+
+	// Default: transform stdin or each file, and write to stdout
+	if len(args) == 0 {
+		stream, err := setup("")
+		if err != nil {
+			return err
+		}
+		return stream(os.Stdin, os.Stdout)
+	}
+	for _, path := range args {
+		if err := streamStdout(path, setup); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// streamStdout transforms the file at path to stdout.
+func streamStdout(path string, setup StreamSetup) error {
+	c, err := LoadEditorConfig(path)
+	if err != nil {
+		return err
+	}
+	stream, err := setup(path)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return c.stream(stream)(f, os.Stdout)
+}
+
+// streamFile transforms a file in place through a temporary file in the same
+// directory, only replacing the file if the content changed.
+func streamFile(path string, setup StreamSetup) error {
+	c, err := LoadEditorConfig(path)
+	if err != nil {
+		return err
+	}
+	stream, err := setup(path)
+	if err != nil {
+		return err
+	}
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	tmp, err := streamTemp(path, in, c.stream(stream))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	same, err := sameContent(path, tmp)
+	if err != nil || same {
+		return err
+	}
+	if err := os.Chmod(tmp, info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// streamTemp streams r into a new temporary file next to path and returns
+// its name. The caller renames or removes it.
+func streamTemp(path string, r io.Reader, stream StreamFunc) (string, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return "", err
+	}
+	err = stream(r, tmp)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// sameContent reports whether the files a and b hold the same bytes.
+func sameContent(a, b string) (bool, error) {
+	fa, err := os.Open(a)
+	if err != nil {
+		return false, err
+	}
+	defer fa.Close()
+	fb, err := os.Open(b)
+	if err != nil {
+		return false, err
+	}
+	defer fb.Close()
+	bufA, bufB := make([]byte, 64*1024), make([]byte, 64*1024)
+	for {
+		na, errA := io.ReadFull(fa, bufA)
+		nb, errB := io.ReadFull(fb, bufB)
+		if !bytes.Equal(bufA[:na], bufB[:nb]) {
+			return false, nil
+		}
+		endA := errA == io.EOF || errA == io.ErrUnexpectedEOF
+		endB := errB == io.EOF || errB == io.ErrUnexpectedEOF
+		switch {
+		case endA && endB:
+			return true, nil
+		case errA != nil && !endA:
+			return false, errA
+		case errB != nil && !endB:
+			return false, errB
+		}
+	}
+}
@@ -0,0 +1,219 @@
+// Package config reads a project's .mdtools.toml, which configures the
+// pipeline that mdtools runs over its Markdown files.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FileName is the name of the configuration file.
+const FileName = ".mdtools.toml"
+
+// ErrNotFound is returned by Find when no directory has a configuration file.
+var ErrNotFound = errors.New("no " + FileName + " found")
+
+// Config is a project configuration:
+//
+//	[pipe]
+//	files = ["*.md"]                  # names of the files the pipeline applies to
+//	steps = ["mdjoin", "house-style"] # commands and plugins it runs, in order
+//
+//	[plugins.house-style]
+//	command = "scripts/house-style"   # relative to the configuration file
+//	args = ["--strict"]
+//
+//	[plugins.house-style.options]
+//	spelling = "en-GB"
+type Config struct {
+	// Path is the file the configuration was read from.
+	Path string
+	// Files are glob patterns for the names of the Markdown files the
+	// pipeline applies to. The default is *.md and *.markdown.
+	Files []string
+	// Steps are the commands of the pipeline, each a tool with its
+	// arguments, that a file is piped through in order.
+	Steps []string
+	// Plugins are the external transforms steps can name, by name.
+	Plugins map[string]Plugin
+}
+
+// Plugin is an external transform that speaks the plugin protocol.
+type Plugin struct {
+	// Command is the executable, relative to the configuration file's
+	// directory if it has a directory part, or else found in $PATH.
+	Command string
+	// Args are passed to Command.
+	Args []string
+	// Options are sent to the plugin with each request.
+	Options map[string]any
+}
+
+// Find returns the path of the configuration file in dir or the nearest
+// directory above it that has one.
+func Find(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		p := filepath.Join(dir, FileName)
+		if _, err := os.Stat(p); err == nil {
+			return p, nil
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", ErrNotFound
+		}
+		dir = parent
+	}
+}
+
+// Load reads the configuration file at p.
+func Load(p string) (*Config, error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	c, err := parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+	c.Path = p
+	for name, plugin := range c.Plugins {
+		if strings.ContainsRune(plugin.Command, '/') && !filepath.IsAbs(plugin.Command) {
+			plugin.Command = filepath.Join(filepath.Dir(p), filepath.FromSlash(plugin.Command))
+			c.Plugins[name] = plugin
+		}
+	}
+	return c, nil
+}
+
+// parse decodes a configuration file, rejecting keys it doesn't know so that
+// typos don't go unnoticed.
+func parse(src string) (*Config, error) {
+	doc, err := parseTOML(src)
+	if err != nil {
+		return nil, err
+	}
+	c := &Config{Files: []string{"*.md", "*.markdown"}}
+	for _, key := range sortedKeys(doc) {
+		switch key {
+		case "pipe":
+			pipe, ok := doc[key].(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("pipe must be a table")
+			}
+			for _, k := range sortedKeys(pipe) {
+				switch k {
+				case "files":
+					if c.Files, err = stringList(pipe, k, "pipe."); err != nil {
+						return nil, err
+					}
+				case "steps":
+					if c.Steps, err = stringList(pipe, k, "pipe."); err != nil {
+						return nil, err
+					}
+				default:
+					return nil, fmt.Errorf("unknown key pipe.%s", k)
+				}
+			}
+		case "plugins":
+			plugins, ok := doc[key].(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("plugins must be a table")
+			}
+			c.Plugins = make(map[string]Plugin)
+			for _, name := range sortedKeys(plugins) {
+				if c.Plugins[name], err = parsePlugin(name, plugins[name]); err != nil {
+					return nil, err
+				}
+			}
+		default:
+			return nil, fmt.Errorf("unknown key %s", key)
+		}
+	}
+	for _, pattern := range c.Files {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("pipe.files: bad pattern %q", pattern)
+		}
+	}
+	return c, nil
+}
+
+// parsePlugin decodes the [plugins.<name>] table v.
+func parsePlugin(name string, v any) (Plugin, error) {
+	var p Plugin
+	prefix := "plugins." + name + "."
+	t, ok := v.(map[string]any)
+	if !ok || name == "" || strings.ContainsAny(name, " \t") {
+		return p, fmt.Errorf("plugins.%s must be a table named without spaces", name)
+	}
+	var err error
+	for _, k := range sortedKeys(t) {
+		switch k {
+		case "command":
+			if p.Command, ok = t[k].(string); !ok || p.Command == "" {
+				return p, fmt.Errorf("%scommand must be a string", prefix)
+			}
+		case "args":
+			if p.Args, err = stringList(t, k, prefix); err != nil {
+				return p, err
+			}
+		case "options":
+			if p.Options, ok = t[k].(map[string]any); !ok {
+				return p, fmt.Errorf("%soptions must be a table", prefix)
+			}
+		default:
+			return p, fmt.Errorf("unknown key %s%s", prefix, k)
+		}
+	}
+	if p.Command == "" {
+		return p, fmt.Errorf("%scommand is missing", prefix)
+	}
+	return p, nil
+}
+
+// Matches reports whether the pipeline applies to the file at p.
+func (c *Config) Matches(p string) bool {
+	name := filepath.Base(p)
+	for _, pattern := range c.Files {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// stringList returns t[key] as a list of strings.
+func stringList(t map[string]any, key, prefix string) ([]string, error) {
+	list, ok := t[key].([]any)
+	if !ok {
+		return nil, fmt.Errorf("%s%s must be an array of strings", prefix, key)
+	}
+	out := make([]string, 0, len(list))
+	for _, v := range list {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s%s must be an array of strings", prefix, key)
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+func sortedKeys(t map[string]any) []string {
+	keys := make([]string, 0, len(t))
+	for k := range t {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,275 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// parseTOML parses the subset of TOML that .mdtools.toml uses: tables,
+// dotted table names, and keys whose values are strings, integers, booleans,
+// or arrays of those. Tables are map[string]any, arrays []any, and integers
+// int64.
+func parseTOML(src string) (map[string]any, error) {
+	p := &tomlParser{src: src, line: 1}
+	root := make(map[string]any)
+	table := root
+	for {
+		p.skipSpace(true)
+		if p.eof() {
+			return root, nil
+		}
+		if p.peek() == '[' {
+			p.pos++
+			if p.peek() == '[' {
+				return nil, p.errorf("arrays of tables aren't supported")
+			}
+			keys, err := p.keyPath()
+			if err != nil {
+				return nil, err
+			}
+			p.skipSpace(false)
+			if p.peek() != ']' {
+				return nil, p.errorf("expected ] after table name")
+			}
+			p.pos++
+			if table, err = p.table(root, keys); err != nil {
+				return nil, err
+			}
+		} else {
+			keys, err := p.keyPath()
+			if err != nil {
+				return nil, err
+			}
+			p.skipSpace(false)
+			if p.peek() != '=' {
+				return nil, p.errorf("expected = after key")
+			}
+			p.pos++
+			p.skipSpace(false)
+			value, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			parent, err := p.table(table, keys[:len(keys)-1])
+			if err != nil {
+				return nil, err
+			}
+			key := keys[len(keys)-1]
+			if _, ok := parent[key]; ok {
+				return nil, p.errorf("duplicate key %q", key)
+			}
+			parent[key] = value
+		}
+		p.skipSpace(false)
+		if !p.eof() && p.peek() != '\n' {
+			return nil, p.errorf("unexpected %q after value", p.peek())
+		}
+	}
+}
+
+// tomlParser holds the position in the source being parsed.
+type tomlParser struct {
+	src  string
+	pos  int
+	line int
+}
+
+func (p *tomlParser) eof() bool  { return p.pos >= len(p.src) }
+func (p *tomlParser) peek() byte { return p.src[p.pos] }
+
+func (p *tomlParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+// skipSpace skips spaces, tabs, and comments, and newlines too when
+// newlines is true.
+func (p *tomlParser) skipSpace(newlines bool) {
+	for !p.eof() {
+		switch c := p.peek(); {
+		case c == ' ' || c == '\t' || c == '\r':
+			p.pos++
+		case c == '\n' && newlines:
+			p.pos++
+			p.line++
+		case c == '#':
+			for !p.eof() && p.peek() != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// table returns the table at keys under t, creating missing tables.
+func (p *tomlParser) table(t map[string]any, keys []string) (map[string]any, error) {
+	for _, k := range keys {
+		switch v := t[k].(type) {
+		case nil:
+			next := make(map[string]any)
+			t[k] = next
+			t = next
+		case map[string]any:
+			t = v
+		default:
+			return nil, p.errorf("%q is not a table", k)
+		}
+	}
+	return t, nil
+}
+
+// keyPath parses a key, or dotted keys, made of bare or quoted parts.
+func (p *tomlParser) keyPath() ([]string, error) {
+	var keys []string
+	for {
+		p.skipSpace(false)
+		if p.eof() {
+			return nil, p.errorf("expected a key")
+		}
+		var key string
+		switch c := p.peek(); {
+		case c == '"' || c == '\'':
+			s, err := p.str()
+			if err != nil {
+				return nil, err
+			}
+			key = s
+		default:
+			start := p.pos
+			for !p.eof() && isBareKeyChar(p.peek()) {
+				p.pos++
+			}
+			if p.pos == start {
+				return nil, p.errorf("expected a key, found %q", p.peek())
+			}
+			key = p.src[start:p.pos]
+		}
+		keys = append(keys, key)
+		p.skipSpace(false)
+		if p.eof() || p.peek() != '.' {
+			return keys, nil
+		}
+		p.pos++
+	}
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+// value parses a string, integer, boolean, or array.
+func (p *tomlParser) value() (any, error) {
+	if p.eof() {
+		return nil, p.errorf("expected a value")
+	}
+	switch c := p.peek(); {
+	case c == '"' || c == '\'':
+		return p.str()
+	case c == '[':
+		return p.array()
+	case strings.HasPrefix(p.src[p.pos:], "true"):
+		p.pos += 4
+		return true, nil
+	case strings.HasPrefix(p.src[p.pos:], "false"):
+		p.pos += 5
+		return false, nil
+	case c == '-' || c == '+' || c >= '0' && c <= '9':
+		start := p.pos
+		p.pos++
+		for !p.eof() && (p.peek() >= '0' && p.peek() <= '9' || p.peek() == '_') {
+			p.pos++
+		}
+		n, err := strconv.ParseInt(strings.ReplaceAll(p.src[start:p.pos], "_", ""), 10, 64)
+		if err != nil {
+			return nil, p.errorf("bad integer %q", p.src[start:p.pos])
+		}
+		return n, nil
+	}
+	return nil, p.errorf("unsupported value starting %q", p.peek())
+}
+
+// array parses an array, which may span lines and end with a comma.
+func (p *tomlParser) array() ([]any, error) {
+	p.pos++ // [
+	values := []any{}
+	for {
+		p.skipSpace(true)
+		if p.eof() {
+			return nil, p.errorf("unterminated array")
+		}
+		if p.peek() == ']' {
+			p.pos++
+			return values, nil
+		}
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+		p.skipSpace(true)
+		if p.eof() {
+			return nil, p.errorf("unterminated array")
+		}
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ']':
+		default:
+			return nil, p.errorf("expected , or ] in array")
+		}
+	}
+}
+
+// str parses a one-line basic ("…") or literal ('…') string.
+func (p *tomlParser) str() (string, error) {
+	quote := p.peek()
+	p.pos++
+	var b strings.Builder
+	for {
+		if p.eof() || p.peek() == '\n' {
+			return "", p.errorf("unterminated string")
+		}
+		c := p.peek()
+		p.pos++
+		switch {
+		case c == quote:
+			return b.String(), nil
+		case c == '\\' && quote == '"':
+			if p.eof() {
+				return "", p.errorf("unterminated string")
+			}
+			e := p.peek()
+			p.pos++
+			switch e {
+			case '"', '\\':
+				b.WriteByte(e)
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case 'u', 'U':
+				n := 4
+				if e == 'U' {
+					n = 8
+				}
+				if p.pos+n > len(p.src) {
+					return "", p.errorf("bad \\%c escape", e)
+				}
+				r, err := strconv.ParseUint(p.src[p.pos:p.pos+n], 16, 32)
+				if err != nil || !utf8.ValidRune(rune(r)) {
+					return "", p.errorf("bad \\%c escape", e)
+				}
+				b.WriteRune(rune(r))
+				p.pos += n
+			default:
+				return "", p.errorf("bad escape \\%c", e)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+}
@@ -0,0 +1,355 @@
+// Package corpus provides directory-level utilities for md-tools binaries that
+// operate on a tree of Markdown files rather than a single input stream.
+package corpus
+
+import (
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+
+	"github.com/dbh/md-tools/internal/markdown"
+)
+
+// md parses documents. Goldmark instances are safe for concurrent use, so
+// one serves every call.
+var md = goldmark.New()
+
+// Corpus is the set of Markdown files found under a root directory.
+type Corpus struct {
+	Root  string
+	Files []string // slash-separated paths relative to Root, sorted
+	index map[string]bool
+}
+
+// Heading is a heading found in a corpus file.
+type Heading struct {
+	Level int
+	Text  string
+	Slug  string // GitHub-style anchor, unique within the file
+	Line  int    // 1-based
+}
+
+// Link is a link found in a corpus file.
+type Link struct {
+	Source   string // file containing the link, relative to the corpus root
+	Line     int    // 1-based line of the link text, or 0 if unknown
+	Dest     string // destination exactly as written
+	Target   string // resolved path relative to the root, "" for external links
+	Fragment string // text after the "#" in Dest, if any
+	Image    bool   // true for ![alt](dest) images
+}
+
+// Load walks root and collects every *.md file, skipping hidden directories.
+func Load(root string) (*Corpus, error) {
+	c := &Corpus{Root: root, index: make(map[string]bool)}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p != root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !IsMarkdown(p) {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		c.Files = append(c.Files, rel)
+		c.index[rel] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(c.Files)
+	return c, nil
+}
+
+// IsMarkdown reports whether the path has a Markdown file extension.
+func IsMarkdown(p string) bool {
+	ext := strings.ToLower(path.Ext(p))
+	return ext == ".md" || ext == ".markdown"
+}
+
+// Has reports whether rel names a Markdown file in the corpus.
+func (c *Corpus) Has(rel string) bool {
+	return c.index[rel]
+}
+
+// Abs returns the filesystem path of a corpus-relative path.
+func (c *Corpus) Abs(rel string) string {
+	return filepath.Join(c.Root, filepath.FromSlash(rel))
+}
+
+// Read returns the contents of a corpus file.
+func (c *Corpus) Read(rel string) ([]byte, error) {
+	return os.ReadFile(c.Abs(rel))
+}
+
+// Exists reports whether rel names any file or directory under the root, not
+// only Markdown files (e.g. images or downloads that links point to).
+func (c *Corpus) Exists(rel string) bool {
+	if c.index[rel] {
+		return true
+	}
+	_, err := os.Stat(c.Abs(rel))
+	return err == nil
+}
+
+// Links parses content (the text of the corpus file source) and returns every
+// link and image in document order. Reference-style links are reported with
+// their resolved destination.
+func (c *Corpus) Links(source string, content []byte) []Link {
+	doc := md.Parser().Parse(text.NewReader(content))
+	var links []Link
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		var dest string
+		image := false
+		switch node := n.(type) {
+		case *ast.Link:
+			dest = string(node.Destination)
+		case *ast.Image:
+			dest = string(node.Destination)
+			image = true
+		default:
+			return ast.WalkContinue, nil
+		}
+		l := Link{Source: source, Line: nodeLine(n, content), Dest: dest, Image: image}
+		l.Target, l.Fragment = c.Resolve(source, dest)
+		links = append(links, l)
+		return ast.WalkContinue, nil
+	})
+	return links
+}
+
+// Resolve resolves a link destination written in the file source to a path
+// relative to the corpus root. External destinations (with a scheme or host)
+// resolve to "". A destination without an extension resolves to the matching
+// Markdown file when one exists, so extensionless links work as SSGs expect.
+func (c *Corpus) Resolve(source, dest string) (target, fragment string) {
+	if dest == "" {
+		return "", ""
+	}
+	u, err := url.Parse(dest)
+	if err != nil || u.Scheme != "" || u.Host != "" {
+		return "", ""
+	}
+	fragment = u.Fragment
+	p := u.Path
+	if p == "" {
+		return source, fragment
+	}
+	if strings.HasPrefix(p, "/") {
+		target = path.Clean(strings.TrimPrefix(p, "/"))
+	} else {
+		target = path.Join(path.Dir(source), p)
+	}
+	if path.Ext(target) == "" && !c.index[target] {
+		if c.index[target+".md"] {
+			target += ".md"
+		} else if c.index[path.Join(target, "index.md")] {
+			target = path.Join(target, "index.md")
+		}
+	}
+	return target, fragment
+}
+
+// BookOrder returns files sorted depth-first by path, the reading order of a
+// documentation tree: in each directory, files come before subdirectories,
+// and index.md or README.md comes first.
+func BookOrder(files []string) []string {
+	key := func(rel string) string {
+		dir, base := path.Split(rel)
+		if IsIndex(base) {
+			base = ""
+		}
+		return dir + "\x00" + base
+	}
+	sorted := append([]string(nil), files...)
+	sort.SliceStable(sorted, func(i, j int) bool { return key(sorted[i]) < key(sorted[j]) })
+	return sorted
+}
+
+// IsIndex reports whether a file name is a directory's landing page,
+// index.md or README.md.
+func IsIndex(name string) bool {
+	return strings.EqualFold(name, "index.md") || strings.EqualFold(name, "README.md")
+}
+
+// IsSummary reports whether the file rel is a SUMMARY.md, the table of
+// contents of an mdBook or a MkDocs literate nav, which isn't a page.
+func IsSummary(rel string) bool {
+	return strings.EqualFold(path.Base(rel), "SUMMARY.md")
+}
+
+// RelLink returns the relative link destination from file from to file to,
+// both corpus-relative.
+func RelLink(from, to string) string {
+	rel, err := filepath.Rel(filepath.FromSlash(path.Dir(from)), filepath.FromSlash(to))
+	if err != nil {
+		return to
+	}
+	return filepath.ToSlash(rel)
+}
+
+// MarkdownLink returns a Markdown link from file from to file to, both
+// corpus-relative, with the title of to as its text. Brackets in the title
+// are escaped, and the destination is enclosed in angle brackets when it
+// holds spaces.
+func MarkdownLink(title, from, to string) string {
+	return "[" + LinkText(title) + "](" + markdown.Destination(RelLink(from, to)) + ")"
+}
+
+// LinkText escapes the brackets in title, such as those of a link in a
+// heading, so that it can be a link's text. Backslash escapes already in it
+// are kept.
+func LinkText(title string) string {
+	var text strings.Builder
+	for i := 0; i < len(title); i++ {
+		switch c := title[i]; c {
+		case '\\':
+			text.WriteByte(c)
+			if i+1 < len(title) {
+				i++
+				text.WriteByte(title[i])
+			}
+			continue
+		case '[', ']':
+			text.WriteByte('\\')
+		}
+		text.WriteByte(title[i])
+	}
+	return text.String()
+}
+
+// Title returns the text of the first level-one ATX heading in content, or the
+// file name without its extension when there is none.
+func Title(rel string, content []byte) string {
+	inFence := false
+	for _, line := range strings.Split(string(content), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+			continue
+		}
+		if !inFence && strings.HasPrefix(line, "# ") {
+			if title := strings.TrimSpace(strings.TrimRight(line[2:], "# ")); title != "" {
+				return title
+			}
+		}
+	}
+	base := path.Base(rel)
+	return strings.TrimSuffix(base, path.Ext(base))
+}
+
+// Headings returns the ATX and setext headings in content in document order.
+func Headings(content []byte) []Heading {
+	doc := md.Parser().Parse(text.NewReader(content))
+	var headings []Heading
+	var slugs markdown.Slugger
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		h, ok := n.(*ast.Heading)
+		if !ok || !entering {
+			return ast.WalkContinue, nil
+		}
+		t := inlineText(h, content)
+		headings = append(headings, Heading{
+			Level: h.Level,
+			Text:  t,
+			Slug:  slugs.Slug(t),
+			Line:  nodeLine(h, content),
+		})
+		return ast.WalkSkipChildren, nil
+	})
+	return headings
+}
+
+// CodeRanges returns the byte ranges of code blocks and code spans in content,
+// where link-like text is literal and must not be rewritten.
+func CodeRanges(content []byte) []markdown.ByteRange {
+	doc := md.Parser().Parse(text.NewReader(content))
+	ranges := markdown.CodeBlockRanges(doc, content)
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		if span, ok := n.(*ast.CodeSpan); ok {
+			for c := span.FirstChild(); c != nil; c = c.NextSibling() {
+				if t, ok := c.(*ast.Text); ok {
+					ranges = append(ranges, markdown.ByteRange{Start: t.Segment.Start, End: t.Segment.Stop})
+				}
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	return ranges
+}
+
+// inlineText returns the plain text of an inline container, dropping markup
+// delimiters but keeping code span contents.
+func inlineText(n ast.Node, source []byte) string {
+	var b strings.Builder
+	ast.Walk(n, func(c ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch t := c.(type) {
+		case *ast.Text:
+			b.Write(t.Segment.Value(source))
+			if t.SoftLineBreak() {
+				b.WriteByte(' ')
+			}
+		case *ast.String:
+			b.Write(t.Value)
+		}
+		return ast.WalkContinue, nil
+	})
+	return b.String()
+}
+
+// nodeLine returns the 1-based source line of the first text inside n, or 0
+// when n has no text (e.g. an empty link).
+func nodeLine(n ast.Node, source []byte) int {
+	start := -1
+	ast.Walk(n, func(c ast.Node, entering bool) (ast.WalkStatus, error) {
+		if t, ok := c.(*ast.Text); ok && entering {
+			start = t.Segment.Start
+			return ast.WalkStop, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	if start < 0 {
+		return 0
+	}
+	return strings.Count(string(source[:start]), "\n") + 1
+}
+
+// Update writes content to the corpus file rel if it differs from old and
+// reports whether the file changed. When check is true nothing is written; the
+// return value reports whether the file is out of date.
+func (c *Corpus) Update(rel string, old []byte, content string, check bool) (bool, error) {
+	if content == string(old) {
+		return false, nil
+	}
+	if check {
+		return true, nil
+	}
+	return true, os.WriteFile(c.Abs(rel), []byte(content), 0644)
+}
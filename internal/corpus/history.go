@@ -0,0 +1,46 @@
+package corpus
+
+import (
+	"bufio"
+	"bytes"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// History is the first and last commit time of a file.
+type History struct {
+	Created, Modified time.Time
+}
+
+// GitHistory returns the commit history of the files under root, keyed by
+// path relative to root. It returns nil when root isn't in a git repository.
+func GitHistory(root string) map[string]History {
+	cmd := exec.Command("git", "-C", root, "-c", "core.quotepath=off", "log", "--format=@%cI", "--name-only", "--relative", "--", ".")
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		return nil
+	}
+
+	// Commits are listed newest first: the first time a file appears is its
+	// last modification and the last time is when it was added.
+	files := make(map[string]History)
+	var when time.Time
+	sc := bufio.NewScanner(&out)
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case strings.HasPrefix(line, "@"):
+			when, _ = time.Parse(time.RFC3339, line[1:])
+		case line != "":
+			h, seen := files[line]
+			if !seen {
+				h.Modified = when
+			}
+			h.Created = when
+			files[line] = h
+		}
+	}
+	return files
+}
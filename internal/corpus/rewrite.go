@@ -0,0 +1,160 @@
+package corpus
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/text"
+
+	"github.com/dbh/md-tools/internal/markdown"
+	"github.com/dbh/md-tools/internal/markdown/links"
+)
+
+// Destinations returns the destination of every link, image, and autolink in
+// content, in document order. Reference-style links report the destination
+// of their definition.
+func Destinations(content []byte) []string {
+	doc := md.Parser().Parse(text.NewReader(content))
+	var dests []string
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch node := n.(type) {
+		case *ast.Link:
+			dests = append(dests, string(node.Destination))
+		case *ast.Image:
+			dests = append(dests, string(node.Destination))
+		case *ast.AutoLink:
+			if node.AutoLinkType == ast.AutoLinkURL {
+				dests = append(dests, string(node.URL(content)))
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	return dests
+}
+
+// linkify parses documents for RewriteDests, reading bare URLs as GFM does,
+// and the footnotes nothing refers to, so the links in them are found too.
+var linkify = goldmark.New(goldmark.WithExtensions(links.Footnotes, extension.Linkify))
+
+// RewriteDests returns content with the destination of each link, image,
+// autolink, and reference definition, including a definition nothing uses,
+// replaced by what rewrite returns for it as written. A reference is left to
+// its definition. A replacement that needs angle brackets, such as one with
+// a space, gets them unless the destination has them; an autolink's is
+// written as it is.
+func RewriteDests(content string, rewrite func(dest string) string) string {
+	source := []byte(content)
+	doc := linkify.Parser().Parse(text.NewReader(source))
+	defs := links.CollectRefDefs(doc, source)
+
+	var found []writtenDest
+	for _, l := range links.CollectLinks(doc, source, defs) {
+		switch {
+		case l.Start < 0 || l.Label != "":
+		case l.Auto():
+			found = append(found, writtenDest{l.Text.Start, l.Text.End, true})
+		default:
+			if d, ok := inlineDest(source, l); ok {
+				found = append(found, d)
+			}
+		}
+	}
+	for _, def := range defs {
+		if d, ok := definitionDest(source, def); ok {
+			found = append(found, d)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].start < found[j].start })
+
+	var b strings.Builder
+	pos := 0
+	for _, d := range found {
+		if d.start < pos {
+			continue
+		}
+		dest := content[d.start:d.end]
+		bracketed := d.start > 0 && content[d.start-1] == '<' && !d.auto
+		replacement := rewrite(dest)
+		if replacement == dest {
+			continue
+		}
+		if !d.auto {
+			replacement = markdown.Destination(replacement)
+			if bracketed {
+				replacement = strings.TrimSuffix(strings.TrimPrefix(replacement, "<"), ">")
+			}
+		}
+		b.WriteString(content[pos:d.start])
+		b.WriteString(replacement)
+		pos = d.end
+	}
+	b.WriteString(content[pos:])
+	return b.String()
+}
+
+// writtenDest is where a destination is written in a document, without the
+// angle brackets around it.
+type writtenDest struct {
+	start, end int
+	auto       bool // an autolink's URL, bare or in angle brackets
+}
+
+// inlineDest finds the destination of the inline link or image l, after its
+// text's "](".
+func inlineDest(source []byte, l links.Link) (writtenDest, bool) {
+	i := l.Text.End + len("](")
+	if i > l.End || string(source[l.Text.End:i]) != "](" {
+		return writtenDest{}, false
+	}
+	for i < l.End && (source[i] == ' ' || source[i] == '\t' || source[i] == '\n') {
+		i++
+	}
+	if i < l.End && source[i] == '<' {
+		i++
+	}
+	end := i + len(l.Destination)
+	if l.Destination == "" || end > l.End || string(source[i:end]) != l.Destination {
+		return writtenDest{}, false
+	}
+	return writtenDest{start: i, end: end}, true
+}
+
+// definitionDest finds the destination of def, after its label's "]:".
+func definitionDest(source []byte, def links.Definition) (writtenDest, bool) {
+	if def.Range.End == 0 {
+		return writtenDest{}, false
+	}
+	written := source[def.Range.Start:def.Range.End]
+	label := bytes.Index(written, []byte("["+def.Written+"]:"))
+	if label < 0 {
+		return writtenDest{}, false
+	}
+	i := def.Range.Start + label + len("["+def.Written+"]:")
+	for i < def.Range.End && (source[i] == ' ' || source[i] == '\t' || source[i] == '\n') {
+		i++
+	}
+	end := i
+	if i < def.Range.End && source[i] == '<' {
+		i++
+		for end = i; end < def.Range.End && source[end] != '>' && source[end] != '\n'; end++ {
+			if source[end] == '\\' {
+				end++
+			}
+		}
+	} else {
+		for end < def.Range.End && source[end] > ' ' {
+			end++
+		}
+	}
+	if end <= i || end > def.Range.End {
+		return writtenDest{}, false
+	}
+	return writtenDest{start: i, end: end}, true
+}
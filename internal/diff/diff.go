@@ -0,0 +1,77 @@
+// Package diff compares documents line by line.
+package diff
+
+import "strings"
+
+// Hunk is a run of lines a[AStart:AEnd] replaced by b[BStart:BEnd].
+type Hunk struct {
+	AStart, AEnd, BStart, BEnd int
+}
+
+// maxLines bounds the lines compared line by line; larger changes are
+// reported as one hunk.
+const maxLines = 4000
+
+// SplitLines splits content into lines without their newlines.
+func SplitLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+}
+
+// Lines returns the hunks that turn a into b, from a longest common
+// subsequence of their lines.
+func Lines(a, b []string) []Hunk {
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+	ma, mb := a[pre:len(a)-suf], b[pre:len(b)-suf]
+	if len(ma) == 0 && len(mb) == 0 {
+		return nil
+	}
+	if len(ma) > maxLines || len(mb) > maxLines {
+		return []Hunk{{pre, len(a) - suf, pre, len(b) - suf}}
+	}
+
+	// lcs[i][j] is the length of the LCS of ma[i:] and mb[j:].
+	lcs := make([][]int, len(ma)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(mb)+1)
+	}
+	for i := len(ma) - 1; i >= 0; i-- {
+		for j := len(mb) - 1; j >= 0; j-- {
+			if ma[i] == mb[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var hunks []Hunk
+	i, j := 0, 0
+	for i < len(ma) || j < len(mb) {
+		if i < len(ma) && j < len(mb) && ma[i] == mb[j] {
+			i++
+			j++
+			continue
+		}
+		h := Hunk{AStart: pre + i, BStart: pre + j}
+		for (i < len(ma) || j < len(mb)) && !(i < len(ma) && j < len(mb) && ma[i] == mb[j]) {
+			if j == len(mb) || (i < len(ma) && lcs[i+1][j] >= lcs[i][j+1]) {
+				i++
+			} else {
+				j++
+			}
+		}
+		h.AEnd, h.BEnd = pre+i, pre+j
+		hunks = append(hunks, h)
+	}
+	return hunks
+}
@@ -0,0 +1,183 @@
+package markdown
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	atxHeadingRe = regexp.MustCompile(`^( {0,3}#{1,6}[ \t]+)(.*?)([ \t]+#+)?[ \t]*$`)
+	// attrRe matches the contents of an attribute block: IDs, classes,
+	// key=value pairs, and Pandoc's "-" (unnumbered), optionally after
+	// kramdown's leading colon.
+	attrRe  = regexp.MustCompile(`^\{:?[ \t]*(?:(?:#[\p{L}\p{N}_:.-]+|\.[\w-]+|[\w-]+=(?:"[^"]*"|'[^']*'|[^\s"'}]+)|-)[ \t]*)+\}$`)
+	blockRe = regexp.MustCompile(`\{[^{}\n]*\}`)
+	idRe    = regexp.MustCompile(`(?:^|[{\s])#([\p{L}\p{N}_:.-]+)`)
+)
+
+// AttrHeading is a heading line and its trailing attribute block, if any.
+type AttrHeading struct {
+	Line  int
+	Level int
+	Text  string // heading text without the attribute block
+	Attrs string // "{...}", or "" for none
+	ID    string // explicit ID from Attrs or a following kramdown IAL
+}
+
+// CodeLines reports which lines from start on are in fenced or indented
+// code blocks.
+func CodeLines(lines []string, start int) []bool {
+	code := make([]bool, len(lines))
+	fence := ""
+	for i := start; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		switch {
+		case fence != "":
+			code[i] = true
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			code[i] = true
+			fence = trimmed[:3]
+		case (strings.HasPrefix(lines[i], "    ") || strings.HasPrefix(lines[i], "\t")) &&
+			(i == start || strings.TrimSpace(lines[i-1]) == "" || code[i-1]):
+			code[i] = true
+		}
+	}
+	return code
+}
+
+// AttrHeadings returns the ATX and setext headings from start on, outside
+// the code lines CodeLines reports.
+func AttrHeadings(lines []string, start int, code []bool) []AttrHeading {
+	var headings []AttrHeading
+	for i := start; i < len(lines); i++ {
+		if code[i] {
+			continue
+		}
+		var h AttrHeading
+		next := i + 1 // the line after the heading
+		if m := atxHeadingRe.FindStringSubmatch(lines[i]); m != nil {
+			h = AttrHeading{Line: i, Level: strings.Count(m[1], "#"), Text: m[2]}
+		} else if i+1 < len(lines) && strings.TrimSpace(lines[i]) != "" && !IsHorizontalRule(lines[i]) &&
+			(i == start || strings.TrimSpace(lines[i-1]) == "") && setextRe.MatchString(lines[i+1]) {
+			level := 1
+			if strings.TrimSpace(lines[i+1])[0] == '-' {
+				level = 2
+			}
+			h = AttrHeading{Line: i, Level: level, Text: strings.TrimSpace(lines[i])}
+			next = i + 2
+		} else {
+			continue
+		}
+		if loc := trailingAttrs(h.Text); loc >= 0 {
+			h.Attrs = h.Text[loc:]
+			h.Text = strings.TrimRight(h.Text[:loc], " \t")
+			h.ID = AttrID(h.Attrs)
+		}
+		// A kramdown IAL on the next line applies to the heading too.
+		if h.ID == "" && next < len(lines) && IsIAL(lines[next]) {
+			h.ID = AttrID(lines[next])
+		}
+		headings = append(headings, h)
+	}
+	return headings
+}
+
+// SetHeadingText replaces the text of the heading on line, keeping its
+// indentation, its "#" marker, and any closing "#" sequence.
+func SetHeadingText(line, text string) string {
+	if m := atxHeadingRe.FindStringSubmatch(line); m != nil {
+		return m[1] + text + m[3]
+	}
+	return line[:len(line)-len(strings.TrimLeft(line, " "))] + text
+}
+
+// trailingAttrs returns where the attribute block at the end of heading text
+// starts, or -1.
+func trailingAttrs(text string) int {
+	if !strings.HasSuffix(text, "}") {
+		return -1
+	}
+	open := strings.LastIndexByte(text, '{')
+	if open < 0 || !attrRe.MatchString(text[open:]) {
+		return -1
+	}
+	return open
+}
+
+// AttrID returns the first ID in an attribute block, or "".
+func AttrID(attrs string) string {
+	if m := idRe.FindStringSubmatch(attrs); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// SpanAttrs returns the attribute blocks attached to spans in line: those
+// directly after "]", ")", "*", "_", or "`", outside code spans. A heading's
+// trailing block is separated by a space and isn't included.
+func SpanAttrs(line string) [][2]int {
+	spans := codeSpans(line)
+	var found [][2]int
+	for _, loc := range blockRe.FindAllStringIndex(line, -1) {
+		if loc[0] == 0 || !strings.ContainsRune("])*_`", rune(line[loc[0]-1])) {
+			continue
+		}
+		if inSpan(loc[0], spans) || !attrRe.MatchString(line[loc[0]:loc[1]]) {
+			continue
+		}
+		found = append(found, [2]int{loc[0], loc[1]})
+	}
+	return found
+}
+
+// codeSpans returns the byte ranges of the code spans in line.
+func codeSpans(line string) [][2]int {
+	var spans [][2]int
+	for i := 0; i < len(line); {
+		if line[i] != '`' {
+			i++
+			continue
+		}
+		n := 0
+		for i+n < len(line) && line[i+n] == '`' {
+			n++
+		}
+		run := line[i : i+n]
+		end := -1
+		for j := i + n; j < len(line); {
+			k := strings.Index(line[j:], run)
+			if k < 0 {
+				break
+			}
+			k += j
+			m := 0
+			for k+m < len(line) && line[k+m] == '`' {
+				m++
+			}
+			if m == n {
+				end = k + n
+				break
+			}
+			j = k + m
+		}
+		if end < 0 {
+			i += n
+			continue
+		}
+		spans = append(spans, [2]int{i, end})
+		i = end
+	}
+	return spans
+}
+
+func inSpan(pos int, spans [][2]int) bool {
+	for _, s := range spans {
+		if pos >= s[0] && pos < s[1] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package markdown
+
+import (
+	"bytes"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+// CodeBlockRanges returns the byte ranges of the fenced and indented code
+// blocks in doc, parsed from source. A fenced block's range starts at its
+// opening fence, so the info string is included.
+func CodeBlockRanges(doc ast.Node, source []byte) []ByteRange {
+	var ranges []ByteRange
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch node := n.(type) {
+		case *ast.FencedCodeBlock:
+			start, end := node.Pos(), len(source)
+			if i := bytes.IndexByte(source[start:], '\n'); i >= 0 {
+				end = start + i
+			}
+			if lines := node.Lines(); lines.Len() > 0 {
+				end = lines.At(lines.Len() - 1).Stop
+			}
+			ranges = append(ranges, ByteRange{Start: start, End: end})
+		case *ast.CodeBlock:
+			if lines := node.Lines(); lines.Len() > 0 {
+				ranges = append(ranges, ByteRange{
+					Start: lines.At(0).Start,
+					End:   lines.At(lines.Len() - 1).Stop,
+				})
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	return ranges
+}
+
+// UnclosedFence returns the fence that would close a fenced code block left
+// open at the end of doc, or "" if the document doesn't end in one. Text
+// appended to such a document, like reference definitions, would otherwise
+// land inside the code.
+func UnclosedFence(doc ast.Node, source []byte) string {
+	block, ok := doc.LastChild().(*ast.FencedCodeBlock)
+	if !ok {
+		return ""
+	}
+	opening := bytes.TrimLeft(source[block.Pos():], " ")
+	n := 0
+	for n < len(opening) && opening[n] == opening[0] {
+		n++
+	}
+	fence := opening[:n]
+	end := bytes.IndexByte(opening, '\n')
+	if lines := block.Lines(); lines.Len() > 0 {
+		end = lines.At(lines.Len()-1).Stop - (len(source) - len(opening))
+	}
+	if end < 0 {
+		return string(fence)
+	}
+	// Whatever follows the code is blank or is its closing fence.
+	if rest := bytes.TrimSpace(opening[end:]); bytes.HasPrefix(rest, fence) {
+		return ""
+	}
+	return string(fence)
+}
@@ -0,0 +1,105 @@
+package markdown
+
+import (
+	"bytes"
+	"strings"
+)
+
+// WrittenTitle returns title, the raw title the parser found for a link or
+// definition, as it is written in source: closing just before end, apart
+// from any space, with the quotes or parentheses it was written in. If
+// source doesn't have it there in one piece, as when it spans the lines of
+// a block quote, it's quoted with QuoteTitle.
+func WrittenTitle(source []byte, end int, title []byte) string {
+	if len(title) == 0 {
+		return ""
+	}
+	for end > 0 && (source[end-1] == ' ' || source[end-1] == '\t' || source[end-1] == '\n') {
+		end--
+	}
+	start := end - len(title) - 2
+	if start >= 0 {
+		written := source[start:end]
+		opener, closer := written[0], written[len(written)-1]
+		if (opener == '"' || opener == '\'') && closer == opener || opener == '(' && closer == ')' {
+			if bytes.Equal(written[1:len(written)-1], title) {
+				return string(written)
+			}
+		}
+	}
+	return QuoteTitle(title)
+}
+
+// QuoteTitle returns title, raw with its backslash escapes, in the first of
+// double quotes, single quotes, or parentheses it can be written in without
+// adding escapes. There's always one: the delimiters it was parsed from.
+// An empty title is "".
+func QuoteTitle(title []byte) string {
+	switch {
+	case len(title) == 0:
+		return ""
+	case !hasUnescaped(title, '"'):
+		return `"` + string(title) + `"`
+	case !hasUnescaped(title, '\''):
+		return `'` + string(title) + `'`
+	default:
+		return "(" + string(title) + ")"
+	}
+}
+
+// Destination returns url, raw with its backslash escapes, as a link's or a
+// definition's destination: in angle brackets when it's empty or has spaces
+// or unbalanced parentheses, which a bare destination can't, or ends in a
+// backslash that would escape what follows it, escaping the brackets and
+// that backslash in it that aren't already.
+func Destination(url string) string {
+	trailing := len(url) - len(strings.TrimRight(url, "\\"))
+	if url != "" && !strings.ContainsAny(url, " \t<>") && balancedParens(url) && trailing%2 == 0 {
+		return url
+	}
+	var b strings.Builder
+	b.WriteByte('<')
+	for i := 0; i < len(url); i++ {
+		switch c := url[i]; {
+		case c == '\\' && i+1 < len(url):
+			b.WriteString(url[i : i+2])
+			i++
+		case c == '<' || c == '>' || c == '\\':
+			b.WriteByte('\\')
+			fallthrough
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('>')
+	return b.String()
+}
+
+// balancedParens reports whether the parentheses in url that aren't escaped
+// are balanced.
+func balancedParens(url string) bool {
+	depth := 0
+	for i := 0; i < len(url) && depth >= 0; i++ {
+		switch url[i] {
+		case '\\':
+			i++
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+	}
+	return depth == 0
+}
+
+// hasUnescaped reports whether s has a c that isn't escaped by a backslash.
+func hasUnescaped(s []byte, c byte) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+		} else if s[i] == c {
+			return true
+		}
+	}
+	return false
+}
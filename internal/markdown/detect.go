@@ -6,9 +6,15 @@ import (
 )
 
 var (
-	footnoteDefRe = regexp.MustCompile(`^\[\^[^\]]+\]:`)
-	linkRefDefRe  = regexp.MustCompile(`^\[[^\]]+\]:\s*\S`)
-	orderedListRe = regexp.MustCompile(`^\d+\.\s`)
+	footnoteDefRe    = regexp.MustCompile(`^\[\^[^\]]+\]:`)
+	linkRefDefRe     = regexp.MustCompile(`^\[[^\]]+\]:\s*\S`)
+	orderedListRe    = regexp.MustCompile(`^\d+[.)]\s`)
+	listMarkerRe     = regexp.MustCompile(`^ *(?:[-*+]|\d+[.)]) +`)
+	ialRe            = regexp.MustCompile(`^ {0,3}\{:[^{}\n]*\}[ \t]*$`)
+	calloutRe        = regexp.MustCompile(`^\[![^\]\s]+\][+-]?(?:[ \t].*)?$`)
+	blockIDRe        = regexp.MustCompile(`^\^[A-Za-z0-9-]+$`)
+	tableDelimiterRe = regexp.MustCompile(`^:?-+:?$`)
+	setextRe         = regexp.MustCompile(`^ {0,3}(?:=+|-+)[ \t]*$`)
 )
 
 // LooksLikeFrontmatterProperty returns true if the line appears to be
@@ -22,6 +28,61 @@ func LooksLikeFrontmatterProperty(line string) bool {
 	return idx > 0
 }
 
+// FrontmatterEnd returns the number of leading lines that form YAML
+// frontmatter, or 0 if there is none. Two forms are recognized: a block
+// delimited by "---" lines, and property lines closed by a single "---".
+func FrontmatterEnd(lines []string) int {
+	return frontmatterEnd(func(i int) (string, bool) {
+		if i < len(lines) {
+			return lines[i], true
+		}
+		return "", false
+	})
+}
+
+// frontmatterEnd is FrontmatterEnd for lines read through line, which
+// returns the i'th line and whether there is one.
+func frontmatterEnd(line func(i int) (string, bool)) int {
+	first, ok := line(0)
+	if !ok {
+		return 0
+	}
+	i := 0
+	if strings.TrimSpace(first) == "---" {
+		if second, ok := line(1); !ok || !LooksLikeFrontmatterProperty(second) {
+			return 0
+		}
+		i = 1
+	} else if LooksLikeFrontmatterProperty(first) {
+		closed := false
+		for j := 1; ; j++ {
+			l, ok := line(j)
+			if !ok || strings.TrimSpace(l) == "" {
+				break
+			}
+			if strings.TrimSpace(l) == "---" {
+				closed = true
+				break
+			}
+		}
+		if !closed {
+			return 0
+		}
+	} else {
+		return 0
+	}
+	for {
+		l, ok := line(i)
+		if !ok {
+			return i
+		}
+		i++
+		if strings.TrimSpace(l) == "---" {
+			return i
+		}
+	}
+}
+
 // IsFootnoteDefinition returns true if the line starts a footnote definition.
 // Footnote definitions have the form [^label]: ...
 func IsFootnoteDefinition(line string) bool {
@@ -36,7 +97,7 @@ func IsFootnoteContinuation(line string) bool {
 	if trimmed == "" {
 		return false
 	}
-	if IsFootnoteDefinition(line) || IsLinkRefDefinition(line) {
+	if IsFootnoteDefinition(line) || IsLinkRefDefinition(line) || IsIAL(line) {
 		return false
 	}
 	if strings.HasPrefix(trimmed, "#") ||
@@ -45,7 +106,7 @@ func IsFootnoteContinuation(line string) bool {
 		strings.HasPrefix(trimmed, "~~~") {
 		return false
 	}
-	return !IsListItem(line) && !IsTableRow(line) && !IsHorizontalRule(line)
+	return !IsListItem(line) && !IsTableRow(line) && !IsHorizontalRule(line) && !interruptsWithHTML(line)
 }
 
 // IsLinkRefDefinition returns true if the line is a link reference definition.
@@ -58,24 +119,206 @@ func IsLinkRefDefinition(line string) bool {
 	return linkRefDefRe.MatchString(line)
 }
 
+// CutLinkTitle splits a link reference definition, which may span lines, into
+// its label and destination, and its title with the quotes or parentheses it
+// is written in, or "" if it has none. ok is false if something other than
+// a whole title follows the destination, as while a title's closing quote is
+// still on a line to come.
+func CutLinkTitle(def string) (head, title string, ok bool) {
+	i := strings.Index(def, "]:") + 2
+	if i < 2 {
+		return def, "", false
+	}
+	i += len(def[i:]) - len(strings.TrimLeft(def[i:], " \t\n"))
+	if strings.HasPrefix(def[i:], "<") {
+		if j := strings.IndexByte(def[i:], '>'); j >= 0 {
+			i += j + 1
+		}
+	} else if j := strings.IndexAny(def[i:], " \t\n"); j >= 0 {
+		i += j
+	} else {
+		i = len(def)
+	}
+	head, title = def[:i], strings.TrimSpace(def[i:])
+	if title == "" {
+		return head, "", true
+	}
+	closer := map[byte]byte{'"': '"', '\'': '\'', '(': ')'}[title[0]]
+	closed := closer != 0 && len(title) > 1 && title[len(title)-1] == closer &&
+		(len(title)-len(strings.TrimRight(title[:len(title)-1], "\\")))%2 == 1
+	return head, title, closed
+}
+
 // IsListItem returns true if the line is a list item.
-// Supports unordered lists (-, *, +) and ordered lists (1., 2., etc).
+// Supports unordered lists (-, *, +) and ordered lists (1., 2), etc).
 func IsListItem(line string) bool {
 	trimmed := strings.TrimSpace(line)
 	// Unordered: -, *, +
 	if len(trimmed) > 1 && (trimmed[0] == '-' || trimmed[0] == '*' || trimmed[0] == '+') && trimmed[1] == ' ' {
 		return true
 	}
-	// Ordered: 1. 2. etc
+	// Ordered: 1. 2) etc
 	return orderedListRe.MatchString(trimmed)
 }
 
+// ListItemPrefix returns the start of list item line up to its content: the
+// indentation, the marker, and the spaces after it. Past four spaces, only
+// the first belongs to the marker and the rest indent code in the item. It
+// returns "" if line isn't a list item.
+func ListItemPrefix(line string) string {
+	if !IsListItem(line) {
+		return ""
+	}
+	prefix := listMarkerRe.FindString(line)
+	if spaces := len(prefix) - len(strings.TrimRight(prefix, " ")); spaces > 4 {
+		prefix = prefix[:len(prefix)-spaces+1]
+	}
+	return prefix
+}
+
+// ListItemLead returns the start of a line that a ListItem handler is called
+// with, up to its text: the ListItemPrefix of an item's first line, or the
+// indentation of a later paragraph's.
+func ListItemLead(line string) string {
+	if prefix := ListItemPrefix(line); prefix != "" {
+		return prefix
+	}
+	return line[:len(line)-len(strings.TrimLeft(line, " "))]
+}
+
 // IsTableRow returns true if the line is a GFM table row.
 // GFM table rows start with a pipe character.
 func IsTableRow(line string) bool {
 	return strings.HasPrefix(strings.TrimSpace(line), "|")
 }
 
+// IsTableStart reports whether header and delimiter, consecutive lines, start
+// a GFM table whose rows needn't start with a pipe: a header row, and under
+// it a delimiter row such as "--- | :---:" with as many cells.
+func IsTableStart(header, delimiter string) bool {
+	if !strings.Contains(delimiter, "|") || !strings.Contains(header, "|") {
+		return false
+	}
+	cells := tableCells(delimiter)
+	for _, cell := range cells {
+		if !tableDelimiterRe.MatchString(cell) {
+			return false
+		}
+	}
+	return len(cells) == len(tableCells(header))
+}
+
+// tableCells splits a table row into its trimmed cells at the pipes that
+// aren't escaped, ignoring a leading and a trailing one.
+func tableCells(row string) []string {
+	row = strings.TrimSpace(row)
+	row = strings.TrimPrefix(row, "|")
+	if strings.HasSuffix(row, "|") && !strings.HasSuffix(row, `\|`) {
+		row = row[:len(row)-1]
+	}
+	var cells []string
+	start := 0
+	for i := 0; i < len(row); i++ {
+		switch row[i] {
+		case '\\':
+			i++
+		case '|':
+			cells = append(cells, strings.TrimSpace(row[start:i]))
+			start = i + 1
+		}
+	}
+	return append(cells, strings.TrimSpace(row[start:]))
+}
+
+// IsIAL returns true if the line is a kramdown inline attribute list, such as
+// {: .class #id}, which applies to the block it follows (or precedes).
+func IsIAL(line string) bool {
+	return ialRe.MatchString(line)
+}
+
+// IsAttribution returns true if the line, inside a blockquote, credits the
+// quote: text after an em dash, a horizontal bar, or two hyphens, as in
+// "— Robert Frost". It stays on a line of its own after the quote.
+func IsAttribution(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	for _, dash := range []string{"—", "―", "--"} {
+		if rest, ok := strings.CutPrefix(trimmed, dash); ok && strings.TrimLeft(rest, " ") != "" && !strings.HasPrefix(rest, "-") {
+			return true
+		}
+	}
+	return false
+}
+
+// IsCalloutHeader returns true if the line, inside a blockquote, is the
+// header of a GFM alert or an Obsidian callout: [!type], optionally followed
+// by a fold marker (+ or -) and a custom title. Any type is accepted,
+// including Obsidian's aliases (tldr, hint, faq, ...) and custom types.
+func IsCalloutHeader(line string) bool {
+	return calloutRe.MatchString(line)
+}
+
+// IsBlockID returns true if s is an Obsidian block ID such as ^intro, which
+// must stay at the end of the block it names (or on its own line after it).
+func IsBlockID(s string) bool {
+	return blockIDRe.MatchString(strings.TrimSpace(s))
+}
+
+// IsCommentBlockStart returns true if the line opens an Obsidian comment
+// (%%) that continues onto the following lines.
+func IsCommentBlockStart(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), "%%") && strings.Count(line, "%%") == 1
+}
+
+// VerseMarkers are the names of the sections whose lines are kept as
+// written, such as poetry, lyrics, and addresses: <!-- verse --> to
+// <!-- /verse -->.
+var VerseMarkers = []string{"verse", "poetry"}
+
+// VerseStart returns the name of the verse section the line opens, or "".
+func VerseStart(line string) string {
+	trimmed := strings.TrimSpace(line)
+	for _, name := range VerseMarkers {
+		if trimmed == MarkerOpen(name) {
+			return name
+		}
+	}
+	return ""
+}
+
+// HasHardBreak returns true if the line ends in a hard line break: two or
+// more spaces, or a backslash that isn't itself escaped.
+func HasHardBreak(line string) bool {
+	if strings.HasSuffix(line, "  ") {
+		return true
+	}
+	n := len(line) - len(strings.TrimRight(line, "\\"))
+	return n%2 == 1
+}
+
+// CutHardBreak returns line without the hard line break it ends in, and the
+// break: two spaces, or a backslash with the space before it, if any. A line
+// without one is returned with "".
+func CutHardBreak(line string) (text, brk string) {
+	switch {
+	case !HasHardBreak(line):
+		return line, ""
+	case strings.HasSuffix(line, "  "):
+		return strings.TrimRight(line, " "), "  "
+	}
+	text = strings.TrimRight(line[:len(line)-1], " \t")
+	if len(text) < len(line)-1 {
+		return text, ` \`
+	}
+	return text, `\`
+}
+
+// IsSetextUnderline returns true if the line, under a paragraph, makes it a
+// setext heading: a run of = (level 1) or - (level 2) and nothing else. The
+// - kind is a horizontal rule where no paragraph is above it.
+func IsSetextUnderline(line string) bool {
+	return setextRe.MatchString(line)
+}
+
 // IsHorizontalRule returns true if the line is a horizontal rule.
 // Horizontal rules are three or more -, *, or _ characters with optional spaces.
 func IsHorizontalRule(line string) bool {
@@ -100,3 +343,25 @@ func IsHorizontalRule(line string) bool {
 	}
 	return false
 }
+
+// StartsBlock returns true if a line starting with word could interrupt a
+// paragraph: a heading, list item, blockquote, fence, HTML block, thematic
+// break, or setext underline. Wrapping and splitting mustn't start a line
+// with one.
+func StartsBlock(word string) bool {
+	switch word {
+	case "#", "##", "###", "####", "#####", "######", "-", "+", "*", "1.", "1)":
+		return true
+	}
+	for _, prefix := range []string{">", "<", "```", "~~~"} {
+		if strings.HasPrefix(word, prefix) {
+			return true
+		}
+	}
+	for _, c := range "-=*_" {
+		if strings.Trim(word, string(c)) == "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,164 @@
+package markdown
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Footnote dialects, as taken by the -dialect flag of the footnote tools.
+const (
+	// DialectExtra is PHP Markdown Extra's [^label] references with
+	// "[^label]: text" definitions, which GFM, Pandoc, and goldmark share.
+	DialectExtra = "extra"
+	// DialectMMD is MultiMarkdown, which adds inline footnotes written
+	// [^text], told apart from references by the whitespace in them.
+	DialectMMD = "mmd"
+	// DialectMarkua is Leanpub's Markua, which adds inline footnotes written
+	// ^[text] and endnotes written [^^label].
+	DialectMarkua = "markua"
+)
+
+// CheckFootnoteDialect returns an error if dialect isn't one of the above.
+func CheckFootnoteDialect(dialect string) error {
+	switch dialect {
+	case DialectExtra, DialectMMD, DialectMarkua:
+		return nil
+	}
+	return fmt.Errorf("unknown -dialect %q (want extra, mmd, or markua)", dialect)
+}
+
+// footnoteLabelRe matches a footnote reference or definition label.
+var footnoteLabelRe = regexp.MustCompile(`\[\^\^?([^\]\s]+)\]`)
+
+// NormalizeFootnotes rewrites the footnotes of a document in dialect to
+// Extra's, so that they can be read by a footnote parser. Inline footnotes
+// become numbered references, with a number no label in the document uses,
+// and their definitions are appended to the end; Markua endnotes become
+// footnotes. Nothing in code, given by its byte ranges, is changed. The
+// replacements it made are returned too, in order, so that positions in the
+// result can be traced back to content.
+func NormalizeFootnotes(content, dialect string, code []ByteRange) (string, []Replacement) {
+	if dialect != DialectMMD && dialect != DialectMarkua {
+		return content, nil
+	}
+	used := make(map[string]bool)
+	for _, m := range footnoteLabelRe.FindAllStringSubmatch(content, -1) {
+		used[m[1]] = true
+	}
+	next := 1
+	label := func() string {
+		for used[strconv.Itoa(next)] {
+			next++
+		}
+		used[strconv.Itoa(next)] = true
+		return strconv.Itoa(next)
+	}
+
+	var b strings.Builder
+	var defs []string
+	var reps []Replacement
+	last := 0
+	replace := func(start, end int, s string) {
+		b.WriteString(content[last:start])
+		reps = append(reps, Replacement{Old: ByteRange{start, end}, New: ByteRange{b.Len(), b.Len() + len(s)}})
+		b.WriteString(s)
+		last = end
+	}
+	for i := 0; i < len(content); i++ {
+		if inCode(i, code) {
+			continue
+		}
+		switch {
+		case dialect == DialectMarkua && strings.HasPrefix(content[i:], "[^^"):
+			// An endnote keeps its label as a footnote.
+			replace(i, i+3, "[^")
+			i += 2
+		case dialect == DialectMarkua && strings.HasPrefix(content[i:], "^["),
+			dialect == DialectMMD && strings.HasPrefix(content[i:], "[^"):
+			open := i + 1
+			if content[i] == '[' {
+				open = i
+			}
+			end := bracketEnd(content, open)
+			if end < 0 {
+				continue
+			}
+			body := content[open+1 : end-1]
+			if dialect == DialectMMD {
+				// [^label] is a reference and [^label]: a definition.
+				body = body[1:]
+				if !strings.ContainsAny(body, " \t\n") || (end < len(content) && content[end] == ':') {
+					continue
+				}
+			}
+			n := label()
+			replace(i, end, "[^"+n+"]")
+			defs = append(defs, "[^"+n+"]: "+strings.Join(strings.Fields(body), " "))
+			i = end - 1
+		}
+	}
+	if len(reps) == 0 {
+		return content, nil
+	}
+	if len(defs) == 0 {
+		b.WriteString(content[last:])
+		return b.String(), reps
+	}
+	// The definitions have no place in content, so they're inserted at its
+	// end.
+	replace(len(strings.TrimRight(content, "\n")), len(content), "\n\n")
+	replace(len(content), len(content), strings.Join(defs, "\n")+"\n")
+	return b.String(), reps
+}
+
+// bracketEnd returns the index after the bracket matching the one at
+// content[open], or -1 if it isn't closed before a blank line.
+func bracketEnd(content string, open int) int {
+	depth := 0
+	for i := open; i < len(content); i++ {
+		switch content[i] {
+		case '\\':
+			i++
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		case '\n':
+			if strings.HasPrefix(strings.TrimLeft(content[i+1:], " \t"), "\n") {
+				return -1
+			}
+		}
+	}
+	return -1
+}
+
+// InlineFootnote returns text written as an inline footnote in dialect, and
+// whether dialect can write it inline: it must be one line, and for
+// MultiMarkdown have whitespace in it so it doesn't read as a label.
+func InlineFootnote(text, dialect string) (string, bool) {
+	if strings.Contains(text, "\n") || bracketEnd("["+text+"]", 0) != len(text)+2 {
+		return "", false
+	}
+	switch dialect {
+	case DialectMMD:
+		if !strings.ContainsAny(text, " \t") || strings.HasPrefix(text, "^") {
+			return "", false
+		}
+		return "[^" + text + "]", true
+	case DialectMarkua:
+		return "^[" + text + "]", true
+	}
+	return "", false
+}
+
+// inCode reports whether pos is inside one of the code ranges.
+func inCode(pos int, code []ByteRange) bool {
+	i := sort.Search(len(code), func(i int) bool { return code[i].End > pos })
+	return i < len(code) && code[i].Start <= pos
+}
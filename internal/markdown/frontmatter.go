@@ -0,0 +1,35 @@
+package markdown
+
+import "strings"
+
+// FrontmatterField returns the value of a top-level "key: value" line in the
+// document's frontmatter, with surrounding whitespace removed.
+func FrontmatterField(lines []string, key string) (value string, ok bool) {
+	end := FrontmatterEnd(lines)
+	for _, line := range lines[:end] {
+		if k, v, found := strings.Cut(line, ":"); found && k == key {
+			return strings.TrimSpace(v), true
+		}
+	}
+	return "", false
+}
+
+// SetFrontmatterField returns lines with the top-level frontmatter field key
+// set to value. An existing field is replaced in place; a new one is added at
+// the end of the frontmatter, which is created when the document has none.
+func SetFrontmatterField(lines []string, key, value string) []string {
+	field := key + ": " + value
+	end := FrontmatterEnd(lines)
+	if end == 0 {
+		return append([]string{"---", field, "---"}, lines...)
+	}
+	result := append([]string(nil), lines...)
+	for i, line := range result[:end] {
+		if k, _, found := strings.Cut(line, ":"); found && k == key {
+			result[i] = field
+			return result
+		}
+	}
+	// end-1 is the closing "---".
+	return append(result[:end-1], append([]string{field}, lines[end-1:]...)...)
+}
@@ -0,0 +1,81 @@
+package markdown
+
+import (
+	"regexp"
+	"strings"
+)
+
+// HTML block kinds, as CommonMark numbers them. Each starts differently and
+// ends at a different place.
+const (
+	htmlRaw         = 1 + iota // <script>, <pre>, <style>, or <textarea>
+	htmlComment                // <!-- … -->
+	htmlInstruction            // <? … ?>
+	htmlDeclaration            // <!DOCTYPE …>
+	htmlCDATA                  // <![CDATA[ … ]]>
+	htmlBlockTag               // a block-level tag, such as <div> or </figure>
+	htmlTag                    // any other whole tag alone on its line
+)
+
+var (
+	htmlRawRe      = regexp.MustCompile(`(?i)^<(?:script|pre|style|textarea)(?:[\s>]|$)`)
+	htmlRawCloseRe = regexp.MustCompile(`(?i)</(?:script|pre|style|textarea)>`)
+	htmlBlockTagRe = regexp.MustCompile(`(?i)^</?(?:address|article|aside|base|basefont|blockquote|body|caption|center|col|colgroup|dd|details|dialog|dir|div|dl|dt|fieldset|figcaption|figure|footer|form|frame|frameset|h[1-6]|head|header|hr|html|iframe|legend|li|link|main|menu|menuitem|nav|noframes|ol|optgroup|option|p|param|search|section|summary|table|tbody|td|tfoot|th|thead|title|tr|track|ul)(?:\s|/?>|$)`)
+	htmlTagRe      = regexp.MustCompile(`^(?:<[A-Za-z][A-Za-z0-9-]*(?:\s+[A-Za-z_:][A-Za-z0-9_.:-]*(?:\s*=\s*(?:[^\s"'=<>` + "`" + `]+|'[^']*'|"[^"]*"))?)*\s*/?>|</[A-Za-z][A-Za-z0-9-]*\s*>)\s*$`)
+)
+
+// htmlBlockStart returns the kind of HTML block line starts, or 0 if it
+// starts none. Pass the kind to htmlBlockEnd to find where the block ends.
+func htmlBlockStart(line string) int {
+	if len(line)-len(strings.TrimLeft(line, " ")) > 3 {
+		return 0
+	}
+	s := strings.TrimLeft(line, " ")
+	switch {
+	case !strings.HasPrefix(s, "<"):
+		return 0
+	case htmlRawRe.MatchString(s):
+		return htmlRaw
+	case strings.HasPrefix(s, "<!--"):
+		return htmlComment
+	case strings.HasPrefix(s, "<?"):
+		return htmlInstruction
+	case strings.HasPrefix(s, "<![CDATA["):
+		return htmlCDATA
+	case len(s) > 2 && s[1] == '!' && ('A' <= s[2] && s[2] <= 'Z' || 'a' <= s[2] && s[2] <= 'z'):
+		return htmlDeclaration
+	case htmlBlockTagRe.MatchString(s):
+		return htmlBlockTag
+	case htmlTagRe.MatchString(s):
+		return htmlTag
+	}
+	return 0
+}
+
+// htmlBlockEnd reports whether line ends an HTML block of the given kind that
+// is open, and whether line is part of it. The first five kinds end at the
+// line that closes them, which may be the one that opened them; the others
+// end before a blank line.
+func htmlBlockEnd(kind int, line string) (end, part bool) {
+	switch kind {
+	case htmlRaw:
+		return htmlRawCloseRe.MatchString(line), true
+	case htmlComment:
+		return strings.Contains(line, "-->"), true
+	case htmlInstruction:
+		return strings.Contains(line, "?>"), true
+	case htmlDeclaration:
+		return strings.Contains(line, ">"), true
+	case htmlCDATA:
+		return strings.Contains(line, "]]>"), true
+	}
+	blank := strings.TrimSpace(line) == ""
+	return blank, !blank
+}
+
+// interruptsWithHTML reports whether line starts an HTML block that can
+// interrupt a paragraph: any but a lone tag that isn't a block-level one.
+func interruptsWithHTML(line string) bool {
+	kind := htmlBlockStart(line)
+	return kind != 0 && kind != htmlTag
+}
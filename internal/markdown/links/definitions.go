@@ -0,0 +1,167 @@
+package links
+
+import (
+	"bytes"
+
+	"github.com/dbh/md-tools/internal/markdown"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Definition is a link reference definition in a document.
+type Definition struct {
+	Label       string             // normalized, as util.ToLinkReference returns it
+	Written     string             // the label as written, without its brackets
+	Destination string             // the URL, with its escapes resolved
+	Title       string             // as written, with its quotes or parentheses, or ""
+	Range       markdown.ByteRange // its lines, through the final newline
+}
+
+// CollectRefDefs returns the link reference definitions the parser found
+// in doc, in order, so lines in code that only look like definitions are
+// never among them. A definition's lines include a destination or title on
+// a line of its own. A definition inside a block quote, which shares its
+// lines with the quote's markers, has an empty Range, as do definitions
+// between a line and an indented one, which removing them would join: the
+// indented line could go on the block before. So does a definition whose
+// paragraph goes on with a line that would start another kind of block,
+// such as raw HTML, once the definition is removed.
+func CollectRefDefs(doc ast.Node, source []byte) []Definition {
+	var defs []Definition
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		def, ok := n.(*ast.LinkReferenceDefinition)
+		if !entering || !ok {
+			return ast.WalkContinue, nil
+		}
+		lines := def.Lines()
+		if lines.Len() == 0 {
+			return ast.WalkSkipChildren, nil
+		}
+		stop := lines.At(lines.Len() - 1).Stop
+		title := def.Title
+		if afterLabel(source, def.Pos(), stop) {
+			// The parser gave up on a title that has text after it, on
+			// the line after the destination, and took the lines back
+			// from the label's on, title and all. The destination's
+			// line is still the definition's.
+			title = nil
+			if i := bytes.IndexByte(source[stop:], '\n'); i >= 0 {
+				stop += i + 1
+				for stop < len(source) && source[stop] != '\n' {
+					stop++
+				}
+			}
+		}
+		d := Definition{
+			Label:       string(util.ToLinkReference(def.Label)),
+			Written:     string(def.Label),
+			Destination: string(def.Destination),
+			Title:       markdown.WrittenTitle(source, stop, title),
+		}
+		start := def.Pos()
+		for start > 0 && (source[start-1] == ' ' || source[start-1] == '\t') {
+			start--
+		}
+		if start == 0 || source[start-1] == '\n' {
+			end := len(source)
+			if i := bytes.IndexByte(source[stop:], '\n'); i >= 0 {
+				end = stop + i + 1
+			}
+			if !startsOther(def, source, end) {
+				end = paragraphIndent(def, source, end)
+				d.Range = markdown.ByteRange{Start: start, End: end}
+			}
+		}
+		defs = append(defs, d)
+		return ast.WalkSkipChildren, nil
+	})
+
+	for i := 0; i < len(defs); {
+		j := i + 1
+		if defs[i].Range.End == 0 {
+			i = j
+			continue
+		}
+		for j < len(defs) && defs[j].Range.Start == defs[j-1].Range.End && defs[j].Range.End > 0 {
+			j++
+		}
+		if joins(source, defs[i].Range.Start, defs[j-1].Range.End) {
+			for k := i; k < j; k++ {
+				defs[k].Range = markdown.ByteRange{}
+			}
+		}
+		i = j
+	}
+	return defs
+}
+
+// joins reports whether removing source[start:end], whole lines, would
+// bring a line that isn't blank up against an indented one.
+func joins(source []byte, start, end int) bool {
+	if start < 2 || source[start-2] == '\n' {
+		return false
+	}
+	next := end
+	for next < len(source) && (source[next] == ' ' || source[next] == '\t') {
+		next++
+	}
+	return next > end && next < len(source) && source[next] != '\n' && source[next] != '\r'
+}
+
+// startsOther reports whether the paragraph of definition def, which ends
+// at end, goes on there with a line that would start a block other than a
+// paragraph on its own, which it can't do in the middle of one.
+func startsOther(def ast.Node, source []byte, end int) bool {
+	next := def.NextSibling()
+	if next == nil || next.Kind() != ast.KindParagraph {
+		return false
+	}
+	lines := next.Lines()
+	if lines.Len() == 0 || bytes.LastIndexByte(source[:lines.At(0).Start], '\n')+1 != end {
+		return false
+	}
+	line := lines.At(0)
+	first := blockParser.Parse(text.NewReader(line.Value(source))).FirstChild()
+	return first != nil && first.Kind() != ast.KindParagraph
+}
+
+// blockParser parses a paragraph's line on its own for startsOther.
+var blockParser = goldmark.New().Parser()
+
+// paragraphIndent returns end, the end of the top-level definition def,
+// past the indent of the line there if its paragraph goes on on that line.
+// The indent is the paragraph's to ignore, but would start a code block
+// there once the definition is removed.
+func paragraphIndent(def ast.Node, source []byte, end int) int {
+	next := def.NextSibling()
+	if def.Parent() == nil || def.Parent().Kind() != ast.KindDocument || next == nil || next.Kind() != ast.KindParagraph {
+		return end
+	}
+	lines := next.Lines()
+	if lines.Len() == 0 || bytes.LastIndexByte(source[:lines.At(0).Start], '\n')+1 != end {
+		return end
+	}
+	i := end
+	for i < lines.At(0).Start && (source[i] == ' ' || source[i] == '\t') {
+		i++
+	}
+	return i
+}
+
+// afterLabel reports whether only space follows, up to stop, the label of
+// the definition at start.
+func afterLabel(source []byte, start, stop int) bool {
+	i := start + 1
+	for i < stop && source[i] != ']' {
+		if source[i] == '\\' {
+			i++
+		}
+		i++
+	}
+	if i+1 >= stop || source[i+1] != ':' {
+		return false
+	}
+	return len(bytes.TrimSpace(source[i+2:stop])) == 0
+}
@@ -0,0 +1,239 @@
+package links
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/dbh/md-tools/internal/markdown"
+	"github.com/yuin/goldmark/ast"
+)
+
+// SourceExtent returns the start and end of a link, image, or autolink
+// node in source, and the extent of its text: a link's text or an image's
+// alt text, between its brackets, or an autolink's URL. Start is -1 if it
+// can't be found.
+//
+// The parser records where each link opens, at its "[", and each image at
+// its "!". The text closes at the matching "]", counting only the brackets
+// outside the code spans, raw HTML, autolinks, and images in it, so text
+// like [`a]`](url), [<b>x</b>](url), or [![badge](img)](url) is found whole.
+func SourceExtent(node ast.Node, source []byte) (start, end int, text markdown.ByteRange) {
+	if link, ok := node.(*ast.AutoLink); ok {
+		return autoLinkExtent(link, source)
+	}
+	return linkExtent(node, source)
+}
+
+// autoLinkExtent is SourceExtent for an autolink, with the angle brackets
+// around it if it has them. Its position may be before its text, at the
+// space a bare URL follows. A bare URL must follow what GFM allows it to, a
+// space or one of "*_~(", as the parser doesn't always check once a link
+// comes before it.
+func autoLinkExtent(link *ast.AutoLink, source []byte) (start, end int, text markdown.ByteRange) {
+	pos := link.Pos()
+	if pos < 0 {
+		return -1, -1, text
+	}
+	label := link.Label(source)
+	i := bytes.Index(source[pos:], label)
+	if i < 0 {
+		return -1, -1, text
+	}
+	start, end = pos+i, pos+i+len(label)
+	text = markdown.ByteRange{Start: start, End: end}
+	switch {
+	case start > 0 && source[start-1] == '<' && end < len(source) && source[end] == '>':
+		start, end = start-1, end+1
+	case start > 0 && !strings.ContainsRune(" \t\r\n*_~(", rune(source[start-1])):
+		return -1, -1, text
+	}
+	return start, end, text
+}
+
+// linkExtent is SourceExtent for a link or an image.
+func linkExtent(node ast.Node, source []byte) (start, end int, text markdown.ByteRange) {
+	start, end = node.Pos(), -1
+	open := start
+	if node.Kind() == ast.KindImage && open >= 0 {
+		open++ // past the "!"
+	}
+	if open < 0 || open >= len(source) || source[open] != '[' {
+		return -1, -1, text
+	}
+
+	closeSquare := -1
+	spans := opaqueSpans(node, source)
+	for i, depth := open+1, 1; i < len(source) && closeSquare < 0; i++ {
+		if len(spans) > 0 && i >= spans[0].Start {
+			i, spans = spans[0].End-1, spans[1:]
+			continue
+		}
+		switch source[i] {
+		case '\\':
+			i++
+		case '[':
+			depth++
+		case ']':
+			if depth--; depth == 0 {
+				closeSquare = i
+			}
+		}
+	}
+	if closeSquare < 0 {
+		return -1, -1, text
+	}
+	text = markdown.ByteRange{Start: open + 1, End: closeSquare}
+
+	// The link ends where the form the parser found ends: an inline link's
+	// destination and title, a full reference's [label], a collapsed
+	// reference's [] (which the parser also reads with only space between
+	// its brackets), or, for a shortcut reference, the text's own "]". Text
+	// after a shortcut reference, such as a "(" that never closes, isn't
+	// part of it.
+	var ref *ast.ReferenceLink
+	switch n := node.(type) {
+	case *ast.Link:
+		ref = n.Reference
+	case *ast.Image:
+		ref = n.Reference
+	}
+	switch after := closeSquare + 1; {
+	case ref == nil:
+		end = inlineLinkEnd(source, after)
+	case ref.Type == ast.ReferenceLinkShortcut:
+		end = after
+	case ref.Type == ast.ReferenceLinkCollapsed, ref.Type == ast.ReferenceLinkFull:
+		end = scanPast(source, after, '[', ']')
+	}
+	if end < 0 {
+		start = -1
+	}
+	return start, end, text
+}
+
+// opaqueSpans returns the source ranges of the inline nodes within node in
+// which brackets don't delimit its text, in order: code spans, raw HTML,
+// autolinks, and images, whose own text and destination are theirs.
+func opaqueSpans(node ast.Node, source []byte) []markdown.ByteRange {
+	var spans []markdown.ByteRange
+	ast.Walk(node, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering || n == node {
+			return ast.WalkContinue, nil
+		}
+		span := markdown.ByteRange{Start: -1}
+		switch n := n.(type) {
+		case *ast.CodeSpan:
+			span.Start, span.End = n.Pos(), codeSpanEnd(source, n.Pos())
+		case *ast.RawHTML:
+			if n.Segments.Len() > 0 {
+				span.Start, span.End = n.Segments.At(0).Start, n.Segments.At(n.Segments.Len()-1).Stop
+			}
+		case *ast.AutoLink:
+			span.Start, span.End, _ = autoLinkExtent(n, source)
+		case *ast.Image:
+			span.Start, span.End, _ = linkExtent(n, source)
+		default:
+			return ast.WalkContinue, nil
+		}
+		if span.Start >= 0 && span.End > span.Start && (len(spans) == 0 || span.Start >= spans[len(spans)-1].End) {
+			spans = append(spans, span)
+		}
+		return ast.WalkSkipChildren, nil
+	})
+	return spans
+}
+
+// codeSpanEnd returns the offset just past the code span opening with the
+// run of backticks at source[i]: past the next run of the same length.
+func codeSpanEnd(source []byte, i int) int {
+	if i < 0 {
+		return -1
+	}
+	run := 0
+	for i+run < len(source) && source[i+run] == '`' {
+		run++
+	}
+	for j := i + run; j < len(source); {
+		if source[j] != '`' {
+			j++
+			continue
+		}
+		k := j
+		for k < len(source) && source[k] == '`' {
+			k++
+		}
+		if k-j == run {
+			return k
+		}
+		j = k
+	}
+	return -1
+}
+
+// inlineLinkEnd returns the offset just past the ")" that closes the inline
+// link destination and title opening at source[i], or -1. Brackets and
+// parentheses in an angle-bracket destination or a title, or escaped, don't
+// count.
+func inlineLinkEnd(source []byte, i int) int {
+	if i >= len(source) || source[i] != '(' {
+		return -1
+	}
+	i = skipSpace(source, i+1)
+	if i < len(source) && source[i] == '<' {
+		if i = scanPast(source, i, '<', '>'); i < 0 {
+			return -1
+		}
+	} else {
+		for depth := 0; i < len(source) && source[i] > ' ' && (source[i] != ')' || depth > 0); i++ {
+			switch source[i] {
+			case '\\':
+				i++
+			case '(':
+				depth++
+			case ')':
+				depth--
+			}
+		}
+	}
+	i = skipSpace(source, i)
+	if i < len(source) && strings.IndexByte(`"'(`, source[i]) >= 0 {
+		close := source[i]
+		if close == '(' {
+			close = ')'
+		}
+		if i = scanPast(source, i, source[i], close); i < 0 {
+			return -1
+		}
+		i = skipSpace(source, i)
+	}
+	if i >= len(source) || source[i] != ')' {
+		return -1
+	}
+	return i + 1
+}
+
+// scanPast returns the offset just past the unescaped close that ends the
+// span opening with open at source[i], or -1 if it doesn't close.
+func scanPast(source []byte, i int, open, close byte) int {
+	if i >= len(source) || source[i] != open {
+		return -1
+	}
+	for i++; i < len(source); i++ {
+		switch source[i] {
+		case '\\':
+			i++
+		case close:
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// skipSpace returns the offset of the first byte at or after i that isn't
+// a space, tab, or line break.
+func skipSpace(source []byte, i int) int {
+	for i < len(source) && (source[i] == ' ' || source[i] == '\t' || source[i] == '\n' || source[i] == '\r') {
+		i++
+	}
+	return i
+}
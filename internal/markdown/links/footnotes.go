@@ -0,0 +1,46 @@
+package links
+
+import (
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	extast "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Footnotes is extension.Footnote for tools that rewrite links: a footnote
+// nothing refers to stays in the document, which a renderer would drop, so
+// the references in its body are found and their definitions kept.
+var Footnotes goldmark.Extender = footnotes{}
+
+type footnotes struct{}
+
+func (footnotes) Extend(m goldmark.Markdown) {
+	extension.Footnote.Extend(m)
+	// Ahead of the footnote transformer, at 999, which drops them: lower
+	// priorities run first.
+	m.Parser().AddOptions(parser.WithASTTransformers(util.Prioritized(keepFootnotes{}, 998)))
+}
+
+// keepFootnotes moves the footnotes nothing refers to out of the footnote
+// list to just before it.
+type keepFootnotes struct{}
+
+func (keepFootnotes) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	for list := doc.FirstChild(); list != nil; list = list.NextSibling() {
+		if _, ok := list.(*extast.FootnoteList); !ok {
+			continue
+		}
+		for n := list.FirstChild(); n != nil; {
+			next := n.NextSibling()
+			if fn, ok := n.(*extast.Footnote); ok && fn.Index < 0 {
+				list.RemoveChild(list, fn)
+				doc.InsertBefore(doc, list, fn)
+			}
+			n = next
+		}
+		return
+	}
+}
@@ -0,0 +1,99 @@
+package links
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dbh/md-tools/internal/markdown"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/text"
+)
+
+// inlineParser is shared by every call to Inline. It parses footnotes, so
+// the links in their bodies are converted too, even in one nothing refers
+// to.
+var inlineParser = goldmark.New(goldmark.WithExtensions(Footnotes)).Parser()
+
+// Inline converts the reference-style links of content to inline links, and
+// its reference-style images too if images is set, and drops the reference
+// definitions no reference uses any more: those of the references it
+// leaves, such as images, or ones in an HTML block, are kept.
+func Inline(content string, images bool) string {
+	source := []byte(content)
+	doc := inlineParser.Parse(text.NewReader(source))
+	defs := CollectRefDefs(doc, source)
+
+	// The references to convert. An inline link is already what it would
+	// become.
+	all := CollectLinks(doc, source, defs)
+	converted := func(link Link) bool {
+		return link.Start >= 0 && link.Label != "" && (images || !link.Image())
+	}
+	var links []Link
+	for _, link := range all {
+		if converted(link) {
+			links = append(links, link)
+		}
+	}
+	used := Used(doc, source, all, converted)
+
+	// convert returns links[i] as an inline link, with the references inside
+	// its text, such as the image of a linked image, converted too, and the
+	// index of the link after them.
+	var convert func(i int) (string, int)
+	convert = func(i int) (string, int) {
+		link := links[i]
+		var text strings.Builder
+		pos, j := link.Text.Start, i+1
+		for j < len(links) && links[j].End <= link.Text.End {
+			text.Write(source[pos:links[j].Start])
+			inner, after := convert(j)
+			text.WriteString(inner)
+			pos, j = links[j].End, after
+		}
+		text.Write(source[pos:link.Text.End])
+
+		open := "["
+		if link.Image() {
+			open = "!["
+		}
+		if link.Title != "" {
+			return fmt.Sprintf("%s%s](%s %s)", open, text.String(), markdown.Destination(link.Destination), link.Title), j
+		}
+		return fmt.Sprintf("%s%s](%s)", open, text.String(), markdown.Destination(link.Destination)), j
+	}
+
+	var dropRanges []markdown.ByteRange
+	for _, def := range defs {
+		if !used[def.Label] {
+			dropRanges = append(dropRanges, def.Range)
+		}
+	}
+	excludeRanges := markdown.NewRangeSet(dropRanges)
+
+	// Build output
+	var result strings.Builder
+	lastEnd := 0
+
+	for i := 0; i < len(links); {
+		// A link that overlaps the one before is left as it is.
+		if links[i].Start < lastEnd {
+			i++
+			continue
+		}
+		// Write content before this link, excluding reference definition ranges
+		result.WriteString(excludeRanges.Exclude(string(source[lastEnd:links[i].Start]), lastEnd))
+		lastEnd = links[i].End
+		var converted string
+		converted, i = convert(i)
+		result.WriteString(converted)
+	}
+
+	// Write remaining content, excluding reference definitions
+	remaining := string(source[lastEnd:])
+	remaining = excludeRanges.Exclude(remaining, lastEnd)
+	remaining = strings.TrimRight(remaining, "\n") + "\n"
+	result.WriteString(remaining)
+
+	return result.String()
+}
@@ -0,0 +1,100 @@
+// Package links finds the links, images, autolinks, and reference
+// definitions of a parsed document where they are written in its source,
+// for the tools that rewrite them. mdref, mdinline, and mdextlink find them
+// the same way, so a fix to one is a fix to all three.
+package links
+
+import (
+	"sort"
+
+	"github.com/dbh/md-tools/internal/markdown"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/util"
+)
+
+// Link is a link, image, or autolink in a document.
+type Link struct {
+	Node        ast.Node           // the *ast.Link, *ast.Image, or *ast.AutoLink
+	Start, End  int                // its extent in the source, from an image's "!"
+	Text        markdown.ByteRange // its text, alt text, or autolink URL, as written
+	Destination string             // its URL, raw with its escapes
+	Title       string             // as written, with its quotes or parentheses, or ""
+	Label       string             // its reference's label, normalized, or "" if it has none
+}
+
+// Image reports whether l is an image.
+func (l Link) Image() bool {
+	return l.Node.Kind() == ast.KindImage
+}
+
+// Auto reports whether l is an autolink.
+func (l Link) Auto() bool {
+	return l.Node.Kind() == ast.KindAutoLink
+}
+
+// CollectLinks returns the links, images, and autolinks of doc, in the
+// order they start in source, with those inside one another's text, such
+// as the image of a linked image, after it. Those inside the definitions
+// defs, which CollectRefDefs found in doc, are left out; those whose extent
+// can't be found have a Start of -1 and come first.
+//
+// A reference takes the title of the first definition of its label, as it
+// is written there. An inline link's title is as written after its
+// destination.
+func CollectLinks(doc ast.Node, source []byte, defs []Definition) []Link {
+	var defRanges []markdown.ByteRange
+	titles := make(map[string]string)
+	for _, def := range defs {
+		defRanges = append(defRanges, def.Range)
+		if _, ok := titles[def.Label]; !ok {
+			titles[def.Label] = def.Title
+		}
+	}
+	inDefinition := markdown.NewRangeSet(defRanges)
+
+	var links []Link
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		var link Link
+		var rawTitle []byte
+		var reference *ast.ReferenceLink
+		switch n := n.(type) {
+		case *ast.Link:
+			link.Destination, rawTitle, reference = string(n.Destination), n.Title, n.Reference
+		case *ast.Image:
+			link.Destination, rawTitle, reference = string(n.Destination), n.Title, n.Reference
+		case *ast.AutoLink:
+			link.Destination = string(n.URL(source))
+		default:
+			return ast.WalkContinue, nil
+		}
+		link.Node = n
+		link.Start, link.End, link.Text = SourceExtent(n, source)
+		if link.Start >= 0 && inDefinition.Covers(link.Start, link.End) {
+			return ast.WalkContinue, nil
+		}
+
+		switch {
+		case reference != nil:
+			link.Label = string(util.ToLinkReference(reference.Value))
+			link.Title = markdown.QuoteTitle(rawTitle)
+			if written, ok := titles[link.Label]; ok {
+				link.Title = written
+			}
+		case link.Start >= 0:
+			// An inline link's title closes before its ")".
+			link.Title = markdown.WrittenTitle(source, link.End-1, rawTitle)
+		default:
+			link.Title = markdown.QuoteTitle(rawTitle)
+		}
+		links = append(links, link)
+		return ast.WalkContinue, nil
+	})
+
+	sort.SliceStable(links, func(i, j int) bool {
+		return links[i].Start < links[j].Start
+	})
+	return links
+}
@@ -0,0 +1,56 @@
+package links
+
+import (
+	"regexp"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/util"
+)
+
+// Used returns the labels, normalized, that doc still uses once a tool has
+// rewritten the links of all, which CollectLinks returned, that converted
+// reports it converts: those of the references it leaves, including one
+// that overlaps a converted link before it, which can't be rewritten, and
+// the text in brackets in doc's HTML blocks, which the parser leaves as it
+// is but a renderer may read as Markdown. A definition of any other label
+// can go.
+func Used(doc ast.Node, source []byte, all []Link, converted func(Link) bool) map[string]bool {
+	used := make(map[string]bool)
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if block, ok := n.(*ast.HTMLBlock); ok && entering {
+			for _, m := range bracketedRe.FindAllSubmatch(blockText(block, source), -1) {
+				used[string(util.ToLinkReference(m[1]))] = true
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+
+	lastEnd := 0
+	for _, link := range all {
+		switch {
+		case link.Start < 0 || !converted(link):
+			if link.Label != "" {
+				used[link.Label] = true
+			}
+			continue
+		case link.Start < lastEnd && link.End > lastEnd && link.Label != "":
+			used[link.Label] = true
+		}
+		lastEnd = max(lastEnd, link.End)
+	}
+	return used
+}
+
+// bracketedRe matches text in brackets, as a reference's label is written.
+var bracketedRe = regexp.MustCompile(`\[([^\[\]]+)\]`)
+
+// blockText returns the lines of block as they are in source.
+func blockText(block ast.Node, source []byte) []byte {
+	var text []byte
+	lines := block.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		line := lines.At(i)
+		text = append(text, line.Value(source)...)
+	}
+	return text
+}
@@ -0,0 +1,125 @@
+package markdown
+
+import "strings"
+
+// MarkerOpen returns the HTML comment that opens a generated section, e.g.
+// "<!-- backlinks -->".
+func MarkerOpen(name string) string {
+	return "<!-- " + name + " -->"
+}
+
+// MarkerClose returns the HTML comment that closes a generated section, e.g.
+// "<!-- /backlinks -->".
+func MarkerClose(name string) string {
+	return "<!-- /" + name + " -->"
+}
+
+// FindMarkedSection returns the line indexes of the opening and closing markers
+// of the named section. Markers must stand alone on their line and are ignored
+// inside fenced code blocks. ok is false if the section is absent or unclosed.
+func FindMarkedSection(lines []string, name string) (open, close int, ok bool) {
+	open = -1
+	inFence := false
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			continue
+		}
+		switch {
+		case open < 0 && trimmed == MarkerOpen(name):
+			open = i
+		case open >= 0 && trimmed == MarkerClose(name):
+			return open, i, true
+		}
+	}
+	return -1, -1, false
+}
+
+// StripMarkedSection returns content with the named section (markers included)
+// removed, along with the blank lines that separated it from preceding text.
+func StripMarkedSection(content, name string) string {
+	return ReplaceMarkedSection(content, name, nil)
+}
+
+// ReplaceMarkedSection replaces the body of the named section with body. When
+// the section is absent it is appended at the end of the document, separated
+// by a blank line. A nil body removes the section entirely. The result always
+// ends with a single newline.
+func ReplaceMarkedSection(content, name string, body []string) string {
+	return replaceMarkedSection(content, name, body, false)
+}
+
+// ReplaceMarkedSectionTop is like ReplaceMarkedSection, but an absent section
+// is inserted at the top of the document, after any frontmatter, and followed
+// by a blank line.
+func ReplaceMarkedSectionTop(content, name string, body []string) string {
+	return replaceMarkedSection(content, name, body, true)
+}
+
+func replaceMarkedSection(content, name string, body []string, top bool) string {
+	lines := strings.Split(strings.TrimRight(content, "\n"), "\n")
+	open, close, ok := FindMarkedSection(lines, name)
+
+	var section []string
+	if body != nil {
+		section = append(section, MarkerOpen(name))
+		section = append(section, body...)
+		section = append(section, MarkerClose(name))
+	}
+
+	var result []string
+	switch {
+	case ok:
+		before := lines[:open]
+		after := lines[close+1:]
+		if body == nil {
+			if top {
+				for len(after) > 0 && strings.TrimSpace(after[0]) == "" {
+					after = after[1:]
+				}
+			} else {
+				for len(before) > 0 && strings.TrimSpace(before[len(before)-1]) == "" {
+					before = before[:len(before)-1]
+				}
+				if len(before) > 0 && len(after) > 0 && strings.TrimSpace(after[0]) != "" {
+					before = append(before, "")
+				}
+			}
+		}
+		result = append(result, before...)
+		result = append(result, section...)
+		result = append(result, after...)
+	case len(section) == 0:
+		result = lines
+	case top:
+		fm := FrontmatterEnd(lines)
+		rest := lines[fm:]
+		result = append(result, lines[:fm]...)
+		// Keep a blank line that separated frontmatter from the text.
+		if len(rest) > 0 && strings.TrimSpace(rest[0]) == "" && fm > 0 {
+			result = append(result, "")
+		}
+		for len(rest) > 0 && strings.TrimSpace(rest[0]) == "" {
+			rest = rest[1:]
+		}
+		result = append(result, section...)
+		if len(rest) > 0 {
+			result = append(result, "")
+			result = append(result, rest...)
+		}
+	default:
+		result = lines
+		if len(result) == 1 && result[0] == "" {
+			result = nil
+		} else {
+			result = append(result, "")
+		}
+		result = append(result, section...)
+	}
+
+	return strings.TrimRight(strings.Join(result, "\n"), "\n") + "\n"
+}
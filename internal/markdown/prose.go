@@ -0,0 +1,245 @@
+package markdown
+
+import (
+	"regexp"
+	"strings"
+)
+
+// RewriteProse returns content with rewrite applied to the inline text of
+// each paragraph, heading, and table row. A paragraph's lines, list and
+// quote markers included, are rewritten together. Frontmatter, code blocks,
+// display math, HTML blocks, link reference definitions, and thematic
+// breaks are passed through as they are. The result ends in one newline.
+func RewriteProse(content string, rewrite func(string) string) string {
+	lines := strings.Split(content, "\n")
+	i := FrontmatterEnd(lines)
+	result := append([]string(nil), lines[:i]...)
+
+	var block []string
+	flush := func() {
+		if len(block) > 0 {
+			result = append(result, strings.Split(rewrite(strings.Join(block, "\n")), "\n")...)
+			block = nil
+		}
+	}
+
+	for i < len(lines) {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		// Fenced code and display math: pass through unchanged.
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") || trimmed == "$$" {
+			flush()
+			fence := trimmed[:min(3, len(trimmed))]
+			result = append(result, line)
+			i++
+			for i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), fence) {
+				result = append(result, lines[i])
+				i++
+			}
+			if i < len(lines) {
+				result = append(result, lines[i])
+				i++
+			}
+			continue
+		}
+
+		switch {
+		case trimmed == "":
+			flush()
+			result = append(result, line)
+		case len(block) == 0 && (strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t")):
+			// Indented code block (it can't interrupt a paragraph).
+			result = append(result, line)
+		case IsHorizontalRule(line) || IsLinkRefDefinition(line) || strings.HasPrefix(trimmed, "<"):
+			flush()
+			result = append(result, line)
+		case strings.HasPrefix(trimmed, "#") || IsTableRow(line):
+			// Headings and table rows are single-line blocks.
+			flush()
+			result = append(result, rewrite(line))
+		default:
+			block = append(block, line)
+		}
+		i++
+	}
+	flush()
+
+	output := strings.Join(result, "\n")
+	return strings.TrimRight(output, "\n") + "\n"
+}
+
+// SkipLiteral returns the index past the code span, $math$, autolink, HTML
+// tag, link destination, or GFM bare URL or email address that starts at
+// s[i], inline text whose characters aren't prose, and whether one does. A backslash escape counts
+// too, so an escaped character is skipped along with its backslash.
+func SkipLiteral(s string, i int) (int, bool) {
+	switch c := s[i]; {
+	case c == '\\':
+		return min(i+2, len(s)), true
+	case c == '`':
+		return skipCodeSpan(s, i), true
+	case c == '$':
+		if j := skipMath(s, i); j > i+1 {
+			return j, true
+		}
+	case c == '<':
+		if j := skipAngle(s, i); j > i+1 {
+			return j, true
+		}
+	case c == '(' && i > 0 && s[i-1] == ']':
+		return skipParens(s, i), true
+	}
+	if j := skipBareURL(s, i); j > i {
+		return j, true
+	}
+	return i, false
+}
+
+// bareURLRe and emailRe match the starts of GFM's extended autolinks.
+var (
+	bareURLRe = regexp.MustCompile(`^(?i:https?://|ftp://|www\.)[^\s<]+`)
+	emailRe   = regexp.MustCompile(`^[A-Za-z0-9.+_-]+@[A-Za-z0-9_-]+(?:\.[A-Za-z0-9_-]+)+`)
+)
+
+// skipBareURL returns the index past the URL or email address that GFM
+// links without brackets at s[i], or i if there is none. Like GFM, it
+// leaves out trailing punctuation and a closing parenthesis it doesn't
+// open.
+func skipBareURL(s string, i int) int {
+	var prev byte
+	if i > 0 {
+		prev = s[i-1]
+	}
+	if m := bareURLRe.FindString(s[i:]); m != "" && (i == 0 || strings.IndexByte(" \t\n*_~(", prev) >= 0) {
+		for {
+			switch {
+			case strings.IndexByte("?!.,:*_~", m[len(m)-1]) >= 0:
+				m = m[:len(m)-1]
+			case m[len(m)-1] == ')' && strings.Count(m, ")") > strings.Count(m, "("):
+				m = m[:len(m)-1]
+			default:
+				return i + len(m)
+			}
+		}
+	}
+	if i > 0 && (isAlnum(prev) || strings.IndexByte(".+_-@", prev) >= 0) {
+		return i
+	}
+	if m := emailRe.FindString(s[i:]); m != "" {
+		m = strings.TrimRight(m, ".")
+		if last := m[len(m)-1]; last != '-' && last != '_' {
+			return i + len(m)
+		}
+	}
+	return i
+}
+
+// isAlnum reports whether c is an ASCII letter or digit.
+func isAlnum(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// skipCodeSpan returns the index past the code span starting at s[i], or
+// past the opening backticks if the span is unterminated.
+func skipCodeSpan(s string, i int) int {
+	n := 0
+	for i+n < len(s) && s[i+n] == '`' {
+		n++
+	}
+	for j := i + n; j < len(s); {
+		if s[j] != '`' {
+			j++
+			continue
+		}
+		m := 0
+		for j+m < len(s) && s[j+m] == '`' {
+			m++
+		}
+		if m == n {
+			return j + m
+		}
+		j += m
+	}
+	return i + n
+}
+
+// MathEnd returns the index past the inline math starting at s[i]: $…$ or
+// $$…$$, by the rules SkipLiteral follows, or \(…\) or \[…\]. It returns i
+// if none starts there.
+func MathEnd(s string, i int) int {
+	switch {
+	case strings.HasPrefix(s[i:], `\(`) || strings.HasPrefix(s[i:], `\[`):
+		closer := `\)`
+		if s[i+1] == '[' {
+			closer = `\]`
+		}
+		if j := strings.Index(s[i+2:], closer); j >= 0 {
+			return i + 2 + j + 2
+		}
+	case s[i] == '$':
+		if j := skipMath(s, i); j > i+1 {
+			return j
+		}
+	}
+	return i
+}
+
+// skipMath returns the index past the $math$ or $$math$$ span starting at
+// s[i], or i+1 if the dollar sign doesn't open one.
+func skipMath(s string, i int) int {
+	if strings.HasPrefix(s[i:], "$$") {
+		if j := strings.Index(s[i+2:], "$$"); j >= 0 {
+			return i + 2 + j + 2
+		}
+		return i + 2
+	}
+	if i+1 >= len(s) || s[i+1] == ' ' || s[i+1] == '$' {
+		return i + 1
+	}
+	for j := i + 1; j < len(s); j++ {
+		switch {
+		case s[j] == '\\':
+			j++
+		case s[j] == '$' && s[j-1] != ' ' && (j+1 >= len(s) || s[j+1] < '0' || s[j+1] > '9'):
+			return j + 1
+		}
+	}
+	return i + 1
+}
+
+// skipAngle returns the index past an autolink or HTML tag starting at
+// s[i], or i+1 if the angle bracket doesn't open one.
+func skipAngle(s string, i int) int {
+	if i+1 >= len(s) {
+		return i + 1
+	}
+	c := s[i+1]
+	if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '/' || c == '!' || c == '?') {
+		return i + 1
+	}
+	if j := strings.IndexByte(s[i:], '>'); j >= 0 {
+		return i + j + 1
+	}
+	return i + 1
+}
+
+// skipParens returns the index past the link destination "(...)" starting
+// at s[i], allowing balanced parentheses inside it.
+func skipParens(s string, i int) int {
+	depth := 0
+	for j := i; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return j + 1
+			}
+		}
+	}
+	return i + 1
+}
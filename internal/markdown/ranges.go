@@ -1,6 +1,9 @@
 package markdown
 
-import "strings"
+import (
+	"sort"
+	"strings"
+)
 
 // ByteRange represents a range of bytes in source content.
 type ByteRange struct {
@@ -8,43 +11,109 @@ type ByteRange struct {
 	End   int
 }
 
-// ExcludeRanges returns content with any overlapping ranges removed.
-// contentStart is the byte offset where content begins in the original source.
-// Ranges are specified in terms of the original source byte positions.
-func ExcludeRanges(content string, contentStart int, ranges []ByteRange) string {
-	contentEnd := contentStart + len(content)
-	var result strings.Builder
-
-	pos := 0
-	for _, r := range ranges {
-		// Convert range to be relative to content
-		relStart := r.Start - contentStart
-		relEnd := r.End - contentStart
+// Replacement records that the bytes Old of one text were written as the
+// bytes New of the text made from it.
+type Replacement struct {
+	Old, New ByteRange
+}
 
-		// Skip ranges that don't overlap with content
-		if r.End <= contentStart || r.Start >= contentEnd {
-			continue
+// OriginalOffset returns the position in the old text of pos in the new
+// one, given the replacements that made it, in order. A position inside a
+// replacement is taken to its start.
+func OriginalOffset(reps []Replacement, pos int) int {
+	shift := 0
+	for _, r := range reps {
+		switch {
+		case pos < r.New.Start:
+			return pos + shift
+		case pos < r.New.End:
+			return r.Old.Start
 		}
+		shift = r.Old.End - r.New.End
+	}
+	return pos + shift
+}
+
+// RangeSet is a union of byte ranges, kept sorted and merged so that
+// lookups are binary searches. Build one with NewRangeSet before querying it
+// for many positions or chunks of the same source.
+type RangeSet []ByteRange
 
-		// Clamp to content bounds
-		if relStart < 0 {
-			relStart = 0
+// NewRangeSet returns the union of ranges, which may be unsorted and may
+// overlap. Empty ranges are dropped.
+func NewRangeSet(ranges []ByteRange) RangeSet {
+	sorted := make([]ByteRange, 0, len(ranges))
+	for _, r := range ranges {
+		if r.End > r.Start {
+			sorted = append(sorted, r)
 		}
-		if relEnd > len(content) {
-			relEnd = len(content)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+	var set RangeSet
+	for _, r := range sorted {
+		if n := len(set); n > 0 && r.Start <= set[n-1].End {
+			if r.End > set[n-1].End {
+				set[n-1].End = r.End
+			}
+			continue
 		}
+		set = append(set, r)
+	}
+	return set
+}
+
+// search returns the index of the first range that ends after pos.
+func (s RangeSet) search(pos int) int {
+	return sort.Search(len(s), func(i int) bool { return s[i].End > pos })
+}
 
-		// Write content before this range
-		if relStart > pos {
-			result.WriteString(content[pos:relStart])
+// Contains reports whether pos is inside the set.
+func (s RangeSet) Contains(pos int) bool {
+	i := s.search(pos)
+	return i < len(s) && s[i].Start <= pos
+}
+
+// Covers reports whether all of [start, end) is inside the set.
+func (s RangeSet) Covers(start, end int) bool {
+	i := s.search(start)
+	return i < len(s) && s[i].Start <= start && end <= s[i].End
+}
+
+// Exclude returns content with the bytes in the set removed. contentStart is
+// the byte offset where content begins in the original source, which the
+// ranges are positions in. Only the ranges overlapping content are visited.
+func (s RangeSet) Exclude(content string, contentStart int) string {
+	contentEnd := contentStart + len(content)
+	i := s.search(contentStart)
+	if i == len(s) || s[i].Start >= contentEnd {
+		return content
+	}
+	var result strings.Builder
+	pos := contentStart
+	for ; i < len(s) && s[i].Start < contentEnd; i++ {
+		if s[i].Start > pos {
+			result.WriteString(content[pos-contentStart : s[i].Start-contentStart])
 		}
-		pos = relEnd
+		pos = s[i].End
 	}
-
-	// Write remaining content
-	if pos < len(content) {
-		result.WriteString(content[pos:])
+	if pos < contentEnd {
+		result.WriteString(content[pos-contentStart:])
 	}
-
 	return result.String()
 }
+
+// ExcludeRanges returns content with any overlapping ranges removed.
+// contentStart is the byte offset where content begins in the original source.
+// Ranges are specified in terms of the original source byte positions.
+// Callers excluding ranges from many chunks should build a RangeSet once
+// instead.
+func ExcludeRanges(content string, contentStart int, ranges []ByteRange) string {
+	contentEnd := contentStart + len(content)
+	var overlapping []ByteRange
+	for _, r := range ranges {
+		if r.End > contentStart && r.Start < contentEnd {
+			overlapping = append(overlapping, r)
+		}
+	}
+	return NewRangeSet(overlapping).Exclude(content, contentStart)
+}
@@ -0,0 +1,503 @@
+package markdown
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/dbh/md-tools/internal/markdown/uax29"
+)
+
+// SentencePerLine rewrites the paragraphs and blockquotes of content with one
+// sentence per line, however they were wrapped, leaving other blocks alone.
+func SentencePerLine(content string) string {
+	return Transform(content, SentenceHandlers)
+}
+
+// SentenceHandlers are the Handlers SentencePerLine transforms with.
+var SentenceHandlers = SentenceHandlersWith(SplitSentences)
+
+// SentenceHandlersWith returns Handlers that join the lines of each paragraph
+// and blockquote and split them into sentences with split.
+func SentenceHandlersWith(split func(text string) []string) Handlers {
+	join := func(lines []string) string {
+		return strings.Join(strings.Fields(strings.Join(lines, " ")), " ")
+	}
+	return Handlers{
+		Paragraph: func(lines []string) []string {
+			return split(join(lines))
+		},
+		Blockquote: func(lines []string) []string {
+			return TransformBlockquote(lines, func(content []string) []string {
+				var out []string
+				for _, s := range split(join(content)) {
+					out = append(out, "> "+s)
+				}
+				return out
+			})
+		},
+	}
+}
+
+// SplitSentences splits a paragraph of text, joined onto one line, into its
+// sentences. Inline code, links, emphasis, footnotes, parentheses, quotations,
+// and Obsidian comments are never split, and a trailing block ID stays with
+// the last sentence.
+func SplitSentences(text string) []string {
+	if text == "" {
+		return nil
+	}
+
+	var sentences []string
+	var current strings.Builder
+	runes := []rune(text)
+
+	for i := 0; i < len(runes); i++ {
+		// Inline span (code, link, emphasis, strikethrough, footnote) —
+		// copy verbatim so a sentence boundary inside it never splits.
+		if n := spanLen(runes, i); n > 0 {
+			end := i + n
+			for k := i; k < end; k++ {
+				current.WriteRune(runes[k])
+			}
+			// A sentence may end inside the span, just before its closing
+			// delimiter (e.g. "**Done.** Next"). Break after the span and
+			// anything trailing it.
+			if j := skipTrailers(runes, end); j+1 < len(runes) && runes[j] == ' ' && !unicode.IsLower(runes[j+1]) && spanEndsSentence(runes[i:end]) && !StartsBlock(firstWord(runes[j+1:])) {
+				for k := end; k < j; k++ {
+					current.WriteRune(runes[k])
+				}
+				sentences = append(sentences, current.String())
+				current.Reset()
+				i = j
+				continue
+			}
+			i = end - 1
+			continue
+		}
+
+		current.WriteRune(runes[i])
+
+		if runes[i] == '.' || runes[i] == '!' || runes[i] == '?' {
+			j := skipTrailers(runes, i+1)
+			// A trailing block ID (^id) stays at the end of the last sentence.
+			if j+1 < len(runes) && runes[j] == ' ' && !unicode.IsLower(runes[j+1]) && !IsBlockID(string(runes[j+1:])) && !StartsBlock(firstWord(runes[j+1:])) && !(j == i+1 && numberContinues(runes, i, j+1)) {
+				for k := i + 1; k < j; k++ {
+					current.WriteRune(runes[k])
+				}
+				sentences = append(sentences, current.String())
+				current.Reset()
+				i = j
+			}
+		}
+	}
+
+	if current.Len() > 0 {
+		sentences = append(sentences, current.String())
+	}
+
+	return sentences
+}
+
+// SplitSentencesUnicode is SplitSentences with the sentence boundaries of
+// Unicode Standard Annex #29 in place of its ASCII punctuation, so 。！？ and
+// the rest of Unicode's terminal punctuation end sentences too. Inline spans
+// are never split, and a sentence that ends inside one ends after it.
+func SplitSentencesUnicode(text string) []string {
+	runes := []rune(text)
+	// The segmenter sees each span as a word: its first letter, then
+	// placeholders, ending in a full stop and closing quote if a sentence
+	// ends inside it.
+	masked := append([]rune(nil), runes...)
+	for i := 0; i < len(runes); i++ {
+		n := spanLen(runes, i)
+		if n == 0 {
+			continue
+		}
+		span := runes[i : i+n]
+		for k := range span {
+			masked[i+k] = '\uFFFC'
+		}
+		for _, r := range span {
+			if unicode.IsLetter(r) {
+				masked[i] = r
+				break
+			}
+		}
+		if n > 2 && spanEndsSentence(span) {
+			masked[i+n-2], masked[i+n-1] = '.', '"'
+		}
+		i += n - 1
+	}
+
+	var sentences []string
+	start := 0
+	for _, i := range uax29.SentenceBreaks(masked) {
+		rest := runes[i:]
+		if IsBlockID(string(rest)) || StartsBlock(firstWord(rest)) {
+			continue
+		}
+		if end := i - 1; end > 0 && runes[end] == ' ' && numberContinues(runes, end-1, i) {
+			continue
+		}
+		sentences = append(sentences, strings.TrimRight(string(runes[start:i]), " "))
+		start = i
+	}
+	if start < len(runes) {
+		sentences = append(sentences, string(runes[start:]))
+	}
+	return sentences
+}
+
+// BreakingAfter returns split extended to also break a sentence after each
+// mark in marks, such as ":;", that a space follows, for semantic line breaks.
+// Marks inside inline spans don't break, and neither do those before a block
+// ID or a word that would start a block.
+func BreakingAfter(split func(text string) []string, marks string) func(text string) []string {
+	if marks == "" {
+		return split
+	}
+	return func(text string) []string {
+		var lines []string
+		for _, sentence := range split(text) {
+			lines = append(lines, splitAfter(sentence, marks)...)
+		}
+		return lines
+	}
+}
+
+// MergingShort returns split extended to merge each sentence shorter than
+// minLen characters onto the line before it, so "No." or "Why?" isn't a line
+// of its own. A short first sentence is merged onto the line after it instead.
+func MergingShort(split func(text string) []string, minLen int) func(text string) []string {
+	if minLen <= 0 {
+		return split
+	}
+	return func(text string) []string {
+		var lines []string
+		short := false // whether the last line is a short first sentence
+		for _, sentence := range split(text) {
+			switch {
+			case len(lines) == 0:
+				short = utf8.RuneCountInString(sentence) < minLen
+				lines = append(lines, sentence)
+			case short || utf8.RuneCountInString(sentence) < minLen:
+				lines[len(lines)-1] += " " + sentence
+				short = false
+			default:
+				lines = append(lines, sentence)
+			}
+		}
+		return lines
+	}
+}
+
+// splitAfter splits text after each of marks outside inline spans.
+func splitAfter(text, marks string) []string {
+	runes := []rune(text)
+	var parts []string
+	start := 0
+	for i := 0; i < len(runes); i++ {
+		if n := spanLen(runes, i); n > 0 {
+			i += n - 1
+			continue
+		}
+		if !strings.ContainsRune(marks, runes[i]) {
+			continue
+		}
+		j := skipTrailers(runes, i+1)
+		if j+1 < len(runes) && runes[j] == ' ' && !IsBlockID(string(runes[j+1:])) && !StartsBlock(firstWord(runes[j+1:])) {
+			parts = append(parts, string(runes[start:j]))
+			start = j + 1
+			i = j
+		}
+	}
+	return append(parts, string(runes[start:]))
+}
+
+// monthNames are the months, in full and abbreviated, that an ordinal day
+// such as "10." comes before in German: "am 10. Oktober".
+var monthNames = map[string]bool{
+	"Januar": true, "Jänner": true, "Februar": true, "März": true, "April": true,
+	"Mai": true, "Juni": true, "Juli": true, "August": true, "September": true,
+	"Oktober": true, "November": true, "Dezember": true,
+	"Jan": true, "Feb": true, "Mär": true, "Apr": true, "Jun": true, "Jul": true,
+	"Aug": true, "Sep": true, "Sept": true, "Okt": true, "Nov": true, "Dez": true,
+}
+
+// numberContinues reports whether the full stop at i, after a number, doesn't
+// end a sentence because of the word at next: a month after an ordinal day, as
+// in "am 10. Oktober", or another number with a full stop, as in "items 1. 2.
+// and 3.". A version or decimal such as 1.2.3 never ends one inside it, since
+// no space follows its full stops.
+func numberContinues(runes []rune, i, next int) bool {
+	if runes[i] != '.' {
+		return false
+	}
+	digits := 0
+	for i-digits-1 >= 0 && unicode.IsDigit(runes[i-digits-1]) {
+		digits++
+	}
+	if digits == 0 || i-digits-1 >= 0 && !isSpace(runes[i-digits-1]) && runes[i-digits-1] != '(' {
+		return false
+	}
+	word := firstWord(runes[next:])
+	if orderedListRe.MatchString(word + " ") {
+		return true
+	}
+	return digits <= 2 && monthNames[strings.TrimRight(word, ".,;:")]
+}
+
+// skipTrailers returns the index past the closing quotes and brackets, and
+// the footnotes (reference or inline), that may follow the end of a
+// sentence at i, e.g. "end.' Next", "end.[^1] Next" or "end.^[note] Next".
+func skipTrailers(runes []rune, i int) int {
+	for i < len(runes) {
+		if n := footnoteLen(runes, i); n > 0 {
+			i += n
+		} else if strings.ContainsRune(`"')]”’`, runes[i]) {
+			i++
+		} else {
+			break
+		}
+	}
+	return i
+}
+
+// firstWord returns the text of runes up to the first space.
+func firstWord(runes []rune) string {
+	for i, r := range runes {
+		if r == ' ' {
+			return string(runes[:i])
+		}
+	}
+	return string(runes)
+}
+
+// footnoteLen returns the rune length of a footnote beginning at start, or 0
+// if none is present there. It recognizes both reference footnotes ([^label])
+// and inline footnotes (^[...], which may contain nested brackets).
+func footnoteLen(runes []rune, start int) int {
+	if start+1 >= len(runes) {
+		return 0
+	}
+	switch {
+	case runes[start] == '[' && runes[start+1] == '^':
+		for k := start + 2; k < len(runes); k++ {
+			if runes[k] == ']' {
+				return k - start + 1
+			}
+			if runes[k] == '[' {
+				return 0
+			}
+		}
+	case runes[start] == '^' && runes[start+1] == '[':
+		depth := 0
+		for k := start + 1; k < len(runes); k++ {
+			if runes[k] == '[' {
+				depth++
+			} else if runes[k] == ']' {
+				depth--
+				if depth == 0 {
+					return k - start + 1
+				}
+			}
+		}
+	}
+	return 0
+}
+
+// spanLen returns the rune length of an inline span beginning at i whose
+// interior must not be split, or 0 if no span begins there. Recognized spans
+// are code spans, links/images, emphasis, strikethrough, footnotes,
+// parentheses, quotations, and Obsidian comments.
+func spanLen(runes []rune, i int) int {
+	switch {
+	case runes[i] == '(':
+		return balancedLen(runes, i, '(', ')')
+	case runes[i] == '"':
+		return quoteLen(runes, i)
+	case runes[i] == '“':
+		return balancedLen(runes, i, '“', '”')
+	case runes[i] == '`':
+		return codeSpanLen(runes, i)
+	case runes[i] == '^':
+		return footnoteLen(runes, i) // inline footnote ^[...]
+	case runes[i] == '[':
+		return bracketSpanLen(runes, i)
+	case runes[i] == '*' || runes[i] == '_':
+		return emphasisLen(runes, i)
+	case runes[i] == '~':
+		return strikeLen(runes, i)
+	case runes[i] == '%':
+		return commentLen(runes, i)
+	}
+	return 0
+}
+
+// quoteLen returns the length of a "quotation" at i, closed by the next
+// straight double quote, or 0 if none opens there. An opening quote isn't
+// after a letter or digit, as the one in 12" is.
+func quoteLen(runes []rune, i int) int {
+	if i > 0 && isWordChar(runes[i-1]) || i+1 >= len(runes) || isSpace(runes[i+1]) {
+		return 0
+	}
+	for j := i + 1; j < len(runes); j++ {
+		if runes[j] == '"' {
+			return j + 1 - i
+		}
+	}
+	return 0
+}
+
+// commentLen returns the length of an Obsidian comment (%%…%%) at i, or 0 if
+// none opens there.
+func commentLen(runes []rune, i int) int {
+	if i+1 >= len(runes) || runes[i+1] != '%' {
+		return 0
+	}
+	for j := i + 2; j+1 < len(runes); j++ {
+		if runes[j] == '%' && runes[j+1] == '%' {
+			return j + 2 - i
+		}
+	}
+	return 0
+}
+
+// codeSpanLen returns the length of a backtick code span at i, closed by a run
+// of the same number of backticks, or 0 if unterminated.
+func codeSpanLen(runes []rune, i int) int {
+	n := 0
+	for i+n < len(runes) && runes[i+n] == '`' {
+		n++
+	}
+	for j := i + n; j < len(runes); {
+		if runes[j] != '`' {
+			j++
+			continue
+		}
+		m := 0
+		for j+m < len(runes) && runes[j+m] == '`' {
+			m++
+		}
+		if m == n {
+			return j + m - i
+		}
+		j += m
+	}
+	return 0
+}
+
+// bracketSpanLen returns the length of a [text] span at i, plus a following
+// (target) or [reference] when balanced, or 0 if the brackets are unbalanced.
+func bracketSpanLen(runes []rune, i int) int {
+	textLen := balancedLen(runes, i, '[', ']')
+	if textLen == 0 {
+		return 0
+	}
+	j := i + textLen
+	if j < len(runes) {
+		if t := balancedLen(runes, j, '(', ')'); t > 0 {
+			return textLen + t
+		}
+		if t := balancedLen(runes, j, '[', ']'); t > 0 {
+			return textLen + t
+		}
+	}
+	return textLen
+}
+
+// balancedLen returns the length of a balanced open/close run starting at start
+// (which must hold open), or 0 if it is never closed.
+func balancedLen(runes []rune, start int, open, close rune) int {
+	if start >= len(runes) || runes[start] != open {
+		return 0
+	}
+	depth := 0
+	for j := start; j < len(runes); j++ {
+		switch runes[j] {
+		case open:
+			depth++
+		case close:
+			depth--
+			if depth == 0 {
+				return j - start + 1
+			}
+		}
+	}
+	return 0
+}
+
+// emphasisLen returns the length of an emphasis/strong span (*, _, **, ***, …)
+// at i, or 0 if no span opens there. A delimiter run opens a span only when it
+// is not followed by whitespace (and, for _, not inside a word); it closes at
+// the first matching run not preceded by whitespace.
+func emphasisLen(runes []rune, i int) int {
+	c := runes[i]
+	n := 0
+	for i+n < len(runes) && runes[i+n] == c {
+		n++
+	}
+	after := i + n
+	if after >= len(runes) || isSpace(runes[after]) {
+		return 0
+	}
+	if c == '_' && i > 0 && isWordChar(runes[i-1]) {
+		return 0
+	}
+	for j := after; j < len(runes); j++ {
+		if runes[j] != c {
+			continue
+		}
+		m := 0
+		for j+m < len(runes) && runes[j+m] == c {
+			m++
+		}
+		if isSpace(runes[j-1]) || (c == '_' && j+m < len(runes) && isWordChar(runes[j+m])) {
+			j += m - 1
+			continue
+		}
+		return j + m - i
+	}
+	return 0
+}
+
+// strikeLen returns the length of a GFM strikethrough span (~~…~~) at i, or 0
+// if no span opens there.
+func strikeLen(runes []rune, i int) int {
+	if i+1 >= len(runes) || runes[i+1] != '~' {
+		return 0
+	}
+	after := i + 2
+	if after >= len(runes) || isSpace(runes[after]) {
+		return 0
+	}
+	for j := after; j+1 < len(runes); j++ {
+		if runes[j] == '~' && runes[j+1] == '~' && !isSpace(runes[j-1]) {
+			return j + 2 - i
+		}
+	}
+	return 0
+}
+
+func isSpace(r rune) bool    { return unicode.IsSpace(r) }
+func isWordChar(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }
+
+// spanEndsSentence reports whether span (delimiters included) ends with
+// terminal punctuation once trailing closing delimiters are removed, e.g.
+// "**Done.**" or "`x = 1.`".
+func spanEndsSentence(span []rune) bool {
+	j := len(span) - 1
+	for j >= 0 && isCloser(span[j]) {
+		j--
+	}
+	return j >= 0 && (span[j] == '.' || span[j] == '!' || span[j] == '?')
+}
+
+func isCloser(r rune) bool {
+	switch r {
+	case '*', '_', '~', '`', ')', ']', '"', '\'', '”':
+		return true
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package markdown
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Slug returns the GitHub-style anchor for heading text: lowercased, with
+// punctuation removed and spaces replaced by hyphens.
+func Slug(text string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(text)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_':
+			b.WriteRune(r)
+		case r == ' ':
+			b.WriteRune('-')
+		}
+	}
+	return b.String()
+}
+
+// Slugger assigns unique slugs within one document, suffixing repeats with
+// -1, -2, … the way GitHub does.
+type Slugger struct {
+	seen map[string]bool
+}
+
+// Slug returns the unique slug for text, recording it as used.
+func (s *Slugger) Slug(text string) string {
+	if s.seen == nil {
+		s.seen = make(map[string]bool)
+	}
+	base := Slug(text)
+	slug := base
+	for n := 1; s.seen[slug]; n++ {
+		slug = base + "-" + strconv.Itoa(n)
+	}
+	s.seen[slug] = true
+	return slug
+}
+
+// Reserve records slug as used, so that Slug never returns it. Use it for
+// IDs set explicitly in the document. An empty slug is ignored.
+func (s *Slugger) Reserve(slug string) {
+	if slug == "" {
+		return
+	}
+	if s.seen == nil {
+		s.seen = make(map[string]bool)
+	}
+	s.seen[slug] = true
+}
@@ -1,6 +1,12 @@
 package markdown
 
-import "strings"
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
 
 // Handlers defines the tool-specific behavior for paragraph and blockquote
 // processing in a Markdown document transformation.
@@ -12,76 +18,189 @@ type Handlers struct {
 	// intact) and returns the transformed lines.
 	Blockquote func(lines []string) []string
 	// Footnote is called with a footnote definition's lines (the "[^label]:"
-	// line plus any continuation lines) and returns the transformed lines.
-	// When nil, footnote definitions are emitted verbatim.
+	// line plus any continuation lines), whose hard line breaks are written
+	// as HardBreaks says, and returns the transformed lines. When nil,
+	// footnote definitions are emitted verbatim.
 	Footnote func(lines []string) []string
+	// LinkDefinition is called with a link reference definition's lines (the
+	// "[label]:" line plus any lines its title continues onto) and returns
+	// the transformed lines. When nil, definitions are emitted verbatim.
+	LinkDefinition func(lines []string) []string
+	// ListItem is called with a list item's first paragraph (the marker line
+	// plus its continuation lines), with its hard line breaks as for
+	// Footnote, and returns the transformed lines. It is called the same way
+	// with each of the item's later paragraphs, indented under the marker
+	// without one; ListItemLead finds where the text of either starts.
+	// Nested items are passed one at a time, and the rest of an item's lines
+	// are emitted verbatim. When nil, list items are emitted verbatim.
+	ListItem func(lines []string) []string
+	// Frontmatter, when set, is called with the document's frontmatter lines
+	// before any other handler, so it can configure them for the document.
+	// The lines are emitted as they are.
+	Frontmatter func(lines []string)
+	// HardBreaks is how hard line breaks are written: BreakSpaces or
+	// BreakBackslash. BreakKeep or "" keeps each as it is written.
+	HardBreaks string
+}
+
+// Hard line break styles, as taken by the -breaks flag of the tools that
+// rewrap paragraphs.
+const (
+	// BreakKeep keeps each hard line break as it is written.
+	BreakKeep = "keep"
+	// BreakSpaces writes hard line breaks as two trailing spaces.
+	BreakSpaces = "spaces"
+	// BreakBackslash writes hard line breaks as a trailing backslash, which
+	// editors don't trim and readers can see.
+	BreakBackslash = "backslash"
+)
+
+// CheckHardBreaks returns an error if style isn't one of the above.
+func CheckHardBreaks(style string) error {
+	switch style {
+	case BreakKeep, BreakSpaces, BreakBackslash:
+		return nil
+	}
+	return fmt.Errorf("unknown -breaks %q (want keep, spaces, or backslash)", style)
 }
 
 // Transform applies a Markdown-aware transformation to content, routing each
 // block-level construct to the appropriate handler or emitting it unchanged.
-// Frontmatter, code blocks, headers, list items (with continuations), table
-// rows, and horizontal rules are passed through; paragraphs and blockquotes
-// are delegated to h.
+// Frontmatter, code blocks, display math, HTML blocks, headers, tables, horizontal rules, kramdown
+// IAL lines, Obsidian block ID lines and comment blocks, and verse sections
+// are passed through; paragraphs, blockquotes, and list items are delegated
+// to h. A hard line break ends a paragraph; the
+// handlers get it without the break, which is put back on their last line
+// as h.HardBreaks says.
 func Transform(content string, h Handlers) string {
-	lines := strings.Split(content, "\n")
 	var result []string
-	i := 0
+	lr := &lineReader{buf: strings.Split(content, "\n"), eof: true}
+	transform(lr, h, func(lines ...string) { result = append(result, lines...) })
+	output := strings.Join(result, "\n")
+	output = strings.TrimRight(output, "\n") + "\n"
+	return output
+}
 
+// TransformStream is Transform for input too large to hold in memory. It reads
+// r and writes each block to w as soon as it is transformed, so it only holds
+// one block (a paragraph, blockquote, list item, or footnote) at a time, plus
+// the frontmatter. The output is the same as Transform's.
+func TransformStream(r io.Reader, w io.Writer, h Handlers) error {
+	lr := &lineReader{r: bufio.NewReader(r)}
+	lw := &lineWriter{w: bufio.NewWriter(w)}
+	transform(lr, h, lw.write)
+	if lr.err != nil {
+		return lr.err
+	}
+	return lw.close()
+}
+
+// transform routes the blocks read from lr to h, and passes the output lines
+// to emit.
+func transform(lr *lineReader, h Handlers, emit func(lines ...string)) {
 	// Handle YAML frontmatter (two formats: ---/--- or property-line/---)
-	if i < len(lines) {
-		hasFrontmatter := false
-		if strings.TrimSpace(lines[i]) == "---" {
-			if i+1 < len(lines) && LooksLikeFrontmatterProperty(lines[i+1]) {
-				hasFrontmatter = true
-				result = append(result, lines[i])
-				i++
-			}
-		} else if LooksLikeFrontmatterProperty(lines[i]) {
-			for j := i + 1; j < len(lines); j++ {
-				if strings.TrimSpace(lines[j]) == "---" {
-					hasFrontmatter = true
-					break
-				}
-				if strings.TrimSpace(lines[j]) == "" {
-					break
-				}
+	var frontmatter []string
+	for n := frontmatterEnd(lr.peek); n > 0; n-- {
+		frontmatter = append(frontmatter, lr.next())
+	}
+	if h.Frontmatter != nil && len(frontmatter) > 0 {
+		h.Frontmatter(frontmatter)
+	}
+	emit(frontmatter...)
+
+	// listIndent is the content column of the list item the last block was
+	// in, or -1 outside a list, so that an item indented to it is nested
+	// rather than code, and a paragraph indented to it is the item's.
+	listIndent := -1
+	for lr.more() {
+		line := lr.line()
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		nested := listIndent >= 0 && IsListItem(line) && indent < listIndent+4
+		inItem := listIndent > 0 && !IsListItem(line) && listIndent <= indent && indent < listIndent+4
+		if strings.TrimSpace(line) != "" && !inItem {
+			listIndent = -1
+		}
+
+		// Fenced code block
+		if strings.HasPrefix(strings.TrimSpace(line), "```") || strings.HasPrefix(strings.TrimSpace(line), "~~~") {
+			fence := strings.TrimSpace(line)[:3]
+			emit(lr.next())
+			for lr.more() && !strings.HasPrefix(strings.TrimSpace(lr.line()), fence) {
+				emit(lr.next())
+			}
+			if lr.more() {
+				emit(lr.next())
+			}
+			continue
+		}
+
+		// Display math ($$ … $$ or \[ … \]) on lines of its own, passed
+		// through like code
+		if n := displayMathLines(lr); n > 0 {
+			for ; n > 0; n-- {
+				emit(lr.next())
 			}
+			continue
 		}
-		if hasFrontmatter {
-			for i < len(lines) && strings.TrimSpace(lines[i]) != "---" {
-				result = append(result, lines[i])
-				i++
+
+		// Verse section (<!-- verse --> … <!-- /verse -->), whose line
+		// breaks are the author's, passed through like code
+		if name := VerseStart(line); name != "" {
+			emit(lr.next())
+			for lr.more() && strings.TrimSpace(lr.line()) != MarkerClose(name) {
+				emit(lr.next())
 			}
-			if i < len(lines) {
-				result = append(result, lines[i])
-				i++
+			if lr.more() {
+				emit(lr.next())
 			}
+			continue
 		}
-	}
 
-	for i < len(lines) {
-		line := lines[i]
+		// Obsidian comment block (%% … %%), passed through like code
+		if IsCommentBlockStart(line) {
+			emit(lr.next())
+			for lr.more() && !strings.Contains(lr.line(), "%%") {
+				emit(lr.next())
+			}
+			if lr.more() {
+				emit(lr.next())
+			}
+			continue
+		}
 
-		// Fenced code block
-		if strings.HasPrefix(strings.TrimSpace(line), "```") || strings.HasPrefix(strings.TrimSpace(line), "~~~") {
-			fence := strings.TrimSpace(line)[:3]
-			result = append(result, line)
-			i++
-			for i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), fence) {
-				result = append(result, lines[i])
-				i++
+		// HTML block, passed through like code
+		if kind := htmlBlockStart(line); kind != 0 {
+			for lr.more() {
+				end, part := htmlBlockEnd(kind, lr.line())
+				if part {
+					emit(lr.next())
+				}
+				if end {
+					break
+				}
+			}
+			continue
+		}
+
+		// A later paragraph of a list item, indented under its marker, goes
+		// to h.ListItem as the item's first does
+		if inItem && !interruptsParagraph(line[indent:]) {
+			para := []string{lr.next()}
+			for lr.more() && isItemContinuation(lr.line()) {
+				para = append(para, lr.next())
 			}
-			if i < len(lines) {
-				result = append(result, lines[i])
-				i++
+			if h.ListItem == nil {
+				emit(para...)
+			} else {
+				restyleHardBreaks(para[:len(para)-1], h.HardBreaks)
+				emit(keepHardBreak(para, h.ListItem)...)
 			}
 			continue
 		}
 
 		// Indented code block (4 spaces or tab)
-		if strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t") {
-			result = append(result, line)
-			i++
+		if (strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t")) && !nested {
+			emit(lr.next())
 			continue
 		}
 
@@ -89,55 +208,83 @@ func Transform(content string, h Handlers) string {
 		// handler the block is emitted verbatim, so a multi-sentence footnote
 		// stays on one line and renders portably across Markdown engines.
 		if IsFootnoteDefinition(line) {
-			fnLines := []string{line}
-			i++
-			for i < len(lines) && IsFootnoteContinuation(lines[i]) {
-				fnLines = append(fnLines, lines[i])
-				i++
+			fnLines := []string{lr.next()}
+			for lr.more() && IsFootnoteContinuation(lr.line()) {
+				fnLines = append(fnLines, lr.next())
 			}
 			if h.Footnote != nil {
-				result = append(result, h.Footnote(fnLines)...)
+				restyleHardBreaks(fnLines[:len(fnLines)-1], h.HardBreaks)
+				emit(h.Footnote(fnLines)...)
 			} else {
-				result = append(result, fnLines...)
+				emit(fnLines...)
 			}
 			continue
 		}
 
-		// Link reference definition
+		// Link reference definition, with the lines of its title
 		if IsLinkRefDefinition(line) {
-			result = append(result, line)
-			i++
+			defLines := []string{lr.next()}
+			for lr.more() && continuesLinkDef(defLines, lr.line()) {
+				defLines = append(defLines, lr.next())
+			}
+			if h.LinkDefinition != nil {
+				emit(h.LinkDefinition(defLines)...)
+			} else {
+				emit(defLines...)
+			}
+			continue
+		}
+
+		// kramdown IAL or Obsidian block ID, kept on its own line next to
+		// its block
+		if IsIAL(line) || IsBlockID(line) {
+			emit(lr.next())
 			continue
 		}
 
 		// Blank line
 		if strings.TrimSpace(line) == "" {
-			result = append(result, line)
-			i++
+			emit(lr.next())
 			continue
 		}
 
 		// Header
 		if strings.HasPrefix(line, "#") {
-			result = append(result, line)
-			i++
+			emit(lr.next())
 			continue
 		}
 
-		// List item and continuation lines (indented 1-3 spaces)
+		// List item: its first paragraph, hard line breaks and all, goes to
+		// h.ListItem, and the lines after it that are indented 1-3 spaces are
+		// passed through, up to a nested item
 		if IsListItem(line) {
-			result = append(result, line)
-			i++
-			for i < len(lines) {
-				l := lines[i]
-				if strings.TrimSpace(l) == "" {
+			prefix := ListItemPrefix(line)
+			listIndent = len(prefix)
+			item := []string{lr.next()}
+			for lr.more() && isItemContinuation(lr.line()) {
+				item = append(item, lr.next())
+			}
+			switch last := len(item) - 1; {
+			case h.ListItem == nil || prefix == "" || interruptsParagraph(line[len(prefix):]):
+				emit(item...)
+			default:
+				restyleHardBreaks(item[:last], h.HardBreaks)
+				emit(keepHardBreak(item, h.ListItem)...)
+			}
+			for lr.more() {
+				l := lr.line()
+				if strings.TrimSpace(l) == "" || !strings.HasPrefix(l, " ") || strings.HasPrefix(l, "    ") || IsListItem(l) {
 					break
 				}
-				if !strings.HasPrefix(l, " ") || strings.HasPrefix(l, "    ") {
-					break
+				emit(lr.next())
+				if fence := strings.TrimSpace(l); strings.HasPrefix(fence, "```") || strings.HasPrefix(fence, "~~~") {
+					for lr.more() && !strings.HasPrefix(strings.TrimSpace(lr.line()), fence[:3]) {
+						emit(lr.next())
+					}
+					if lr.more() {
+						emit(lr.next())
+					}
 				}
-				result = append(result, l)
-				i++
 			}
 			continue
 		}
@@ -145,74 +292,222 @@ func Transform(content string, h Handlers) string {
 		// Blockquote
 		if strings.HasPrefix(strings.TrimSpace(line), ">") {
 			var bqLines []string
-			for i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">") {
-				bqLines = append(bqLines, lines[i])
-				i++
+			for lr.more() && strings.HasPrefix(strings.TrimSpace(lr.line()), ">") {
+				bqLines = append(bqLines, lr.next())
+			}
+			for i := range bqLines[:len(bqLines)-1] {
+				depth, content := quoteContent(bqLines[i])
+				nextDepth, next := quoteContent(bqLines[i+1])
+				if HasHardBreak(content) && nextDepth == depth && !interruptsParagraph(next) {
+					bqLines[i] = setHardBreak(bqLines[i], h.HardBreaks)
+				}
 			}
-			result = append(result, h.Blockquote(bqLines)...)
+			emit(h.Blockquote(bqLines)...)
 			continue
 		}
 
 		// Horizontal rule
 		if IsHorizontalRule(line) {
-			result = append(result, line)
-			i++
+			emit(lr.next())
+			continue
+		}
+
+		// Table whose rows don't start with a pipe, up to a blank line or
+		// another block
+		if next, ok := lr.peek(1); ok && IsTableStart(line, next) {
+			emit(lr.next(), lr.next())
+			for lr.more() && (IsTableRow(lr.line()) || !interruptsParagraph(lr.line())) {
+				emit(lr.next())
+			}
 			continue
 		}
 
 		// Table row
 		if IsTableRow(line) {
-			for i < len(lines) && IsTableRow(lines[i]) {
-				result = append(result, lines[i])
-				i++
+			for lr.more() && IsTableRow(lr.line()) {
+				emit(lr.next())
 			}
 			continue
 		}
 
-		// Regular paragraph — collect until a block boundary
+		// Regular paragraph — collect until a block boundary. An underline
+		// makes the lines above it a setext heading, passed through like an
+		// ATX one
 		var paraLines []string
-		for i < len(lines) {
-			l := lines[i]
-			if strings.TrimSpace(l) == "" {
+		heading := false
+		for lr.more() {
+			l := lr.line()
+			if heading = len(paraLines) > 0 && IsSetextUnderline(l); heading {
+				paraLines = append(paraLines, lr.next())
 				break
 			}
-			if strings.HasPrefix(strings.TrimSpace(l), "```") ||
-				strings.HasPrefix(strings.TrimSpace(l), "~~~") ||
-				strings.HasPrefix(l, "    ") ||
-				strings.HasPrefix(l, "\t") ||
-				IsFootnoteDefinition(l) ||
-				IsLinkRefDefinition(l) ||
-				strings.HasPrefix(l, "#") ||
-				IsListItem(l) ||
-				strings.HasPrefix(strings.TrimSpace(l), ">") ||
-				IsHorizontalRule(l) ||
-				IsTableRow(l) {
+			if next, ok := lr.peek(1); interruptsParagraph(l) || ok && IsTableStart(l, next) {
 				break
 			}
-			// Explicit line break (two trailing spaces) ends the paragraph
-			if strings.HasSuffix(l, "  ") {
-				paraLines = append(paraLines, l)
-				i++
+			// Explicit line break (two trailing spaces or a backslash) ends
+			// the paragraph, so verse and addresses keep their lines
+			if HasHardBreak(l) {
+				paraLines = append(paraLines, lr.next())
+				if lr.more() && IsSetextUnderline(lr.line()) {
+					continue
+				}
 				break
 			}
-			paraLines = append(paraLines, l)
-			i++
+			paraLines = append(paraLines, lr.next())
 		}
-		if len(paraLines) > 0 {
-			result = append(result, h.Paragraph(paraLines)...)
+		if heading {
+			emit(paraLines...)
+		} else if len(paraLines) > 0 {
+			// A break the paragraph goes on after is restyled; one at its
+			// end isn't a break, so is left as written.
+			if last := len(paraLines) - 1; lr.more() && !interruptsParagraph(lr.line()) {
+				paraLines[last] = setHardBreak(paraLines[last], h.HardBreaks)
+			}
+			emit(keepHardBreak(paraLines, h.Paragraph)...)
 		}
 	}
+}
 
-	output := strings.Join(result, "\n")
-	output = strings.TrimRight(output, "\n") + "\n"
-	return output
+// displayMathLines returns the number of lines in the display math block
+// that starts at lr's next line: from a line starting with $$ or \[ to the
+// line ending in its closing delimiter, before any blank line. It returns 0
+// if no block starts there, as when the math closes mid-line and text
+// follows it.
+func displayMathLines(lr *lineReader) int {
+	trimmed := strings.TrimSpace(lr.line())
+	closer := ""
+	switch {
+	case strings.HasPrefix(trimmed, "$$"):
+		closer = "$$"
+	case strings.HasPrefix(trimmed, `\[`):
+		closer = `\]`
+	default:
+		return 0
+	}
+	rest := trimmed[2:]
+	for n := 1; ; n++ {
+		switch {
+		case strings.HasSuffix(rest, closer):
+			return n
+		case strings.Contains(rest, closer):
+			return 0
+		}
+		line, ok := lr.peek(n)
+		if !ok || strings.TrimSpace(line) == "" {
+			return 0
+		}
+		rest = strings.TrimSpace(line)
+	}
+}
+
+// interruptsParagraph reports whether line is blank or starts a block that
+// ends the paragraph before it.
+func interruptsParagraph(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return trimmed == "" ||
+		strings.HasPrefix(trimmed, "```") ||
+		strings.HasPrefix(trimmed, "~~~") ||
+		strings.HasPrefix(line, "    ") ||
+		strings.HasPrefix(line, "\t") ||
+		IsFootnoteDefinition(line) ||
+		IsLinkRefDefinition(line) ||
+		IsIAL(line) ||
+		IsBlockID(line) ||
+		IsCommentBlockStart(line) ||
+		VerseStart(line) != "" ||
+		interruptsWithHTML(line) ||
+		strings.HasPrefix(line, "#") ||
+		IsListItem(line) ||
+		strings.HasPrefix(trimmed, ">") ||
+		IsHorizontalRule(line) ||
+		IsTableRow(line)
+}
+
+// continuesLinkDef reports whether line is part of the title of the link
+// reference definition in lines: the title's first line, indented on a line
+// of its own, or a line of one not yet closed.
+func continuesLinkDef(lines []string, line string) bool {
+	trimmed := strings.TrimSpace(line)
+	if interruptsParagraph(strings.TrimLeft(line, " ")) {
+		return false
+	}
+	_, title, closed := CutLinkTitle(strings.Join(lines, "\n"))
+	if title == "" {
+		return strings.HasPrefix(line, " ") && strings.ContainsAny(trimmed[:1], `"'(`)
+	}
+	// A title that has closed with more after it isn't one, so neither are
+	// the lines after it.
+	closer := strings.NewReplacer("(", ")").Replace(title[:1])
+	return !closed && !strings.Contains(title[1:], closer)
+}
+
+// isItemContinuation reports whether line continues the paragraph of the
+// list item before it: it is indented and starts no block of its own.
+func isItemContinuation(line string) bool {
+	return strings.HasPrefix(line, " ") && !interruptsParagraph(strings.TrimLeft(line, " "))
+}
+
+// setHardBreak rewrites the hard line break line ends in as style says.
+func setHardBreak(line, style string) string {
+	text, brk := CutHardBreak(line)
+	switch {
+	case brk == "":
+		return line
+	case style == BreakSpaces:
+		return text + "  "
+	case style == BreakBackslash:
+		return text + `\`
+	}
+	return line
+}
+
+// restyleHardBreaks rewrites the hard line breaks lines end in as style
+// says, for handlers that are passed a block's breaks along with its lines.
+func restyleHardBreaks(lines []string, style string) {
+	for i := range lines {
+		lines[i] = setHardBreak(lines[i], style)
+	}
+}
+
+// keepHardBreak passes lines to f without the hard line break the last of
+// them may end in, and ends f's last line with it. A line that is nothing
+// but a break is passed as it is.
+func keepHardBreak(lines []string, f func([]string) []string) []string {
+	last := len(lines) - 1
+	text, brk := CutHardBreak(lines[last])
+	if brk == "" || strings.TrimSpace(text) == "" {
+		return f(lines)
+	}
+	out := f(append(lines[:last:last], text))
+	if len(out) > 0 {
+		out[len(out)-1] += brk
+	}
+	return out
+}
+
+// quoteContent returns how deeply line is quoted, and its content inside the
+// quote markers.
+func quoteContent(line string) (depth int, content string) {
+	content = line
+	for {
+		trimmed := strings.TrimLeftFunc(content, unicode.IsSpace)
+		if !strings.HasPrefix(trimmed, ">") {
+			return depth, content
+		}
+		content = strings.TrimPrefix(trimmed[1:], " ")
+		depth++
+	}
 }
 
 // TransformBlockquote applies a blockquote-aware transformation to consecutive
 // blockquote lines. The flush function receives accumulated content lines with
 // the "> " prefix stripped, and must return the transformed output lines with
-// the prefix added back. GFM alert headers and table rows are emitted as-is
-// without passing through flush.
+// the prefix added back. Callout headers, table rows, kramdown IAL lines,
+// block ID lines, and attribution lines are emitted as-is without passing
+// through flush, blank lines and hard line breaks separate the paragraphs that
+// are flushed, and nested blockquotes are transformed the same way with their
+// extra prefix kept as written, "> >" or ">>". A paragraph's hard break is cut
+// off before flush and put back after it.
 func TransformBlockquote(lines []string, flush func([]string) []string) []string {
 	if len(lines) == 0 {
 		return nil
@@ -223,32 +518,156 @@ func TransformBlockquote(lines []string, flush func([]string) []string) []string
 
 	flushPending := func() {
 		if len(contentLines) > 0 {
-			result = append(result, flush(contentLines)...)
+			result = append(result, keepHardBreak(contentLines, flush)...)
 			contentLines = nil
 		}
 	}
 
-	for _, line := range lines {
-		content := strings.TrimPrefix(line, ">")
+	for i := 0; i < len(lines); i++ {
+		content := strings.TrimPrefix(strings.TrimLeftFunc(lines[i], unicode.IsSpace), ">")
 		content = strings.TrimPrefix(content, " ")
 
-		// GFM alert header (e.g. [!NOTE]) — flush pending, emit as-is
-		if strings.HasPrefix(content, "[!") && strings.Contains(content, "]") {
+		// Blank line — ends a paragraph of the quote
+		if strings.TrimSpace(content) == "" {
 			flushPending()
-			result = append(result, prefix+content)
+			result = append(result, ">")
+			continue
+		}
+
+		// Nested blockquote — transform its lines one level down, keeping
+		// the prefix as its first line writes it: "> >" or ">>"
+		if strings.HasPrefix(content, ">") {
+			flushPending()
+			nestedPrefix := prefix
+			if strings.HasPrefix(strings.TrimLeftFunc(lines[i], unicode.IsSpace), ">>") {
+				nestedPrefix = ">"
+			}
+			var nested []string
+			for ; i < len(lines); i++ {
+				c := strings.TrimPrefix(strings.TrimPrefix(strings.TrimLeftFunc(lines[i], unicode.IsSpace), ">"), " ")
+				if !strings.HasPrefix(c, ">") {
+					break
+				}
+				nested = append(nested, c)
+			}
+			i--
+			for _, line := range TransformBlockquote(nested, flush) {
+				result = append(result, nestedPrefix+line)
+			}
 			continue
 		}
 
-		// Table row — flush pending, emit as-is
-		if IsTableRow(content) {
+		// Callout header (e.g. [!NOTE]), table row, IAL, block ID, or
+		// attribution (— Author) — flush pending, emit as-is
+		if IsCalloutHeader(content) || IsTableRow(content) || IsIAL(content) || IsBlockID(content) || IsAttribution(content) {
 			flushPending()
 			result = append(result, prefix+content)
 			continue
 		}
 
+		// Setext underline — the paragraph above it is a heading, kept as
+		// written
+		if len(contentLines) > 0 && IsSetextUnderline(content) {
+			for _, l := range append(contentLines, content) {
+				result = append(result, prefix+l)
+			}
+			contentLines = nil
+			continue
+		}
+
 		contentLines = append(contentLines, content)
+
+		// Hard line break — ends the paragraph, keeping the break
+		if HasHardBreak(content) {
+			flushPending()
+		}
 	}
 
 	flushPending()
 	return result
 }
+
+// lineReader reads the lines of a document, as strings.Split(content, "\n")
+// would split it, with lookahead. It holds only the lines that have been
+// peeked at but not consumed, reading more from r as needed; a reader over an
+// in-memory document has every line in buf and eof set.
+type lineReader struct {
+	buf []string
+	r   *bufio.Reader
+	eof bool
+	err error
+}
+
+// peek returns the i'th unconsumed line and whether there is one.
+func (lr *lineReader) peek(i int) (string, bool) {
+	for len(lr.buf) <= i && !lr.eof {
+		line, err := lr.r.ReadString('\n')
+		if err != nil {
+			lr.eof = true
+			if err != io.EOF {
+				lr.err = err
+				break
+			}
+		}
+		lr.buf = append(lr.buf, strings.TrimSuffix(line, "\n"))
+	}
+	if i < len(lr.buf) {
+		return lr.buf[i], true
+	}
+	return "", false
+}
+
+// more reports whether any lines are left.
+func (lr *lineReader) more() bool {
+	_, ok := lr.peek(0)
+	return ok
+}
+
+// line returns the next line without consuming it. It must only be called
+// when more reports true.
+func (lr *lineReader) line() string {
+	line, _ := lr.peek(0)
+	return line
+}
+
+// next consumes and returns the next line. It must only be called when more
+// reports true.
+func (lr *lineReader) next() string {
+	line := lr.line()
+	lr.buf = lr.buf[1:]
+	return line
+}
+
+// lineWriter writes lines to w joined by newlines, the way Transform joins its
+// output. Blank lines are held back until a non-blank line follows, so the
+// output ends with exactly one newline.
+type lineWriter struct {
+	w       *bufio.Writer
+	written int // lines written, including held-back blank lines
+	blank   int // blank lines held back
+}
+
+func (lw *lineWriter) write(lines ...string) {
+	for _, line := range lines {
+		if line == "" {
+			lw.blank++
+			continue
+		}
+		n := lw.blank
+		if lw.written > 0 {
+			n++
+		}
+		for ; n > 0; n-- {
+			lw.w.WriteByte('\n')
+		}
+		lw.w.WriteString(line)
+		lw.written += lw.blank + 1
+		lw.blank = 0
+	}
+}
+
+// close ends the output with a newline and flushes it.
+func (lw *lineWriter) close() error {
+	lw.w.WriteByte('\n')
+	return lw.w.Flush()
+}
@@ -0,0 +1,170 @@
+// Package uax29 finds sentence boundaries by the rules of Unicode Standard
+// Annex #29, Unicode Text Segmentation, rather than by ASCII punctuation, so
+// text in any script splits where its own full stops and question and
+// exclamation marks end its sentences: 。！？ as well as . ! ?.
+//
+// Character classes are derived from the unicode package's tables, which
+// approximate the Sentence_Break property closely enough for prose.
+package uax29
+
+import (
+	"strings"
+	"unicode"
+)
+
+// class is a rune's Sentence_Break property value.
+type class int
+
+const (
+	other class = iota
+	cr
+	lf
+	sep
+	sp
+	lower
+	upper
+	oletter
+	numeric
+	aterm
+	sterm
+	closer
+	scontinue
+	extend
+	format
+)
+
+// sTerms are the STerm runes: those that end a sentence wherever they occur.
+const sTerms = "!?։؝؞؟۔܀܁܂߹࠷࠹࠽࠾" +
+	"।॥၊။።፧፨᙮᜵᜶᠃᠉᥄᥅" +
+	"‼‽⁇⁈⁉⸮⸼。꓿꘎꘏꛳꛷" +
+	"﹖﹗！？｡"
+
+// sContinues are the SContinue runes, which continue a sentence after its
+// terminal punctuation, as the comma in "e.g., this" does.
+const sContinues = ",-:;՝،؍߸᠂᠈–—、" +
+	"︐︑︓︱︲﹐﹑﹕﹘﹣，－：；､"
+
+func classify(r rune) class {
+	switch {
+	case r == '\r':
+		return cr
+	case r == '\n':
+		return lf
+	case r == 0x85 || r == 0x2028 || r == 0x2029:
+		return sep
+	case r == 0x200C || r == 0x200D || unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc):
+		return extend
+	case r != 0x200B && unicode.Is(unicode.Cf, r):
+		return format
+	case unicode.IsSpace(r):
+		return sp
+	case unicode.IsLower(r):
+		return lower
+	case unicode.IsUpper(r) || unicode.IsTitle(r):
+		return upper
+	case unicode.IsLetter(r) || unicode.Is(unicode.Nl, r):
+		return oletter
+	case unicode.Is(unicode.Nd, r):
+		return numeric
+	case r == '.' || r == 0x2024 || r == 0xFE52 || r == 0xFF0E:
+		return aterm
+	case strings.ContainsRune(sTerms, r):
+		return sterm
+	case strings.ContainsRune(sContinues, r):
+		return scontinue
+	case r == '"' || r == '\'' || unicode.In(r, unicode.Ps, unicode.Pe, unicode.Pi, unicode.Pf):
+		return closer
+	}
+	return other
+}
+
+// SentenceBreaks returns the indexes in runes at which a sentence begins,
+// other than the first. A sentence keeps the closing punctuation and the
+// spaces that follow its end.
+func SentenceBreaks(runes []rune) []int {
+	// SB5: extending and format characters take the class of the rune they
+	// follow, so the rules below see only the others, at their indexes.
+	var cls []class
+	var at []int
+	for i, r := range runes {
+		c := classify(r)
+		if (c == extend || c == format) && len(cls) > 0 && !isParaSep(cls[len(cls)-1]) {
+			continue
+		}
+		cls = append(cls, c)
+		at = append(at, i)
+	}
+	var breaks []int
+	for k := 1; k < len(cls); k++ {
+		if breaksBefore(cls, k) {
+			breaks = append(breaks, at[k])
+		}
+	}
+	return breaks
+}
+
+// Sentences splits text into its sentences.
+func Sentences(text string) []string {
+	runes := []rune(text)
+	var sentences []string
+	start := 0
+	for _, i := range SentenceBreaks(runes) {
+		sentences = append(sentences, string(runes[start:i]))
+		start = i
+	}
+	if start < len(runes) {
+		sentences = append(sentences, string(runes[start:]))
+	}
+	return sentences
+}
+
+// breaksBefore reports whether a sentence boundary falls before cls[k], by
+// rules SB3 to SB998.
+func breaksBefore(cls []class, k int) bool {
+	prev, cur := cls[k-1], cls[k]
+	switch {
+	case prev == cr && cur == lf: // SB3
+		return false
+	case isParaSep(prev): // SB4
+		return true
+	case prev == aterm && cur == numeric: // SB6
+		return false
+	case k > 1 && (cls[k-2] == upper || cls[k-2] == lower) && prev == aterm && cur == upper: // SB7
+		return false
+	}
+
+	// The rest apply after terminal punctuation, closing punctuation, and
+	// spaces: SATerm Close* Sp*.
+	p, spaces := k-1, 0
+	for p >= 0 && cls[p] == sp {
+		p--
+		spaces++
+	}
+	for p >= 0 && cls[p] == closer {
+		p--
+	}
+	if p < 0 || cls[p] != aterm && cls[p] != sterm {
+		return false // SB998
+	}
+	if cls[p] == aterm { // SB8: a full stop followed by lowercase isn't an end.
+		m := k
+		for m < len(cls) && !isLetter(cls[m]) && !isParaSep(cls[m]) && cls[m] != aterm && cls[m] != sterm {
+			m++
+		}
+		if m < len(cls) && cls[m] == lower {
+			return false
+		}
+	}
+	switch {
+	case cur == scontinue || cur == aterm || cur == sterm: // SB8a
+		return false
+	case spaces == 0 && cur == closer: // SB9
+		return false
+	case cur == sp || isParaSep(cur): // SB9, SB10
+		return false
+	}
+	return true // SB11
+}
+
+func isParaSep(c class) bool { return c == sep || c == cr || c == lf }
+func isLetter(c class) bool  { return c == oletter || c == upper || c == lower }
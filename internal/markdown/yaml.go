@@ -0,0 +1,611 @@
+package markdown
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// YAMLError is a frontmatter syntax error, at a 1-based line of the
+// document.
+type YAMLError struct {
+	Line int
+	Msg  string
+}
+
+func (e *YAMLError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// ParseFrontmatter parses the frontmatter of a document's lines. It reads
+// the YAML that frontmatter is written in: block mappings and sequences,
+// flow [lists] and {maps}, plain, quoted, and block (| and >) scalars, and
+// comments, but not anchors, aliases, or tags. Values are the ones
+// encoding/json decodes JSON to: map[string]any, []any, string, float64,
+// bool, and nil. Scalars are typed by YAML 1.2's core schema, so a date is
+// a string. lineOf maps the path of each value, as FieldPath and IndexPath
+// write it, to its 1-based line; the frontmatter as a whole is "". A
+// document without frontmatter has no fields.
+func ParseFrontmatter(lines []string) (fields map[string]any, lineOf map[string]int, err error) {
+	fields, lineOf = make(map[string]any), map[string]int{"": 1}
+	end := FrontmatterEnd(lines)
+	if end == 0 {
+		return fields, lineOf, nil
+	}
+	start, stop := 0, end
+	if strings.TrimSpace(lines[0]) == "---" {
+		start = 1
+	}
+	if stop > start && strings.TrimSpace(lines[stop-1]) == "---" {
+		stop--
+	}
+	p := &yamlParser{lines: append([]string(nil), lines[start:stop]...), first: start + 1, lineOf: lineOf}
+	p.skipBlank()
+	if p.i == len(p.lines) {
+		return fields, lineOf, nil
+	}
+	n, err := p.indent()
+	if err != nil {
+		return nil, nil, err
+	}
+	v, err := p.block(n, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	if p.skipBlank(); p.i < len(p.lines) {
+		return nil, nil, p.errorf("unexpected indentation")
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, nil, &YAMLError{Line: start + 1, Msg: "frontmatter must be a mapping of fields"}
+	}
+	return m, lineOf, nil
+}
+
+// plainKeyRe matches the keys FieldPath writes without quotes.
+var plainKeyRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// FieldPath returns the path of the field key of the mapping at path:
+// author.name, or author["first name"] for a key that isn't a plain word.
+func FieldPath(path, key string) string {
+	if !plainKeyRe.MatchString(key) {
+		return path + "[" + strconv.Quote(key) + "]"
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// IndexPath returns the path of item i of the sequence at path: tags[1].
+func IndexPath(path string, i int) string {
+	return path + "[" + strconv.Itoa(i) + "]"
+}
+
+// yamlParser parses the lines of frontmatter, block by block.
+type yamlParser struct {
+	lines  []string
+	first  int // the document line of lines[0]
+	i      int // the next line
+	lineOf map[string]int
+}
+
+func (p *yamlParser) errorf(format string, args ...any) error {
+	return &YAMLError{Line: p.first + p.i, Msg: fmt.Sprintf(format, args...)}
+}
+
+// skipBlank skips blank and comment lines.
+func (p *yamlParser) skipBlank() {
+	for p.i < len(p.lines) {
+		trimmed := strings.TrimSpace(p.lines[p.i])
+		if trimmed != "" && trimmed[0] != '#' {
+			return
+		}
+		p.i++
+	}
+}
+
+// indent returns the indentation of the next line.
+func (p *yamlParser) indent() (int, error) {
+	line := p.lines[p.i]
+	n := len(line) - len(strings.TrimLeft(line, " "))
+	if n < len(line) && line[n] == '\t' {
+		return 0, p.errorf("tabs can't indent YAML")
+	}
+	return n, nil
+}
+
+// block parses the node that starts on the next line, at indent n.
+func (p *yamlParser) block(n int, path string) (any, error) {
+	content := p.lines[p.i][n:]
+	switch {
+	case isSeqItem(content):
+		return p.sequence(n, path)
+	case isMappingLine(content):
+		return p.mapping(n, path)
+	}
+	p.i++
+	return p.value(content, n-1, path, false)
+}
+
+// isSeqItem reports whether content, a line without its indent, is a
+// sequence item.
+func isSeqItem(content string) bool {
+	return content == "-" || strings.HasPrefix(content, "- ")
+}
+
+// isMappingLine reports whether content, a line without its indent, starts
+// a "key: value" pair.
+func isMappingLine(content string) bool {
+	if content == "" || strings.ContainsRune("[{#", rune(content[0])) {
+		return false
+	}
+	_, _, err := splitKey(content)
+	return err == nil
+}
+
+// mapping parses the block mapping whose keys are at indent n.
+func (p *yamlParser) mapping(n int, path string) (any, error) {
+	m := make(map[string]any)
+	for {
+		p.skipBlank()
+		if p.i == len(p.lines) {
+			return m, nil
+		}
+		ind, err := p.indent()
+		if err != nil {
+			return nil, err
+		}
+		if ind < n {
+			return m, nil
+		}
+		if ind > n {
+			return nil, p.errorf("unexpected indentation")
+		}
+		content := p.lines[p.i][n:]
+		if isSeqItem(content) {
+			return nil, p.errorf("expected a key, found a list item")
+		}
+		key, rest, err := splitKey(content)
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		if _, dup := m[key]; dup {
+			return nil, p.errorf("duplicate key %q", key)
+		}
+		child := FieldPath(path, key)
+		p.lineOf[child] = p.first + p.i
+		p.i++
+		if m[key], err = p.value(rest, n, child, true); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// sequence parses the block sequence whose "-" markers are at indent n.
+func (p *yamlParser) sequence(n int, path string) (any, error) {
+	list := []any{}
+	for {
+		p.skipBlank()
+		if p.i == len(p.lines) {
+			return list, nil
+		}
+		ind, err := p.indent()
+		if err != nil {
+			return nil, err
+		}
+		if ind > n {
+			return nil, p.errorf("unexpected indentation")
+		}
+		line := p.lines[p.i]
+		if ind < n || !isSeqItem(line[n:]) {
+			return list, nil
+		}
+		child := IndexPath(path, len(list))
+		p.lineOf[child] = p.first + p.i
+		item := strings.TrimLeft(line[n+1:], " ")
+		var v any
+		if isSeqItem(item) || isMappingLine(item) {
+			// A list or mapping that starts on the item's line is indented
+			// to where it starts.
+			col := len(line) - len(item)
+			p.lines[p.i] = strings.Repeat(" ", col) + item
+			v, err = p.block(col, child)
+		} else {
+			p.i++
+			v, err = p.value(item, n, child, false)
+		}
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+}
+
+// splitKey splits a "key: value" line into its key, unquoted, and value.
+func splitKey(content string) (key, rest string, err error) {
+	if content[0] == '"' || content[0] == '\'' {
+		f := &flowScanner{s: content}
+		v, err := f.quoted()
+		if err != nil {
+			return "", "", err
+		}
+		after := strings.TrimLeft(content[f.pos:], " ")
+		if !strings.HasPrefix(after, ":") || len(after) > 1 && after[1] != ' ' {
+			return "", "", fmt.Errorf("expected : after key")
+		}
+		return v, strings.TrimSpace(after[1:]), nil
+	}
+	if content[0] == '?' {
+		return "", "", fmt.Errorf("complex keys aren't supported")
+	}
+	for i := 0; i < len(content); i++ {
+		switch {
+		case content[i] == '#' && i > 0 && content[i-1] == ' ':
+			return "", "", fmt.Errorf("expected key: value")
+		case content[i] == ':' && (i+1 == len(content) || content[i+1] == ' '):
+			return strings.TrimSpace(content[:i]), strings.TrimSpace(content[i+1:]), nil
+		}
+	}
+	return "", "", fmt.Errorf("expected key: value")
+}
+
+// value parses the value rest that follows a key or "-" at indent n, with
+// the lines it continues on, and the block below it when rest is empty. In a
+// mapping, a sequence below may be at the key's own indent.
+func (p *yamlParser) value(rest string, n int, path string, inMapping bool) (any, error) {
+	line := p.first + p.i - 1
+	switch {
+	case rest == "" || rest[0] == '#':
+		p.skipBlank()
+		if p.i == len(p.lines) {
+			return nil, nil
+		}
+		ind, err := p.indent()
+		if err != nil {
+			return nil, err
+		}
+		if ind > n {
+			return p.block(ind, path)
+		}
+		if inMapping && ind == n && isSeqItem(p.lines[p.i][n:]) {
+			return p.sequence(n, path)
+		}
+		return nil, nil
+	case rest[0] == '|' || rest[0] == '>':
+		return p.blockScalar(rest, n)
+	}
+
+	// Gather the lines the value continues on: those of an unclosed quote
+	// or flow collection, or of a plain scalar, folded into one.
+	text := rest
+	for p.i < len(p.lines) && strings.TrimSpace(p.lines[p.i]) != "" {
+		next := p.lines[p.i]
+		content := strings.TrimLeft(next, " ")
+		if len(next)-len(content) <= n || isSeqItem(content) || isMappingLine(content) {
+			break
+		}
+		f := &flowScanner{s: text}
+		if _, err := f.value(false); err == nil && (strings.ContainsRune("\"'[{", rune(text[0])) || strings.Contains(text, " #")) {
+			break
+		}
+		text += " " + strings.TrimSpace(next)
+		p.i++
+	}
+
+	f := &flowScanner{s: text}
+	v, err := f.value(false)
+	if err == nil {
+		f.skipSpace()
+		if f.pos < len(f.s) && f.s[f.pos] != '#' {
+			err = fmt.Errorf("unexpected %q", f.s[f.pos:])
+		}
+	}
+	if err != nil {
+		return nil, &YAMLError{Line: line, Msg: err.Error()}
+	}
+	p.setLines(path, v, line)
+	return v, nil
+}
+
+// setLines records line for the values nested in v, a flow collection at
+// path.
+func (p *yamlParser) setLines(path string, v any, line int) {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, item := range v {
+			child := FieldPath(path, k)
+			p.lineOf[child] = line
+			p.setLines(child, item, line)
+		}
+	case []any:
+		for i, item := range v {
+			child := IndexPath(path, i)
+			p.lineOf[child] = line
+			p.setLines(child, item, line)
+		}
+	}
+}
+
+// blockScalar parses a literal (|) or folded (>) scalar with the given
+// header, whose lines are indented more than n.
+func (p *yamlParser) blockScalar(header string, n int) (any, error) {
+	folded := header[0] == '>'
+	chomp, explicit := byte(0), 0
+	for _, c := range []byte(strings.TrimSpace(strings.SplitN(header[1:], " #", 2)[0])) {
+		switch {
+		case (c == '-' || c == '+') && chomp == 0:
+			chomp = c
+		case c >= '1' && c <= '9' && explicit == 0:
+			explicit = int(c - '0')
+		default:
+			return nil, &YAMLError{Line: p.first + p.i - 1, Msg: fmt.Sprintf("bad block scalar header %q", header)}
+		}
+	}
+
+	indent := n + explicit
+	if explicit == 0 {
+		indent = -1
+	}
+	var body []string
+	for ; p.i < len(p.lines); p.i++ {
+		line := p.lines[p.i]
+		if strings.TrimSpace(line) == "" {
+			body = append(body, "")
+			continue
+		}
+		ind := len(line) - len(strings.TrimLeft(line, " "))
+		if indent < 0 {
+			indent = ind
+		}
+		if ind < indent || ind <= n {
+			break
+		}
+		body = append(body, line[indent:])
+	}
+	// Trailing blank lines belong to the scalar only with "+".
+	trailing := 0
+	for len(body) > 0 && body[len(body)-1] == "" {
+		body = body[:len(body)-1]
+		trailing++
+	}
+	if len(body) == 0 {
+		return "", nil
+	}
+
+	var b strings.Builder
+	for i, line := range body {
+		switch {
+		case i == 0:
+		case !folded:
+			b.WriteString("\n")
+		case line == "":
+			b.WriteString("\n")
+		case body[i-1] == "":
+		case strings.HasPrefix(line, " ") || strings.HasPrefix(body[i-1], " "):
+			b.WriteString("\n")
+		default:
+			b.WriteString(" ")
+		}
+		b.WriteString(line)
+	}
+	switch chomp {
+	case 0:
+		b.WriteString("\n")
+	case '+':
+		b.WriteString(strings.Repeat("\n", trailing+1))
+	}
+	return b.String(), nil
+}
+
+// flowScanner scans a value written on one line: a scalar or a flow
+// collection.
+type flowScanner struct {
+	s   string
+	pos int
+}
+
+func (f *flowScanner) skipSpace() {
+	for f.pos < len(f.s) && f.s[f.pos] == ' ' {
+		f.pos++
+	}
+}
+
+// value scans a value. In a flow collection, a plain scalar ends at the
+// collection's punctuation.
+func (f *flowScanner) value(inFlow bool) (any, error) {
+	f.skipSpace()
+	if f.pos == len(f.s) {
+		return nil, nil
+	}
+	switch f.s[f.pos] {
+	case '[':
+		f.pos++
+		list := []any{}
+		for {
+			f.skipSpace()
+			if f.pos < len(f.s) && f.s[f.pos] == ']' {
+				f.pos++
+				return list, nil
+			}
+			v, err := f.value(true)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+			if err := f.separator(']'); err != nil {
+				return nil, err
+			}
+		}
+	case '{':
+		f.pos++
+		m := make(map[string]any)
+		for {
+			f.skipSpace()
+			if f.pos < len(f.s) && f.s[f.pos] == '}' {
+				f.pos++
+				return m, nil
+			}
+			k, err := f.value(true)
+			if err != nil {
+				return nil, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				key = fmt.Sprint(k)
+			}
+			f.skipSpace()
+			var v any
+			if f.pos < len(f.s) && f.s[f.pos] == ':' {
+				f.pos++
+				if v, err = f.value(true); err != nil {
+					return nil, err
+				}
+			}
+			if _, dup := m[key]; dup {
+				return nil, fmt.Errorf("duplicate key %q", key)
+			}
+			m[key] = v
+			if err := f.separator('}'); err != nil {
+				return nil, err
+			}
+		}
+	case '"', '\'':
+		return f.quoted()
+	case '&', '*', '!':
+		return nil, fmt.Errorf("anchors, aliases, and tags aren't supported")
+	case '|', '>':
+		if inFlow {
+			return nil, fmt.Errorf("unexpected %q", f.s[f.pos])
+		}
+	}
+	return resolvePlain(f.plain(inFlow)), nil
+}
+
+// separator scans the comma after an item of a flow collection, or its
+// closing bracket, which it leaves to be scanned.
+func (f *flowScanner) separator(closer byte) error {
+	f.skipSpace()
+	switch {
+	case f.pos == len(f.s):
+		return fmt.Errorf("expected %c", closer)
+	case f.s[f.pos] == ',':
+		f.pos++
+		return nil
+	case f.s[f.pos] == closer:
+		return nil
+	}
+	return fmt.Errorf("expected , or %c, found %q", closer, f.s[f.pos:])
+}
+
+// plain scans a plain scalar, up to a comment, or in a flow collection, its
+// punctuation.
+func (f *flowScanner) plain(inFlow bool) string {
+	start := f.pos
+	for ; f.pos < len(f.s); f.pos++ {
+		c := f.s[f.pos]
+		if c == '#' && f.pos > start && f.s[f.pos-1] == ' ' {
+			break
+		}
+		if inFlow && (strings.IndexByte(",[]{}", c) >= 0 || c == ':' && (f.pos+1 == len(f.s) || strings.IndexByte(" ,]}", f.s[f.pos+1]) >= 0)) {
+			break
+		}
+	}
+	return strings.TrimRight(f.s[start:f.pos], " ")
+}
+
+// quoted scans a single- or double-quoted scalar.
+func (f *flowScanner) quoted() (string, error) {
+	q := f.s[f.pos]
+	f.pos++
+	var b strings.Builder
+	for f.pos < len(f.s) {
+		c := f.s[f.pos]
+		switch {
+		case c == q && q == '\'' && f.pos+1 < len(f.s) && f.s[f.pos+1] == '\'':
+			b.WriteByte('\'')
+			f.pos += 2
+		case c == q:
+			f.pos++
+			return b.String(), nil
+		case c == '\\' && q == '"':
+			r, n, err := unescape(f.s[f.pos:])
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(r)
+			f.pos += n
+		default:
+			b.WriteByte(c)
+			f.pos++
+		}
+	}
+	return "", fmt.Errorf("unterminated %c string", q)
+}
+
+// yamlEscapes are the one-character escapes of double-quoted scalars.
+var yamlEscapes = map[byte]string{
+	'0': "\x00", 'a': "\a", 'b': "\b", 't': "\t", '\t': "\t", 'n': "\n",
+	'v': "\v", 'f': "\f", 'r': "\r", 'e': "\x1b", ' ': " ", '"': `"`,
+	'/': "/", '\\': `\`, 'N': "\u0085", '_': " ", 'L': " ", 'P': " ",
+}
+
+// unescape decodes the escape sequence that s starts with and returns it
+// and its length.
+func unescape(s string) (string, int, error) {
+	if len(s) < 2 {
+		return "", 0, fmt.Errorf("unterminated \" string")
+	}
+	if r, ok := yamlEscapes[s[1]]; ok {
+		return r, 2, nil
+	}
+	digits := map[byte]int{'x': 2, 'u': 4, 'U': 8}[s[1]]
+	if digits == 0 || len(s) < 2+digits {
+		return "", 0, fmt.Errorf("bad escape %q", s[:2])
+	}
+	n, err := strconv.ParseUint(s[2:2+digits], 16, 32)
+	if err != nil || !utf8.ValidRune(rune(n)) {
+		return "", 0, fmt.Errorf("bad escape %q", s[:2+digits])
+	}
+	return string(rune(n)), 2 + digits, nil
+}
+
+// floatRe matches the decimal numbers of YAML's core schema.
+var floatRe = regexp.MustCompile(`^[-+]?(\.[0-9]+|[0-9]+(\.[0-9]*)?)([eE][-+]?[0-9]+)?$`)
+
+// resolvePlain types a plain scalar by YAML 1.2's core schema.
+func resolvePlain(s string) any {
+	switch s {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	case ".inf", ".Inf", ".INF", "+.inf", "+.Inf", "+.INF":
+		return math.Inf(1)
+	case "-.inf", "-.Inf", "-.INF":
+		return math.Inf(-1)
+	case ".nan", ".NaN", ".NAN":
+		return math.NaN()
+	}
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0o") {
+		base := 16
+		if s[1] == 'o' {
+			base = 8
+		}
+		if n, err := strconv.ParseUint(s[2:], base, 64); err == nil {
+			return float64(n)
+		}
+		return s
+	}
+	if floatRe.MatchString(s) {
+		if n, err := strconv.ParseFloat(s, 64); err == nil {
+			return n
+		}
+	}
+	return s
+}
@@ -0,0 +1,78 @@
+// Package plugin runs external transforms over a JSON contract, so a project
+// can add steps to its mdtools pipeline without changing md-tools.
+//
+// A plugin is an executable that reads one request from stdin and writes one
+// response to stdout, both JSON objects:
+//
+//	{"version": 1, "path": "docs/a.md", "content": "…", "args": [], "options": {}}
+//	{"content": "…"}
+//
+// Path is the file being transformed, or empty for stdin; args are the
+// arguments given after the plugin's name in the step; options are the
+// plugin's options from .mdtools.toml. A plugin that fails responds with
+// {"error": "message"} or exits non-zero; what it writes to stderr is passed
+// through.
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// Version is the version of the protocol.
+const Version = 1
+
+// Request is what a plugin reads from stdin.
+type Request struct {
+	Version int            `json:"version"`
+	Path    string         `json:"path"`
+	Content string         `json:"content"`
+	Args    []string       `json:"args"`
+	Options map[string]any `json:"options"`
+}
+
+// Response is what a plugin writes to stdout.
+type Response struct {
+	Content *string `json:"content"`
+	Error   string  `json:"error,omitempty"`
+}
+
+// Run runs command with args and req, and returns the content it responds
+// with.
+func Run(command string, args []string, req Request) (string, error) {
+	req.Version = Version
+	if req.Args == nil {
+		req.Args = []string{}
+	}
+	if req.Options == nil {
+		req.Options = map[string]any{}
+	}
+	in, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	cmd := exec.Command(command, args...)
+	cmd.Stdin = bytes.NewReader(in)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", err
+	}
+	var resp Response
+	dec := json.NewDecoder(&out)
+	if err := dec.Decode(&resp); err != nil {
+		return "", fmt.Errorf("bad response: %w", err)
+	}
+	switch {
+	case resp.Error != "":
+		return "", errors.New(resp.Error)
+	case resp.Content == nil:
+		return "", errors.New("bad response: no content")
+	}
+	return *resp.Content, nil
+}
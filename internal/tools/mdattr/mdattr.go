@@ -0,0 +1,166 @@
+// Package mdattr gives Markdown headings Pandoc and kramdown attribute blocks
+// ({#id}) with IDs derived from their slugs, and finds IDs defined twice.
+package mdattr
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/markdown"
+)
+
+// Flags defines mdattr's flags on fs. Once fs is parsed, the function it
+// returns checks them and returns the transform.
+func Flags(fs *flag.FlagSet) func() (cli.TransformFunc, error) {
+	o := &options{
+		levels: fs.String("levels", "1-6", "heading `levels` to add IDs to, as a range (2-3) or list (1,2)"),
+	}
+	return func() (cli.TransformFunc, error) {
+		levels, err := parseLevels(*o.levels)
+		if err != nil {
+			return nil, fmt.Errorf("-levels: %v", err)
+		}
+		o.wantLevels = levels
+		return o.transform, nil
+	}
+}
+
+// options holds mdattr's flags.
+type options struct {
+	levels     *string
+	wantLevels map[int]bool
+}
+
+// Duplicate is an ID defined again after its first definition.
+type Duplicate struct {
+	ID          string
+	Line, First int // 1-based
+}
+
+func (d Duplicate) String() string {
+	return fmt.Sprintf("duplicate id %q (first at line %d)", d.ID, d.First)
+}
+
+// Duplicates returns the IDs that headings, spans, and kramdown IALs in
+// content define more than once, one for each definition after the first.
+func Duplicates(content string) []Duplicate {
+	lines := strings.Split(content, "\n")
+	start := markdown.FrontmatterEnd(lines)
+	code := markdown.CodeLines(lines, start)
+	_, dups := explicitIDs(lines, start, code, markdown.AttrHeadings(lines, start, code))
+	return dups
+}
+
+// parseLevels parses "2-3" or "1,2,4" into a set of heading levels.
+func parseLevels(s string) (map[int]bool, error) {
+	set := make(map[int]bool)
+	for _, part := range strings.Split(s, ",") {
+		lo, hi, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		if !isRange {
+			hi = lo
+		}
+		a, err1 := strconv.Atoi(lo)
+		b, err2 := strconv.Atoi(hi)
+		if err1 != nil || err2 != nil || a < 1 || b > 6 || a > b {
+			return nil, fmt.Errorf("invalid level range %q", part)
+		}
+		for l := a; l <= b; l++ {
+			set[l] = true
+		}
+	}
+	return set, nil
+}
+
+func (o *options) transform(content string) string {
+	lines := strings.Split(content, "\n")
+	start := markdown.FrontmatterEnd(lines)
+	code := markdown.CodeLines(lines, start)
+	headings := markdown.AttrHeadings(lines, start, code)
+	ids, _ := explicitIDs(lines, start, code, headings)
+	output := strings.Join(o.addIDs(lines, headings, ids), "\n")
+	return strings.TrimRight(output, "\n") + "\n"
+}
+
+// explicitIDs returns the IDs set in the document, each with the line that
+// first sets it, and the ones set again.
+func explicitIDs(lines []string, start int, code []bool, headings []markdown.AttrHeading) (map[string]int, []Duplicate) {
+	first := make(map[string]int)
+	var dups []Duplicate
+	note := func(id string, line int) {
+		if id == "" {
+			return
+		}
+		if prev, seen := first[id]; seen {
+			dups = append(dups, Duplicate{ID: id, Line: line + 1, First: prev + 1})
+			return
+		}
+		first[id] = line
+	}
+
+	isHeading := make(map[int]bool)
+	for _, h := range headings {
+		isHeading[h.Line] = true
+	}
+	for i := start; i < len(lines); i++ {
+		if code[i] {
+			continue
+		}
+		if markdown.IsIAL(lines[i]) {
+			note(markdown.AttrID(lines[i]), i)
+			continue
+		}
+		for _, loc := range markdown.SpanAttrs(lines[i]) {
+			note(markdown.AttrID(lines[i][loc[0]:loc[1]]), i)
+		}
+		if isHeading[i] {
+			for _, h := range headings {
+				if h.Line == i && h.Attrs != "" {
+					note(h.ID, i)
+				}
+			}
+		}
+	}
+	return first, dups
+}
+
+// addIDs gives each heading of a selected level without an ID one derived
+// from its slug, merging it into an existing attribute block. Slugs avoid
+// the IDs already in use.
+func (o *options) addIDs(lines []string, headings []markdown.AttrHeading, ids map[string]int) []string {
+	var slugs markdown.Slugger
+	for id := range ids {
+		slugs.Reserve(id)
+	}
+	result := append([]string(nil), lines...)
+	for _, h := range headings {
+		if h.ID != "" || !o.wantLevels[h.Level] {
+			continue
+		}
+		id := slugs.Slug(plainText(h.Text))
+		if id == "" {
+			continue
+		}
+		attrs := "{#" + id + "}"
+		switch {
+		case strings.HasPrefix(h.Attrs, "{:"):
+			attrs = "{: #" + id + " " + strings.TrimLeft(h.Attrs[2:], " \t")
+		case h.Attrs != "":
+			attrs = "{#" + id + " " + strings.TrimLeft(h.Attrs[1:], " \t")
+		}
+		result[h.Line] = markdown.SetHeadingText(lines[h.Line], h.Text+" "+attrs)
+	}
+	return result
+}
+
+var linkDest = regexp.MustCompile(`\]\([^)]*\)`)
+
+// plainText drops the markup from heading text that would otherwise end up
+// in its slug: link destinations, images' "!", and emphasis and code
+// delimiters are removed by Slug itself.
+func plainText(text string) string {
+	return linkDest.ReplaceAllString(text, "]")
+}
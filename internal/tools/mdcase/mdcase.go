@@ -0,0 +1,372 @@
+// Package mdcase normalizes the capitalization of Markdown headings to Title
+// Case or sentence case.
+package mdcase
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/markdown"
+)
+
+// Flags defines mdcase's flags on fs. Once fs is parsed, the function it
+// returns checks them and returns the transform.
+func Flags(fs *flag.FlagSet) func() (cli.TransformFunc, error) {
+	o := &options{
+		style:    fs.String("style", "title", "heading `case`: title or sentence"),
+		dictFile: fs.String("dict", "", "`file` of words (one per line) to keep exactly as spelled, e.g. proper nouns"),
+		levels:   fs.String("levels", "1-6", "heading `levels` to change, as a range (2-3) or list (1,2)"),
+	}
+	return func() (cli.TransformFunc, error) {
+		if *o.style != "title" && *o.style != "sentence" {
+			return nil, fmt.Errorf("unknown -style %q (want title or sentence)", *o.style)
+		}
+		var err error
+		if o.wantLevels, err = parseLevels(*o.levels); err != nil {
+			return nil, fmt.Errorf("-levels: %v", err)
+		}
+		if *o.dictFile != "" {
+			if o.dict, err = loadDict(*o.dictFile); err != nil {
+				return nil, err
+			}
+		}
+		return o.transform, nil
+	}
+}
+
+// options holds mdcase's flags.
+type options struct {
+	style    *string
+	dictFile *string
+	levels   *string
+
+	// dict maps the lowercase form of each dictionary word to its spelling.
+	dict map[string]string
+	// wantLevels is the set of heading levels selected by -levels.
+	wantLevels map[int]bool
+}
+
+// smallWords stay lowercase in Title Case unless they start or end the heading
+// or follow a colon.
+var smallWords = map[string]bool{
+	"a": true, "an": true, "and": true, "as": true, "at": true, "but": true,
+	"by": true, "en": true, "for": true, "from": true, "if": true, "in": true,
+	"into": true, "nor": true, "of": true, "on": true, "or": true, "per": true,
+	"so": true, "the": true, "to": true, "up": true, "via": true, "vs": true,
+	"with": true, "yet": true,
+}
+
+var (
+	atxHeadingRe = regexp.MustCompile(`^( {0,3}#{1,6})([ \t]+)(.*?)([ \t]+#+)?[ \t]*$`)
+	setextRe     = regexp.MustCompile(`^ {0,3}(=+|-+)[ \t]*$`)
+)
+
+// parseLevels parses "2-3" or "1,2,4" into a set of heading levels.
+func parseLevels(s string) (map[int]bool, error) {
+	set := make(map[int]bool)
+	for _, part := range strings.Split(s, ",") {
+		lo, hi, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		if !isRange {
+			hi = lo
+		}
+		a, err1 := strconv.Atoi(lo)
+		b, err2 := strconv.Atoi(hi)
+		if err1 != nil || err2 != nil || a < 1 || b > 6 || a > b {
+			return nil, fmt.Errorf("invalid level range %q", part)
+		}
+		for l := a; l <= b; l++ {
+			set[l] = true
+		}
+	}
+	return set, nil
+}
+
+// loadDict reads one word per line; blank lines and # comments are skipped.
+func loadDict(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	d := make(map[string]string)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		w := strings.TrimSpace(sc.Text())
+		if w == "" || strings.HasPrefix(w, "#") {
+			continue
+		}
+		d[strings.ToLower(w)] = w
+	}
+	return d, sc.Err()
+}
+
+func (o *options) transform(content string) string {
+	lines := strings.Split(content, "\n")
+	i := markdown.FrontmatterEnd(lines)
+	result := append([]string(nil), lines[:i]...)
+
+	for i < len(lines) {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		// Fenced code block: pass through unchanged.
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence := trimmed[:3]
+			result = append(result, line)
+			i++
+			for i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), fence) {
+				result = append(result, lines[i])
+				i++
+			}
+			if i < len(lines) {
+				result = append(result, lines[i])
+				i++
+			}
+			continue
+		}
+
+		// ATX heading: "## Text ##"
+		if m := atxHeadingRe.FindStringSubmatch(line); m != nil && !strings.HasPrefix(line, "    ") {
+			if o.wantLevels[strings.Count(m[1], "#")] {
+				line = m[1] + m[2] + o.recase(m[3]) + m[4]
+			}
+			result = append(result, line)
+			i++
+			continue
+		}
+
+		// Setext heading: a text line underlined with === (h1) or --- (h2).
+		if i+1 < len(lines) && isSetextText(line, i == 0 || strings.TrimSpace(lines[i-1]) == "") {
+			if m := setextRe.FindStringSubmatch(lines[i+1]); m != nil {
+				level := 1
+				if m[1][0] == '-' {
+					level = 2
+				}
+				if o.wantLevels[level] {
+					indent := line[:len(line)-len(strings.TrimLeft(line, " "))]
+					line = indent + o.recase(strings.TrimSpace(line))
+				}
+				result = append(result, line, lines[i+1])
+				i += 2
+				continue
+			}
+		}
+
+		result = append(result, line)
+		i++
+	}
+
+	output := strings.Join(result, "\n")
+	return strings.TrimRight(output, "\n") + "\n"
+}
+
+// isSetextText reports whether line could be the text of a setext heading: a
+// single-line paragraph that starts after a blank line.
+func isSetextText(line string, afterBlank bool) bool {
+	if !afterBlank || strings.TrimSpace(line) == "" || strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t") {
+		return false
+	}
+	trimmed := strings.TrimSpace(line)
+	return !strings.HasPrefix(trimmed, ">") && !strings.HasPrefix(trimmed, "<") &&
+		!markdown.IsListItem(line) && !markdown.IsTableRow(line) && !markdown.IsHorizontalRule(line) &&
+		!markdown.IsLinkRefDefinition(line) && !markdown.IsFootnoteDefinition(line)
+}
+
+// token is a run of heading text. Protected tokens (code spans, link
+// destinations, HTML, attribute blocks) are copied verbatim.
+type token struct {
+	text      string
+	protected bool
+}
+
+// tokenize splits heading text into words, spaces, and protected spans.
+func tokenize(s string) []token {
+	var tokens []token
+	var word strings.Builder
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, token{text: word.String()})
+			word.Reset()
+		}
+	}
+	for i := 0; i < len(s); {
+		c := s[i]
+		var end int
+		switch {
+		case c == '`':
+			end = closeRun(s, i, '`')
+		case c == '<':
+			end = closeAt(s, i, '>')
+		case c == '{':
+			end = closeAt(s, i, '}')
+		case c == '(' && i > 0 && s[i-1] == ']':
+			end = closeAt(s, i, ')')
+		case c == ' ' || c == '\t':
+			flush()
+			j := i
+			for j < len(s) && (s[j] == ' ' || s[j] == '\t') {
+				j++
+			}
+			tokens = append(tokens, token{text: s[i:j], protected: true})
+			i = j
+			continue
+		}
+		if end > i {
+			flush()
+			tokens = append(tokens, token{text: s[i:end], protected: true})
+			i = end
+			continue
+		}
+		word.WriteByte(c)
+		i++
+	}
+	flush()
+	return tokens
+}
+
+// closeRun returns the index just past the backtick run closing the one at i,
+// or i if unterminated.
+func closeRun(s string, i int, delim byte) int {
+	n := 0
+	for i+n < len(s) && s[i+n] == delim {
+		n++
+	}
+	for j := i + n; j < len(s); {
+		if s[j] != delim {
+			j++
+			continue
+		}
+		m := 0
+		for j+m < len(s) && s[j+m] == delim {
+			m++
+		}
+		if m == n {
+			return j + m
+		}
+		j += m
+	}
+	return i
+}
+
+// closeAt returns the index just past the first close after i, or i if none.
+func closeAt(s string, i int, close byte) int {
+	if j := strings.IndexByte(s[i+1:], close); j >= 0 {
+		return i + 1 + j + 1
+	}
+	return i
+}
+
+// recase applies the selected style to heading text.
+func (o *options) recase(text string) string {
+	tokens := tokenize(text)
+
+	// Indexes of word tokens, to find the first and last word.
+	var words []int
+	for i, t := range tokens {
+		if !t.protected {
+			words = append(words, i)
+		}
+	}
+	if len(words) == 0 {
+		return text
+	}
+
+	var b strings.Builder
+	afterColon := false
+	for i, t := range tokens {
+		if t.protected {
+			b.WriteString(t.text)
+			continue
+		}
+		first := i == words[0]
+		last := i == words[len(words)-1]
+		b.WriteString(o.recaseWord(t.text, first, last, afterColon))
+		afterColon = strings.HasSuffix(strings.TrimRight(t.text, "*_)\"'”’"), ":")
+	}
+	return b.String()
+}
+
+// recaseWord recases one whitespace-delimited word. Hyphenated compounds are
+// handled part by part in Title Case.
+func (o *options) recaseWord(word string, first, last, afterColon bool) string {
+	// Separate leading and trailing punctuation/markup from the core word.
+	start := strings.IndexFunc(word, isWordRune)
+	if start < 0 {
+		return word
+	}
+	end := strings.LastIndexFunc(word, isWordRune)
+	_, size := utf8.DecodeRuneInString(word[end:])
+	end += size
+	prefix, core, suffix := word[:start], word[start:end], word[end:]
+
+	if spelled, ok := o.dict[strings.ToLower(core)]; ok {
+		return prefix + spelled + suffix
+	}
+	if keepAsIs(core) {
+		return word
+	}
+
+	if *o.style == "sentence" {
+		if first || afterColon {
+			return prefix + upperFirst(strings.ToLower(core)) + suffix
+		}
+		return prefix + strings.ToLower(core) + suffix
+	}
+
+	parts := strings.Split(core, "-")
+	for i, p := range parts {
+		lower := strings.ToLower(p)
+		edge := (first || afterColon) && i == 0 || last && i == len(parts)-1
+		if smallWords[lower] && !edge && len(parts) == 1 {
+			parts[i] = lower
+		} else {
+			parts[i] = upperFirst(p)
+		}
+	}
+	return prefix + strings.Join(parts, "-") + suffix
+}
+
+// keepAsIs reports whether a word's existing capitalization is deliberate:
+// the pronoun I, acronyms (API), mixed case (GitHub, iOS), and words
+// containing digits or path/domain punctuation (v2, go.mod, a/b).
+func keepAsIs(core string) bool {
+	if core == "I" || strings.HasPrefix(core, "I'") || strings.HasPrefix(core, "I’") {
+		return true
+	}
+	if strings.ContainsAny(core, "./\\@0123456789") {
+		return true
+	}
+	upper, lowerThenUpper := 0, false
+	prev := rune(0)
+	for _, r := range core {
+		if unicode.IsUpper(r) {
+			upper++
+			if unicode.IsLower(prev) {
+				lowerThenUpper = true
+			}
+		}
+		prev = r
+	}
+	first, _ := utf8.DecodeRuneInString(core)
+	return lowerThenUpper || upper > 1 || upper == 1 && !unicode.IsUpper(first)
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func upperFirst(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	if r == utf8.RuneError {
+		return s
+	}
+	return string(unicode.ToUpper(r)) + s[size:]
+}
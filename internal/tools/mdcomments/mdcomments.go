@@ -0,0 +1,209 @@
+// Package mdcomments strips HTML comments for publishing, or lists them as a
+// review report.
+package mdcomments
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/corpus"
+	"github.com/dbh/md-tools/internal/markdown"
+)
+
+// Flags defines mdcomments's flags on fs. Once fs is parsed, the function it
+// returns checks them and returns the transform.
+func Flags(fs *flag.FlagSet) func() (cli.TransformFunc, error) {
+	setup := ReportFlags(fs)
+	return func() (cli.TransformFunc, error) {
+		transform, _, err := setup()
+		return transform, err
+	}
+}
+
+// ReportFunc writes "name:line: [heading] text" to w for each comment in
+// content, where heading is the nearest heading above it.
+type ReportFunc func(w io.Writer, name, content string)
+
+// ReportFlags is Flags for a command that can also report the comments
+// instead of stripping them.
+func ReportFlags(fs *flag.FlagSet) func() (cli.TransformFunc, ReportFunc, error) {
+	o := &options{
+		keep: fs.String("keep", "", "also keep comments whose text matches this `regexp`"),
+	}
+	return func() (cli.TransformFunc, ReportFunc, error) {
+		if *o.keep != "" {
+			re, err := regexp.Compile(*o.keep)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid -keep: %v", err)
+			}
+			o.keepRe = re
+		}
+		return o.transform, o.report, nil
+	}
+}
+
+// options holds mdcomments's flags.
+type options struct {
+	keep   *string
+	keepRe *regexp.Regexp
+}
+
+var (
+	markerRe    = regexp.MustCompile(`^/?[a-z][a-z0-9-]*$`)
+	directiveRe = regexp.MustCompile(`^md[a-z]+(:|\s|$)`)
+)
+
+// comment is an HTML comment in the document.
+type comment struct {
+	start, end int    // byte offsets of "<!--" and just past "-->"
+	text       string // the text between the delimiters, trimmed
+	line       int    // 1-based
+}
+
+// findComments returns the comments outside frontmatter and code, skipping
+// md-tools directives and comments matching -keep.
+func (o *options) findComments(content string) []comment {
+	lines := strings.Split(content, "\n")
+	pos := 0
+	for _, line := range lines[:markdown.FrontmatterEnd(lines)] {
+		pos += len(line) + 1
+	}
+	if pos > len(content) { // frontmatter that ends the document
+		pos = len(content)
+	}
+	code := corpus.CodeRanges([]byte(content))
+
+	var all []comment
+	for {
+		i := strings.Index(content[pos:], "<!--")
+		if i < 0 {
+			break
+		}
+		start := pos + i
+		j := strings.Index(content[start+4:], "-->")
+		if j < 0 {
+			break
+		}
+		end := start + 4 + j + 3
+		pos = end
+		if overlapsCode(start, end, code) {
+			pos = start + 4
+			continue
+		}
+		all = append(all, comment{
+			start: start,
+			end:   end,
+			text:  strings.TrimSpace(content[start+4 : end-3]),
+			line:  strings.Count(content[:start], "\n") + 1,
+		})
+	}
+
+	// A marker is only a directive when its partner is present too, so a
+	// lone "<!-- fix -->" is still a comment.
+	texts := make(map[string]bool, len(all))
+	for _, c := range all {
+		texts[c.text] = true
+	}
+	var comments []comment
+	for _, c := range all {
+		if markerRe.MatchString(c.text) {
+			partner := "/" + c.text
+			if strings.HasPrefix(c.text, "/") {
+				partner = c.text[1:]
+			}
+			if texts[partner] {
+				continue
+			}
+		}
+		if directiveRe.MatchString(c.text) || o.keepRe != nil && o.keepRe.MatchString(c.text) {
+			continue
+		}
+		comments = append(comments, c)
+	}
+	return comments
+}
+
+// overlapsCode reports whether [start, end) overlaps code. A comment that
+// code starts inside, like a fence interrupting the paragraph it began in,
+// was never a comment.
+func overlapsCode(start, end int, ranges []markdown.ByteRange) bool {
+	for _, r := range ranges {
+		if r.Start < end && start < r.End {
+			return true
+		}
+	}
+	return false
+}
+
+// transform removes comments. Removing one can change how the rest of the
+// document parses, turning what followed it into a comment of its own, so
+// it strips again until nothing changes.
+func (o *options) transform(content string) string {
+	for {
+		output := o.strip(content)
+		if output == content {
+			return output
+		}
+		content = output
+	}
+}
+
+// strip removes the comments found in content. A comment on lines of its own
+// takes the lines with it, along with a blank line if that would leave two
+// in a row; an inline comment takes one of the spaces around it.
+func (o *options) strip(content string) string {
+	var result strings.Builder
+	pos := 0
+	for _, c := range o.findComments(content) {
+		if c.start < pos {
+			continue
+		}
+		start, end := c.start, c.end
+		lineStart := strings.LastIndexByte(content[:start], '\n') + 1
+		lineEnd := len(content)
+		if k := strings.IndexByte(content[end:], '\n'); k >= 0 {
+			lineEnd = end + k
+		}
+		if lineStart >= pos && strings.TrimSpace(content[lineStart:start]) == "" && strings.TrimSpace(content[end:lineEnd]) == "" {
+			// Whole lines: drop them and their newline.
+			start, end = lineStart, min(lineEnd+1, len(content))
+			blankBefore := start == 0 || strings.HasSuffix(content[:start], "\n\n")
+			if blankBefore {
+				for end < len(content) && content[end] == '\n' {
+					end++
+				}
+			}
+		} else if start > 0 && content[start-1] == ' ' && (end == len(content) || content[end] == ' ' || content[end] == '\n' || strings.ContainsRune(".,;:!?)", rune(content[end]))) {
+			start--
+		}
+		result.WriteString(content[pos:start])
+		pos = end
+	}
+	result.WriteString(content[pos:])
+	output := result.String()
+	return strings.TrimRight(output, "\n") + "\n"
+}
+
+// report is the ReportFunc of o.
+func (o *options) report(w io.Writer, name, content string) {
+	headings := corpus.Headings([]byte(content))
+	for _, c := range o.findComments(content) {
+		heading := ""
+		for _, h := range headings {
+			if h.Line > c.line {
+				break
+			}
+			heading = h.Text
+		}
+		text := strings.Join(strings.Fields(c.text), " ")
+		if heading != "" {
+			fmt.Fprintf(w, "%s:%d: [%s] %s\n", name, c.line, heading, text)
+		} else {
+			fmt.Fprintf(w, "%s:%d: %s\n", name, c.line, text)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+// Package mdconvert converts HTML to Markdown, for migrating legacy pages into
+// the toolchain.
+package mdconvert
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/JohannesKaufmann/html-to-markdown/v2/converter"
+	"github.com/JohannesKaufmann/html-to-markdown/v2/plugin/base"
+	"github.com/JohannesKaufmann/html-to-markdown/v2/plugin/commonmark"
+	"github.com/JohannesKaufmann/html-to-markdown/v2/plugin/strikethrough"
+	"github.com/JohannesKaufmann/html-to-markdown/v2/plugin/table"
+	"github.com/dbh/md-tools/internal/cli"
+)
+
+// Flags defines mdconvert's flags on fs. Once fs is parsed, the function it
+// returns checks them and returns the transform.
+func Flags(fs *flag.FlagSet) func() (cli.TransformFunc, error) {
+	o := &options{
+		keep:   fs.String("keep", "", "comma-separated `elements` to keep as raw HTML (e.g. table,video)"),
+		remove: fs.String("remove", "", "comma-separated `elements` to drop with their content (e.g. nav,footer)"),
+		domain: fs.String("domain", "", "base `URL` for resolving relative links and images"),
+	}
+	return func() (cli.TransformFunc, error) {
+		o.conv = newConverter(splitList(*o.keep), splitList(*o.remove))
+		return o.transform, nil
+	}
+}
+
+// options holds mdconvert's flags.
+type options struct {
+	keep   *string
+	remove *string
+	domain *string
+
+	conv *converter.Converter
+}
+
+// blockElements are the HTML elements kept on lines of their own when they
+// are kept as raw HTML; anything else is kept inline.
+var blockElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "audio": true,
+	"blockquote": true, "details": true, "dialog": true, "div": true,
+	"dl": true, "fieldset": true, "figure": true, "footer": true,
+	"form": true, "h1": true, "h2": true, "h3": true, "h4": true,
+	"h5": true, "h6": true, "header": true, "hr": true, "iframe": true,
+	"main": true, "nav": true, "ol": true, "p": true, "picture": true,
+	"pre": true, "section": true, "table": true, "ul": true, "video": true,
+}
+
+// newConverter returns a converter with GitHub Flavored Markdown tables and
+// strikethrough, rendering the keep elements as HTML and dropping the remove
+// elements.
+func newConverter(keep, remove []string) *converter.Converter {
+	c := converter.NewConverter(
+		converter.WithPlugins(
+			base.NewBasePlugin(),
+			commonmark.NewCommonmarkPlugin(
+				commonmark.WithEmDelimiter("_"),
+				commonmark.WithHorizontalRule("---"),
+			),
+			table.NewTablePlugin(),
+			strikethrough.NewStrikethroughPlugin(),
+		),
+	)
+	for _, name := range keep {
+		if blockElements[name] {
+			c.Register.RendererFor(name, converter.TagTypeBlock, base.RenderAsHTML, converter.PriorityEarly)
+		} else {
+			c.Register.RendererFor(name, converter.TagTypeInline, base.RenderAsHTML, converter.PriorityEarly)
+		}
+	}
+	for _, name := range remove {
+		c.Register.TagType(name, converter.TagTypeRemove, converter.PriorityEarly)
+	}
+	return c
+}
+
+// splitList splits a comma-separated list of element names, lowercased.
+func splitList(s string) []string {
+	var names []string
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func (o *options) transform(content string) string {
+	var opts []converter.ConvertOptionFunc
+	if *o.domain != "" {
+		opts = append(opts, converter.WithDomain(*o.domain))
+	}
+	output, err := o.conv.ConvertString(content, opts...)
+	if err != nil {
+		// The HTML parser accepts anything, so this only happens if a
+		// renderer fails; keep the input rather than lose it.
+		fmt.Fprintf(os.Stderr, "mdconvert: %v\n", err)
+		output = content
+	}
+	return strings.TrimRight(output, "\n") + "\n"
+}
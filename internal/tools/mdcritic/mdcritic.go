@@ -0,0 +1,144 @@
+// Package mdcritic accepts or rejects CriticMarkup edits, or renders them as
+// HTML for review builds.
+package mdcritic
+
+import (
+	"flag"
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/corpus"
+	"github.com/dbh/md-tools/internal/markdown"
+)
+
+// Flags defines mdcritic's flags on fs. Once fs is parsed, the function it
+// returns checks them and returns the transform.
+func Flags(fs *flag.FlagSet) func() (cli.TransformFunc, error) {
+	o := &options{
+		mode: fs.String("mode", "accept", "what to do with the markup: accept, reject, or html"),
+	}
+	return func() (cli.TransformFunc, error) {
+		if *o.mode != "accept" && *o.mode != "reject" && *o.mode != "html" {
+			return nil, fmt.Errorf("unknown -mode %q (want accept, reject, or html)", *o.mode)
+		}
+		return o.transform, nil
+	}
+}
+
+// options holds mdcritic's flags.
+type options struct {
+	mode *string
+}
+
+// closers maps each opening delimiter to its closing one.
+var closers = map[string]string{
+	"{++": "++}",
+	"{--": "--}",
+	"{~~": "~~}",
+	"{==": "==}",
+	"{>>": "<<}",
+}
+
+// transform applies the markup. Markup can be nested, as a comment inside
+// an addition, so it repeats until no markup is left to apply.
+func (o *options) transform(content string) string {
+	for {
+		output := o.apply(content)
+		if output == content {
+			return output
+		}
+		content = output
+	}
+}
+
+// apply makes one pass over content, leaving any markup inside the text it
+// keeps for the next.
+func (o *options) apply(content string) string {
+	code := markdown.NewRangeSet(corpus.CodeRanges([]byte(content)))
+	var b strings.Builder
+	for i := 0; i < len(content); {
+		open := content[i:min(i+3, len(content))]
+		closer, ok := closers[open]
+		if !ok || code.Contains(i) {
+			b.WriteByte(content[i])
+			i++
+			continue
+		}
+		j := strings.Index(content[i+3:], closer)
+		if j < 0 {
+			b.WriteByte(content[i])
+			i++
+			continue
+		}
+		inner := content[i+3 : i+3+j]
+		end := i + 3 + j + 3
+		replacement := o.render(open, inner)
+
+		if replacement == "" {
+			// Markup alone on its lines goes with them; otherwise don't
+			// leave two spaces where it was.
+			written := b.String()
+			lineStart := strings.LastIndexByte(written, '\n') + 1
+			rest := content[end:]
+			lineEnd := strings.IndexByte(rest, '\n')
+			if lineEnd < 0 {
+				lineEnd = len(rest)
+			}
+			switch {
+			case strings.TrimSpace(written[lineStart:]) == "" && strings.TrimSpace(rest[:lineEnd]) == "":
+				b.Reset()
+				b.WriteString(written[:lineStart])
+				end += lineEnd
+				if end < len(content) {
+					end++
+				}
+				if (lineStart == 0 || strings.HasSuffix(written[:lineStart], "\n\n")) && strings.HasPrefix(content[end:], "\n") {
+					end++
+				}
+			case strings.HasSuffix(written, " ") && (end == len(content) || strings.ContainsRune(" \n.,;:!?)", rune(content[end]))):
+				b.Reset()
+				b.WriteString(written[:len(written)-1])
+			}
+		}
+		b.WriteString(replacement)
+		i = end
+	}
+	output := b.String()
+	return strings.TrimRight(output, "\n") + "\n"
+}
+
+// render returns the replacement for the markup opened by open.
+func (o *options) render(open, inner string) string {
+	before, after, _ := strings.Cut(inner, "~>")
+	switch *o.mode {
+	case "accept":
+		switch open {
+		case "{++", "{==":
+			return inner
+		case "{~~":
+			return after
+		}
+		return ""
+	case "reject":
+		switch open {
+		case "{--", "{==":
+			return inner
+		case "{~~":
+			return before
+		}
+		return ""
+	}
+	switch open {
+	case "{++":
+		return "<ins>" + inner + "</ins>"
+	case "{--":
+		return "<del>" + inner + "</del>"
+	case "{~~":
+		return "<del>" + before + "</del><ins>" + after + "</ins>"
+	case "{==":
+		return "<mark>" + inner + "</mark>"
+	}
+	return `<span class="critic comment">` + html.EscapeString(inner) + "</span>"
+}
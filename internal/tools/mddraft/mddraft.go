@@ -0,0 +1,160 @@
+// Package mddraft removes draft material before publishing, or lists it.
+package mddraft
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/markdown"
+)
+
+// Flags defines mddraft's flags on fs. Once fs is parsed, the function it
+// returns checks them and returns the transform.
+func Flags(fs *flag.FlagSet) func() (cli.TransformFunc, error) {
+	return func() (cli.TransformFunc, error) {
+		return transform, nil
+	}
+}
+
+var (
+	atxHeadingRe = regexp.MustCompile(`^ {0,3}(#{1,6})[ \t]+(.*?)(?:[ \t]+#+)?[ \t]*$`)
+	setextRe     = regexp.MustCompile(`^ {0,3}(=+|-+)[ \t]*$`)
+	draftAttrRe  = regexp.MustCompile(`[ \t]*\{(?:[^{}]*[:\s])?\.draft(?:\s[^{}]*)?\}$`)
+)
+
+// draft is a run of draft lines.
+type draft struct {
+	start, end int    // line indexes, end exclusive
+	title      string // heading text, or the first line of a marked block
+}
+
+// findDrafts returns the drafts in lines in document order. Drafts never
+// overlap: one that starts inside another is part of it.
+func findDrafts(lines []string) []draft {
+	start := markdown.FrontmatterEnd(lines)
+	code := codeLines(lines, start)
+
+	var drafts []draft
+	for i := start; i < len(lines); i++ {
+		if code[i] {
+			continue
+		}
+		if strings.TrimSpace(lines[i]) == markdown.MarkerOpen("draft") {
+			end := i + 1
+			for end < len(lines) && (code[end] || strings.TrimSpace(lines[end]) != markdown.MarkerClose("draft")) {
+				end++
+			}
+			if end == len(lines) {
+				continue // unclosed: not a draft
+			}
+			title := ""
+			for _, line := range lines[i+1 : end] {
+				if t := strings.TrimSpace(line); t != "" {
+					title = t
+					break
+				}
+			}
+			drafts = append(drafts, draft{start: i, end: end + 1, title: title})
+			i = end
+			continue
+		}
+		level, text, ok := headingAt(lines, i, start, code)
+		if !ok {
+			continue
+		}
+		loc := draftAttrRe.FindStringIndex(text)
+		if loc == nil {
+			continue
+		}
+		end := i + 1
+		for end < len(lines) {
+			if l, _, ok := headingAt(lines, end, start, code); ok && l <= level {
+				break
+			}
+			end++
+		}
+		drafts = append(drafts, draft{start: i, end: end, title: text[:loc[0]]})
+		i = end - 1
+	}
+	return drafts
+}
+
+// headingAt reports whether an ATX or setext heading starts at lines[i], and
+// returns its level and text.
+func headingAt(lines []string, i, start int, code []bool) (level int, text string, ok bool) {
+	if code[i] {
+		return 0, "", false
+	}
+	if m := atxHeadingRe.FindStringSubmatch(lines[i]); m != nil {
+		return len(m[1]), m[2], true
+	}
+	if i+1 < len(lines) && strings.TrimSpace(lines[i]) != "" && !markdown.IsHorizontalRule(lines[i]) &&
+		(i == start || strings.TrimSpace(lines[i-1]) == "") && setextRe.MatchString(lines[i+1]) {
+		level = 1
+		if strings.TrimSpace(lines[i+1])[0] == '-' {
+			level = 2
+		}
+		return level, strings.TrimSpace(lines[i]), true
+	}
+	return 0, "", false
+}
+
+// codeLines reports which lines are in fenced or indented code blocks.
+func codeLines(lines []string, start int) []bool {
+	code := make([]bool, len(lines))
+	fence := ""
+	for i := start; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		switch {
+		case fence != "":
+			code[i] = true
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			code[i] = true
+			fence = trimmed[:3]
+		case (strings.HasPrefix(lines[i], "    ") || strings.HasPrefix(lines[i], "\t")) &&
+			(i == start || strings.TrimSpace(lines[i-1]) == "" || code[i-1]):
+			code[i] = true
+		}
+	}
+	return code
+}
+
+// transform removes the drafts, along with the blank lines after each one
+// when it was preceded by a blank line or the start of the document.
+func transform(content string) string {
+	lines := strings.Split(content, "\n")
+	var result []string
+	pos := 0
+	for _, d := range findDrafts(lines) {
+		result = append(result, lines[pos:d.start]...)
+		pos = d.end
+		if len(result) == 0 || strings.TrimSpace(result[len(result)-1]) == "" {
+			for pos < len(lines) && strings.TrimSpace(lines[pos]) == "" {
+				pos++
+			}
+		}
+	}
+	result = append(result, lines[pos:]...)
+	output := strings.Join(result, "\n")
+	return strings.TrimRight(output, "\n") + "\n"
+}
+
+// List writes "name:first-last: title" to w for each draft in content, with
+// 1-based line numbers. Trailing blank lines don't count.
+func List(w io.Writer, name, content string) {
+	lines := strings.Split(content, "\n")
+	for _, d := range findDrafts(lines) {
+		last := d.end
+		for last > d.start+1 && strings.TrimSpace(lines[last-1]) == "" {
+			last--
+		}
+		fmt.Fprintf(w, "%s:%d-%d: %s\n", name, d.start+1, last, d.title)
+	}
+}
@@ -0,0 +1,233 @@
+// Package mdemph normalizes emphasis markers so italics use one delimiter and
+// bold another, e.g. _italic_ and **bold**.
+package mdemph
+
+import (
+	"flag"
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/markdown"
+)
+
+// Flags defines mdemph's flags on fs. Once fs is parsed, the function it
+// returns checks them and returns the transform.
+func Flags(fs *flag.FlagSet) func() (cli.TransformFunc, error) {
+	o := &options{
+		italic: fs.String("italic", "_", "`delimiter` for italics: _ or *"),
+		bold:   fs.String("bold", "*", "`delimiter` for bold, doubled: * or _"),
+	}
+	return func() (cli.TransformFunc, error) {
+		for name, v := range map[string]string{"italic": *o.italic, "bold": *o.bold} {
+			if v != "_" && v != "*" {
+				return nil, fmt.Errorf("unknown -%s %q (want _ or *)", name, v)
+			}
+		}
+		return o.transform, nil
+	}
+}
+
+// options holds mdemph's flags.
+type options struct {
+	italic *string
+	bold   *string
+}
+
+func (o *options) transform(content string) string {
+	return markdown.RewriteProse(content, o.convert)
+}
+
+// delim is a run of * or _ characters. Characters still available for
+// matching are s[start:start+count].
+type delim struct {
+	ch       byte
+	start    int
+	count    int
+	orig     int
+	canOpen  bool
+	canClose bool
+}
+
+// match is one emphasis (n == 1) or strong emphasis (n == 2) pair: the
+// opening delimiter at s[open:open+n] and the closing one at s[close:close+n].
+type match struct {
+	open, close, n int
+}
+
+// convert rewrites the emphasis delimiters in one block of inline text. Every
+// rewrite is checked by parsing the result again: a pair that would merge with
+// a neighbouring delimiter, or an underscore that would land inside a word,
+// changes what is emphasized and is left as written.
+func (o *options) convert(s string) string {
+	matches := findEmphasis(s)
+	for {
+		var pending []match
+		for _, m := range matches {
+			if s[m.open] != o.target(m) {
+				pending = append(pending, m)
+			}
+		}
+		if len(pending) == 0 {
+			return s
+		}
+
+		// Usually every pair can be rewritten at once; otherwise fall back
+		// to rewriting them one by one, keeping each that preserves the
+		// emphasis. One kept rewrite can make room for another, so go
+		// round again until none is kept.
+		if out := o.rewrite(s, pending); sameEmphasis(out, matches) {
+			return out
+		}
+		kept := false
+		for _, m := range pending {
+			if out := o.rewrite(s, []match{m}); sameEmphasis(out, matches) {
+				s = out
+				kept = true
+			}
+		}
+		if !kept {
+			return s
+		}
+	}
+}
+
+// target returns the delimiter character selected for pair m.
+func (o *options) target(m match) byte {
+	if m.n == 2 {
+		return (*o.bold)[0]
+	}
+	return (*o.italic)[0]
+}
+
+// rewrite returns s with the delimiters of each pair replaced by its target.
+func (o *options) rewrite(s string, pairs []match) string {
+	out := []byte(s)
+	for _, m := range pairs {
+		for k := 0; k < m.n; k++ {
+			out[m.open+k] = o.target(m)
+			out[m.close+k] = o.target(m)
+		}
+	}
+	return string(out)
+}
+
+// sameEmphasis reports whether s has exactly the emphasis pairs want.
+func sameEmphasis(s string, want []match) bool {
+	got := findEmphasis(s)
+	if len(got) != len(want) {
+		return false
+	}
+	seen := make(map[match]bool, len(want))
+	for _, m := range want {
+		seen[m] = true
+	}
+	for _, m := range got {
+		if !seen[m] {
+			return false
+		}
+	}
+	return true
+}
+
+// findEmphasis finds emphasis pairs in s with the CommonMark "process
+// emphasis" procedure.
+func findEmphasis(s string) []match {
+	var stack []*delim
+	for i := 0; i < len(s); {
+		if j, ok := markdown.SkipLiteral(s, i); ok {
+			i = j
+			continue
+		}
+		switch c := s[i]; {
+		case c == '*' || c == '_':
+			j := i
+			for j < len(s) && s[j] == c {
+				j++
+			}
+			left, right := flanking(s, i, j)
+			d := &delim{ch: c, start: i, count: j - i, orig: j - i}
+			if c == '*' {
+				d.canOpen, d.canClose = left, right
+			} else {
+				d.canOpen = left && (!right || isPunct(runeBefore(s, i)))
+				d.canClose = right && (!left || isPunct(runeAfter(s, j)))
+			}
+			stack = append(stack, d)
+			i = j
+		default:
+			i++
+		}
+	}
+
+	var matches []match
+	for ci := 0; ci < len(stack); ci++ {
+		closer := stack[ci]
+		if !closer.canClose {
+			continue
+		}
+		for closer.count > 0 {
+			oi := ci - 1
+			for ; oi >= 0; oi-- {
+				o := stack[oi]
+				if o.ch != closer.ch || !o.canOpen || o.count == 0 {
+					continue
+				}
+				// The "rule of 3" for runs that can both open and close.
+				if (o.canClose || closer.canOpen) && (o.orig+closer.orig)%3 == 0 && !(o.orig%3 == 0 && closer.orig%3 == 0) {
+					continue
+				}
+				break
+			}
+			if oi < 0 {
+				break
+			}
+			opener := stack[oi]
+			n := 1
+			if opener.count >= 2 && closer.count >= 2 {
+				n = 2
+			}
+			opener.count -= n
+			matches = append(matches, match{open: opener.start + opener.count, close: closer.start, n: n})
+			closer.start += n
+			closer.count -= n
+			// Delimiters between the pair can no longer match anything.
+			for k := oi + 1; k < ci; k++ {
+				stack[k].count = 0
+			}
+		}
+	}
+	return matches
+}
+
+// flanking reports whether the delimiter run s[i:j] is left-flanking and
+// right-flanking.
+func flanking(s string, i, j int) (left, right bool) {
+	prev, next := runeBefore(s, i), runeAfter(s, j)
+	left = !unicode.IsSpace(next) && (!isPunct(next) || unicode.IsSpace(prev) || isPunct(prev))
+	right = !unicode.IsSpace(prev) && (!isPunct(prev) || unicode.IsSpace(next) || isPunct(next))
+	return left, right
+}
+
+// runeBefore returns the rune before s[i], or a space at the start of s.
+func runeBefore(s string, i int) rune {
+	if i == 0 {
+		return ' '
+	}
+	r, _ := utf8.DecodeLastRuneInString(s[:i])
+	return r
+}
+
+// runeAfter returns the rune at s[j], or a space at the end of s.
+func runeAfter(s string, j int) rune {
+	if j >= len(s) {
+		return ' '
+	}
+	r, _ := utf8.DecodeRuneInString(s[j:])
+	return r
+}
+
+func isPunct(r rune) bool {
+	return unicode.IsPunct(r) || unicode.IsSymbol(r)
+}
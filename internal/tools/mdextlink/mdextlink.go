@@ -0,0 +1,203 @@
+// Package mdextlink applies a policy to the links that leave the site:
+// marking them, sending them through a redirect, or opening them in a new
+// tab.
+package mdextlink
+
+import (
+	"flag"
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/corpus"
+	"github.com/dbh/md-tools/internal/markdown"
+	"github.com/dbh/md-tools/internal/markdown/links"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// Flags defines mdextlink's flags on fs. Once fs is parsed, the function it
+// returns checks them and returns the transform.
+func Flags(fs *flag.FlagSet) func() (cli.TransformFunc, error) {
+	o := &options{
+		policy: fs.String("policy", "marker", "what to do with external links: marker (append -marker), redirect (through -prefix), or html (<a> opening a new tab)"),
+		marker: fs.String("marker", "(external)", "`text` to append after each external link"),
+		prefix: fs.String("prefix", "", "redirect `URL` the escaped destination is appended to, e.g. https://example.com/out?url="),
+		allow:  fs.String("allow", "", "comma-separated `domains` whose links aren't external (subdomains included)"),
+	}
+	return func() (cli.TransformFunc, error) {
+		switch *o.policy {
+		case "marker":
+			if strings.TrimSpace(*o.marker) == "" {
+				return nil, fmt.Errorf("-marker is empty")
+			}
+		case "redirect":
+			u, err := url.Parse(*o.prefix)
+			if *o.prefix == "" || err != nil || u.Host == "" {
+				return nil, fmt.Errorf("-policy redirect needs an absolute -prefix URL")
+			}
+			// Links already sent through the redirect are left alone.
+			o.domains = append(o.domains, strings.ToLower(u.Hostname()))
+		case "html":
+		default:
+			return nil, fmt.Errorf("unknown -policy %q (want marker, redirect, or html)", *o.policy)
+		}
+		for _, d := range strings.Split(*o.allow, ",") {
+			if d = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(d)), "."); d != "" {
+				o.domains = append(o.domains, d)
+			}
+		}
+		return o.transform, nil
+	}
+}
+
+// options holds mdextlink's flags.
+type options struct {
+	policy *string
+	marker *string
+	prefix *string
+	allow  *string
+
+	// domains are the -allow domains, and the -prefix host.
+	domains []string
+}
+
+// md parses documents. A goldmark instance is safe for concurrent use.
+var md = goldmark.New()
+
+// autolinkRe matches a URL autolink, <https://…>.
+var autolinkRe = regexp.MustCompile(`<(https?://[^\s<>]*)>`)
+
+// edit replaces the bytes from start to end with text.
+type edit struct {
+	start, end int
+	text       string
+}
+
+func (o *options) transform(content string) string {
+	source := []byte(content)
+	doc := md.Parser().Parse(text.NewReader(source))
+
+	defs := links.CollectRefDefs(doc, source)
+
+	var edits []edit
+	redirected := make(map[string]bool) // labels of definitions to redirect
+	for _, l := range links.CollectLinks(doc, source, defs) {
+		link, ok := l.Node.(*ast.Link)
+		if !ok || l.Start < 0 || !o.external(l.Destination) {
+			continue
+		}
+		start, end, linkText := l.Start, l.End, content[l.Text.Start:l.Text.End]
+		dest := l.Destination
+		switch *o.policy {
+		case "marker":
+			if !o.marked(content, end) {
+				edits = append(edits, edit{end, end, " " + *o.marker})
+			}
+		case "redirect":
+			if l.Label != "" {
+				// The definition is rewritten instead, for every link
+				// that uses it.
+				redirected[l.Label] = true
+				break
+			}
+			rewritten := "[" + linkText + "](" + o.redirect(dest)
+			if l.Title != "" {
+				rewritten += " " + l.Title
+			}
+			edits = append(edits, edit{start, end, rewritten + ")"})
+		case "html":
+			edits = append(edits, edit{start, end, anchor(dest, string(link.Title), linkText)})
+		}
+	}
+
+	if len(redirected) > 0 {
+		for _, def := range defs {
+			if !redirected[def.Label] || def.Range.End == 0 {
+				continue
+			}
+			line := content[def.Range.Start:def.Range.End]
+			colon := strings.Index(line, "]:")
+			rest := line[colon+2:]
+			dest := strings.Fields(rest)[0]
+			at := def.Range.Start + colon + 2 + strings.Index(rest, dest)
+			bare := strings.TrimSuffix(strings.TrimPrefix(dest, "<"), ">")
+			if o.external(bare) {
+				edits = append(edits, edit{at, at + len(dest), o.redirect(bare)})
+			}
+		}
+	}
+
+	code := markdown.NewRangeSet(corpus.CodeRanges(source))
+	for _, m := range autolinkRe.FindAllStringSubmatchIndex(content, -1) {
+		dest := content[m[2]:m[3]]
+		if code.Contains(m[0]) || !o.external(dest) {
+			continue
+		}
+		switch *o.policy {
+		case "marker":
+			if !o.marked(content, m[1]) {
+				edits = append(edits, edit{m[1], m[1], " " + *o.marker})
+			}
+		case "redirect":
+			edits = append(edits, edit{m[0], m[1], "[" + dest + "](" + o.redirect(dest) + ")"})
+		case "html":
+			edits = append(edits, edit{m[0], m[1], anchor(dest, "", html.EscapeString(dest))})
+		}
+	}
+
+	sort.Slice(edits, func(i, j int) bool { return edits[i].start < edits[j].start })
+	var b strings.Builder
+	last := 0
+	for _, e := range edits {
+		if e.start < last {
+			continue
+		}
+		b.WriteString(content[last:e.start])
+		b.WriteString(e.text)
+		last = e.end
+	}
+	b.WriteString(content[last:])
+	return strings.TrimRight(b.String(), "\n") + "\n"
+}
+
+// external reports whether dest is an http(s) URL for a host outside the
+// allowed domains.
+func (o *options) external(dest string) bool {
+	u, err := url.Parse(dest)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, d := range o.domains {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return false
+		}
+	}
+	return true
+}
+
+// marked reports whether the marker already follows the link ending at end.
+func (o *options) marked(content string, end int) bool {
+	return strings.HasPrefix(content[end:], " "+*o.marker)
+}
+
+// redirect returns dest sent through the -prefix URL.
+func (o *options) redirect(dest string) string {
+	return *o.prefix + url.QueryEscape(dest)
+}
+
+// anchor returns an HTML link to dest that opens in a new tab. Its text,
+// linkText, is left as Markdown, which is still parsed inside the tag.
+func anchor(dest, title, linkText string) string {
+	a := `<a href="` + html.EscapeString(dest) + `"`
+	if title != "" {
+		a += ` title="` + html.EscapeString(title) + `"`
+	}
+	return a + ` rel="noopener" target="_blank">` + linkText + `</a>`
+}
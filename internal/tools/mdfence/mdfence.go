@@ -0,0 +1,204 @@
+// Package mdfence normalizes code blocks: indented code blocks become fenced
+// blocks, and every fence uses the same character and the shortest length that
+// can't be closed early by the block's content.
+package mdfence
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/markdown"
+)
+
+// Flags defines mdfence's flags on fs. Once fs is parsed, the function it
+// returns checks them and returns the transform.
+func Flags(fs *flag.FlagSet) func() (cli.TransformFunc, error) {
+	o := &options{
+		lang:  fs.String("lang", "", "info string (`language`) for blocks converted from indented code"),
+		style: fs.String("style", "backtick", "fence `character`: backtick or tilde"),
+	}
+	return func() (cli.TransformFunc, error) {
+		if *o.style != "backtick" && *o.style != "tilde" {
+			return nil, fmt.Errorf("unknown -style %q (want backtick or tilde)", *o.style)
+		}
+		return o.transform, nil
+	}
+}
+
+// options holds mdfence's flags.
+type options struct {
+	lang  *string
+	style *string
+}
+
+func (o *options) transform(content string) string {
+	lines := strings.Split(content, "\n")
+	i := markdown.FrontmatterEnd(lines)
+	result := append([]string(nil), lines[:i]...)
+
+	// inContainer is set inside a list item or footnote definition, where
+	// indented lines are continuation content rather than code. prevText is
+	// set after a paragraph line, which an indented code block can't
+	// interrupt.
+	inContainer, prevText := false, false
+
+	for i < len(lines) {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		indent := indentOf(line)
+
+		// Fenced code block: rewrite the fences, keep the content.
+		if indent < 4 || inContainer {
+			if ch, n, info, ok := openingFence(line); ok {
+				end := i + 1
+				for end < len(lines) && !isClosingFence(lines[end], ch, n) {
+					end++
+				}
+				if end == len(lines) {
+					// Unclosed: the block runs to the end of the document.
+					result = append(result, lines[i:]...)
+					break
+				}
+				prefix := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+				fence := o.fenceFor(lines[i+1:end], info)
+				result = append(result, prefix+fence+info)
+				result = append(result, lines[i+1:end]...)
+				result = append(result, prefix+fence)
+				i = end + 1
+				prevText = false
+				continue
+			}
+		}
+
+		if trimmed == "" {
+			result = append(result, line)
+			i++
+			prevText = false
+			continue
+		}
+
+		// Indented code block: runs until a non-blank line indented less than
+		// four columns; trailing blank lines aren't part of it.
+		if indent >= 4 && !inContainer && !prevText {
+			end, last := i, i
+			for end < len(lines) && (strings.TrimSpace(lines[end]) == "" || indentOf(lines[end]) >= 4) {
+				if strings.TrimSpace(lines[end]) != "" {
+					last = end
+				}
+				end++
+			}
+			var code []string
+			for _, l := range lines[i : last+1] {
+				code = append(code, dedent(l, 4))
+			}
+			fence := o.fenceFor(code, *o.lang)
+			result = append(result, fence+*o.lang)
+			result = append(result, code...)
+			result = append(result, fence)
+			i = last + 1
+			continue
+		}
+
+		switch {
+		case indent < 4 && (markdown.IsListItem(line) || markdown.IsFootnoteDefinition(line)):
+			inContainer = !markdown.IsHorizontalRule(line)
+		case indent < 4 && !prevText:
+			// A new top-level block after a blank line ends any list.
+			inContainer = false
+		}
+		prevText = !strings.HasPrefix(trimmed, "#") && !markdown.IsHorizontalRule(line)
+		result = append(result, line)
+		i++
+	}
+
+	output := strings.Join(result, "\n")
+	return strings.TrimRight(output, "\n") + "\n"
+}
+
+// openingFence parses a fence opener: three or more backticks or tildes and
+// an optional info string. Backtick fences can't have backticks in their info
+// string.
+func openingFence(line string) (ch byte, n int, info string, ok bool) {
+	t := strings.TrimLeft(line, " \t")
+	if len(t) < 3 || (t[0] != '`' && t[0] != '~') {
+		return 0, 0, "", false
+	}
+	ch = t[0]
+	for n < len(t) && t[n] == ch {
+		n++
+	}
+	if n < 3 {
+		return 0, 0, "", false
+	}
+	info = strings.TrimSpace(t[n:])
+	if ch == '`' && strings.Contains(info, "`") {
+		return 0, 0, "", false
+	}
+	return ch, n, info, true
+}
+
+// isClosingFence reports whether line closes a fence of n ch characters: a
+// run of at least n of them and nothing else.
+func isClosingFence(line string, ch byte, n int) bool {
+	t := strings.TrimSpace(line)
+	return len(t) >= n && strings.Trim(t, string(ch)) == ""
+}
+
+// fenceFor returns the fence for a block with the given content and info
+// string: the -style character, one longer than any run of it that starts a
+// content line, and at least three long.
+func (o *options) fenceFor(content []string, info string) string {
+	ch := byte('`')
+	if *o.style == "tilde" || strings.Contains(info, "`") {
+		ch = '~'
+	}
+	n := 3
+	for _, l := range content {
+		t := strings.TrimLeft(l, " \t")
+		run := 0
+		for run < len(t) && t[run] == ch {
+			run++
+		}
+		if run >= n {
+			n = run + 1
+		}
+	}
+	return strings.Repeat(string(ch), n)
+}
+
+// indentOf returns the width of line's leading whitespace, with tab stops
+// every four columns.
+func indentOf(line string) int {
+	n := 0
+	for _, c := range line {
+		switch c {
+		case ' ':
+			n++
+		case '\t':
+			n += 4 - n%4
+		default:
+			return n
+		}
+	}
+	return n
+}
+
+// dedent removes up to width columns of leading whitespace from line.
+func dedent(line string, width int) string {
+	col := 0
+	for i, c := range line {
+		switch {
+		case col >= width:
+			return line[i:]
+		case c == ' ':
+			col++
+		case c == '\t':
+			col += 4 - col%4
+		default:
+			return line[i:]
+		}
+	}
+	return ""
+}
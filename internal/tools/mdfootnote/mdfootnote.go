@@ -0,0 +1,178 @@
+// Package mdfootnote converts Tufte CSS sidenotes back to Markdown footnotes.
+package mdfootnote
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	htmltomd "github.com/JohannesKaufmann/html-to-markdown/v2"
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/markdown"
+)
+
+// Flags defines mdfootnote's flags on fs. Once fs is parsed, the function it
+// returns checks them and returns the transform.
+func Flags(fs *flag.FlagSet) func() (cli.TransformFunc, error) {
+	o := &options{
+		dialect: fs.String("dialect", markdown.DialectExtra, "footnote `syntax`: extra ([^n] definitions), mmd (inline [^text] where possible), or markua (inline ^[text] where possible)"),
+	}
+	return func() (cli.TransformFunc, error) {
+		if err := markdown.CheckFootnoteDialect(*o.dialect); err != nil {
+			return nil, err
+		}
+		return o.transform, nil
+	}
+}
+
+// options holds mdfootnote's flags.
+type options struct {
+	dialect *string
+}
+
+// sidenote represents a found sidenote in the document
+type sidenote struct {
+	start   int    // start position of the full sidenote HTML
+	end     int    // end position
+	number  int    // sidenote number
+	content string // HTML content (will be converted to markdown)
+}
+
+// sidenotePattern matches the sidenote HTML up to the content of its span,
+// which runs to the matching </span>.
+var sidenotePattern = regexp.MustCompile(
+	`\n<label for="sidenote-(\d+)" class="margin-toggle sidenote-number"(?: data-marker="[^"]*")?></label>\n` +
+		`<input type="checkbox" id="sidenote-\d+" class="margin-toggle"/>\n` +
+		`<span class="sidenote"(?: data-marker="[^"]*")?>`,
+)
+
+// closingSpan returns the position of the </span> that closes a span whose
+// content starts at pos, or -1 if there isn't one.
+func closingSpan(content string, pos int) int {
+	depth := 0
+	for {
+		opening := strings.Index(content[pos:], "<span")
+		closing := strings.Index(content[pos:], "</span>")
+		switch {
+		case closing < 0:
+			return -1
+		case opening >= 0 && opening < closing:
+			depth++
+			pos += opening + len("<span")
+		case depth == 0:
+			return pos + closing
+		default:
+			depth--
+			pos += closing + len("</span>")
+		}
+	}
+}
+
+// hiddenSpanPattern matches the hidden paren spans
+var hiddenSpanPattern = regexp.MustCompile(`<span class="hidden">\([^<]*</span>|<span class="hidden">\)[^<]*</span>`)
+
+func (o *options) transform(content string) string {
+	// Find all sidenotes
+	matches := sidenotePattern.FindAllStringSubmatchIndex(content, -1)
+	if len(matches) == 0 {
+		return content
+	}
+
+	var sidenotes []sidenote
+	end := 0
+	for _, match := range matches {
+		// match[0], match[1] = start of the sidenote and of its span content
+		// match[2], match[3] = sidenote number
+		if match[0] < end {
+			continue // inside the previous sidenote
+		}
+		closing := closingSpan(content, match[1])
+		if closing < 0 {
+			continue
+		}
+
+		numStr := content[match[2]:match[3]]
+		var num int
+		fmt.Sscanf(numStr, "%d", &num)
+
+		end = closing + len("</span>")
+		sidenotes = append(sidenotes, sidenote{
+			start:   match[0],
+			end:     end,
+			number:  num,
+			content: content[match[1]:closing],
+		})
+	}
+
+	// Sort by position (should already be in order, but be safe)
+	sort.Slice(sidenotes, func(i, j int) bool {
+		return sidenotes[i].start < sidenotes[j].start
+	})
+
+	// Build result
+	var result strings.Builder
+	var footnotes []string
+	lastEnd := 0
+
+	for _, sn := range sidenotes {
+		// Write content before this sidenote
+		result.WriteString(content[lastEnd:sn.start])
+
+		// Convert sidenote content to markdown
+		htmlContent := sn.content
+		// Remove hidden paren spans
+		htmlContent = hiddenSpanPattern.ReplaceAllString(htmlContent, "")
+		// Trim whitespace
+		htmlContent = strings.TrimSpace(htmlContent)
+
+		// Convert HTML to markdown
+		mdContent, err := htmltomd.ConvertString(htmlContent)
+		if err != nil {
+			// Fallback: use content as-is
+			mdContent = htmlContent
+		}
+		mdContent = strings.TrimSpace(mdContent)
+
+		// Write an inline footnote when the dialect has them
+		if inline, ok := markdown.InlineFootnote(mdContent, *o.dialect); ok {
+			result.WriteString(inline)
+			lastEnd = sn.end
+			continue
+		}
+
+		// Write footnote reference, numbering in order when some are inline
+		number := sn.number
+		if *o.dialect != markdown.DialectExtra {
+			number = len(footnotes) + 1
+		}
+		result.WriteString(fmt.Sprintf("[^%d]", number))
+
+		// Store footnote definition
+		for len(footnotes) < number {
+			footnotes = append(footnotes, "")
+		}
+		footnotes[number-1] = mdContent
+
+		lastEnd = sn.end
+	}
+
+	// Write remaining content
+	remaining := content[lastEnd:]
+	remaining = strings.TrimRight(remaining, "\n")
+	result.WriteString(remaining)
+
+	// Append footnote definitions
+	if len(footnotes) > 0 {
+		result.WriteString("\n")
+	}
+	for i, fn := range footnotes {
+		if fn != "" {
+			result.WriteString(fmt.Sprintf("\n[^%d]: %s", i+1, fn))
+		}
+	}
+	result.WriteString("\n")
+
+	return result.String()
+}
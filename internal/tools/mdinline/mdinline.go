@@ -0,0 +1,30 @@
+// Package mdinline converts reference-style Markdown links to inline links.
+package mdinline
+
+import (
+	"flag"
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/markdown/links"
+)
+
+// Flags defines mdinline's flags on fs. Once fs is parsed, the function it
+// returns checks them and returns the transform.
+func Flags(fs *flag.FlagSet) func() (cli.TransformFunc, error) {
+	o := &options{
+		images: fs.Bool("images", false, "convert reference-style images to inline ones too"),
+	}
+	return func() (cli.TransformFunc, error) {
+		return o.transform, nil
+	}
+}
+
+// options holds mdinline's flags.
+type options struct {
+	images *bool
+}
+
+// transform converts reference-style links, and with -images images, to
+// inline links.
+func (o *options) transform(content string) string {
+	return links.Inline(content, *o.images)
+}
@@ -0,0 +1,118 @@
+// Package mdjoin joins Markdown sentences into single-line paragraphs.
+package mdjoin
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/markdown"
+)
+
+// Flags defines mdjoin's flags on fs. Once fs is parsed, the function it
+// returns checks them and returns the transform.
+func Flags(fs *flag.FlagSet) func() (cli.TransformFunc, error) {
+	o := &options{
+		breaks:        fs.String("breaks", markdown.BreakKeep, "write hard line breaks as `style`: keep, spaces (two trailing spaces), or backslash"),
+		paragraphOnly: fs.Bool("paragraph-only", false, "join only the lines a sentence is wrapped across, keeping a line break after each sentence, for semantic line breaks"),
+	}
+	return func() (cli.TransformFunc, error) {
+		if err := markdown.CheckHardBreaks(*o.breaks); err != nil {
+			return nil, err
+		}
+		return o.transform, nil
+	}
+}
+
+// options holds mdjoin's flags.
+type options struct {
+	breaks        *string
+	paragraphOnly *bool
+}
+
+func (o *options) transform(content string) string {
+	return markdown.Transform(content, markdown.Handlers{
+		Paragraph:  o.join,
+		Blockquote: o.joinBlockquote,
+		ListItem:   o.joinListItem,
+		HardBreaks: *o.breaks,
+	})
+}
+
+// join joins lines into a single line or, with -paragraph-only, into a line
+// per sentence, joining only the lines a sentence was wrapped across.
+func (o *options) join(lines []string) []string {
+	if !*o.paragraphOnly {
+		return []string{joinLines(lines)}
+	}
+	var result []string
+	var sentence []string
+	for i, line := range lines {
+		sentence = append(sentence, line)
+		if text := joinLines(sentence); i == len(lines)-1 || endsSentence(text, joinLines(lines[i+1:i+2])) {
+			result = append(result, text)
+			sentence = nil
+		}
+	}
+	return result
+}
+
+// endsSentence reports whether text ends a sentence when next follows it.
+func endsSentence(text, next string) bool {
+	n := -1
+	for _, sentence := range markdown.SplitSentences(text + " " + next) {
+		n += len(sentence) + 1
+		if n == len(text) {
+			return true
+		}
+	}
+	return false
+}
+
+// joinBlockquote joins blockquote lines into single lines per paragraph.
+func (o *options) joinBlockquote(lines []string) []string {
+	return markdown.TransformBlockquote(lines, func(content []string) []string {
+		var result []string
+		for _, line := range o.join(content) {
+			result = append(result, "> "+line)
+		}
+		return result
+	})
+}
+
+// joinListItem joins a list item's text onto its marker line. The text after
+// each hard line break is joined onto a line of its own, indented under the
+// marker.
+func (o *options) joinListItem(lines []string) []string {
+	prefix := markdown.ListItemLead(lines[0])
+	indent := strings.Repeat(" ", len(prefix))
+	body := append([]string{lines[0][len(prefix):]}, lines[1:]...)
+	var result []string
+	start := 0
+	for i, line := range body {
+		text, brk := markdown.CutHardBreak(line)
+		if brk == "" && i < len(body)-1 {
+			continue
+		}
+		joined := o.join(append(body[start:i:i], text))
+		for j, text := range joined {
+			lead := indent
+			if len(result) == 0 {
+				lead = prefix
+			}
+			line := strings.TrimRight(lead+text, " ")
+			if j == len(joined)-1 {
+				line += brk
+			}
+			result = append(result, line)
+		}
+		start = i + 1
+	}
+	return result
+}
+
+// joinLines joins lines into a single line.
+func joinLines(lines []string) string {
+	text := strings.Join(lines, " ")
+	return strings.Join(strings.Fields(text), " ")
+}
@@ -0,0 +1,318 @@
+// Package mdlist normalizes list formatting: the bullet marker used by
+// unordered lists, ordered versus unordered items, and loose versus tight
+// spacing.
+package mdlist
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/markdown"
+)
+
+// Flags defines mdlist's flags on fs. Once fs is parsed, the function it
+// returns checks them and returns the transform.
+func Flags(fs *flag.FlagSet) func() (cli.TransformFunc, error) {
+	o := &options{
+		bullet:  fs.String("bullet", "", "`marker` for unordered items: -, *, or + (default: keep; - for items made unordered)"),
+		typ:     fs.String("type", "", "convert every item to this `type`: ordered or unordered (default: keep)"),
+		spacing: fs.String("spacing", "", "list `spacing`: tight or loose (default: keep)"),
+	}
+	return func() (cli.TransformFunc, error) {
+		if err := o.validateFlags(); err != nil {
+			return nil, err
+		}
+		return o.transform, nil
+	}
+}
+
+// options holds mdlist's flags.
+type options struct {
+	bullet  *string
+	typ     *string
+	spacing *string
+}
+
+func (o *options) validateFlags() error {
+	switch *o.bullet {
+	case "", "-", "*", "+":
+	default:
+		return fmt.Errorf("unknown -bullet %q (want -, *, or +)", *o.bullet)
+	}
+	switch *o.typ {
+	case "", "ordered", "unordered":
+	default:
+		return fmt.Errorf("unknown -type %q (want ordered or unordered)", *o.typ)
+	}
+	switch *o.spacing {
+	case "", "tight", "loose":
+	default:
+		return fmt.Errorf("unknown -spacing %q (want tight or loose)", *o.spacing)
+	}
+	return nil
+}
+
+// listItemRe matches a list item line: indentation, marker, and the spaces
+// between the marker and the item content.
+var listItemRe = regexp.MustCompile(`^([ \t]*)([-*+]|\d{1,9}[.)])( +)\S`)
+
+func (o *options) transform(content string) string {
+	lines := strings.Split(content, "\n")
+	i := markdown.FrontmatterEnd(lines)
+	result := append([]string(nil), lines[:i]...)
+
+	for i < len(lines) {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		// Fenced code block: pass through unchanged.
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence := trimmed[:3]
+			result = append(result, line)
+			i++
+			for i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), fence) {
+				result = append(result, lines[i])
+				i++
+			}
+			if i < len(lines) {
+				result = append(result, lines[i])
+				i++
+			}
+			continue
+		}
+
+		// A list starts with an item that isn't indented code.
+		if isItem(line) && indentOf(line) < 4 {
+			var list []string
+			list, i = o.convertList(lines, i)
+			result = append(result, list...)
+			continue
+		}
+
+		result = append(result, line)
+		i++
+	}
+
+	output := strings.Join(result, "\n")
+	return strings.TrimRight(output, "\n") + "\n"
+}
+
+// level is an open list item. Lines indented to at least its old content
+// column belong to it; they move by newCol-oldCol when its marker changes
+// width.
+type level struct {
+	oldCol, newCol int
+}
+
+// convertList rewrites the list starting at lines[start] and returns the
+// rewritten lines and the index of the first line after the list.
+func (o *options) convertList(lines []string, start int) ([]string, int) {
+	var (
+		out      []string
+		stack    []level
+		counters []int    // item number at each nesting depth
+		kinds    []string // marker kind of the current list at each depth
+		newKinds []string // the kind its markers are converted to
+		blanks   []string // blank lines held until we know what follows
+		fence    string   // open fence inside an item, if any
+		fenceAt  int      // shift applied to the open fence's lines
+		prevText bool     // previous line was non-blank item content
+	)
+	shift := func() int {
+		if len(stack) == 0 {
+			return 0
+		}
+		return stack[len(stack)-1].newCol - stack[len(stack)-1].oldCol
+	}
+
+	i := start
+	for ; i < len(lines); i++ {
+		line := lines[i]
+
+		if fence != "" {
+			out = append(out, reindent(line, fenceAt))
+			if strings.HasPrefix(strings.TrimSpace(line), fence) {
+				fence = ""
+			}
+			continue
+		}
+
+		if strings.TrimSpace(line) == "" {
+			if !continuesList(lines, i, stack) {
+				break
+			}
+			blanks = append(blanks, line)
+			prevText = false
+			continue
+		}
+
+		n := indentOf(line)
+
+		// Lazy continuation: paragraph text directly after item text, not
+		// indented to the item's content column.
+		if prevText && len(blanks) == 0 && n < stack[len(stack)-1].oldCol && !isItem(line) && markdown.IsFootnoteContinuation(line) {
+			out = append(out, line)
+			continue
+		}
+
+		for len(stack) > 0 && n < stack[len(stack)-1].oldCol {
+			stack = stack[:len(stack)-1]
+		}
+		depth := len(stack)
+		item := isItem(line) && (depth == 0 || n-stack[depth-1].oldCol < 4)
+		if depth == 0 && !item {
+			break
+		}
+
+		if !item {
+			out = append(out, blanks...)
+			blanks = nil
+			counters = counters[:min(depth, len(counters))]
+			kinds = kinds[:min(depth, len(kinds))]
+			newKinds = newKinds[:min(depth, len(newKinds))]
+			out = append(out, reindent(line, shift()))
+			if f := fenceOf(line); f != "" {
+				fence, fenceAt = f, shift()
+			}
+			prevText = fence == ""
+			continue
+		}
+
+		m := listItemRe.FindStringSubmatch(line)
+		marker, gap := m[2], m[3]
+
+		// A different kind of marker starts a new list, so the blank lines
+		// separating the two lists are kept and numbering restarts. When the
+		// conversion gives both lists the same kind of marker, an empty
+		// comment between them keeps them apart.
+		sibling := depth < len(kinds) && kinds[depth] == kindOf(marker)
+		switch {
+		case !sibling:
+			out = append(out, blanks...)
+			if depth < len(newKinds) && newKinds[depth] == kindOf(o.convertMarker(marker, 1)) {
+				indent := 0
+				if depth > 0 {
+					indent = stack[depth-1].newCol
+				}
+				out = append(out, strings.Repeat(" ", indent)+"<!-- -->")
+			}
+		case *o.spacing == "tight":
+		case *o.spacing == "loose" && len(blanks) == 0:
+			out = append(out, "")
+		default:
+			out = append(out, blanks...)
+		}
+		blanks = nil
+
+		for len(counters) <= depth {
+			counters = append(counters, 0)
+			kinds = append(kinds, "")
+			newKinds = append(newKinds, "")
+		}
+		counters, kinds, newKinds = counters[:depth+1], kinds[:depth+1], newKinds[:depth+1]
+		if !sibling {
+			counters[depth] = 0
+			kinds[depth] = kindOf(marker)
+		}
+		counters[depth]++
+
+		if len(gap) > 4 {
+			gap = " " // the rest is indented code; content starts after one space
+		}
+		newIndent := max(0, n+shift())
+		newMarker := o.convertMarker(marker, counters[depth])
+		newKinds[depth] = kindOf(newMarker)
+		rest := line[len(m[1])+len(marker):]
+		out = append(out, strings.Repeat(" ", newIndent)+newMarker+rest)
+		stack = append(stack, level{
+			oldCol: n + len(marker) + len(gap),
+			newCol: newIndent + len(newMarker) + len(gap),
+		})
+		if f := fenceOf(rest); f != "" {
+			fence, fenceAt = f, shift()
+		}
+		prevText = fence == ""
+	}
+
+	return out, i
+}
+
+// continuesList reports whether the blank line at lines[i] is inside the list:
+// the next non-blank line is another item or is indented under an open item.
+func continuesList(lines []string, i int, stack []level) bool {
+	for ; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) != "" {
+			break
+		}
+	}
+	if i == len(lines) || len(stack) == 0 {
+		return false
+	}
+	return isItem(lines[i]) || indentOf(lines[i]) >= stack[0].oldCol
+}
+
+// convertMarker returns the marker for an item whose original marker is
+// marker and whose position in its list is number.
+func (o *options) convertMarker(marker string, number int) string {
+	ordered := marker[0] >= '0' && marker[0] <= '9'
+	switch {
+	case *o.typ == "ordered" && !ordered:
+		return strconv.Itoa(number) + "."
+	case *o.bullet != "" && (*o.typ == "unordered" || !ordered):
+		return *o.bullet
+	case *o.typ == "unordered":
+		return "-"
+	}
+	return marker
+}
+
+// kindOf returns the bullet character of an unordered marker or the
+// delimiter of an ordered one; items of one list share a kind.
+func kindOf(marker string) string {
+	return marker[len(marker)-1:]
+}
+
+// isItem reports whether line starts a list item. Thematic breaks such as
+// "* * *" look like items but aren't.
+func isItem(line string) bool {
+	return listItemRe.MatchString(line) && !markdown.IsHorizontalRule(line)
+}
+
+// fenceOf returns the fence that s opens, if any.
+func fenceOf(s string) string {
+	t := strings.TrimSpace(s)
+	if strings.HasPrefix(t, "```") || strings.HasPrefix(t, "~~~") {
+		return t[:3]
+	}
+	return ""
+}
+
+// indentOf returns the width of line's leading whitespace, with tab stops
+// every four columns.
+func indentOf(line string) int {
+	n := 0
+	for _, c := range line {
+		switch c {
+		case ' ':
+			n++
+		case '\t':
+			n += 4 - n%4
+		default:
+			return n
+		}
+	}
+	return n
+}
+
+// reindent moves line's leading whitespace by shift columns.
+func reindent(line string, shift int) string {
+	if shift == 0 || strings.TrimSpace(line) == "" {
+		return line
+	}
+	rest := strings.TrimLeft(line, " \t")
+	return strings.Repeat(" ", max(0, indentOf(line)+shift)) + rest
+}
@@ -0,0 +1,367 @@
+// Package mdmath converts math delimiters between $...$/$$...$$,
+// \(...\)/\[...\], and fenced math blocks, so one source can target KaTeX,
+// MathJax, or GitHub.
+package mdmath
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/markdown"
+)
+
+// Flags defines mdmath's flags on fs. Once fs is parsed, the function it
+// returns checks them and returns the transform.
+func Flags(fs *flag.FlagSet) func() (cli.TransformFunc, error) {
+	o := &options{
+		inline:  fs.String("inline", "dollar", "inline math `style`: dollar ($x$), paren (\\(x\\)), or backtick ($`x`$)"),
+		display: fs.String("display", "dollar", "display math `style`: dollar ($$x$$), bracket (\\[x\\]), or fence (```math)"),
+	}
+	return func() (cli.TransformFunc, error) {
+		if *o.inline != "dollar" && *o.inline != "paren" && *o.inline != "backtick" {
+			return nil, fmt.Errorf("unknown -inline %q (want dollar, paren, or backtick)", *o.inline)
+		}
+		if *o.display != "dollar" && *o.display != "bracket" && *o.display != "fence" {
+			return nil, fmt.Errorf("unknown -display %q (want dollar, bracket, or fence)", *o.display)
+		}
+		return o.transform, nil
+	}
+}
+
+// options holds mdmath's flags.
+type options struct {
+	inline  *string
+	display *string
+}
+
+// Display delimiter pairs by style.
+var displayDelims = map[string][2]string{
+	"dollar":  {"$$", "$$"},
+	"bracket": {`\[`, `\]`},
+}
+
+func (o *options) transform(content string) string {
+	lines := strings.Split(content, "\n")
+	i := markdown.FrontmatterEnd(lines)
+	result := append([]string(nil), lines[:i]...)
+
+	var para []string
+	flush := func() {
+		if len(para) > 0 {
+			result = append(result, strings.Split(o.convertInline(strings.Join(para, "\n")), "\n")...)
+			para = nil
+		}
+	}
+
+	for i < len(lines) {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+
+		// Fenced code: a math fence is display math, anything else is code.
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			flush()
+			fence := fenceRun(trimmed)
+			end := i + 1
+			for end < len(lines) && !isClosingFence(lines[end], fence) {
+				end++
+			}
+			if strings.TrimSpace(trimmed[len(fence):]) == "math" && end < len(lines) {
+				result = append(result, o.displayBlock(indent, "fence", lines[i+1:end], false, lines[i:end+1])...)
+			} else {
+				result = append(result, lines[i:min(end+1, len(lines))]...)
+			}
+			i = end + 1
+			continue
+		}
+
+		// Indented code after a blank line.
+		if (strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t")) && len(para) == 0 &&
+			(len(result) == 0 || strings.TrimSpace(result[len(result)-1]) == "") {
+			for i < len(lines) && (strings.HasPrefix(lines[i], "    ") || strings.HasPrefix(lines[i], "\t") || strings.TrimSpace(lines[i]) == "") {
+				result = append(result, lines[i])
+				i++
+			}
+			continue
+		}
+
+		if style, body, end, single := displayAt(lines, i); style != "" {
+			flush()
+			result = append(result, o.displayBlock(indent, style, body, single, lines[i:end+1])...)
+			i = end + 1
+			continue
+		}
+
+		if trimmed == "" {
+			flush()
+			result = append(result, line)
+		} else {
+			para = append(para, line)
+		}
+		i++
+	}
+	flush()
+
+	output := strings.Join(result, "\n")
+	return strings.TrimRight(output, "\n") + "\n"
+}
+
+// fenceRun returns the run of fence characters a fence line starts with.
+func fenceRun(trimmed string) string {
+	n := 0
+	for n < len(trimmed) && trimmed[n] == trimmed[0] {
+		n++
+	}
+	return trimmed[:n]
+}
+
+func isClosingFence(line, fence string) bool {
+	trimmed := strings.TrimSpace(line)
+	return strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == ""
+}
+
+// displayAt reports whether a display math block starts at lines[i]: a line
+// starting with $$ or \[ whose closing delimiter ends the same or a later
+// line, before any blank line. It returns the style, the content lines, the
+// index of the closing line, and whether it is all on one line.
+func displayAt(lines []string, i int) (style string, body []string, end int, single bool) {
+	trimmed := strings.TrimSpace(lines[i])
+	for _, s := range []string{"dollar", "bracket"} {
+		d := displayDelims[s]
+		if !strings.HasPrefix(trimmed, d[0]) {
+			continue
+		}
+		rest := trimmed[len(d[0]):]
+		if strings.HasSuffix(rest, d[1]) && !strings.HasSuffix(rest, `\`+d[1]) && len(rest) > len(d[1]) {
+			inner := rest[:len(rest)-len(d[1])]
+			if strings.Contains(inner, d[1]) {
+				return "", nil, 0, false // "$$a$$ and $$b$$" is text
+			}
+			return s, []string{strings.TrimSpace(inner)}, i, true
+		}
+		if strings.Contains(rest, d[1]) {
+			return "", nil, 0, false
+		}
+		body = nil
+		if first := strings.TrimSpace(rest); first != "" {
+			body = append(body, first)
+		}
+		for j := i + 1; j < len(lines); j++ {
+			t := strings.TrimSpace(lines[j])
+			if t == "" {
+				return "", nil, 0, false
+			}
+			if strings.HasSuffix(t, d[1]) {
+				if last := strings.TrimSpace(strings.TrimSuffix(t, d[1])); last != "" {
+					body = append(body, strings.TrimRight(strings.TrimSuffix(lines[j], d[1]), " \t"))
+				}
+				return s, body, j, false
+			}
+			body = append(body, lines[j])
+		}
+		return "", nil, 0, false
+	}
+	return "", nil, 0, false
+}
+
+// displayBlock renders display math in the -display style. original is
+// returned unchanged when the math is already in that style.
+func (o *options) displayBlock(indent, from string, body []string, single bool, original []string) []string {
+	if from == *o.display {
+		return original
+	}
+	if *o.display == "fence" {
+		fence := "```"
+		for strings.Contains(strings.Join(body, "\n"), fence) {
+			fence += "`"
+		}
+		block := []string{indent + fence + "math"}
+		block = append(block, reindent(body, indent)...)
+		return append(block, indent+fence)
+	}
+	d := displayDelims[*o.display]
+	if single {
+		return []string{indent + d[0] + body[0] + d[1]}
+	}
+	block := []string{indent + d[0]}
+	block = append(block, reindent(body, indent)...)
+	return append(block, indent+d[1])
+}
+
+// reindent gives lines without indent the block's indent.
+func reindent(lines []string, indent string) []string {
+	out := make([]string, len(lines))
+	for i, line := range lines {
+		if strings.HasPrefix(line, indent) {
+			out[i] = line
+		} else {
+			out[i] = indent + line
+		}
+	}
+	return out
+}
+
+// convertInline converts the math spans in paragraph text.
+func (o *options) convertInline(text string) string {
+	var b strings.Builder
+	scanned := 0 // where the last $ that opened no span stopped looking
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == '`':
+			end := codeSpanEnd(text, i)
+			b.WriteString(text[i:end])
+			i = end
+			continue
+		case c == '\\' && i+1 < len(text):
+			var close, style string
+			switch text[i+1] {
+			case '(':
+				close, style = `\)`, "paren"
+			case '[':
+				close, style = `\]`, "bracket"
+			}
+			if style != "" {
+				if j := strings.Index(text[i+2:], close); j > 0 {
+					inner := text[i+2 : i+2+j]
+					end := i + 2 + j + 2
+					b.WriteString(o.renderSpan(style, inner, text[i:end]))
+					i = end
+					continue
+				}
+			}
+			// An escape: copy it and the escaped character.
+			b.WriteString(text[i : i+2])
+			i += 2
+			continue
+		case c == '$' && strings.HasPrefix(text[i:], "$$"):
+			if j := strings.Index(text[i+2:], "$$"); j > 0 {
+				end := i + 2 + j + 2
+				b.WriteString(o.renderSpan("dollar", text[i+2:i+2+j], text[i:end]))
+				i = end
+				continue
+			}
+			b.WriteString("$$")
+			i += 2
+			continue
+		case c == '$' && strings.HasPrefix(text[i:], "$`"):
+			if j := strings.Index(text[i+2:], "`$"); j > 0 {
+				end := i + 2 + j + 2
+				b.WriteString(o.renderSpan("backtick", text[i+2:i+2+j], text[i:end]))
+				i = end
+				continue
+			}
+		case c == '$' && i >= scanned:
+			// A $ before where the last one stopped looking has no closing
+			// $ either, so it isn't looked for again.
+			end, stop := dollarEnd(text, i)
+			if end > 0 {
+				b.WriteString(o.renderSpan("inline-dollar", text[i+1:end-1], text[i:end]))
+				i = end
+				continue
+			}
+			scanned = stop
+		}
+		b.WriteByte(c)
+		i++
+	}
+	return b.String()
+}
+
+// renderSpan renders math found as span style from in the target style,
+// returning original when the style is unchanged. "dollar" and "bracket"
+// are display math; the others are inline.
+func (o *options) renderSpan(from, inner, original string) string {
+	if from == "dollar" || from == "bracket" {
+		to := *o.display
+		if to == "fence" {
+			to = "dollar"
+		}
+		if from == to {
+			return original
+		}
+		d := displayDelims[to]
+		return d[0] + inner + d[1]
+	}
+	to := *o.inline
+	if to == "dollar" {
+		to = "inline-dollar"
+	}
+	if from == to {
+		return original
+	}
+	switch to {
+	case "paren":
+		return `\(` + inner + `\)`
+	case "backtick":
+		return "$`" + inner + "`$"
+	}
+	return "$" + strings.TrimSpace(inner) + "$"
+}
+
+// dollarEnd returns the end of the $...$ span opening at i, or -1 and where
+// it stopped looking. Like Pandoc, the opening $ must be followed by a
+// non-space, and the closing $ preceded by a non-space and not followed by a
+// digit, so "$5 and $10" is text. A span never contains $$, a blank line, or
+// a code span.
+func dollarEnd(text string, i int) (end, stop int) {
+	if i+1 >= len(text) || strings.ContainsRune(" \t\n$", rune(text[i+1])) {
+		return -1, i + 1
+	}
+	for j := i + 1; j < len(text); j++ {
+		switch text[j] {
+		case '\\':
+			j++
+		case '`':
+			n := len(text[j:]) - len(strings.TrimLeft(text[j:], "`"))
+			if codeSpanEnd(text, j) > j+n {
+				return -1, j // a code span starts before this span ends
+			}
+			j += n - 1
+		case '\n':
+			if j+1 < len(text) && text[j+1] == '\n' {
+				return -1, j
+			}
+		case '$':
+			if j+1 < len(text) && text[j+1] == '$' {
+				return -1, j // display math starts before this span ends
+			}
+			if strings.ContainsRune(" \t\n", rune(text[j-1])) {
+				continue
+			}
+			if j+1 < len(text) && text[j+1] >= '0' && text[j+1] <= '9' {
+				continue
+			}
+			return j + 1, j + 1
+		}
+	}
+	return -1, len(text)
+}
+
+// codeSpanEnd returns the end of the code span opening at i, or the end of
+// the backtick run when it isn't closed.
+func codeSpanEnd(text string, i int) int {
+	n := 0
+	for i+n < len(text) && text[i+n] == '`' {
+		n++
+	}
+	run := text[i : i+n]
+	for j := i + n; j < len(text); {
+		k := strings.Index(text[j:], run)
+		if k < 0 {
+			break
+		}
+		k += j
+		m := 0
+		for k+m < len(text) && text[k+m] == '`' {
+			m++
+		}
+		if m == n {
+			return k + n
+		}
+		j = k + m
+	}
+	return i + n
+}
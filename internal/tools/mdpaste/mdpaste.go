@@ -0,0 +1,497 @@
+// Package mdpaste turns rich text copied from Google Docs, Word, or a web page
+// into tidy Markdown.
+package mdpaste
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/JohannesKaufmann/html-to-markdown/v2/converter"
+	"github.com/JohannesKaufmann/html-to-markdown/v2/plugin/base"
+	"github.com/JohannesKaufmann/html-to-markdown/v2/plugin/commonmark"
+	"github.com/JohannesKaufmann/html-to-markdown/v2/plugin/strikethrough"
+	"github.com/JohannesKaufmann/html-to-markdown/v2/plugin/table"
+	"github.com/dbh/md-tools/internal/cli"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Flags defines mdpaste's flags on fs. Once fs is parsed, the function it
+// returns checks them and returns the transform.
+func Flags(fs *flag.FlagSet) func() (cli.TransformFunc, error) {
+	o := &options{
+		top:    fs.Int("top", 1, "`level` of the highest heading (1-6)"),
+		inline: fs.Bool("inline", false, "keep links inline instead of numbered references"),
+	}
+	return func() (cli.TransformFunc, error) {
+		if *o.top < 1 || *o.top > 6 {
+			return nil, fmt.Errorf("-top must be between 1 and 6")
+		}
+		return o.transform, nil
+	}
+}
+
+// options holds mdpaste's flags.
+type options struct {
+	top    *int
+	inline *bool
+}
+
+var (
+	listItemRe   = regexp.MustCompile(`^([ \t]*)([-*+]|\d{1,9}[.)])[ \t]`)
+	msoLevelRe   = regexp.MustCompile(`level(\d)`)
+	orderedRe    = regexp.MustCompile(`^\(?[0-9A-Za-z]{1,4}[.)]$`)
+	headingAtoms = map[atom.Atom]int{atom.H1: 1, atom.H2: 2, atom.H3: 3, atom.H4: 4, atom.H5: 5, atom.H6: 6}
+)
+
+// reference is a link destination collected while rendering.
+type reference struct {
+	url   string
+	title string
+}
+
+func (o *options) transform(content string) string {
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mdpaste: %v\n", err)
+		return content
+	}
+	clean(doc)
+	convertWordLists(doc)
+	o.normalizeHeadings(doc)
+
+	var refs []reference
+	output, err := o.newConverter(&refs).ConvertNode(doc)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mdpaste: %v\n", err)
+		return content
+	}
+
+	lines := tightenLists(strings.Split(string(output), "\n"))
+	var result strings.Builder
+	result.WriteString(strings.TrimRight(strings.Join(lines, "\n"), "\n") + "\n")
+	if len(refs) > 0 {
+		result.WriteString("\n")
+		for i, ref := range refs {
+			if ref.title != "" {
+				fmt.Fprintf(&result, "[%d]: %s %q\n", i+1, ref.url, ref.title)
+			} else {
+				fmt.Fprintf(&result, "[%d]: %s\n", i+1, ref.url)
+			}
+		}
+	}
+	return result.String()
+}
+
+// tightenLists removes the blank line the converter puts between a list
+// item's text and its nested list, which would make the whole list loose.
+func tightenLists(lines []string) []string {
+	var result []string
+	fence := ""
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case fence != "":
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			fence = trimmed[:3]
+		case trimmed == "" && len(result) > 0 && i+1 < len(lines):
+			prev := listItemRe.FindStringSubmatch(result[len(result)-1])
+			next := listItemRe.FindStringSubmatch(lines[i+1])
+			if prev != nil && next != nil && len(next[1]) > len(prev[1]) {
+				continue
+			}
+		}
+		result = append(result, line)
+	}
+	return result
+}
+
+// newConverter returns a converter with GitHub Flavored Markdown tables and
+// strikethrough that, unless -inline is set, renders links as numbered
+// references and appends their destinations to refs.
+func (o *options) newConverter(refs *[]reference) *converter.Converter {
+	c := converter.NewConverter(
+		converter.WithPlugins(
+			base.NewBasePlugin(),
+			commonmark.NewCommonmarkPlugin(
+				commonmark.WithEmDelimiter("_"),
+				commonmark.WithHorizontalRule("---"),
+			),
+			table.NewTablePlugin(),
+			strikethrough.NewStrikethroughPlugin(),
+		),
+	)
+	if !*o.inline {
+		numbers := make(map[reference]int)
+		c.Register.RendererFor("a", converter.TagTypeInline, func(ctx converter.Context, w converter.Writer, n *html.Node) converter.RenderStatus {
+			href := strings.TrimSpace(attr(n, "href"))
+			if href == "" || strings.HasPrefix(href, "#") {
+				return converter.RenderTryNext
+			}
+			var buf bytes.Buffer
+			ctx.RenderChildNodes(ctx, &buf, n)
+			text := bytes.TrimSpace(buf.Bytes())
+			if len(text) == 0 {
+				return converter.RenderTryNext
+			}
+			ref := reference{
+				url:   ctx.AssembleAbsoluteURL(ctx, "a", href),
+				title: strings.ReplaceAll(attr(n, "title"), "\n", " "),
+			}
+			if strings.ContainsAny(ref.url, " \t") {
+				ref.url = "<" + ref.url + ">"
+			}
+			num, ok := numbers[ref]
+			if !ok {
+				*refs = append(*refs, ref)
+				num = len(*refs)
+				numbers[ref] = num
+			}
+			// Keep the spaces that pasted links often carry inside them.
+			if buf.Len() > 0 && buf.Bytes()[0] == ' ' {
+				w.WriteByte(' ')
+			}
+			fmt.Fprintf(w, "[%s][%d]", text, num)
+			if buf.Len() > 1 && buf.Bytes()[buf.Len()-1] == ' ' {
+				w.WriteByte(' ')
+			}
+			return converter.RenderSuccess
+		}, converter.PriorityEarly)
+	}
+	return c
+}
+
+// clean rewrites the styling that word processors express with inline styles
+// as plain elements: bold, italic, and struck-through spans get <strong>,
+// <em>, and <del>; a Google Docs "<b style=font-weight:normal>" wrapper is
+// unwrapped; Word titles become headings; emphasis inside headings is
+// dropped; list items lose their paragraph wrappers and misplaced nested
+// lists move into the item before them; non-breaking spaces become spaces.
+func clean(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		clean(c)
+		c = next
+	}
+
+	switch n.Type {
+	case html.TextNode:
+		n.Data = strings.ReplaceAll(n.Data, "\u00a0", " ")
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+
+	style := parseStyle(attr(n, "style"))
+	switch n.DataAtom {
+	case atom.B, atom.Strong:
+		if w := style["font-weight"]; w == "normal" || w == "400" {
+			unwrap(n)
+			return
+		}
+	case atom.P:
+		if hasClass(n, "MsoTitle") {
+			n.DataAtom, n.Data = atom.H1, "h1"
+		}
+	case atom.Li:
+		var paragraphs []*html.Node
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.DataAtom == atom.P {
+				paragraphs = append(paragraphs, c)
+			}
+		}
+		if len(paragraphs) == 1 {
+			unwrap(paragraphs[0])
+		}
+	case atom.Ul, atom.Ol:
+		if p := n.Parent; p != nil && (p.DataAtom == atom.Ul || p.DataAtom == atom.Ol) {
+			prev := n.PrevSibling
+			for prev != nil && prev.Type != html.ElementNode {
+				prev = prev.PrevSibling
+			}
+			if prev != nil && prev.DataAtom == atom.Li {
+				p.RemoveChild(n)
+				prev.AppendChild(n)
+			}
+		}
+	}
+	if _, ok := headingAtoms[n.DataAtom]; ok {
+		for _, el := range findAll(n, atom.B, atom.Strong, atom.I, atom.Em) {
+			unwrap(el)
+		}
+		return
+	}
+
+	if n.DataAtom != atom.Span && n.DataAtom != atom.Font {
+		return
+	}
+	if insideHeading(n) {
+		return
+	}
+	var wrappers []atom.Atom
+	if w := style["font-weight"]; w == "bold" || w == "bolder" || numericWeight(w) >= 600 {
+		wrappers = append(wrappers, atom.Strong)
+	}
+	if style["font-style"] == "italic" || style["font-style"] == "oblique" {
+		wrappers = append(wrappers, atom.Em)
+	}
+	if strings.Contains(style["text-decoration"], "line-through") || strings.Contains(style["text-decoration-line"], "line-through") {
+		wrappers = append(wrappers, atom.Del)
+	}
+	for _, a := range wrappers {
+		wrapChildren(n, a)
+	}
+}
+
+// convertWordLists replaces runs of Word's list paragraphs, which carry their
+// level in an "mso-list" style and a typed-out bullet or number, with nested
+// <ul> and <ol> elements.
+func convertWordLists(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if _, ok := msoList(c); !ok {
+			convertWordLists(c)
+			continue
+		}
+
+		// Collect the run of list paragraphs, skipping whitespace between.
+		var run []*html.Node
+		for item := c; item != nil; item = item.NextSibling {
+			if item.Type == html.TextNode && strings.TrimSpace(item.Data) == "" {
+				continue
+			}
+			if _, ok := msoList(item); !ok {
+				break
+			}
+			run = append(run, item)
+		}
+
+		type open struct {
+			list  *html.Node
+			level int
+		}
+		var stack []open
+		var root *html.Node
+		for _, p := range run {
+			level, _ := msoList(p)
+			ordered := orderedRe.MatchString(removeMsoMarker(p))
+			for len(stack) > 0 && stack[len(stack)-1].level > level {
+				stack = stack[:len(stack)-1]
+			}
+			if len(stack) == 0 || stack[len(stack)-1].level < level {
+				list := newElement(atom.Ul)
+				if ordered {
+					list = newElement(atom.Ol)
+				}
+				if len(stack) == 0 {
+					root = list
+				} else if parent := stack[len(stack)-1].list.LastChild; parent != nil {
+					parent.AppendChild(list)
+				} else {
+					stack[len(stack)-1].list.AppendChild(list)
+				}
+				stack = append(stack, open{list, level})
+			}
+			li := newElement(atom.Li)
+			for p.FirstChild != nil {
+				child := p.FirstChild
+				p.RemoveChild(child)
+				li.AppendChild(child)
+			}
+			stack[len(stack)-1].list.AppendChild(li)
+		}
+
+		n.InsertBefore(root, c)
+		last := run[len(run)-1]
+		for item := c; item != nil; {
+			next := item.NextSibling
+			n.RemoveChild(item)
+			if item == last {
+				break
+			}
+			item = next
+		}
+		c = root
+	}
+}
+
+// msoList reports the list level of a Word list paragraph.
+func msoList(n *html.Node) (int, bool) {
+	if n.Type != html.ElementNode || n.DataAtom != atom.P {
+		return 0, false
+	}
+	list, ok := parseStyle(attr(n, "style"))["mso-list"]
+	if !ok || list == "ignore" {
+		return 0, false
+	}
+	level := 1
+	if m := msoLevelRe.FindStringSubmatch(list); m != nil {
+		level, _ = strconv.Atoi(m[1])
+	}
+	return level, true
+}
+
+// removeMsoMarker removes the typed-out bullet or number of a Word list
+// paragraph and returns its text.
+func removeMsoMarker(p *html.Node) string {
+	var marker string
+	var walk func(*html.Node) bool
+	walk = func(n *html.Node) bool {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.ElementNode && parseStyle(attr(c, "style"))["mso-list"] == "ignore" {
+				for _, t := range findText(c) {
+					marker += t
+				}
+				n.RemoveChild(c)
+				return true
+			}
+			if walk(c) {
+				return true
+			}
+		}
+		return false
+	}
+	walk(p)
+	return strings.TrimSpace(strings.ReplaceAll(marker, "\u00a0", " "))
+}
+
+// normalizeHeadings renumbers the document's heading levels so the highest
+// is -top and no level is skipped.
+func (o *options) normalizeHeadings(doc *html.Node) {
+	var headings []*html.Node
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if _, ok := headingAtoms[n.DataAtom]; ok && n.Type == html.ElementNode {
+			headings = append(headings, n)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	var levels []int
+	seen := make(map[int]bool)
+	for _, h := range headings {
+		if l := headingAtoms[h.DataAtom]; !seen[l] {
+			seen[l] = true
+			levels = append(levels, l)
+		}
+	}
+	sort.Ints(levels)
+	renumber := make(map[int]int)
+	for i, l := range levels {
+		renumber[l] = min(*o.top+i, 6)
+	}
+	for _, h := range headings {
+		level := renumber[headingAtoms[h.DataAtom]]
+		h.Data = "h" + strconv.Itoa(level)
+		h.DataAtom = atom.Lookup([]byte(h.Data))
+	}
+}
+
+// parseStyle parses a style attribute into lowercased properties and values.
+func parseStyle(style string) map[string]string {
+	props := make(map[string]string)
+	for _, decl := range strings.Split(style, ";") {
+		if k, v, ok := strings.Cut(decl, ":"); ok {
+			props[strings.ToLower(strings.TrimSpace(k))] = strings.ToLower(strings.TrimSpace(v))
+		}
+	}
+	return props
+}
+
+// numericWeight returns a numeric font-weight, or 0.
+func numericWeight(w string) int {
+	n, _ := strconv.Atoi(w)
+	return n
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasClass(n *html.Node, class string) bool {
+	for _, c := range strings.Fields(attr(n, "class")) {
+		if strings.EqualFold(c, class) {
+			return true
+		}
+	}
+	return false
+}
+
+func insideHeading(n *html.Node) bool {
+	for p := n.Parent; p != nil; p = p.Parent {
+		if _, ok := headingAtoms[p.DataAtom]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func newElement(a atom.Atom) *html.Node {
+	return &html.Node{Type: html.ElementNode, DataAtom: a, Data: a.String()}
+}
+
+// unwrap replaces n with its children.
+func unwrap(n *html.Node) {
+	parent := n.Parent
+	for n.FirstChild != nil {
+		c := n.FirstChild
+		n.RemoveChild(c)
+		parent.InsertBefore(c, n)
+	}
+	parent.RemoveChild(n)
+}
+
+// wrapChildren moves the children of n into a new element a inside n.
+func wrapChildren(n *html.Node, a atom.Atom) {
+	wrapper := newElement(a)
+	for n.FirstChild != nil {
+		c := n.FirstChild
+		n.RemoveChild(c)
+		wrapper.AppendChild(c)
+	}
+	n.AppendChild(wrapper)
+}
+
+// findAll returns the descendants of n that are any of the given elements.
+func findAll(n *html.Node, atoms ...atom.Atom) []*html.Node {
+	var found []*html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		for _, a := range atoms {
+			if c.Type == html.ElementNode && c.DataAtom == a {
+				found = append(found, c)
+				break
+			}
+		}
+		found = append(found, findAll(c, atoms...)...)
+	}
+	return found
+}
+
+// findText returns the text nodes under n in document order.
+func findText(n *html.Node) []string {
+	var texts []string
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.TextNode {
+			texts = append(texts, c.Data)
+		}
+		texts = append(texts, findText(c)...)
+	}
+	return texts
+}
@@ -0,0 +1,198 @@
+// Package mdreading annotates a document with its estimated reading time, as a
+// reading_time frontmatter field or as an inline badge.
+package mdreading
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/markdown"
+)
+
+// Flags defines mdreading's flags on fs. Once fs is parsed, the function it
+// returns checks them and returns the transform.
+func Flags(fs *flag.FlagSet) func() (cli.TransformFunc, error) {
+	o := &options{
+		badge:    fs.Bool("badge", false, "add a badge under the title instead of a reading_time frontmatter field"),
+		sections: fs.Int("sections", 0, "also add a badge under every heading of this `level` (2-6)"),
+		wpm:      fs.Int("wpm", 200, "reading speed in `words` per minute"),
+	}
+	return func() (cli.TransformFunc, error) {
+		if *o.sections != 0 && (*o.sections < 2 || *o.sections > 6) {
+			return nil, fmt.Errorf("-sections must be between 2 and 6")
+		}
+		if *o.wpm < 1 {
+			return nil, fmt.Errorf("-wpm must be positive")
+		}
+		return o.transform, nil
+	}
+}
+
+// options holds mdreading's flags.
+type options struct {
+	badge    *bool
+	sections *int
+	wpm      *int
+}
+
+const markerName = "reading-time"
+
+var (
+	badgeRe   = regexp.MustCompile(`^` + regexp.QuoteMeta(markdown.MarkerOpen(markerName)) + `.*` + regexp.QuoteMeta(markdown.MarkerClose(markerName)) + `$`)
+	headingRe = regexp.MustCompile(`^(#{1,6})[ \t]`)
+	urlRe     = regexp.MustCompile(`\]\([^)]*\)|<[a-zA-Z][^>]*>|https?://\S+`)
+)
+
+func (o *options) transform(content string) string {
+	lines := removeBadges(strings.Split(content, "\n"))
+	end := markdown.FrontmatterEnd(lines)
+	head, body := lines[:end], lines[end:]
+	code := codeLines(body)
+	total := o.minutes(countWords(body, code))
+
+	var result []string
+	if *o.sections > 0 {
+		body, code = o.sectionBadges(body, code)
+	}
+	field := fmt.Sprintf("%d min", total)
+	if *o.badge {
+		// An existing field is kept up to date, but none is added.
+		if _, ok := markdown.FrontmatterField(head, "reading_time"); ok {
+			head = markdown.SetFrontmatterField(head, "reading_time", field)
+		}
+		result = append(head, titleBadge(body, code, total)...)
+	} else {
+		result = append(markdown.SetFrontmatterField(head, "reading_time", field), body...)
+	}
+
+	output := strings.Join(result, "\n")
+	return strings.TrimRight(output, "\n") + "\n"
+}
+
+// badgeLine returns the badge for a reading time.
+func badgeLine(min int) string {
+	return fmt.Sprintf("%s_%d min read_%s", markdown.MarkerOpen(markerName), min, markdown.MarkerClose(markerName))
+}
+
+// removeBadges drops badge lines outside code, each with the blank line
+// inserted after it.
+func removeBadges(lines []string) []string {
+	code := codeLines(lines)
+	var result []string
+	for i := 0; i < len(lines); i++ {
+		if !code[i] && badgeRe.MatchString(strings.TrimSpace(lines[i])) {
+			if i+1 < len(lines) && strings.TrimSpace(lines[i+1]) == "" {
+				i++
+			}
+			continue
+		}
+		result = append(result, lines[i])
+	}
+	return result
+}
+
+// titleBadge inserts the document badge after a leading "# " title, or at the
+// top of body when there is none.
+func titleBadge(body []string, code []bool, min int) []string {
+	first := 0
+	for first < len(body) && strings.TrimSpace(body[first]) == "" {
+		first++
+	}
+	if first < len(body) && !code[first] && strings.HasPrefix(body[first], "# ") {
+		return insertAfterHeading(body, first, badgeLine(min))
+	}
+	return append([]string{badgeLine(min), ""}, body...)
+}
+
+// sectionBadges inserts a badge under every heading of level -sections with
+// the reading time of that section, and returns the new lines and code mask.
+func (o *options) sectionBadges(body []string, code []bool) ([]string, []bool) {
+	var headings []int
+	for i, line := range body {
+		if m := headingRe.FindStringSubmatch(line); m != nil && !code[i] && len(m[1]) == *o.sections {
+			headings = append(headings, i)
+		}
+	}
+	// Work from the bottom so earlier indexes stay valid.
+	for k := len(headings) - 1; k >= 0; k-- {
+		h := headings[k]
+		end := h + 1
+		for end < len(body) {
+			m := headingRe.FindStringSubmatch(body[end])
+			if m != nil && !code[end] && len(m[1]) <= *o.sections {
+				break
+			}
+			end++
+		}
+		min := o.minutes(countWords(body[h+1:end], code[h+1:end]))
+		body = insertAfterHeading(body, h, badgeLine(min))
+	}
+	return body, codeLines(body)
+}
+
+// insertAfterHeading inserts line after the heading at lines[h], separated
+// from it and from what follows by blank lines.
+func insertAfterHeading(lines []string, h int, line string) []string {
+	at := h + 1
+	insert := []string{"", line, ""}
+	if at < len(lines) && strings.TrimSpace(lines[at]) == "" {
+		at++
+		insert = insert[1:]
+	}
+	if at >= len(lines) {
+		insert = insert[:len(insert)-1]
+	}
+	result := append([]string(nil), lines[:at]...)
+	result = append(result, insert...)
+	return append(result, lines[at:]...)
+}
+
+// codeLines reports which lines are inside fenced code blocks, fences
+// included.
+func codeLines(lines []string) []bool {
+	code := make([]bool, len(lines))
+	fence := ""
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case fence != "":
+			code[i] = true
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			code[i] = true
+			fence = trimmed[:3]
+		}
+	}
+	return code
+}
+
+// countWords counts the words of prose in lines, skipping code, HTML
+// comments, URLs, and tokens without a letter or digit (markup such as "#"
+// or "-").
+func countWords(lines []string, code []bool) int {
+	n := 0
+	for i, line := range lines {
+		if code[i] || strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t") ||
+			strings.HasPrefix(strings.TrimSpace(line), "<!--") || markdown.IsLinkRefDefinition(line) {
+			continue
+		}
+		for _, field := range strings.Fields(urlRe.ReplaceAllString(line, " ")) {
+			if strings.IndexFunc(field, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) >= 0 {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// minutes converts a word count to whole minutes, rounding up, with a
+// minimum of one.
+func (o *options) minutes(words int) int {
+	return max(1, (words+*o.wpm-1) / *o.wpm)
+}
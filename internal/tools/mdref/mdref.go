@@ -0,0 +1,571 @@
+// Package mdref converts inline Markdown links to reference-style links.
+package mdref
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/markdown"
+	"github.com/dbh/md-tools/internal/markdown/links"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Flags defines mdref's flags on fs. Once fs is parsed, the function it
+// returns checks them and returns the transform.
+func Flags(fs *flag.FlagSet) func() (cli.TransformFunc, error) {
+	o := &options{
+		merge:     fs.Bool("merge", false, "keep the existing reference definitions and their labels, numbering only new URLs after them"),
+		images:    fs.Bool("images", false, "convert images to reference style too, sharing definitions with links to the same URL"),
+		labels:    fs.String("labels", "numeric", "label new references by `strategy`: numeric, slug (of the link text), domain (of the URL), or text (the link text itself)"),
+		autolinks: fs.Bool("autolinks", false, "convert autolinks, <https://…> and bare URLs, to reference links with the URL's host and path as their text"),
+		placement: fs.String("placement", "end", "put new definitions at the `end` of the document, or after the section or paragraph each is first used in"),
+		sort:      fs.String("sort", "none", "sort new definitions by `order`: none (as first used), number, label, or url"),
+		align:     fs.Bool("align", false, "pad definitions after the colon so their destinations line up"),
+		group:     fs.Int("group", 0, "put at most `n` definitions in a block, with a blank line between blocks (0 for no limit)"),
+	}
+	return func() (cli.TransformFunc, error) {
+		switch *o.labels {
+		case "numeric", "slug", "domain", "text":
+		default:
+			return nil, fmt.Errorf("unknown -labels %q (want numeric, slug, domain, or text)", *o.labels)
+		}
+		switch *o.placement {
+		case "end", "section", "paragraph":
+		default:
+			return nil, fmt.Errorf("unknown -placement %q (want end, section, or paragraph)", *o.placement)
+		}
+		switch *o.sort {
+		case "none", "number", "label", "url":
+		default:
+			return nil, fmt.Errorf("unknown -sort %q (want none, number, label, or url)", *o.sort)
+		}
+		if *o.group < 0 {
+			return nil, fmt.Errorf("-group %d is negative", *o.group)
+		}
+		return o.transform, nil
+	}
+}
+
+// options holds mdref's flags.
+type options struct {
+	merge     *bool
+	images    *bool
+	labels    *string
+	autolinks *bool
+	placement *string
+	sort      *string
+	align     *bool
+	group     *int
+}
+
+// linkInfo represents a link or image found in the document with its
+// position
+type linkInfo struct {
+	start int    // start position in content (byte offset)
+	end   int    // end position in content (byte offset)
+	text  string // link text, or an image's alt text, as written
+	texts int    // the byte offset of text
+	url   string // destination URL
+	title string // optional title, as written with its quotes
+	label string // its reference's label, normalized, or "" for an inline link
+	auto  bool   // whether it is an autolink, whose text is made from its URL
+}
+
+// reference holds the label, URL, and title of a reference definition
+type reference struct {
+	label string
+	url   string
+	title string
+}
+
+// refKey returns the key links to url with title share a definition by.
+func refKey(url, title string) string {
+	if title != "" {
+		return url + "\x00" + title
+	}
+	return url
+}
+
+// md parses documents and collects their reference definitions. It parses
+// footnotes, so the links in their bodies are converted too, even in one
+// nothing refers to.
+var md = goldmark.New(goldmark.WithExtensions(links.Footnotes))
+
+// linkify is md for -autolinks, which finds bare URLs as GFM does.
+var linkify = goldmark.New(goldmark.WithExtensions(links.Footnotes, extension.Linkify))
+
+// transform converts inline links to reference-style links. With -merge,
+// existing definitions stay where they are, links keep the labels they
+// have, and an inline link takes the label of a definition of its URL, or
+// else the number after the highest one defined.
+func (o *options) transform(content string) string {
+	source := []byte(content)
+
+	parser := md.Parser()
+	if *o.autolinks {
+		parser = linkify.Parser()
+	}
+	doc := parser.Parse(text.NewReader(source))
+
+	// Find the reference definitions, to exclude them from the output. The
+	// first definition of a label is the one that counts.
+	var defRanges []markdown.ByteRange
+	labels := make(map[string]string) // -merge: definitions' labels by refKey
+	used := make(map[string]bool)     // -merge: the labels defined, normalized
+	next := 1                         // -merge: the number new labels start at
+	defs := links.CollectRefDefs(doc, source)
+	for _, def := range defs {
+		used[def.Label] = true
+		defRanges = append(defRanges, def.Range)
+		if _, ok := labels[refKey(def.Destination, def.Title)]; !ok {
+			labels[refKey(def.Destination, def.Title)] = def.Written
+		}
+		if n, err := strconv.Atoi(def.Label); err == nil && n >= next {
+			next = n + 1
+		}
+	}
+	excludeRanges := markdown.NewRangeSet(defRanges)
+	all := links.CollectLinks(doc, source, defs)
+
+	// A label doc still uses after conversion keeps its definition, and is
+	// taken.
+	kept := links.Used(doc, source, all, func(link links.Link) bool { return o.converts(link, source) })
+	links := o.collect(all, source)
+	var dropRanges []markdown.ByteRange
+	for _, def := range defs {
+		if !kept[def.Label] {
+			dropRanges = append(dropRanges, def.Range)
+		}
+	}
+	dropped := markdown.NewRangeSet(dropRanges)
+	if !*o.merge {
+		labels, used, next = make(map[string]string), make(map[string]bool), 1
+		for label := range kept {
+			used[label] = true
+		}
+	}
+	exclude := func(s string, offset int) string {
+		if *o.merge {
+			return s
+		}
+		return dropped.Exclude(s, offset)
+	}
+
+	// Text in brackets that isn't a link, as [2] isn't until [2]: is
+	// defined, would become one if a new definition took its label.
+	from := 0
+	for _, link := range links {
+		reserveBracketed(used, source[from:max(from, link.start)], from, excludeRanges)
+		from = max(from, link.end)
+	}
+	reserveBracketed(used, source[from:], from, excludeRanges)
+
+	// convert returns links[i] in reference style, with the links inside
+	// its text, such as the image of a linked image, converted too, and the
+	// index of the link after them.
+	var refs []reference
+	breaks := o.breaks(doc, source)
+	pending := make(map[int][]reference) // new definitions by the break they go before
+	var convert func(i int) (string, int)
+	convert = func(i int) (string, int) {
+		link := links[i]
+		var text strings.Builder
+		j := i + 1
+		open, written := "[", string(source[link.start:link.end])
+		if link.auto {
+			text.WriteString(link.text)
+		} else {
+			pos := link.texts
+			for j < len(links) && links[j].end <= link.texts+len(link.text) {
+				text.Write(source[pos:links[j].start])
+				inner, after := convert(j)
+				text.WriteString(inner)
+				pos, j = links[j].end, after
+			}
+			text.Write(source[pos : link.texts+len(link.text)])
+			open = string(source[link.start:link.texts])
+			written = open + text.String() + string(source[link.texts+len(link.text):link.end])
+		}
+
+		// With -merge, a reference link already has its label.
+		if *o.merge && link.label != "" {
+			return written, j
+		}
+
+		// Get or assign the reference's label
+		key := refKey(link.url, link.title)
+		label, exists := labels[key]
+		if !exists {
+			link.text = text.String()
+			label = o.newLabel(link, used, &next)
+			labels[key] = label
+			ref := reference{label: label, url: link.url, title: link.title}
+			if b := sort.SearchInts(breaks, link.start+1); b < len(breaks) {
+				pending[breaks[b]] = append(pending[breaks[b]], ref)
+			} else {
+				refs = append(refs, ref)
+			}
+		}
+
+		// A shortcut reference that already names its label, as text like
+		// [1] or [ 1] does once [1]: is defined, is kept as written.
+		switch {
+		case written == open+text.String()+"]" && normalize(text.String()) == normalize(label):
+			return written, j
+		case label == text.String():
+			return open + label + "][]", j
+		}
+		return open + text.String() + "][" + label + "]", j
+	}
+
+	// Build output excluding reference definitions
+	var result strings.Builder
+	lastEnd := 0
+	// write writes source[from:to], excluding reference definitions, with
+	// the definitions pending at the breaks within it.
+	write := func(from, to int) {
+		for _, b := range breaks[sort.SearchInts(breaks, from+1):] {
+			if b > to {
+				break
+			}
+			if len(pending[b]) == 0 {
+				continue
+			}
+			result.WriteString(exclude(string(source[from:b]), from))
+			if !*o.merge || !endsWithDefinition(result.String()) {
+				before := strings.TrimRight(result.String(), "\n")
+				result.Reset()
+				result.WriteString(before + "\n\n")
+			}
+			o.writeDefinitions(&result, pending[b])
+			result.WriteString("\n")
+			from = b
+		}
+		result.WriteString(exclude(string(source[from:to]), from))
+	}
+	for i := 0; i < len(links); {
+		// A link that overlaps the one before, as one whose destination
+		// couldn't be told from what follows may, is left as it is.
+		if links[i].start < lastEnd {
+			i++
+			continue
+		}
+		// Write content before this link, but skip reference definition ranges
+		write(lastEnd, links[i].start)
+		lastEnd = links[i].end
+		var converted string
+		converted, i = convert(i)
+		result.WriteString(converted)
+	}
+
+	// Write remaining content, excluding reference definitions
+	write(lastEnd, len(source))
+	remaining := strings.TrimRight(result.String(), "\n") + "\n"
+	result.Reset()
+	result.WriteString(remaining)
+
+	// Append new reference definitions, outside any code block left open.
+	// Merged into a block of definitions that ends the document, they
+	// follow it directly.
+	if len(refs) > 0 {
+		if fence := markdown.UnclosedFence(doc, source); fence != "" {
+			result.WriteString(fence + "\n")
+		}
+		if !*o.merge || !endsWithDefinition(result.String()) {
+			result.WriteString("\n")
+		}
+		o.writeDefinitions(&result, refs)
+	}
+
+	return result.String()
+}
+
+// converts reports whether link is one to convert: an inline link, the
+// images and autolinks the flags ask for, or a reference link, which stays
+// as it is with -merge but may have links to convert in its text.
+func (o *options) converts(link links.Link, source []byte) bool {
+	if link.Start < 0 {
+		return false
+	}
+	switch n := link.Node.(type) {
+	case *ast.Image:
+		// Images without alt text are left as they are.
+		if !*o.images || !n.HasChildren() {
+			return false
+		}
+	case *ast.AutoLink:
+		return *o.autolinks && n.AutoLinkType == ast.AutoLinkURL && convertible(n, source, link.Start)
+	}
+	// An inline link or image where a definition's or a link's destination
+	// would be would make one of what is around it in reference style.
+	return link.Label != "" || !atDestination(link.Node, source, link.Start) && !inDestination(link.Node, source, link.Start)
+}
+
+// collect returns the links of all, which links.CollectLinks returned, that
+// are to be converted, in order.
+func (o *options) collect(all []links.Link, source []byte) []linkInfo {
+	var found []linkInfo
+	for _, link := range all {
+		if !o.converts(link, source) {
+			continue
+		}
+		if link.Auto() {
+			found = append(found, linkInfo{start: link.Start, end: link.End, text: autolinkText(link.Destination), url: link.Destination, auto: true})
+			continue
+		}
+		found = append(found, linkInfo{
+			start: link.Start,
+			end:   link.End,
+			text:  string(source[link.Text.Start:link.Text.End]),
+			texts: link.Text.Start,
+			url:   link.Destination,
+			title: link.Title,
+			label: link.Label,
+		})
+	}
+	return found
+}
+
+// breaks returns the offsets of the lines that new definitions can go
+// before by -placement: the top-level headings after the frontmatter, for
+// section, or every top-level block but a definition, for paragraph. There
+// are none for end.
+func (o *options) breaks(doc ast.Node, source []byte) []int {
+	if *o.placement == "end" {
+		return nil
+	}
+	after := 0
+	lines := strings.SplitAfter(string(source), "\n")
+	for _, line := range lines[:markdown.FrontmatterEnd(lines)] {
+		after += len(line)
+	}
+	var breaks []int
+	for n := doc.FirstChild(); n != nil; n = n.NextSibling() {
+		switch {
+		case n.Kind() == ast.KindLinkReferenceDefinition:
+			continue
+		case *o.placement == "section" && n.Kind() != ast.KindHeading:
+			continue
+		}
+		// A block's position may be past its line's indent or marker.
+		pos := n.Pos()
+		if pos < 0 {
+			continue
+		}
+		pos = bytes.LastIndexByte(source[:pos], '\n') + 1
+		if pos > after && (len(breaks) == 0 || pos > breaks[len(breaks)-1]) {
+			breaks = append(breaks, pos)
+		}
+	}
+	return breaks
+}
+
+// writeDefinitions writes refs to result as reference definitions, one per
+// line, in the -sort order and in blocks of at most -group, each aligned by
+// -align.
+func (o *options) writeDefinitions(result *strings.Builder, refs []reference) {
+	refs = append([]reference(nil), refs...)
+	sort.SliceStable(refs, func(i, j int) bool { return o.less(refs[i], refs[j]) })
+	for len(refs) > 0 {
+		block := refs
+		if *o.group > 0 && len(block) > *o.group {
+			block = refs[:*o.group]
+		}
+		width := 0
+		for _, ref := range block {
+			width = max(width, utf8.RuneCountInString(ref.label))
+		}
+		for _, ref := range block {
+			pad := ""
+			if *o.align {
+				pad = strings.Repeat(" ", width-utf8.RuneCountInString(ref.label))
+			}
+			if ref.title != "" {
+				fmt.Fprintf(result, "[%s]: %s%s %s\n", ref.label, pad, markdown.Destination(ref.url), ref.title)
+			} else {
+				fmt.Fprintf(result, "[%s]: %s%s\n", ref.label, pad, markdown.Destination(ref.url))
+			}
+		}
+		if refs = refs[len(block):]; len(refs) > 0 {
+			result.WriteString("\n")
+		}
+	}
+}
+
+// less reports whether a sorts before b by -sort. Numbered labels sort by
+// number, before the others, which sort by label.
+func (o *options) less(a, b reference) bool {
+	switch *o.sort {
+	case "number":
+		m, errA := strconv.Atoi(a.label)
+		n, errB := strconv.Atoi(b.label)
+		switch {
+		case errA == nil && errB == nil:
+			return m < n
+		case errA == nil || errB == nil:
+			return errA == nil
+		}
+		return normalize(a.label) < normalize(b.label)
+	case "label":
+		return normalize(a.label) < normalize(b.label)
+	case "url":
+		return a.url < b.url
+	}
+	return false
+}
+
+// newLabel returns a label for link's new definition by the -labels strategy
+// that isn't in used, and records it there. Numbers count up from next; other
+// labels that are taken get a suffix, -2, -3, and so on. A link whose text or
+// URL gives no label is numbered.
+func (o *options) newLabel(link linkInfo, used map[string]bool, next *int) string {
+	base := ""
+	switch *o.labels {
+	case "slug":
+		base = markdown.Slug(link.text)
+	case "domain":
+		if u, err := url.Parse(link.url); err == nil {
+			base = strings.TrimPrefix(u.Hostname(), "www.")
+		}
+	case "text":
+		if !strings.ContainsAny(link.text, "[]") {
+			base = strings.Join(strings.Fields(link.text), " ")
+		}
+	}
+	label := base
+	for n := 2; base == "" || used[normalize(label)]; n++ {
+		if base == "" {
+			label = strconv.Itoa(*next)
+			*next++
+			if !used[label] {
+				break
+			}
+			continue
+		}
+		label = base + "-" + strconv.Itoa(n)
+	}
+	used[normalize(label)] = true
+	return label
+}
+
+// convertible reports whether the autolink at offset i in source can be
+// converted to a link without changing what is around it: not in a link's
+// text, where a link can't be, nor where the link would make more Markdown
+// of the text, as atDestination and afterAngle describe.
+func convertible(link *ast.AutoLink, source []byte, i int) bool {
+	for n := link.Parent(); n != nil; n = n.Parent() {
+		if n.Kind() == ast.KindLink {
+			return false
+		}
+	}
+	return !atDestination(link, source, i) && !afterAngle(source, i)
+}
+
+// labelColonRe matches the start of a definition, up to its destination,
+// or of what was one before its label was converted to a link, as "[0][1]:".
+var labelColonRe = regexp.MustCompile(`^ {0,3}(?:\[[^\]]*\])+:\s*$`)
+
+// atDestination reports whether link, at offset i in source, is where a
+// definition's destination would be, after a "[label]:" that starts its
+// paragraph. A paragraph like "[1]:<x:>y" or "[1]:[a](b )" isn't a
+// definition, but would be one with the link converted.
+func atDestination(link ast.Node, source []byte, i int) bool {
+	return labelColonRe.Match(textBefore(link, source, i))
+}
+
+// inDestination reports whether link, at offset i in source, follows a
+// "](" in its paragraph that no ")" closes. It may be in the destination or
+// title of what isn't a link, as in `[](0 "[](x)")`, but would be one with
+// the link converted.
+func inDestination(link ast.Node, source []byte, i int) bool {
+	before := textBefore(link, source, i)
+	open := bytes.LastIndex(before, []byte("]("))
+	return open >= 0 && bytes.IndexByte(before[open:], ')') < 0
+}
+
+// textBefore returns the text of the block link is in, up to offset i in
+// source, without the markers of the blocks around it.
+func textBefore(link ast.Node, source []byte, i int) []byte {
+	block := link.Parent()
+	for block != nil && block.Type() != ast.TypeBlock {
+		block = block.Parent()
+	}
+	if block == nil {
+		return nil
+	}
+	var before []byte
+	lines := block.Lines()
+	for k := 0; k < lines.Len() && lines.At(k).Start < i; k++ {
+		before = append(before, source[lines.At(k).Start:min(lines.At(k).Stop, i)]...)
+	}
+	return before
+}
+
+// afterAngle reports whether offset i in source follows a "<" with no space
+// or ">" between them. An autolink there, as in "<x:<y:z>>", could make what
+// is around it an autolink once converted.
+func afterAngle(source []byte, i int) bool {
+	j := i - 1
+	for j >= 0 && !strings.ContainsRune(" \t\r\n<>", rune(source[j])) {
+		j--
+	}
+	return j >= 0 && source[j] == '<'
+}
+
+// autolinkText returns the text of a link made from an autolink to dest: its
+// host, without "www.", and path, with the characters that would be Markdown
+// escaped. A URL with no host is its own text.
+func autolinkText(dest string) string {
+	text := dest
+	if u, err := url.Parse(dest); err == nil && u.Host != "" {
+		text = strings.TrimPrefix(u.Host, "www.") + strings.TrimSuffix(u.EscapedPath(), "/")
+	}
+	var b strings.Builder
+	for _, r := range text {
+		if strings.ContainsRune("\\`*_[]<>", r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// bracketedRe matches text in brackets, which is a shortcut reference once
+// its label is defined.
+var bracketedRe = regexp.MustCompile(`\[([^\[\]]+)\]`)
+
+// reserveBracketed records in used the labels of the text in brackets in
+// text, which starts at offset in the document, outside the definitions in
+// skip.
+func reserveBracketed(used map[string]bool, text []byte, offset int, skip markdown.RangeSet) {
+	for _, m := range bracketedRe.FindAllSubmatchIndex(text, -1) {
+		if !skip.Covers(offset+m[0], offset+m[1]) {
+			used[normalize(string(text[m[2]:m[3]]))] = true
+		}
+	}
+}
+
+// normalize returns label as labels are matched: case-folded, with its
+// spaces collapsed.
+func normalize(label string) string {
+	return string(util.ToLinkReference([]byte(label)))
+}
+
+// endsWithDefinition reports whether the last line of s is a link reference
+// definition.
+func endsWithDefinition(s string) bool {
+	s = strings.TrimRight(s, "\n")
+	return markdown.IsLinkRefDefinition(s[strings.LastIndexByte(s, '\n')+1:])
+}
@@ -0,0 +1,658 @@
+// Package mdsidenote converts Markdown footnotes to Tufte CSS sidenotes.
+package mdsidenote
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/corpus"
+	"github.com/dbh/md-tools/internal/markdown"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	extast "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Flags defines mdsidenote's flags on fs. Once fs is parsed, the function it
+// returns checks them and returns the transform.
+func Flags(fs *flag.FlagSet) func() (cli.TransformFunc, error) {
+	setup := MapFlags(fs)
+	return func() (cli.TransformFunc, error) {
+		transform, _, err := setup()
+		return transform, err
+	}
+}
+
+// MapFlags is Flags for cmd/mdsidenote, which writes -sourcemap. The
+// function it returns also returns one that encodes, as JSON, the source
+// map of the last document transformed. The registry has no -sourcemap: its
+// tools write nothing but the document.
+func MapFlags(fs *flag.FlagSet) func() (cli.TransformFunc, func() ([]byte, error), error) {
+	o := &options{
+		dialect: fs.String("dialect", markdown.DialectExtra, "footnote `syntax`: extra ([^label]), mmd (adds [^inline text]), or markua (adds ^[inline] and [^^endnote])"),
+		marker:  fs.String("marker", "number", "sidenote `marker`: number (left to the theme's counter), letter (a, b, … z, aa), or symbol (*, †, ‡, §, ‖, ¶, **)"),
+	}
+	return func() (cli.TransformFunc, func() ([]byte, error), error) {
+		if err := markdown.CheckFootnoteDialect(*o.dialect); err != nil {
+			return nil, nil, err
+		}
+		if *o.marker != "number" && *o.marker != "letter" && *o.marker != "symbol" {
+			return nil, nil, fmt.Errorf("unknown -marker %q (want number, letter, or symbol)", *o.marker)
+		}
+		return o.transform, o.encodeSourceMap, nil
+	}
+}
+
+// options holds mdsidenote's flags, and the sidenotes of the last document
+// transformed.
+type options struct {
+	dialect   *string
+	marker    *string
+	sidenotes []mapSidenote
+}
+
+// sourceMap is what -sourcemap writes: where each sidenote came from.
+// Offsets are in bytes, and a range's end is exclusive.
+type sourceMap struct {
+	Version   int           `json:"version"`
+	Sidenotes []mapSidenote `json:"sidenotes"`
+}
+
+// mapSidenote maps a footnote reference to the sidenote that replaced it.
+// A footnote referenced twice is in the map twice.
+type mapSidenote struct {
+	ID         string    `json:"id"`
+	Label      string    `json:"label,omitempty"`      // empty for an inline footnote
+	Source     mapRange  `json:"source"`               // the reference, or the whole inline footnote
+	Definition *mapRange `json:"definition,omitempty"` // "[^label]: ..."
+	Output     mapRange  `json:"output"`               // the label, input, and span written for it
+}
+
+// mapRange is a byte range in the input or the output.
+type mapRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// symbols are the traditional note markers, in order. Past the last, they
+// start again doubled, then tripled.
+var symbols = []string{"*", "†", "‡", "§", "‖", "¶"}
+
+// markerAttr returns the data-marker attribute for the nth sidenote, or ""
+// for numbers, which Tufte CSS draws with a counter. A theme shows the
+// others with content: attr(data-marker).
+func (o *options) markerAttr(n int) string {
+	var marker string
+	switch *o.marker {
+	case "letter":
+		marker = strings.Repeat(string(rune('a'+(n-1)%26)), (n-1)/26+1)
+	case "symbol":
+		marker = strings.Repeat(symbols[(n-1)%len(symbols)], (n-1)/len(symbols)+1)
+	default:
+		return ""
+	}
+	return fmt.Sprintf(" data-marker=\"%s\"", marker)
+}
+
+// md parses documents and renders footnote content. It is built once: a
+// goldmark instance is safe for concurrent use.
+var md = goldmark.New(
+	goldmark.WithExtensions(extension.Footnote),
+	goldmark.WithRendererOptions(html.WithUnsafe()),
+)
+
+var (
+	// linkDefRe matches a reference link definition line, [label]: url.
+	linkDefRe = regexp.MustCompile(`(?m)^\[([^\]]+)\]:[ \t]*(\S+).*$`)
+	// refLinkRe matches [text][label], [label][], and [label].
+	refLinkRe      = regexp.MustCompile(`\[([^\]]+)\]\[([^\]]*)\]|\[([^\]]+)\](?:\[([^\]]*)\])?`)
+	fullRefRe      = regexp.MustCompile(`\[([^\]]+)\]\[([^\]]+)\]`)
+	collapsedRefRe = regexp.MustCompile(`\[([^\]]+)\]\[\]`)
+	// numberedUseRe and numberedDefRe match uses and definitions of numeric
+	// link labels, for renumbering.
+	numberedUseRe = regexp.MustCompile(`\]\[(\d+)\]`)
+	numberedDefRe = regexp.MustCompile(`(?m)^\[(\d+)\]:`)
+)
+
+// footnoteRef represents a footnote reference in the document
+type footnoteRef struct {
+	start int // byte position of [^label]
+	end   int // byte position after [^label]
+	index int // the footnote index (from goldmark)
+}
+
+// footnoteDef represents a footnote definition
+type footnoteDef struct {
+	start      int    // byte position of [^label]: ...
+	end        int    // byte position after the definition
+	ref        string // the footnote reference label
+	content    string // the rendered HTML content
+	rawContent string // the raw markdown content (for reference tracking)
+}
+
+// linkDef represents a reference-style link definition
+type linkDef struct {
+	label string
+	url   string
+	start int // byte position in source
+	end   int // byte position after definition
+}
+
+func (o *options) transform(content string) string {
+	content, reps := markdown.NormalizeFootnotes(content, *o.dialect, corpus.CodeRanges([]byte(content)))
+	source := []byte(content)
+
+	ctx := parser.NewContext()
+	reader := text.NewReader(source)
+	doc := md.Parser().Parse(reader, parser.WithContext(ctx))
+
+	// Collect link reference definitions
+	linkDefs := collectLinkDefs(source, ctx)
+
+	// Locate footnote markup once rather than searching the source for each
+	// footnote, which is quadratic in footnote-heavy documents.
+	refStarts := footnoteRefStarts(source)
+	defStarts := footnoteDefStarts(source)
+
+	// Collect footnote references and definitions
+	var refs []footnoteRef
+	var linkIndexes []int             // of each reference, in order
+	labels := make(map[int]string)    // keyed by index
+	defs := make(map[int]footnoteDef) // keyed by index
+
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+
+		switch node := n.(type) {
+		case *extast.FootnoteLink:
+			linkIndexes = append(linkIndexes, node.Index)
+
+		case *extast.Footnote:
+			labels[node.Index] = string(node.Ref)
+
+			// Get the footnote content
+			refLabel := string(node.Ref)
+			rawContent := extractFootnoteRawContent(node, source)
+
+			// Find the definition extent in source
+			start, end := findFootnoteDefExtent(refLabel, defStarts, source)
+			if start >= 0 && end >= 0 {
+				defs[node.Index] = footnoteDef{
+					start:      start,
+					end:        end,
+					ref:        refLabel,
+					rawContent: rawContent,
+				}
+			}
+		}
+
+		return ast.WalkContinue, nil
+	})
+
+	// Find each reference in the source: the next [^label] with its label.
+	// A footnote may be referenced more than once.
+	next := 0
+	for _, index := range linkIndexes {
+		label := labels[index]
+		for next < len(refStarts) && footnoteRefLabel(source, refStarts[next]) != label {
+			next++
+		}
+		if next == len(refStarts) {
+			break
+		}
+		start := refStarts[next]
+		refs = append(refs, footnoteRef{
+			start: start,
+			end:   start + len("[^]") + len(label),
+			index: index,
+		})
+		next++
+	}
+
+	// Assign sidenote numbers in order of appearance
+	sidenoteNum := make(map[int]int) // goldmark index -> sidenote number
+	nextNum := 1
+	for _, ref := range refs {
+		if _, exists := sidenoteNum[ref.index]; !exists {
+			sidenoteNum[ref.index] = nextNum
+			nextNum++
+		}
+	}
+
+	// Track which link references are used in footnotes vs body
+	footnoteRefs := make(map[string]bool)
+	for _, def := range defs {
+		for label := range findRefLinksInText(def.rawContent) {
+			footnoteRefs[label] = true
+		}
+	}
+
+	// Determine which references are used in body (non-footnote) text
+	bodyRefs := findBodyRefLinks(source, defs)
+
+	// References to keep: used in body text
+	// References to remove: only used in footnotes
+	refsToRemove := make(map[string]bool)
+	for label := range footnoteRefs {
+		if !bodyRefs[label] {
+			refsToRemove[label] = true
+		}
+	}
+
+	// Render footnote content with reference links resolved
+	linkMap := make(map[string]string)
+	for _, ld := range linkDefs {
+		linkMap[ld.label] = ld.url
+	}
+	var buf bytes.Buffer
+	for idx, def := range defs {
+		htmlContent := renderFootnoteContentWithRefs(def.rawContent, linkMap, &buf)
+		def.content = htmlContent
+		defs[idx] = def
+	}
+
+	// Build the set of ranges to exclude: footnote definitions, and link
+	// definitions only used in footnotes
+	var excludeRanges []markdown.ByteRange
+	for _, def := range defs {
+		excludeRanges = append(excludeRanges, markdown.ByteRange{Start: def.start, End: def.end})
+	}
+	for _, ld := range linkDefs {
+		if refsToRemove[ld.label] {
+			excludeRanges = append(excludeRanges, markdown.ByteRange{Start: ld.start, End: ld.end})
+		}
+	}
+	excluded := markdown.NewRangeSet(excludeRanges)
+
+	// Build output
+	var result strings.Builder
+	var sidenotes []mapSidenote
+	lastEnd := 0
+
+	for _, ref := range refs {
+		// Write content before this ref, excluding definition ranges
+		before := excluded.Exclude(string(source[lastEnd:ref.start]), lastEnd)
+		result.WriteString(before)
+
+		// Get the sidenote number and content
+		num := sidenoteNum[ref.index]
+		def, hasDef := defs[ref.index]
+
+		if hasDef {
+			sidenotes = append(sidenotes, mapEntry(ref, def, num, reps, result.Len()))
+
+			// Write the sidenote HTML
+			marker := o.markerAttr(num)
+			result.WriteString(fmt.Sprintf("\n<label for=\"sidenote-%d\" class=\"margin-toggle sidenote-number\"%s></label>\n", num, marker))
+			result.WriteString(fmt.Sprintf("<input type=\"checkbox\" id=\"sidenote-%d\" class=\"margin-toggle\"/>\n", num))
+			result.WriteString(fmt.Sprintf("<span class=\"sidenote\"%s>", marker))
+			result.WriteString("<span class=\"hidden\">(</span>")
+			result.WriteString(def.content)
+			result.WriteString("<span class=\"hidden\">)</span>")
+			result.WriteString("</span>")
+			sidenotes[len(sidenotes)-1].Output.End = result.Len()
+		} else {
+			// No definition found, leave the reference as-is
+			result.WriteString(string(source[ref.start:ref.end]))
+		}
+
+		lastEnd = ref.end
+	}
+
+	// Write remaining content, excluding definitions
+	remaining := excluded.Exclude(string(source[lastEnd:]), lastEnd)
+
+	// Renumber remaining link references
+	remaining = renumberLinkRefs(remaining, linkDefs, refsToRemove)
+
+	remaining = strings.TrimRight(remaining, "\n") + "\n"
+	result.WriteString(remaining)
+
+	o.sidenotes = sidenotes
+	return result.String()
+}
+
+// mapEntry returns the source map entry for the sidenote numbered num that
+// replaces ref, to be written at start in the output. Positions in the
+// source are traced back through reps, the replacements that made it, to
+// the document as given.
+func mapEntry(ref footnoteRef, def footnoteDef, num int, reps []markdown.Replacement, start int) mapSidenote {
+	entry := mapSidenote{
+		ID:     fmt.Sprintf("sidenote-%d", num),
+		Label:  def.ref,
+		Source: mapRange{markdown.OriginalOffset(reps, ref.start), markdown.OriginalOffset(reps, ref.end)},
+		Output: mapRange{Start: start},
+	}
+	defStart, defEnd := markdown.OriginalOffset(reps, def.start), markdown.OriginalOffset(reps, def.end)
+	if defStart == defEnd {
+		// An inline footnote's definition was made up for it.
+		entry.Label = ""
+	} else {
+		entry.Definition = &mapRange{defStart, defEnd}
+	}
+	return entry
+}
+
+// encodeSourceMap encodes the source map of the last document transformed.
+func (o *options) encodeSourceMap() ([]byte, error) {
+	sidenotes := o.sidenotes
+	if sidenotes == nil {
+		sidenotes = []mapSidenote{}
+	}
+	data, err := json.MarshalIndent(sourceMap{Version: 1, Sidenotes: sidenotes}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// footnoteRefStarts returns the byte positions of the footnote references
+// ([^label] not followed by a colon) in source, in order.
+func footnoteRefStarts(source []byte) []int {
+	var starts []int
+	for i := 0; i < len(source)-2; i++ {
+		if source[i] == '[' && source[i+1] == '^' {
+			// Find the closing ]
+			end := i + 2
+			for end < len(source) && source[end] != ']' && source[end] != '\n' {
+				end++
+			}
+			if end < len(source) && source[end] == ']' {
+				// Check if this is a reference (not a definition - no colon after)
+				afterClose := end + 1
+				if afterClose >= len(source) || source[afterClose] != ':' {
+					starts = append(starts, i)
+				}
+			}
+		}
+	}
+	return starts
+}
+
+// footnoteDefStarts maps each footnote label to the byte position of its
+// first [^label]: in source.
+func footnoteDefStarts(source []byte) map[string]int {
+	starts := make(map[string]int)
+	for i := 0; i < len(source)-2; i++ {
+		if source[i] != '[' || source[i+1] != '^' {
+			continue
+		}
+		end := i + 2
+		for end < len(source) && source[end] != ']' && source[end] != '\n' {
+			end++
+		}
+		if end+1 < len(source) && source[end] == ']' && source[end+1] == ':' {
+			label := string(source[i+2 : end])
+			if _, seen := starts[label]; !seen {
+				starts[label] = i
+			}
+		}
+	}
+	return starts
+}
+
+// footnoteRefLabel returns the label of the footnote reference at start, one
+// of the positions from footnoteRefStarts.
+func footnoteRefLabel(source []byte, start int) string {
+	end := start + bytes.IndexByte(source[start:], ']')
+	return string(source[start+2 : end])
+}
+
+// findFootnoteDefExtent finds the byte range of a footnote definition
+func findFootnoteDefExtent(label string, defStarts map[string]int, source []byte) (int, int) {
+	idx, ok := defStarts[label]
+	if !ok {
+		// footnoteDefStarts only sees labels on one line.
+		if idx = bytes.Index(source, []byte("[^"+label+"]:")); idx < 0 {
+			return -1, -1
+		}
+	}
+
+	// Find the end of the definition - it continues until:
+	// - A blank line followed by non-indented content, or
+	// - Another footnote definition, or
+	// - End of file
+	start := idx
+	end := idx
+
+	// Skip to end of current line
+	for end < len(source) && source[end] != '\n' {
+		end++
+	}
+	if end < len(source) {
+		end++ // include the newline
+	}
+
+	// Continue through continuation lines (indented or blank)
+	for end < len(source) {
+		lineStart := end
+		lineEnd := end
+
+		// Find end of line
+		for lineEnd < len(source) && source[lineEnd] != '\n' {
+			lineEnd++
+		}
+
+		line := source[lineStart:lineEnd]
+
+		// Check if this is a continuation
+		if len(line) == 0 {
+			// Blank line - might be part of definition, continue
+			end = lineEnd
+			if end < len(source) {
+				end++
+			}
+			continue
+		}
+
+		// Check for indentation (continuation)
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') {
+			end = lineEnd
+			if end < len(source) {
+				end++
+			}
+			continue
+		}
+
+		// Check for another footnote definition
+		if bytes.HasPrefix(line, []byte("[^")) {
+			break
+		}
+
+		// Non-indented, non-blank line - end of definition
+		break
+	}
+
+	return start, end
+}
+
+// collectLinkDefs finds all reference-style link definitions in the source.
+// A line that only looks like one, such as a lazy continuation of a
+// paragraph, isn't a definition to the parser and is skipped.
+func collectLinkDefs(source []byte, ctx parser.Context) []linkDef {
+	var defs []linkDef
+	matches := linkDefRe.FindAllSubmatchIndex(source, -1)
+
+	for _, match := range matches {
+		// Skip footnote definitions [^label]:
+		label := string(source[match[2]:match[3]])
+		if strings.HasPrefix(label, "^") {
+			continue
+		}
+		if _, ok := ctx.Reference(util.ToLinkReference([]byte(label))); !ok {
+			continue
+		}
+
+		defs = append(defs, linkDef{
+			label: label,
+			url:   string(source[match[4]:match[5]]),
+			start: match[0],
+			end:   match[1] + 1, // include newline
+		})
+	}
+
+	return defs
+}
+
+// extractFootnoteRawContent extracts the raw markdown content from a footnote
+func extractFootnoteRawContent(node *extast.Footnote, source []byte) string {
+	var buf bytes.Buffer
+
+	for child := node.FirstChild(); child != nil; child = child.NextSibling() {
+		if para, ok := child.(*ast.Paragraph); ok {
+			if para.Lines().Len() > 0 {
+				for i := 0; i < para.Lines().Len(); i++ {
+					line := para.Lines().At(i)
+					buf.Write(line.Value(source))
+				}
+			}
+		}
+	}
+
+	return strings.TrimSpace(buf.String())
+}
+
+// findRefLinksInText finds all reference-style link labels used in text
+func findRefLinksInText(text string) map[string]bool {
+	refs := make(map[string]bool)
+	matches := refLinkRe.FindAllStringSubmatch(text, -1)
+
+	for _, match := range matches {
+		if match[2] != "" {
+			// [text][label] form
+			refs[match[2]] = true
+		} else if match[4] != "" {
+			// [text][label] form (alternate capture)
+			refs[match[4]] = true
+		} else if match[1] != "" {
+			// Could be [label][] or just [label] used as reference
+			refs[match[1]] = true
+		} else if match[3] != "" {
+			refs[match[3]] = true
+		}
+	}
+
+	return refs
+}
+
+// findBodyRefLinks finds reference links used in the body (non-footnote) text
+func findBodyRefLinks(source []byte, footnoteDefs map[int]footnoteDef) map[string]bool {
+	bodyRefs := make(map[string]bool)
+
+	// Build ranges to exclude (footnote definitions and link definitions)
+	var excludeRanges []markdown.ByteRange
+	for _, def := range footnoteDefs {
+		excludeRanges = append(excludeRanges, markdown.ByteRange{Start: def.start, End: def.end})
+	}
+
+	// Also exclude link definition lines
+	linkDefMatches := linkDefRe.FindAllIndex(source, -1)
+	for _, match := range linkDefMatches {
+		excludeRanges = append(excludeRanges, markdown.ByteRange{Start: match[0], End: match[1]})
+	}
+
+	// Get body text by excluding footnote definitions
+	bodyText := markdown.ExcludeRanges(string(source), 0, excludeRanges)
+
+	// Find all reference links in body
+	for label := range findRefLinksInText(bodyText) {
+		bodyRefs[label] = true
+	}
+
+	return bodyRefs
+}
+
+// renderFootnoteContentWithRefs renders footnote content with reference links resolved
+// linkMap maps link labels to URLs; buf is scratch space for rendering
+func renderFootnoteContentWithRefs(rawContent string, linkMap map[string]string, buf *bytes.Buffer) string {
+	// Replace reference links with inline links
+	// Handle [text][label] form
+	content := fullRefRe.ReplaceAllStringFunc(rawContent, func(match string) string {
+		parts := fullRefRe.FindStringSubmatch(match)
+		if len(parts) == 3 {
+			text := parts[1]
+			label := parts[2]
+			if url, ok := linkMap[label]; ok {
+				return "[" + text + "](" + url + ")"
+			}
+		}
+		return match
+	})
+
+	// Handle [label][] form (empty second bracket)
+	content = collapsedRefRe.ReplaceAllStringFunc(content, func(match string) string {
+		parts := collapsedRefRe.FindStringSubmatch(match)
+		if len(parts) == 2 {
+			label := parts[1]
+			if url, ok := linkMap[label]; ok {
+				return "[" + label + "](" + url + ")"
+			}
+		}
+		return match
+	})
+
+	// Now render through goldmark
+	buf.Reset()
+	md.Convert([]byte(content), buf)
+
+	// Strip the <p> tags
+	result := strings.TrimSpace(buf.String())
+	result = strings.TrimPrefix(result, "<p>")
+	result = strings.TrimSuffix(result, "</p>")
+
+	return result
+}
+
+// renumberLinkRefs renumbers link references after removing some
+func renumberLinkRefs(text string, linkDefs []linkDef, removed map[string]bool) string {
+	// Build old -> new label mapping for numeric labels
+	var keptLabels []string
+	for _, ld := range linkDefs {
+		if !removed[ld.label] {
+			keptLabels = append(keptLabels, ld.label)
+		}
+	}
+
+	// Create renumbering map (only for numeric labels)
+	renumber := make(map[string]string)
+	newNum := 1
+	for _, label := range keptLabels {
+		if _, seen := renumber[label]; seen {
+			continue // a duplicate definition; the first one counts
+		}
+		if _, err := strconv.Atoi(label); err == nil {
+			renumber[label] = strconv.Itoa(newNum)
+			newNum++
+		}
+	}
+
+	// Replace in text - both usages [text][N] and definitions [N]:
+	// Each is replaced in one pass, so 3 -> 2 and 2 -> 1 don't both end as 1
+	relabel := func(match, prefix, suffix string) string {
+		label := strings.TrimSuffix(strings.TrimPrefix(match, prefix), suffix)
+		if new, ok := renumber[label]; ok {
+			return prefix + new + suffix
+		}
+		return match
+	}
+	result := numberedUseRe.ReplaceAllStringFunc(text, func(match string) string {
+		return relabel(match, "][", "]")
+	})
+	result = numberedDefRe.ReplaceAllStringFunc(result, func(match string) string {
+		return relabel(match, "[", "]:")
+	})
+
+	return result
+}
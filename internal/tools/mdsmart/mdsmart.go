@@ -0,0 +1,396 @@
+// Package mdsmart replaces straight quotes, apostrophes, dashes, and
+// ellipses with typographic ones, in the quotation style of a locale.
+package mdsmart
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/markdown"
+)
+
+// Flags defines mdsmart's flags on fs. Once fs is parsed, the function it
+// returns checks them and returns the transform.
+func Flags(fs *flag.FlagSet) func() (cli.TransformFunc, error) {
+	o := &options{
+		locale: fs.String("locale", "en", "quotation `style`: "+localeList()),
+	}
+	return func() (cli.TransformFunc, error) {
+		s, ok := locales[*o.locale]
+		if !ok {
+			return nil, fmt.Errorf("unknown -locale %q (want %s)", *o.locale, localeList())
+		}
+		o.style = s
+		return o.transform, nil
+	}
+}
+
+// options holds mdsmart's flags.
+type options struct {
+	locale *string
+	style  style
+}
+
+// style is how a locale writes quotations.
+type style struct {
+	open, close           string // quotation marks
+	openInner, closeInner string // for a quotation inside another
+	// french puts a narrow no-break space inside guillemets and before
+	// ; : ! and ?.
+	french bool
+}
+
+// locales are the styles -locale selects.
+var locales = map[string]style{
+	"en":    {open: "“", close: "”", openInner: "‘", closeInner: "’"},
+	"en-GB": {open: "‘", close: "’", openInner: "“", closeInner: "”"},
+	"de":    {open: "„", close: "“", openInner: "‚", closeInner: "‘"},
+	"de-CH": {open: "«", close: "»", openInner: "‹", closeInner: "›"},
+	"fr":    {open: "«", close: "»", openInner: "“", closeInner: "”", french: true},
+	"fr-CH": {open: "«", close: "»", openInner: "‹", closeInner: "›"},
+	"es":    {open: "«", close: "»", openInner: "“", closeInner: "”"},
+	"it":    {open: "«", close: "»", openInner: "“", closeInner: "”"},
+}
+
+// localeList lists the locales for messages: "de, de-CH, en, … or it".
+func localeList() string {
+	names := make([]string, 0, len(locales))
+	for name := range locales {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names[:len(names)-1], ", ") + ", or " + names[len(names)-1]
+}
+
+const (
+	apostrophe = "’"
+	narrowNBSP = "\u202f"
+)
+
+// Quotation marks as they may already be written, straight or in any
+// locale's style.
+const (
+	doubleQuotes = `"“”„«»`
+	singleQuotes = `'‘’‚‹›`
+	guillemets   = "«»‹›"
+)
+
+// Roles a quotation mark can have.
+const (
+	opening = iota + 1
+	closing
+	apostropheRole
+	either // between two letters: a closing mark if one is open
+)
+
+// mark is something in the text to be rewritten: a quotation mark, or with
+// space the spaces before French high punctuation.
+type mark struct {
+	start, end int // of what's replaced
+	// spaceBefore and spaceAfter are the bytes of space around a
+	// guillemet, the inside one of which is replaced with it.
+	spaceBefore, spaceAfter int
+	double                  bool // a quotation's mark rather than an inner quotation's
+	apos                    bool // written ', ‘, or ’, which may be an apostrophe
+	role                    int
+	text                    string // replacement text when set in the first pass
+}
+
+func (o *options) transform(content string) string {
+	return markdown.RewriteProse(content, o.convert)
+}
+
+// convert rewrites the punctuation of one block of inline text.
+func (o *options) convert(s string) string {
+	if strings.Trim(s, "|:- \t") == "" {
+		return s // a table's delimiter row
+	}
+	marks := o.findMarks(s)
+	pairQuotes(marks)
+
+	var b strings.Builder
+	last := 0
+	for _, m := range marks {
+		switch m.role {
+		case opening:
+			m.end += m.spaceAfter
+		case closing:
+			m.start = max(m.start-m.spaceBefore, last)
+		}
+		b.WriteString(s[last:m.start])
+		b.WriteString(o.replacement(m))
+		last = m.end
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// findMarks returns the marks of s in order, skipping code, math, HTML, link
+// destinations, and attribute blocks.
+func (o *options) findMarks(s string) []*mark {
+	var marks []*mark
+	prevEnd := 0   // where the last mark ends
+	afterTag := -1 // where the last opening HTML tag ends
+	// before returns the rune before s[i] as a quotation mark sees it.
+	// Right after another quotation mark, it's that mark's role that
+	// counts, "'Hi,' she said.", since the glyph it turns into may read
+	// differently.
+	before := func(i int) rune {
+		switch last := len(marks) - 1; {
+		case i == afterTag:
+			return ' ' // <q>"quoted"</q>
+		case last < 0 || prevEnd != i || marks[last].text != "":
+			return runeBefore(s, i)
+		case marks[last].role == opening:
+			return ' '
+		default:
+			return 'x'
+		}
+	}
+	for i := 0; i < len(s); {
+		if j, ok := markdown.SkipLiteral(s, i); ok {
+			if strings.HasPrefix(s[i:], "<") && !strings.HasPrefix(s[i:], "</") {
+				afterTag = j
+			}
+			i = j
+			continue
+		}
+		if j := skipAttributes(s, i); j > i {
+			i = j
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case strings.ContainsRune(doubleQuotes, r) || strings.ContainsRune(singleQuotes, r):
+			m := &mark{start: i, end: i + size, double: o.isDouble(r), apos: strings.ContainsRune("'‘’", r)}
+			switch {
+			case strings.ContainsRune(guillemets, r):
+				// The spaces inside a guillemet go with it, « x », so
+				// it's placed by what's past them on that side. Between
+				// spaces, it's taken to be written the way round it goes.
+				for m.start-m.spaceBefore > prevEnd && isSpace(runeBefore(s, m.start-m.spaceBefore)) && s[m.start-m.spaceBefore-1] != '\n' {
+					_, n := utf8.DecodeLastRuneInString(s[:m.start-m.spaceBefore])
+					m.spaceBefore += n
+				}
+				for m.end+m.spaceAfter < len(s) && isSpace(runeAfter(s, m.end+m.spaceAfter)) && s[m.end+m.spaceAfter] != '\n' {
+					_, n := utf8.DecodeRuneInString(s[m.end+m.spaceAfter:])
+					m.spaceAfter += n
+				}
+				if strings.ContainsRune("«‹", r) {
+					if m.role = role(before(m.start), runeAfter(s, m.end+m.spaceAfter), false); m.role == 0 {
+						m.role = opening
+					}
+				} else {
+					if m.role = role(before(m.start-m.spaceBefore), runeAfter(s, m.end), false); m.role == 0 {
+						m.role = closing
+					}
+				}
+			default:
+				m.role = role(before(i), runeAfter(s, i+size), m.apos)
+			}
+			if m.role != 0 {
+				marks = append(marks, m)
+				prevEnd = m.end
+			}
+			i = max(i+size, m.end)
+			continue
+		case strings.HasPrefix(s[i:], "..."):
+			if !strings.HasPrefix(s[i+3:], ".") {
+				marks = append(marks, &mark{start: i, end: i + 3, text: "…"})
+				prevEnd = i + 3
+			}
+			i += 3 + len(s[i+3:]) - len(strings.TrimLeft(s[i+3:], "."))
+			continue
+		case r == '-':
+			n := len(s[i:]) - len(strings.TrimLeft(s[i:], "-"))
+			switch before, after := runeBefore(s, i), runeAfter(s, i+n); {
+			case n == 3:
+				marks = append(marks, &mark{start: i, end: i + 3, text: "—"})
+				prevEnd = i + 3
+			case n == 2 && !(isSpace(before) && isWord(after)):
+				// Not --flag, which is likely an option.
+				marks = append(marks, &mark{start: i, end: i + 2, text: "–"})
+				prevEnd = i + 2
+			}
+			i += n
+			continue
+		case strings.ContainsRune(";:!?", r) && i > prevEnd && isSpace(runeBefore(s, i)):
+			after := runeAfter(s, i+size)
+			if r == '!' && after == '[' || isWord(after) {
+				break // an image, or an emoji like :smile:
+			}
+			start := i
+			for start > prevEnd && isSpace(runeBefore(s, start)) {
+				_, n := utf8.DecodeLastRuneInString(s[:start])
+				start -= n
+			}
+			if start > 0 && s[start-1] == '\n' {
+				break
+			}
+			if o.style.french {
+				marks = append(marks, &mark{start: start, end: i, text: narrowNBSP})
+			} else if strings.Trim(s[start:i], "\u00a0\u202f") == "" {
+				// No-break spaces only French style calls for.
+				marks = append(marks, &mark{start: start, end: i, text: ""})
+			}
+		}
+		i += size
+	}
+	return marks
+}
+
+// isDouble reports whether the quotation mark r opens or closes a
+// quotation rather than a quotation inside one. The marks of the locale's
+// style are read as it writes them, so that French “inner” quotes stay
+// inner; others by their shape.
+func (o *options) isDouble(r rune) bool {
+	q := string(r)
+	switch q {
+	case o.style.open, o.style.close:
+		return true
+	case o.style.openInner, o.style.closeInner:
+		return false
+	}
+	return strings.ContainsRune(doubleQuotes, r)
+}
+
+// role returns the role of a quotation mark between before and after, or 0
+// if it doesn't have one, standing alone between spaces. apos is whether
+// the mark may be an apostrophe.
+func role(before, after rune, apos bool) int {
+	switch {
+	case isSpace(after) && (isSpace(before) || opensAfter(before)):
+		return 0
+	case apos && isWord(before) && isWord(after):
+		return apostropheRole // don't, l'été
+	case apos && (isSpace(before) || opensAfter(before)) && unicode.IsDigit(after):
+		return apostropheRole // '90s
+	case isSpace(before) || opensAfter(before):
+		return opening
+	case isWord(before) && isWord(after):
+		return either
+	}
+	return closing
+}
+
+// pairQuotes matches the opening and closing quotation marks of marks,
+// settling marks between letters and turning single marks without a partner
+// into apostrophes: 'tis, the students' books.
+func pairQuotes(marks []*mark) {
+	var open []*mark
+	for _, m := range marks {
+		if m.text != "" || m.role == apostropheRole || m.role == 0 {
+			continue
+		}
+		if m.role == opening {
+			open = append(open, m)
+			continue
+		}
+		k := len(open) - 1
+		for k >= 0 && open[k].double != m.double {
+			k--
+		}
+		switch {
+		case k >= 0:
+			m.role = closing
+			for _, unclosed := range open[k+1:] {
+				if unclosed.apos {
+					unclosed.role = apostropheRole
+				}
+			}
+			open = open[:k]
+		case m.role == either:
+			m.role = opening
+			open = append(open, m)
+		case m.apos:
+			m.role = apostropheRole
+		}
+	}
+	for _, unclosed := range open {
+		if unclosed.apos {
+			unclosed.role = apostropheRole
+		}
+	}
+}
+
+// replacement returns the text that replaces m.
+func (o *options) replacement(m *mark) string {
+	if m.text != "" || m.role == 0 {
+		return m.text
+	}
+	st := o.style
+	switch {
+	case m.role == apostropheRole:
+		return apostrophe
+	case m.double && m.role == opening:
+		return st.guillemetSpace(st.open, true)
+	case m.double:
+		return st.guillemetSpace(st.close, false)
+	case m.role == opening:
+		return st.guillemetSpace(st.openInner, true)
+	}
+	return st.guillemetSpace(st.closeInner, false)
+}
+
+// guillemetSpace returns the quotation mark q with the space French style
+// puts inside guillemets.
+func (st style) guillemetSpace(q string, opening bool) string {
+	if !st.french || !strings.Contains(guillemets, q) {
+		return q
+	}
+	if opening {
+		return q + narrowNBSP
+	}
+	return narrowNBSP + q
+}
+
+// skipAttributes returns the index past the attribute block, such as
+// {#id .class key="value"}, starting at s[i], or i if none does.
+func skipAttributes(s string, i int) int {
+	if s[i] != '{' || i+1 >= len(s) || !strings.ContainsRune("#.:", rune(s[i+1])) {
+		return i
+	}
+	if j := strings.IndexAny(s[i:], "}\n"); j >= 0 && s[i+j] == '}' {
+		return i + j + 1
+	}
+	return i
+}
+
+// opensAfter reports whether a quotation opens after r, as it does after
+// an opening bracket or a dash.
+func opensAfter(r rune) bool {
+	return strings.ContainsRune("([{/-–—", r)
+}
+
+// isSpace reports whether r is a space, a no-break space included, or the
+// start or end of the text.
+func isSpace(r rune) bool {
+	return unicode.IsSpace(r)
+}
+
+func isWord(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// runeBefore returns the rune before s[i], or a space at the start of s.
+func runeBefore(s string, i int) rune {
+	if i == 0 {
+		return ' '
+	}
+	r, _ := utf8.DecodeLastRuneInString(s[:i])
+	return r
+}
+
+// runeAfter returns the rune at s[j], or a space at the end of s.
+func runeAfter(s string, j int) rune {
+	if j >= len(s) {
+		return ' '
+	}
+	r, _ := utf8.DecodeRuneInString(s[j:])
+	return r
+}
@@ -0,0 +1,55 @@
+// Package mdsplit splits Markdown paragraphs into one sentence per line.
+package mdsplit
+
+import (
+	"flag"
+	"fmt"
+	"unicode"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/markdown"
+)
+
+// Flags defines mdsplit's flags on fs. Once fs is parsed, the function it
+// returns checks them and returns the transform.
+func Flags(fs *flag.FlagSet) func() (cli.TransformFunc, error) {
+	o := &options{
+		breaks:    fs.String("breaks", markdown.BreakKeep, "write hard line breaks as `style`: keep, spaces (two trailing spaces), or backslash"),
+		breakOn:   fs.String("break-on", "", "also break after each of these `marks`, such as \":;\", when a space follows"),
+		minLength: fs.Int("min-length", 0, "merge a sentence shorter than `n` characters onto the line before it (0 keeps every sentence on its own line)"),
+		unicode:   fs.Bool("unicode", false, "find sentence boundaries by Unicode's rules (UAX #29), for text in any language, instead of by . ! and ?"),
+	}
+	return func() (cli.TransformFunc, error) {
+		if err := markdown.CheckHardBreaks(*o.breaks); err != nil {
+			return nil, err
+		}
+		if *o.minLength < 0 {
+			return nil, fmt.Errorf("-min-length %d is negative", *o.minLength)
+		}
+		for _, r := range *o.breakOn {
+			if !unicode.IsPunct(r) && !unicode.IsSymbol(r) {
+				return nil, fmt.Errorf("-break-on %q: %q isn't punctuation", *o.breakOn, r)
+			}
+		}
+		return o.transform, nil
+	}
+}
+
+// options holds mdsplit's flags.
+type options struct {
+	breaks    *string
+	breakOn   *string
+	minLength *int
+	unicode   *bool
+}
+
+func (o *options) transform(content string) string {
+	split := markdown.SplitSentences
+	if *o.unicode {
+		split = markdown.SplitSentencesUnicode
+	}
+	split = markdown.BreakingAfter(split, *o.breakOn)
+	h := markdown.SentenceHandlersWith(markdown.MergingShort(split, *o.minLength))
+	h.HardBreaks = *o.breaks
+	return markdown.Transform(content, h)
+}
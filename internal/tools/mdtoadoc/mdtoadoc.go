@@ -0,0 +1,679 @@
+// Package mdtoadoc converts Markdown to AsciiDoc, so Markdown documentation
+// can move into an Antora site a page at a time.
+package mdtoadoc
+
+import (
+	"flag"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/markdown"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	extast "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// Flags defines mdtoadoc's flags on fs. Once fs is parsed, the function it
+// returns checks them and returns the transform.
+func Flags(fs *flag.FlagSet) func() (cli.TransformFunc, error) {
+	return func() (cli.TransformFunc, error) {
+		return transform, nil
+	}
+}
+
+// admonitions maps GFM alert types to AsciiDoc admonition styles, which
+// have the same five.
+var admonitions = map[string]string{
+	"note":      "NOTE",
+	"tip":       "TIP",
+	"important": "IMPORTANT",
+	"warning":   "WARNING",
+	"caution":   "CAUTION",
+}
+
+var (
+	fieldRe   = regexp.MustCompile(`^([A-Za-z][\w-]*):[ \t]+(\S.*)$`)
+	labelRe   = regexp.MustCompile(`[^\w-]+`)
+	alertRe   = regexp.MustCompile(`^\[!(\w+)\][+-]?(?:[ \t]+(.*))?$`)
+	attrRefRe = regexp.MustCompile(`^\{[\w-]+\}`)
+	// blockStartRe matches the start of a line that AsciiDoc would read as
+	// block syntax rather than paragraph text: a list marker, a comment, a
+	// block title or attribute list, an admonition label, a delimiter.
+	blockStartRe = regexp.MustCompile(`^(?:=+ |\*+ |\.+ |-+ |\d+\. |[a-zA-Z]\. |//|\.\S|\||:\w+:|\[[^\]]*\]$|'''|<<<|[-=_+*.]{4,}$|(?:NOTE|TIP|IMPORTANT|WARNING|CAUTION): |<\d+> )`)
+)
+
+// charRefs write the characters that start AsciiDoc inline markup without
+// starting it.
+var charRefs = map[rune]string{
+	'*': "{asterisk}",
+	'`': "{backtick}",
+	'^': "{caret}",
+	'~': "{tilde}",
+	'+': "{plus}",
+	'_': "&#95;",
+	'#': "&#35;",
+}
+
+// md parses with the GFM and footnote extensions, which AsciiDoc has
+// equivalents for.
+var md = goldmark.New(goldmark.WithExtensions(extension.GFM, extension.Footnote))
+
+// writer renders a Markdown AST as AsciiDoc.
+type writer struct {
+	src []byte
+	// footnotes maps footnote indexes to their definitions, and refs counts
+	// the references to each: AsciiDoc writes a footnote's text at its
+	// first reference, and names it only if it has more than one.
+	footnotes map[int]*extast.Footnote
+	refs      map[int]int
+	written   map[int]bool
+
+	slugs markdown.Slugger
+	depth int // of the list being written
+	nest  int // of the delimited block being written
+
+	// inMacro is set while writing the text of a macro, where ] would end
+	// it, and inTable while writing a table cell, where | would.
+	inMacro, inTable bool
+}
+
+func transform(content string) string {
+	lines := strings.Split(content, "\n")
+	fm := markdown.FrontmatterEnd(lines)
+
+	w := &writer{
+		src:       []byte(strings.Join(lines[fm:], "\n")),
+		footnotes: make(map[int]*extast.Footnote),
+		refs:      make(map[int]int),
+		written:   make(map[int]bool),
+	}
+	doc := md.Parser().Parse(text.NewReader(w.src))
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *extast.Footnote:
+			w.footnotes[n.Index] = n
+		case *extast.FootnoteLink:
+			w.refs[n.Index]++
+		}
+		return ast.WalkContinue, nil
+	})
+
+	// The header: the document title, then simple "key: value" frontmatter
+	// as attribute entries.
+	var title string
+	var attrs []string
+	for _, line := range lines[:fm] {
+		if m := fieldRe.FindStringSubmatch(line); m != nil {
+			value := strings.Trim(m[2], `"'`)
+			if strings.EqualFold(m[1], "title") {
+				title = "= " + value
+				continue
+			}
+			attrs = append(attrs, ":"+strings.ToLower(m[1])+": "+value)
+		}
+	}
+	if h, ok := doc.FirstChild().(*ast.Heading); ok && h.Level == 1 {
+		title = "= " + w.inline(h)
+		doc.RemoveChild(doc, h)
+	}
+	var out []string
+	if title != "" {
+		out = append(out, title)
+	}
+	out = append(out, attrs...)
+	out = appendBlocks(out, w.blocks(doc))
+
+	output := strings.Join(out, "\n")
+	return strings.TrimRight(output, "\n") + "\n"
+}
+
+// appendBlocks appends block to out, separated by a blank line.
+func appendBlocks(out, block []string) []string {
+	if len(block) == 0 {
+		return out
+	}
+	if len(out) > 0 {
+		out = append(out, "")
+	}
+	return append(out, block...)
+}
+
+// blocks renders the children of a container, separated by blank lines.
+func (w *writer) blocks(n ast.Node) []string {
+	var out []string
+	for child := n.FirstChild(); child != nil; child = child.NextSibling() {
+		// A list right after another would join it; a comment ends it.
+		if prev := child.PreviousSibling(); child.Kind() == ast.KindList && prev != nil && prev.Kind() == ast.KindList {
+			out = appendBlocks(out, []string{"//-"})
+		}
+		out = appendBlocks(out, w.block(child))
+	}
+	return out
+}
+
+// block renders one block node.
+func (w *writer) block(n ast.Node) []string {
+	switch n := n.(type) {
+	case *ast.Heading:
+		title := w.inline(n)
+		return []string{"[#" + anchorID(w.slugs.Slug(plainText(n, w.src))) + "]", strings.Repeat("=", n.Level) + " " + title}
+
+	case *ast.Paragraph, *ast.TextBlock:
+		if img, ok := onlyImage(n); ok {
+			return []string{"image::" + target(string(img.Destination)) + w.macroText(img, string(img.Title), true)}
+		}
+		return protect(strings.Split(w.inline(n), "\n"))
+
+	case *ast.ThematicBreak:
+		return []string{"'''"}
+
+	case *ast.FencedCodeBlock:
+		var out []string
+		if lang := string(n.Language(w.src)); lang != "" {
+			out = append(out, "[source,"+lang+"]")
+		}
+		return append(out, delimited("----", w.lines(n))...)
+
+	case *ast.CodeBlock:
+		return delimited("----", w.lines(n))
+
+	case *ast.HTMLBlock:
+		body := w.lines(n)
+		if n.HasClosure() {
+			body = append(body, strings.TrimRight(string(n.ClosureLine.Value(w.src)), "\n"))
+		}
+		return delimited("++++", body)
+
+	case *ast.Blockquote:
+		return w.quote(n)
+
+	case *ast.List:
+		return w.list(n)
+
+	case *extast.Table:
+		return w.table(n)
+
+	case *extast.FootnoteList:
+		// Each footnote's text is written at its first reference.
+		return nil
+	}
+	return nil
+}
+
+// lines returns the source lines of a leaf block without their newlines.
+func (w *writer) lines(n ast.Node) []string {
+	var out []string
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		seg := lines.At(i)
+		out = append(out, strings.Repeat(" ", seg.Padding)+strings.TrimRight(string(seg.Value(w.src)), "\n"))
+	}
+	return out
+}
+
+// delimited wraps lines in a delimited block, lengthening the delimiter
+// until no line would close it early.
+func delimited(delim string, lines []string) []string {
+	for _, line := range lines {
+		if strings.TrimRight(line, " \t") == delim {
+			return delimited(delim+delim[:1], lines)
+		}
+	}
+	out := append([]string{delim}, lines...)
+	return append(out, delim)
+}
+
+// quote renders a block quote as a quote block, or a GFM alert as an
+// admonition block.
+func (w *writer) quote(n *ast.Blockquote) []string {
+	w.nest++
+	defer func() { w.nest-- }()
+
+	var style, title string
+	if p, ok := n.FirstChild().(*ast.Paragraph); ok && p.Lines().Len() > 0 {
+		seg := p.Lines().At(0)
+		header := strings.TrimSpace(string(seg.Value(w.src)))
+		if m := alertRe.FindStringSubmatch(header); m != nil && admonitions[strings.ToLower(m[1])] != "" {
+			style, title = admonitions[strings.ToLower(m[1])], m[2]
+		}
+	}
+	if style == "" {
+		return delimited(strings.Repeat("_", 3+w.nest), w.blocks(n))
+	}
+
+	// The alert's first paragraph starts with its header line.
+	first := n.FirstChild()
+	_, rest, _ := strings.Cut(w.inline(first), "\n")
+	var body []string
+	if rest != "" {
+		body = protect(strings.Split(rest, "\n"))
+	}
+	for child := first.NextSibling(); child != nil; child = child.NextSibling() {
+		body = appendBlocks(body, w.block(child))
+	}
+	var out []string
+	if title != "" {
+		out = append(out, "."+escape(title, false, false))
+	}
+	out = append(out, "["+style+"]")
+	return append(out, delimited(strings.Repeat("=", 3+w.nest), body)...)
+}
+
+// list renders a list, with the markers repeated to its depth and the
+// blocks after an item's text attached with list continuations.
+func (w *writer) list(n *ast.List) []string {
+	w.depth++
+	defer func() { w.depth-- }()
+
+	marker := strings.Repeat("*", w.depth)
+	if n.IsOrdered() {
+		marker = strings.Repeat(".", w.depth)
+	}
+	var out []string
+	if n.IsOrdered() && n.Start > 1 {
+		out = append(out, "[start="+strconv.Itoa(n.Start)+"]")
+	}
+	for item := n.FirstChild(); item != nil; item = item.NextSibling() {
+		var lines []string
+		for child := item.FirstChild(); child != nil; child = child.NextSibling() {
+			body := w.block(child)
+			if len(body) == 0 {
+				continue
+			}
+			_, isList := child.(*ast.List)
+			switch {
+			case lines == nil && (child.Kind() == ast.KindTextBlock || child.Kind() == ast.KindParagraph):
+				lines = append([]string{marker + " " + body[0]}, body[1:]...)
+				continue
+			case lines == nil:
+				lines = []string{marker + " {empty}"}
+			}
+			if !isList {
+				lines = append(lines, "+")
+			}
+			lines = append(lines, body...)
+		}
+		if lines == nil {
+			lines = []string{marker + " {empty}"}
+		}
+		out = append(out, lines...)
+	}
+	return out
+}
+
+// table renders a table, with its header row on the line before a blank
+// one, and its alignments in the cols attribute.
+func (w *writer) table(n *extast.Table) []string {
+	var out []string
+	cols := make([]string, len(n.Alignments))
+	aligned := false
+	for i, a := range n.Alignments {
+		switch a {
+		case extast.AlignLeft:
+			cols[i], aligned = "<", true
+		case extast.AlignCenter:
+			cols[i], aligned = "^", true
+		case extast.AlignRight:
+			cols[i], aligned = ">", true
+		default:
+			cols[i] = "1"
+		}
+	}
+	if aligned {
+		out = append(out, `[cols="`+strings.Join(cols, ",")+`"]`)
+	}
+	out = append(out, "|===")
+	w.inTable = true
+	for row := n.FirstChild(); row != nil; row = row.NextSibling() {
+		var cells []string
+		for cell := row.FirstChild(); cell != nil; cell = cell.NextSibling() {
+			cells = append(cells, strings.TrimRight("|"+strings.ReplaceAll(w.inline(cell), "\n", " "), " "))
+		}
+		out = append(out, strings.Join(cells, " "))
+		if _, ok := row.(*extast.TableHeader); ok {
+			out = append(out, "")
+		}
+	}
+	w.inTable = false
+	return append(out, "|===")
+}
+
+// onlyImage returns the image a paragraph consists of, if it is nothing
+// else.
+func onlyImage(n ast.Node) (*ast.Image, bool) {
+	img, ok := n.FirstChild().(*ast.Image)
+	return img, ok && n.FirstChild() == n.LastChild()
+}
+
+// protect puts {empty} before the lines of a paragraph that would start a
+// block.
+func protect(lines []string) []string {
+	for i, line := range lines {
+		if blockStartRe.MatchString(line) {
+			lines[i] = "{empty}" + line
+		}
+	}
+	return lines
+}
+
+// piece is a rendered inline: text, or constrained markup whose delimiters
+// are doubled when it touches a word.
+type piece struct {
+	text  string
+	role  string // written before the delimiters, like [.line-through]
+	delim string // "_", "*", or "#"; empty for text
+}
+
+// inline renders the inline content of n.
+func (w *writer) inline(n ast.Node) string {
+	var pieces []piece
+	var text strings.Builder // plain text not yet escaped
+	flush := func() {
+		if text.Len() > 0 {
+			pieces = append(pieces, piece{text: escape(text.String(), w.inMacro, w.inTable)})
+			text.Reset()
+		}
+	}
+	for child := n.FirstChild(); child != nil; child = child.NextSibling() {
+		p, isMarkup := w.span(child)
+		if !isMarkup {
+			// Escape text as a whole, since goldmark splits it at
+			// delimiters.
+			text.WriteString(p.text)
+			continue
+		}
+		flush()
+		pieces = append(pieces, p)
+	}
+	flush()
+
+	var b strings.Builder
+	for i, p := range pieces {
+		if p.delim == "" {
+			b.WriteString(p.text)
+			continue
+		}
+		before, _ := utf8.DecodeLastRuneInString(b.String())
+		var after rune
+		if i+1 < len(pieces) {
+			next := pieces[i+1]
+			after, _ = utf8.DecodeRuneInString(next.role + next.delim + next.text)
+		}
+		d := p.delim
+		if isWord(before) || isWord(after) {
+			d += d
+		}
+		b.WriteString(p.role + d + p.text + d)
+	}
+	return strings.TrimRight(b.String(), " \n")
+}
+
+func isWord(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// span renders one inline node and reports whether it is markup. Text that
+// isn't markup is returned unescaped.
+func (w *writer) span(n ast.Node) (piece, bool) {
+	switch n := n.(type) {
+	case *ast.Text:
+		s := string(n.Segment.Value(w.src))
+		switch {
+		case n.HardLineBreak():
+			s = strings.TrimSuffix(s, `\`)
+			return piece{text: escape(s, w.inMacro, w.inTable) + " +\n"}, true
+		case n.SoftLineBreak():
+			s += "\n"
+		}
+		return piece{text: s}, false
+	case *ast.String:
+		return piece{text: string(n.Value)}, false
+	case *ast.CodeSpan:
+		code := plainText(n, w.src)
+		if strings.Contains(code, "+") || w.inMacro && strings.Contains(code, "]") {
+			return piece{text: "`pass:[" + strings.ReplaceAll(code, "]", `\]`) + "]`"}, true
+		}
+		return piece{text: "`+" + code + "+`"}, true
+	case *ast.Emphasis:
+		d := "_"
+		if n.Level == 2 {
+			d = "*"
+		}
+		return piece{text: w.inline(n), delim: d}, true
+	case *extast.Strikethrough:
+		return piece{text: w.inline(n), role: "[.line-through]", delim: "#"}, true
+	case *ast.Link:
+		return piece{text: w.link(n)}, true
+	case *ast.AutoLink:
+		u := string(n.URL(w.src))
+		if n.AutoLinkType == ast.AutoLinkEmail && !strings.HasPrefix(u, "mailto:") {
+			return piece{text: "mailto:" + u + "[" + escape(u, true, w.inTable) + "]"}, true
+		}
+		return piece{text: target(u) + "[]"}, true
+	case *ast.Image:
+		return piece{text: "image:" + target(string(n.Destination)) + w.macroText(n, string(n.Title), true)}, true
+	case *extast.FootnoteLink:
+		return piece{text: w.footnote(n.Index)}, true
+	case *extast.TaskCheckBox:
+		if n.IsChecked {
+			return piece{text: "[x] "}, true
+		}
+		return piece{text: "[ ] "}, true
+	case *ast.RawHTML:
+		var b strings.Builder
+		for i := 0; i < n.Segments.Len(); i++ {
+			seg := n.Segments.At(i)
+			b.Write(seg.Value(w.src))
+		}
+		return piece{text: "+++" + b.String() + "+++"}, true
+	}
+	return piece{text: plainText(n, w.src)}, false
+}
+
+// link renders a link: a cross-reference for a fragment, an xref to the
+// AsciiDoc page for a link to another Markdown file, and a URL or link
+// macro otherwise.
+func (w *writer) link(n *ast.Link) string {
+	dest := string(n.Destination)
+	if frag, ok := strings.CutPrefix(dest, "#"); ok && frag != "" {
+		text := w.macroInline(n)
+		if text == "" {
+			return "<<" + anchorID(frag) + ">>"
+		}
+		return "<<" + anchorID(frag) + "," + text + ">>"
+	}
+	u, err := url.Parse(dest)
+	switch {
+	case err == nil && u.Scheme == "" && u.Host == "" && isMarkdownPath(u.Path):
+		page := strings.TrimSuffix(u.Path, pathExt(u.Path)) + ".adoc"
+		if u.Fragment != "" {
+			page += "#" + anchorID(u.Fragment)
+		}
+		return "xref:" + target(page) + w.macroText(n, string(n.Title), false)
+	case err == nil && (u.Scheme == "http" || u.Scheme == "https" || u.Scheme == "mailto"):
+		return target(dest) + w.macroText(n, string(n.Title), false)
+	}
+	return "link:" + target(dest) + w.macroText(n, string(n.Title), false)
+}
+
+// macroText renders the bracketed text of a link or image macro, with its
+// title. The text is quoted when it would be read as attributes: for an
+// image, whose alt text is the first of them, if it has a comma.
+func (w *writer) macroText(n ast.Node, title string, image bool) string {
+	var text string
+	if image {
+		text = escape(plainText(n, w.src), true, w.inTable)
+	} else {
+		text = w.macroInline(n)
+	}
+	if title == "" && !strings.Contains(text, "=") && !(image && strings.Contains(text, ",")) {
+		return "[" + text + "]"
+	}
+	attrs := `"` + strings.ReplaceAll(text, `"`, `\"`) + `"`
+	if title != "" {
+		attrs += `,title="` + strings.ReplaceAll(title, `"`, `\"`) + `"`
+	}
+	return "[" + attrs + "]"
+}
+
+// macroInline renders the inline content of n as the text of a macro.
+func (w *writer) macroInline(n ast.Node) string {
+	inMacro := w.inMacro
+	w.inMacro = true
+	defer func() { w.inMacro = inMacro }()
+	return w.inline(n)
+}
+
+// footnote renders a reference to footnote index: the footnote macro with
+// its text the first time, and by its name after that.
+func (w *writer) footnote(index int) string {
+	f := w.footnotes[index]
+	if f == nil {
+		return ""
+	}
+	name := ""
+	if w.refs[index] > 1 {
+		name = strings.Trim(labelRe.ReplaceAllString(string(f.Ref), "-"), "-")
+		if name == "" {
+			name = "fn" + strconv.Itoa(index)
+		}
+	}
+	if w.written[index] {
+		return "footnote:" + name + "[]"
+	}
+	w.written[index] = true
+
+	// AsciiDoc footnotes are inline: their paragraphs are joined.
+	var paras []string
+	for child := f.FirstChild(); child != nil; child = child.NextSibling() {
+		paras = append(paras, strings.ReplaceAll(w.macroInline(child), "\n", " "))
+	}
+	return "footnote:" + name + "[" + strings.Join(paras, " ") + "]"
+}
+
+// isMarkdownPath reports whether p names a Markdown file.
+func isMarkdownPath(p string) bool {
+	ext := strings.ToLower(pathExt(p))
+	return ext == ".md" || ext == ".markdown"
+}
+
+// pathExt returns the extension of the last element of p.
+func pathExt(p string) string {
+	base := p[strings.LastIndexByte(p, '/')+1:]
+	if i := strings.LastIndexByte(base, '.'); i > 0 {
+		return base[i:]
+	}
+	return ""
+}
+
+// target writes a macro target, in which a space would end it.
+func target(dest string) string {
+	return strings.ReplaceAll(dest, " ", "%20")
+}
+
+// anchorID makes an AsciiDoc ID of a slug, which must start with a letter
+// or an underscore.
+func anchorID(slug string) string {
+	if r, _ := utf8.DecodeRuneInString(slug); !unicode.IsLetter(r) && r != '_' {
+		return "_" + slug
+	}
+	return slug
+}
+
+// plainText returns the text of an inline node without markup.
+func plainText(n ast.Node, src []byte) string {
+	var b strings.Builder
+	ast.Walk(n, func(c ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch c := c.(type) {
+		case *ast.Text:
+			b.Write(c.Segment.Value(src))
+			if c.SoftLineBreak() || c.HardLineBreak() {
+				b.WriteByte(' ')
+			}
+		case *ast.String:
+			b.Write(c.Value)
+		case *ast.AutoLink:
+			b.Write(c.URL(src))
+		}
+		return ast.WalkContinue, nil
+	})
+	return b.String()
+}
+
+// escape writes Markdown text as AsciiDoc text: it drops Markdown's
+// backslash escapes and writes the characters that could start AsciiDoc
+// markup with character references. In a macro's text ] is escaped, and in
+// a table cell |.
+func escape(s string, inMacro, inTable bool) string {
+	rs := []rune(s)
+	at := func(i int) rune {
+		if i < 0 || i >= len(rs) {
+			return ' '
+		}
+		return rs[i]
+	}
+	var b strings.Builder
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+		if r == '\\' && i+1 < len(rs) && isASCIIPunct(rs[i+1]) {
+			rs = append(rs[:i], rs[i+1:]...)
+			r = rs[i]
+		}
+		prev, next := at(i-1), at(i+1)
+		switch {
+		case charRefs[r] != "" && markup(r, prev, next):
+			b.WriteString(charRefs[r])
+		case r == '{' && attrRefRe.MatchString(string(rs[i:])):
+			b.WriteString(`\{`)
+		case r == '[' && next == '[':
+			b.WriteString("{startsb}")
+		case r == '<' && next == '<':
+			b.WriteString("{lt}")
+		case r == ']' && inMacro:
+			b.WriteString(`\]`)
+		case r == '|' && inTable:
+			b.WriteString("{vbar}")
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func isASCIIPunct(r rune) bool {
+	return r < utf8.RuneSelf && (unicode.IsPunct(r) || unicode.IsSymbol(r))
+}
+
+// markup reports whether r, between prev and next, could be part of
+// AsciiDoc inline markup. Constrained markup can't start or end inside a
+// word, and no markup starts and ends at a character between spaces.
+func markup(r, prev, next rune) bool {
+	space := func(r rune) bool { return unicode.IsSpace(r) }
+	switch r {
+	case '^', '~':
+		return !space(prev) || !space(next)
+	case '+':
+		// " +" at the end of a line is a hard line break.
+		return next == '\n' || !space(prev) || !space(next)
+	}
+	if prev == r || next == r {
+		return true
+	}
+	if isWord(prev) && isWord(next) || space(prev) && space(next) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,567 @@
+// Package mdtodjot converts Markdown to Djot, rewriting only the syntax that
+// differs between the two.
+package mdtodjot
+
+import (
+	"flag"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/markdown"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	extast "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// Flags defines mdtodjot's flags on fs. Once fs is parsed, the function it
+// returns checks them and returns the transform.
+func Flags(fs *flag.FlagSet) func() (cli.TransformFunc, error) {
+	return func() (cli.TransformFunc, error) {
+		return transform, nil
+	}
+}
+
+var (
+	closedATXRe = regexp.MustCompile(`^( {0,3}#{1,6}[ \t]+.*?)[ \t]+#+[ \t]*$`)
+	refTitleRe  = regexp.MustCompile(`^( {0,3}\[[^\]]+\]:[ \t]*\S+)[ \t]+(?:"([^"]*)"|'([^']*)'|\(([^)]*)\))[ \t]*$`)
+	prefixRe    = regexp.MustCompile(`^[ \t>]*`)
+)
+
+// edit replaces source[start:end] with text.
+type edit struct {
+	start, end int
+	text       string
+}
+
+// md parses with the GFM and footnote extensions, whose syntax Djot spells
+// differently.
+var md = goldmark.New(goldmark.WithExtensions(extension.GFM, extension.Footnote))
+
+// converter collects the edits that turn a document into Djot.
+type converter struct {
+	src        []byte
+	lineStarts []int
+	edits      []edit
+}
+
+func transform(content string) string {
+	lines := strings.Split(content, "\n")
+	fm := markdown.FrontmatterEnd(lines)
+	head := strings.Join(lines[:fm], "\n")
+	body := strings.Join(lines[fm:], "\n")
+	if fm > 0 {
+		head += "\n"
+	}
+
+	c := &converter{src: []byte(body)}
+	c.lineStarts = []int{0}
+	for i, b := range c.src {
+		if b == '\n' {
+			c.lineStarts = append(c.lineStarts, i+1)
+		}
+	}
+	doc := md.Parser().Parse(text.NewReader(c.src))
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		return c.visit(n), nil
+	})
+	c.refTitles()
+
+	output := head + c.apply()
+	return strings.TrimRight(output, "\n") + "\n"
+}
+
+// visit records the edits for one node.
+func (c *converter) visit(n ast.Node) ast.WalkStatus {
+	if n.Type() == ast.TypeBlock {
+		c.separate(n)
+	}
+	switch n := n.(type) {
+	case *ast.Heading:
+		c.heading(n)
+	case *ast.CodeBlock:
+		c.indentedCode(n)
+		return ast.WalkSkipChildren
+	case *ast.FencedCodeBlock:
+		return ast.WalkSkipChildren
+	case *ast.HTMLBlock:
+		c.htmlBlock(n)
+		return ast.WalkSkipChildren
+	case *ast.ThematicBreak:
+		c.thematicBreak(n)
+	case *extast.Table:
+		c.table(n)
+	case *ast.Emphasis:
+		d := "_"
+		if n.Level == 2 {
+			d = "*"
+		}
+		c.delimiters(n, d, d)
+	case *extast.Strikethrough:
+		c.delimiters(n, "{-", "-}")
+	case *ast.Link, *ast.Image:
+		c.link(n)
+	case *ast.RawHTML:
+		c.rawHTML(n)
+	case *ast.Text:
+		c.hardBreak(n)
+	case *ast.CodeSpan, *ast.AutoLink:
+		return ast.WalkSkipChildren
+	}
+	return ast.WalkContinue
+}
+
+// lineOf returns the index of the line containing pos.
+func (c *converter) lineOf(pos int) int {
+	return sort.Search(len(c.lineStarts), func(i int) bool { return c.lineStarts[i] > pos }) - 1
+}
+
+// line returns line i without its newline.
+func (c *converter) line(i int) string {
+	end := len(c.src)
+	if i+1 < len(c.lineStarts) {
+		end = c.lineStarts[i+1] - 1
+	}
+	return string(c.src[c.lineStarts[i]:end])
+}
+
+// blockStart returns the source position where a block's first line of
+// content is, or -1.
+func blockStart(n ast.Node) int {
+	if n.Type() != ast.TypeBlock {
+		return -1
+	}
+	if lines := n.Lines(); lines != nil && lines.Len() > 0 {
+		return lines.At(0).Start
+	}
+	for child := n.FirstChild(); child != nil; child = child.NextSibling() {
+		if s := blockStart(child); s >= 0 {
+			return s
+		}
+		if s := start(child); s >= 0 {
+			return s
+		}
+	}
+	return -1
+}
+
+// separate adds a blank line before a block that directly follows paragraph
+// or heading text, which Djot would read as part of the paragraph or heading.
+func (c *converter) separate(n ast.Node) {
+	prev := n.PreviousSibling()
+	if prev == nil || (prev.Kind() != ast.KindParagraph && prev.Kind() != ast.KindTextBlock && prev.Kind() != ast.KindHeading) {
+		return
+	}
+	s := blockStart(n)
+	if s < 0 {
+		return
+	}
+	i := c.lineOf(s)
+	if i == 0 || strings.TrimSpace(strings.Trim(c.line(i-1), " \t>")) == "" {
+		return
+	}
+	// Inside a quote the blank line keeps its markers.
+	prefix := prefixRe.FindString(c.line(i))
+	prefix = prefix[:strings.LastIndexByte(prefix, '>')+1]
+	c.edits = append(c.edits, edit{c.lineStarts[i], c.lineStarts[i], prefix + "\n"})
+}
+
+// heading turns a setext heading into an ATX one and drops closing #s.
+func (c *converter) heading(n *ast.Heading) {
+	lines := n.Lines()
+	if lines.Len() == 0 {
+		return
+	}
+	first := c.lineOf(lines.At(0).Start)
+	last := c.lineOf(lines.At(lines.Len() - 1).Start)
+	if m := closedATXRe.FindStringSubmatch(c.line(first)); m != nil && first == last && strings.HasPrefix(strings.TrimLeft(c.line(first), " "), "#") {
+		c.edits = append(c.edits, edit{c.lineStarts[first] + len(m[1]), c.lineStarts[first] + len(c.line(first)), ""})
+		return
+	}
+	under := last + 1
+	if under >= len(c.lineStarts) || strings.HasPrefix(strings.TrimLeft(c.line(first), " "), "#") {
+		return
+	}
+	if u := strings.TrimSpace(c.line(under)); u == "" || strings.Trim(u, "=-") != "" {
+		return
+	}
+	c.edits = append(c.edits, edit{lines.At(0).Start, lines.At(0).Start, strings.Repeat("#", n.Level) + " "})
+	end := len(c.src)
+	if under+1 < len(c.lineStarts) {
+		end = c.lineStarts[under+1]
+	}
+	c.edits = append(c.edits, edit{c.lineStarts[under], end, ""})
+}
+
+// indentedCode fences an indented code block.
+func (c *converter) indentedCode(n *ast.CodeBlock) {
+	lines := n.Lines()
+	if lines.Len() == 0 {
+		return
+	}
+	first := c.lineOf(lines.At(0).Start)
+	last := c.lineOf(lines.At(lines.Len() - 1).Start)
+	prefix := string(c.src[c.lineStarts[first]:lines.At(0).Start])
+	if strings.HasSuffix(prefix, "    ") {
+		prefix = prefix[:len(prefix)-4]
+	} else {
+		prefix = strings.TrimSuffix(prefix, "\t")
+	}
+
+	var body strings.Builder
+	for i := 0; i < lines.Len(); i++ {
+		seg := lines.At(i)
+		body.WriteString(prefix)
+		body.WriteString(strings.Repeat(" ", seg.Padding))
+		body.Write(seg.Value(c.src))
+	}
+	fence := "```"
+	for strings.Contains(body.String(), fence) {
+		fence += "`"
+	}
+	end := len(c.src)
+	if last+1 < len(c.lineStarts) {
+		end = c.lineStarts[last+1]
+	}
+	text := prefix + fence + "\n" + strings.TrimRight(body.String(), "\n") + "\n" + prefix + fence + "\n"
+	c.edits = append(c.edits, edit{c.lineStarts[first], end, text})
+}
+
+// htmlBlock wraps an HTML block in a raw HTML fence.
+func (c *converter) htmlBlock(n *ast.HTMLBlock) {
+	lines := n.Lines()
+	if lines.Len() == 0 {
+		return
+	}
+	first := c.lineOf(lines.At(0).Start)
+	last := c.lineOf(lines.At(lines.Len() - 1).Start)
+	if n.HasClosure() {
+		last = c.lineOf(n.ClosureLine.Start)
+	}
+	prefix := string(c.src[c.lineStarts[first]:lines.At(0).Start])
+	var content strings.Builder
+	for i := first; i <= last; i++ {
+		content.WriteString(c.line(i))
+	}
+	fence := "```"
+	for strings.Contains(content.String(), fence) {
+		fence += "`"
+	}
+	c.edits = append(c.edits, edit{c.lineStarts[first], c.lineStarts[first], prefix + fence + "=html\n"})
+	end := len(c.src)
+	sep := ""
+	if last+1 < len(c.lineStarts) {
+		end = c.lineStarts[last+1]
+	} else {
+		sep = "\n"
+	}
+	c.edits = append(c.edits, edit{end, end, sep + prefix + fence + "\n"})
+}
+
+// thematicBreak rewrites ___, which isn't a Djot thematic break.
+func (c *converter) thematicBreak(n *ast.ThematicBreak) {
+	pos := n.Pos()
+	if pos < 0 {
+		return
+	}
+	i := c.lineOf(pos)
+	line := c.line(i)
+	if strings.Contains(line, "_") {
+		c.edits = append(c.edits, edit{c.lineStarts[i], c.lineStarts[i] + len(line), strings.ReplaceAll(line, "_", "-")})
+	}
+}
+
+// table gives every row of a table outer pipes.
+func (c *converter) table(n *extast.Table) {
+	s := blockStart(n)
+	if s < 0 {
+		return
+	}
+	for i := c.lineOf(s); i < len(c.lineStarts); i++ {
+		line := c.line(i)
+		prefix := prefixRe.FindString(line)
+		row := strings.TrimRight(line[len(prefix):], " \t")
+		if row == "" || !strings.Contains(row, "|") {
+			break
+		}
+		at := c.lineStarts[i] + len(prefix)
+		if !strings.HasPrefix(row, "|") {
+			c.edits = append(c.edits, edit{at, at, "| "})
+		}
+		if !strings.HasSuffix(row, "|") || strings.HasSuffix(row, `\|`) {
+			c.edits = append(c.edits, edit{at + len(row), at + len(row), " |"})
+		}
+	}
+}
+
+// delimiters replaces the delimiters around an inline's content.
+func (c *converter) delimiters(n ast.Node, open, close string) {
+	if n.FirstChild() == nil {
+		return
+	}
+	s, e := start(n.FirstChild()), stop(n.LastChild(), c.src)
+	if s < 0 || e < 0 {
+		return
+	}
+	from, to := s, e
+	for from > 0 && (c.src[from-1] == '*' || c.src[from-1] == '_' || c.src[from-1] == '~') && s-from < delimLen(n) {
+		from--
+	}
+	for to < len(c.src) && (c.src[to] == '*' || c.src[to] == '_' || c.src[to] == '~') && to-e < delimLen(n) {
+		to++
+	}
+	c.edits = append(c.edits, edit{from, s, open}, edit{e, to, close})
+}
+
+// delimLen returns how many delimiter characters an inline has on each side.
+func delimLen(n ast.Node) int {
+	switch n := n.(type) {
+	case *ast.Emphasis:
+		return n.Level
+	case *extast.Strikethrough:
+		return 2
+	}
+	return 0
+}
+
+// link completes shortcut references and moves inline titles to attributes.
+func (c *converter) link(n ast.Node) {
+	if n.LastChild() == nil {
+		return
+	}
+	e := stop(n.LastChild(), c.src)
+	if e < 0 || e >= len(c.src) || c.src[e] != ']' {
+		return
+	}
+	after := e + 1
+	switch {
+	case after < len(c.src) && c.src[after] == '(':
+		end := destEnd(c.src, after)
+		var title []byte
+		var dest []byte
+		switch l := n.(type) {
+		case *ast.Link:
+			title, dest = l.Title, l.Destination
+		case *ast.Image:
+			title, dest = l.Title, l.Destination
+		}
+		if end > 0 && len(title) > 0 {
+			c.edits = append(c.edits, edit{after, end, "(" + string(dest) + `){title="` + escapeAttr(string(title)) + `"}`})
+		}
+	case after < len(c.src) && c.src[after] == '[':
+	default:
+		c.edits = append(c.edits, edit{after, after, "[]"})
+	}
+}
+
+// rawHTML marks inline HTML as raw.
+func (c *converter) rawHTML(n *ast.RawHTML) {
+	if n.Segments.Len() == 0 {
+		return
+	}
+	s, e := n.Segments.At(0).Start, n.Segments.At(n.Segments.Len()-1).Stop
+	html := string(c.src[s:e])
+	ticks := "`"
+	for strings.Contains(html, ticks) {
+		ticks += "`"
+	}
+	pad := ""
+	if strings.HasPrefix(html, "`") || strings.HasSuffix(html, "`") {
+		pad = " "
+	}
+	c.edits = append(c.edits, edit{s, s, ticks + pad}, edit{e, e, pad + ticks + "{=html}"})
+}
+
+// hardBreak turns a hard line break made of trailing spaces into a
+// backslash.
+func (c *converter) hardBreak(n *ast.Text) {
+	if !n.HardLineBreak() {
+		return
+	}
+	i := n.Segment.Stop
+	j := i
+	for j < len(c.src) && c.src[j] == ' ' {
+		j++
+	}
+	if j > i && j < len(c.src) && c.src[j] == '\n' {
+		c.edits = append(c.edits, edit{i, j, `\`})
+	}
+}
+
+// refTitles moves the titles of reference definitions to an attribute on
+// the line before, since Djot definitions have none.
+func (c *converter) refTitles() {
+	inFence := false
+	for i := range c.lineStarts {
+		line := c.line(i)
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+		}
+		m := refTitleRe.FindStringSubmatch(line)
+		if inFence || m == nil {
+			continue
+		}
+		title := m[2] + m[3] + m[4]
+		c.edits = append(c.edits,
+			edit{c.lineStarts[i], c.lineStarts[i], `{title="` + escapeAttr(title) + `"}` + "\n"},
+			edit{c.lineStarts[i] + len(m[1]), c.lineStarts[i] + len(line), ""})
+	}
+}
+
+func escapeAttr(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
+
+// apply returns the source with the edits made. Insertions at a position go
+// before a replacement starting there.
+func (c *converter) apply() string {
+	sort.SliceStable(c.edits, func(i, j int) bool {
+		a, b := c.edits[i], c.edits[j]
+		if a.start != b.start {
+			return a.start < b.start
+		}
+		return a.end-a.start < b.end-b.start
+	})
+	var b strings.Builder
+	pos := 0
+	for _, e := range c.edits {
+		if e.start < pos {
+			continue
+		}
+		b.Write(c.src[pos:e.start])
+		b.WriteString(e.text)
+		pos = e.end
+	}
+	b.Write(c.src[pos:])
+	return b.String()
+}
+
+// start returns where an inline starts in the source, or -1.
+func start(n ast.Node) int {
+	switch n := n.(type) {
+	case *ast.Text:
+		return n.Segment.Start
+	case *ast.RawHTML:
+		if n.Segments.Len() > 0 {
+			return n.Segments.At(0).Start
+		}
+	case *ast.Emphasis:
+		if s := firstStart(n); s >= 0 {
+			return s - n.Level
+		}
+	case *extast.Strikethrough:
+		if s := firstStart(n); s >= 0 {
+			return s - 2
+		}
+	case *ast.Link:
+		if s := firstStart(n); s >= 0 {
+			return s - 1
+		}
+	case *ast.Image:
+		if s := firstStart(n); s >= 0 {
+			return s - 2
+		}
+	}
+	return -1
+}
+
+func firstStart(n ast.Node) int {
+	if n.FirstChild() == nil {
+		return -1
+	}
+	return start(n.FirstChild())
+}
+
+// stop returns where an inline ends in the source, or -1.
+func stop(n ast.Node, src []byte) int {
+	switch n := n.(type) {
+	case *ast.Text:
+		return n.Segment.Stop
+	case *ast.RawHTML:
+		if n.Segments.Len() > 0 {
+			return n.Segments.At(n.Segments.Len() - 1).Stop
+		}
+	case *ast.CodeSpan:
+		if n.LastChild() == nil {
+			return -1
+		}
+		e := stop(n.LastChild(), src)
+		if e >= 0 && e < len(src) && src[e] == ' ' {
+			e++
+		}
+		for e >= 0 && e < len(src) && src[e] == '`' {
+			e++
+		}
+		return e
+	case *ast.Emphasis:
+		if e := lastStop(n, src); e >= 0 {
+			return e + n.Level
+		}
+	case *extast.Strikethrough:
+		if e := lastStop(n, src); e >= 0 {
+			return e + 2
+		}
+	case *ast.Link, *ast.Image:
+		e := lastStop(n, src)
+		if e < 0 || e >= len(src) || src[e] != ']' {
+			return -1
+		}
+		e++
+		switch {
+		case e < len(src) && src[e] == '(':
+			return destEnd(src, e)
+		case e < len(src) && src[e] == '[':
+			if k := strings.IndexByte(string(src[e:]), ']'); k >= 0 {
+				return e + k + 1
+			}
+		}
+		return e
+	}
+	return -1
+}
+
+func lastStop(n ast.Node, src []byte) int {
+	if n.LastChild() == nil {
+		return -1
+	}
+	return stop(n.LastChild(), src)
+}
+
+// destEnd returns the position after the ")" closing the link destination
+// and title that open at src[open], or -1.
+func destEnd(src []byte, open int) int {
+	depth := 0
+	var quote byte
+	for i := open; i < len(src); i++ {
+		ch := src[i]
+		switch {
+		case ch == '\\':
+			i++
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '<':
+			if k := strings.IndexByte(string(src[i:]), '>'); k >= 0 {
+				i += k
+			}
+		case ch == '(':
+			depth++
+		case ch == ')':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,461 @@
+// Package mdtorst converts Markdown to reStructuredText, so Markdown
+// contributions can join a Sphinx project.
+package mdtorst
+
+import (
+	"flag"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/markdown"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	extast "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Flags defines mdtorst's flags on fs. Once fs is parsed, the function it
+// returns checks them and returns the transform.
+func Flags(fs *flag.FlagSet) func() (cli.TransformFunc, error) {
+	return func() (cli.TransformFunc, error) {
+		return transform, nil
+	}
+}
+
+// adornments are the heading underline characters by level.
+var adornments = []string{"=", "-", "~", "^", `"`, "'"}
+
+var (
+	fieldRe = regexp.MustCompile(`^([A-Za-z][\w-]*):[ \t]+(\S.*)$`)
+	labelRe = regexp.MustCompile(`[^\w.-]+`)
+)
+
+// md parses with the GFM and footnote extensions, which reST has equivalents
+// for.
+var md = goldmark.New(goldmark.WithExtensions(extension.GFM, extension.Footnote))
+
+// writer renders a Markdown AST as reST.
+type writer struct {
+	src []byte
+	// footnotes maps footnote indexes to their labels.
+	footnotes map[int][]byte
+	// subs are the image substitution definitions, written at the end of
+	// the document, where no indented block can follow one and become its
+	// content; subDests maps their names to the images' destinations.
+	subs     []string
+	subDests map[string]string
+}
+
+func transform(content string) string {
+	lines := strings.Split(content, "\n")
+	fm := markdown.FrontmatterEnd(lines)
+
+	var out []string
+	for _, line := range lines[:fm] {
+		if m := fieldRe.FindStringSubmatch(line); m != nil {
+			out = append(out, ":"+m[1]+": "+strings.Trim(m[2], `"'`))
+		}
+	}
+
+	w := &writer{src: []byte(strings.Join(lines[fm:], "\n"))}
+	doc := md.Parser().Parse(text.NewReader(w.src))
+	w.footnotes = make(map[int][]byte)
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if f, ok := n.(*extast.Footnote); ok && entering {
+			w.footnotes[f.Index] = f.Ref
+		}
+		return ast.WalkContinue, nil
+	})
+	out = appendBlocks(out, w.blocks(doc))
+	out = appendBlocks(out, w.subs)
+
+	output := strings.Join(out, "\n")
+	return strings.TrimRight(output, "\n") + "\n"
+}
+
+// appendBlocks appends block to out, separated by a blank line.
+func appendBlocks(out, block []string) []string {
+	if len(block) == 0 {
+		return out
+	}
+	if len(out) > 0 {
+		out = append(out, "")
+	}
+	return append(out, block...)
+}
+
+// blocks renders the children of a container, separated by blank lines.
+func (w *writer) blocks(n ast.Node) []string {
+	var out []string
+	for child := n.FirstChild(); child != nil; child = child.NextSibling() {
+		// An indented quote after anything but a paragraph would continue
+		// it; an empty comment ends it.
+		if prev := child.PreviousSibling(); child.Kind() == ast.KindBlockquote && prev != nil && prev.Kind() != ast.KindParagraph && prev.Kind() != ast.KindHeading {
+			out = appendBlocks(out, []string{".."})
+		}
+		out = appendBlocks(out, w.block(child))
+	}
+	return out
+}
+
+// block renders one block node.
+func (w *writer) block(n ast.Node) []string {
+	switch n := n.(type) {
+	case *ast.Heading:
+		title := w.inline(n)
+		level := min(n.Level, len(adornments)) - 1
+		return []string{title, strings.Repeat(adornments[level], max(width(title), 1))}
+
+	case *ast.Paragraph, *ast.TextBlock:
+		if img, ok := onlyImage(n); ok {
+			return w.image(img)
+		}
+		return strings.Split(w.inline(n), "\n")
+
+	case *ast.ThematicBreak:
+		return []string{"----"}
+
+	case *ast.FencedCodeBlock:
+		return codeBlock(string(n.Language(w.src)), w.lines(n))
+
+	case *ast.CodeBlock:
+		return codeBlock("", w.lines(n))
+
+	case *ast.HTMLBlock:
+		body := w.lines(n)
+		if n.HasClosure() {
+			body = append(body, strings.TrimRight(string(n.ClosureLine.Value(w.src)), "\n"))
+		}
+		return append([]string{".. raw:: html", ""}, indent(body, "   ")...)
+
+	case *ast.Blockquote:
+		return indent(w.blocks(n), "   ")
+
+	case *ast.List:
+		return w.list(n)
+
+	case *extast.Table:
+		return w.table(n)
+
+	case *extast.FootnoteList:
+		var out []string
+		for fn := n.FirstChild(); fn != nil; fn = fn.NextSibling() {
+			f := fn.(*extast.Footnote)
+			head := ".. [#" + label(f.Ref) + "] "
+			body := w.blocks(f)
+			if len(body) == 0 {
+				body = []string{""}
+			}
+			out = appendBlocks(out, append([]string{head + body[0]}, indent(body[1:], "   ")...))
+		}
+		return out
+	}
+	return nil
+}
+
+// lines returns the source lines of a leaf block without their newlines.
+func (w *writer) lines(n ast.Node) []string {
+	var out []string
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		seg := lines.At(i)
+		out = append(out, strings.Repeat(" ", seg.Padding)+strings.TrimRight(string(seg.Value(w.src)), "\n"))
+	}
+	return out
+}
+
+func codeBlock(lang string, lines []string) []string {
+	head := "::"
+	if lang != "" {
+		head = ".. code-block:: " + lang
+	}
+	if len(lines) == 0 {
+		lines = []string{""}
+	}
+	return append([]string{head, ""}, indent(lines, "   ")...)
+}
+
+// list renders a list with its items' content indented under the marker.
+func (w *writer) list(n *ast.List) []string {
+	var out []string
+	num := n.Start
+	if num == 0 {
+		num = 1
+	}
+	for item := n.FirstChild(); item != nil; item = item.NextSibling() {
+		marker := "- "
+		if n.IsOrdered() {
+			marker = strconv.Itoa(num) + ". "
+			num++
+		}
+		body := w.blocks(item)
+		if len(body) == 0 {
+			body = []string{""}
+		}
+		lines := append([]string{marker + body[0]}, indent(body[1:], strings.Repeat(" ", len(marker)))...)
+		if n.IsTight && !hasBlock(item) && (item.PreviousSibling() == nil || !hasBlock(item.PreviousSibling())) {
+			out = append(out, lines...)
+		} else {
+			out = appendBlocks(out, lines)
+		}
+	}
+	return out
+}
+
+// hasBlock reports whether a list item holds more than text, and so must be
+// separated from its neighbours by blank lines.
+func hasBlock(item ast.Node) bool {
+	for child := item.FirstChild(); child != nil; child = child.NextSibling() {
+		if child.Kind() != ast.KindTextBlock && child.Kind() != ast.KindParagraph {
+			return true
+		}
+	}
+	return false
+}
+
+// table renders a table as a list-table directive.
+func (w *writer) table(n *extast.Table) []string {
+	out := []string{".. list-table::"}
+	if header, ok := n.FirstChild().(*extast.TableHeader); ok && header != nil {
+		out = append(out, "   :header-rows: 1")
+	}
+	out = append(out, "")
+	for row := n.FirstChild(); row != nil; row = row.NextSibling() {
+		first := true
+		for cell := row.FirstChild(); cell != nil; cell = cell.NextSibling() {
+			prefix := "     - "
+			if first {
+				prefix = "   * - "
+				first = false
+			}
+			text := strings.ReplaceAll(w.inline(cell), "\n", " ")
+			out = append(out, strings.TrimRight(prefix+text, " "))
+		}
+	}
+	return out
+}
+
+// onlyImage returns the image a paragraph consists of, if it is nothing
+// else.
+func onlyImage(n ast.Node) (*ast.Image, bool) {
+	img, ok := n.FirstChild().(*ast.Image)
+	return img, ok && n.FirstChild() == n.LastChild()
+}
+
+// image renders an image directive.
+func (w *writer) image(img *ast.Image) []string {
+	out := []string{".. image:: " + string(img.Destination)}
+	if alt := plainText(img, w.src); alt != "" {
+		out = append(out, "   :alt: "+alt)
+	}
+	return out
+}
+
+// inline renders the inline content of n. reST only recognizes markup
+// between whitespace and punctuation, so markup touching a word gets an
+// escaped space, which renders as nothing.
+func (w *writer) inline(n ast.Node) string {
+	var b strings.Builder
+	var text strings.Builder // plain text not yet escaped
+	prevMarkup := false
+	for child := n.FirstChild(); child != nil; child = child.NextSibling() {
+		s, isMarkup := w.span(child)
+		if s == "" {
+			continue
+		}
+		if !isMarkup {
+			text.WriteString(s)
+			continue
+		}
+		// Escape text as a whole, since goldmark splits it at delimiters.
+		plain := escape(text.String())
+		text.Reset()
+		last, _ := utf8.DecodeLastRuneInString(b.String() + plain)
+		first, _ := utf8.DecodeRuneInString(plain)
+		if prevMarkup && plain != "" && !canFollow(first) {
+			b.WriteString(`\ `)
+		}
+		b.WriteString(plain)
+		if b.Len() > 0 && !canPrecede(last) {
+			b.WriteString(`\ `)
+		}
+		b.WriteString(s)
+		prevMarkup = true
+	}
+	plain := escape(text.String())
+	if first, _ := utf8.DecodeRuneInString(plain); prevMarkup && plain != "" && !canFollow(first) {
+		b.WriteString(`\ `)
+	}
+	b.WriteString(plain)
+	return strings.TrimRight(b.String(), " \n")
+}
+
+func canPrecede(r rune) bool {
+	return unicode.IsSpace(r) || strings.ContainsRune(`-:/'"<([{`, r)
+}
+
+func canFollow(r rune) bool {
+	return unicode.IsSpace(r) || strings.ContainsRune(`-.,:;!?\/'")]}>`, r)
+}
+
+// span renders one inline node and reports whether it is inline markup.
+// Text that isn't markup is returned unescaped.
+func (w *writer) span(n ast.Node) (string, bool) {
+	switch n := n.(type) {
+	case *ast.Text:
+		s := string(util.UnescapePunctuations(n.Segment.Value(w.src)))
+		if n.SoftLineBreak() || n.HardLineBreak() {
+			s += "\n"
+		}
+		return s, false
+	case *ast.String:
+		return string(n.Value), false
+	case *ast.CodeSpan:
+		return "``" + codeText(n, w.src) + "``", true
+	case *ast.Emphasis:
+		d := strings.Repeat("*", n.Level)
+		return d + escape(plainText(n, w.src)) + d, true
+	case *ast.Link:
+		return "`" + linkText(plainText(n, w.src)) + " <" + string(n.Destination) + ">`__", true
+	case *ast.AutoLink:
+		return string(n.URL(w.src)), false
+	case *ast.Image:
+		return "|" + w.substitution(plainText(n, w.src), string(n.Destination)) + "|", true
+	case *extast.FootnoteLink:
+		return "[#" + label(w.footnotes[n.Index]) + "]_", true
+	case *ast.RawHTML:
+		var b strings.Builder
+		for i := 0; i < n.Segments.Len(); i++ {
+			seg := n.Segments.At(i)
+			b.Write(seg.Value(w.src))
+		}
+		return b.String(), false
+	}
+	return plainText(n, w.src), false
+}
+
+// substitution returns the name of the substitution for an image with alt
+// text name, defining it unless the same image already is. Images without
+// alt text are numbered, as are those whose alt text names another image.
+func (w *writer) substitution(name, dest string) string {
+	if w.subDests == nil {
+		w.subDests = make(map[string]string)
+	}
+	base := name
+	for n := 1; ; n++ {
+		switch {
+		case name == "":
+		case w.subDests[name] == dest:
+			return name
+		case w.subDests[name] == "":
+			w.subDests[name] = dest
+			w.subs = append(w.subs, ".. |"+name+"| image:: "+dest)
+			return name
+		}
+		if base == "" {
+			name = "image" + strconv.Itoa(n)
+		} else {
+			name = base + " " + strconv.Itoa(n+1)
+		}
+	}
+}
+
+// plainText returns the text of an inline node without markup, with
+// Markdown's backslash escapes removed.
+func plainText(n ast.Node, src []byte) string {
+	var b strings.Builder
+	ast.Walk(n, func(c ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch c := c.(type) {
+		case *ast.Text:
+			b.Write(util.UnescapePunctuations(c.Segment.Value(src)))
+			if c.SoftLineBreak() || c.HardLineBreak() {
+				b.WriteByte(' ')
+			}
+		case *ast.String:
+			b.Write(c.Value)
+		case *ast.AutoLink:
+			b.Write(c.URL(src))
+		}
+		return ast.WalkContinue, nil
+	})
+	return b.String()
+}
+
+// codeText returns the text of a code span, in which backslashes are
+// literal.
+func codeText(n *ast.CodeSpan, src []byte) string {
+	var b strings.Builder
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		switch c := c.(type) {
+		case *ast.Text:
+			b.Write(c.Segment.Value(src))
+			if c.SoftLineBreak() || c.HardLineBreak() {
+				b.WriteByte(' ')
+			}
+		case *ast.String:
+			b.Write(c.Value)
+		}
+	}
+	return b.String()
+}
+
+// escape backslash-escapes the characters that start reST inline markup.
+func escape(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		switch r {
+		case '\\', '*', '`', '|':
+			b.WriteByte('\\')
+		case '_':
+			// Only a trailing underscore makes a reference.
+			next, _ := utf8.DecodeRuneInString(s[i+1:])
+			if i+1 == len(s) || !unicode.IsLetter(next) && !unicode.IsDigit(next) {
+				b.WriteByte('\\')
+			}
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// linkText escapes link text, in which "<" would start the target.
+func linkText(s string) string {
+	return strings.NewReplacer("`", "\\`", "<", "\\<").Replace(s)
+}
+
+// label makes a footnote label of a Markdown footnote reference.
+func label(ref []byte) string {
+	return strings.Trim(labelRe.ReplaceAllString(string(ref), "-"), "-")
+}
+
+// width returns the display width of s, for heading underlines.
+func width(s string) int {
+	n := 0
+	for _, r := range s {
+		if unicode.In(r, unicode.Han, unicode.Hangul, unicode.Hiragana, unicode.Katakana) {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+func indent(lines []string, prefix string) []string {
+	out := make([]string, len(lines))
+	for i, line := range lines {
+		if line != "" {
+			out[i] = prefix + line
+		}
+	}
+	return out
+}
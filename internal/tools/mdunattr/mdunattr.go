@@ -0,0 +1,103 @@
+// Package mdunattr removes Pandoc and kramdown attribute blocks
+// ({#id .class key=val}) from Markdown, for renderers that don't understand
+// them.
+package mdunattr
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/markdown"
+)
+
+// Flags defines mdunattr's flags on fs. Once fs is parsed, the function it
+// returns checks them and returns the transform.
+func Flags(fs *flag.FlagSet) func() (cli.TransformFunc, error) {
+	return func() (cli.TransformFunc, error) {
+		return transform, nil
+	}
+}
+
+// transform removes attribute blocks. Removing one can leave another where
+// it counts as one, as in {:{#a}} or a heading's {.a}{.b}, so it strips
+// again until nothing changes.
+func transform(content string) string {
+	for {
+		output := strip(content)
+		if output == content {
+			return output
+		}
+		content = output
+	}
+}
+
+func strip(content string) string {
+	lines := strings.Split(content, "\n")
+	start := markdown.FrontmatterEnd(lines)
+	code := markdown.CodeLines(lines, start)
+	headings := markdown.AttrHeadings(lines, start, code)
+	output := strings.Join(stripAttrs(lines, start, code, headings), "\n")
+	return strings.TrimRight(output, "\n") + "\n"
+}
+
+// stripAttrs removes heading attributes, span attributes, and kramdown IAL
+// lines. A bracketed span, [text]{.class}, keeps only its text.
+func stripAttrs(lines []string, start int, code []bool, headings []markdown.AttrHeading) []string {
+	trailing := make(map[int]markdown.AttrHeading)
+	for _, h := range headings {
+		trailing[h.Line] = h
+	}
+	result := append([]string(nil), lines[:start]...)
+	for i := start; i < len(lines); i++ {
+		line := lines[i]
+		if code[i] {
+			result = append(result, line)
+			continue
+		}
+		if markdown.IsIAL(line) {
+			// Don't leave two blank lines where it stood alone.
+			if len(result) > 0 && strings.TrimSpace(result[len(result)-1]) == "" && i+1 < len(lines) && strings.TrimSpace(lines[i+1]) == "" {
+				i++
+			}
+			continue
+		}
+		if h, ok := trailing[i]; ok && h.Attrs != "" {
+			line = markdown.SetHeadingText(line, h.Text)
+		}
+		result = append(result, stripSpans(line))
+	}
+	return result
+}
+
+// stripSpans removes the span attribute blocks in line, unwrapping bracketed
+// spans.
+func stripSpans(line string) string {
+	locs := markdown.SpanAttrs(line)
+	for k := len(locs) - 1; k >= 0; k-- {
+		open, end := locs[k][0], locs[k][1]
+		line = line[:open] + line[end:]
+		if line[open-1] != ']' {
+			continue
+		}
+		// Find the "[" matching the "]" before the block. If it closes a
+		// link's reference label or follows "!", it's not a bracketed span.
+		depth := 0
+		for j := open - 1; j >= 0; j-- {
+			switch line[j] {
+			case ']':
+				depth++
+			case '[':
+				depth--
+			}
+			if depth == 0 {
+				if j > 0 && (line[j-1] == ']' || line[j-1] == '!') {
+					break
+				}
+				line = line[:j] + line[j+1:open-1] + line[open:]
+				break
+			}
+		}
+	}
+	return line
+}
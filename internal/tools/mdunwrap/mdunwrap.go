@@ -0,0 +1,59 @@
+// Package mdunwrap unwraps Markdown paragraphs to single long lines.
+package mdunwrap
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/markdown"
+)
+
+// Flags defines mdunwrap's flags on fs. Once fs is parsed, the function it
+// returns checks them and returns the transform.
+func Flags(fs *flag.FlagSet) func() (cli.TransformFunc, error) {
+	o := &options{
+		breaks: fs.String("breaks", markdown.BreakKeep, "write hard line breaks as `style`: keep, spaces (two trailing spaces), or backslash"),
+	}
+	return func() (cli.TransformFunc, error) {
+		if err := markdown.CheckHardBreaks(*o.breaks); err != nil {
+			return nil, err
+		}
+		return o.transform, nil
+	}
+}
+
+// options holds mdunwrap's flags.
+type options struct {
+	breaks *string
+}
+
+func (o *options) transform(content string) string {
+	return markdown.Transform(content, markdown.Handlers{
+		Paragraph:  unwrapParagraph,
+		Blockquote: unwrapBlockquote,
+		HardBreaks: *o.breaks,
+	})
+}
+
+// unwrapParagraph joins lines into a single line.
+func unwrapParagraph(lines []string) []string {
+	// Join all lines into one
+	text := strings.Join(lines, " ")
+	// Normalize multiple spaces
+	text = strings.Join(strings.Fields(text), " ")
+	return []string{text}
+}
+
+// unwrapBlockquote unwraps blockquote lines into single lines per paragraph.
+func unwrapBlockquote(lines []string) []string {
+	return markdown.TransformBlockquote(lines, func(content []string) []string {
+		return []string{"> " + joinLines(content)}
+	})
+}
+
+// joinLines joins lines into a single line.
+func joinLines(lines []string) string {
+	text := strings.Join(lines, " ")
+	return strings.Join(strings.Fields(text), " ")
+}
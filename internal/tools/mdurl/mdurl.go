@@ -0,0 +1,211 @@
+// Package mdurl normalizes the URLs of links: it strips tracking parameters,
+// upgrades http to https for hosts known to serve it, and optionally resolves
+// redirects and canonicalizes trailing slashes.
+package mdurl
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/corpus"
+)
+
+// Flags defines mdurl's flags on fs. Once fs is parsed, the function it
+// returns checks them and returns the transform.
+func Flags(fs *flag.FlagSet) func() (cli.TransformFunc, error) {
+	o := &options{
+		extraHosts: fs.String("https", "", "comma-separated `hosts` to upgrade to https, in addition to the built-in list"),
+		slash:      fs.String("slash", "keep", "trailing slash on paths: keep, strip, or add (to paths without a file extension)"),
+		resolve:    fs.Bool("resolve", false, "follow redirects over the network and use the final URL"),
+		report:     fs.Bool("report", false, "print each rewritten URL as \"old -> new\" on stderr"),
+	}
+	return func() (cli.TransformFunc, error) {
+		if *o.slash != "keep" && *o.slash != "strip" && *o.slash != "add" {
+			return nil, fmt.Errorf("unknown -slash %q (want keep, strip, or add)", *o.slash)
+		}
+		o.hosts = append([]string(nil), httpsHosts...)
+		for _, h := range strings.Split(*o.extraHosts, ",") {
+			if h = strings.TrimSpace(h); h != "" {
+				o.hosts = append(o.hosts, strings.ToLower(h))
+			}
+		}
+		return o.transform, nil
+	}
+}
+
+// options holds mdurl's flags.
+type options struct {
+	extraHosts *string
+	slash      *string
+	resolve    *bool
+	report     *bool
+
+	// hosts is httpsHosts plus the -https hosts.
+	hosts []string
+}
+
+// trackingParams are query parameters that only identify where a click came
+// from. Parameters starting with "utm_" are removed as well.
+var trackingParams = map[string]bool{
+	"fbclid": true, "gclid": true, "dclid": true, "gbraid": true, "wbraid": true,
+	"msclkid": true, "yclid": true, "twclid": true, "igshid": true,
+	"mc_cid": true, "mc_eid": true, "_hsenc": true, "_hsmi": true,
+	"mkt_tok": true, "oly_anon_id": true, "oly_enc_id": true, "vero_id": true,
+}
+
+// httpsHosts serve the same content over https. Subdomains match too.
+var httpsHosts = []string{
+	"github.com", "githubusercontent.com", "gitlab.com", "bitbucket.org",
+	"wikipedia.org", "wikimedia.org", "youtube.com", "youtu.be",
+	"twitter.com", "x.com", "google.com", "stackoverflow.com",
+	"stackexchange.com", "medium.com", "reddit.com", "apple.com",
+	"microsoft.com", "mozilla.org", "golang.org", "go.dev",
+	"npmjs.com", "pypi.org", "archive.org", "substack.com",
+}
+
+func (o *options) transform(content string) string {
+	rewrites := make(map[string]string)
+	output := corpus.RewriteDests(content, func(dest string) string {
+		if rewritten, done := rewrites[dest]; done {
+			return rewritten
+		}
+		rewrites[dest] = o.normalize(dest)
+		if *o.report && rewrites[dest] != dest {
+			fmt.Fprintf(os.Stderr, "%s -> %s\n", dest, rewrites[dest])
+		}
+		return rewrites[dest]
+	})
+	return strings.TrimRight(output, "\n") + "\n"
+}
+
+// normalize returns the canonical form of an http(s) URL. Anything else is
+// returned unchanged.
+func (o *options) normalize(raw string) string {
+	lower := strings.ToLower(raw)
+	if !strings.HasPrefix(lower, "http://") && !strings.HasPrefix(lower, "https://") {
+		return raw
+	}
+	u := raw
+	if *o.resolve {
+		u = follow(u)
+	}
+	base, query, fragment := split(u)
+	if o.upgradeable(base) {
+		base = "https" + base[len("http"):]
+	}
+	base = o.canonicalSlash(base)
+	query = stripTracking(query)
+
+	out := base
+	if query != "" {
+		out += "?" + query
+	}
+	if fragment != "" {
+		out += "#" + fragment
+	}
+	return out
+}
+
+// split divides a URL into the part before the query, the query, and the
+// fragment, leaving each exactly as written.
+func split(u string) (base, query, fragment string) {
+	if i := strings.IndexByte(u, '#'); i >= 0 {
+		u, fragment = u[:i], u[i+1:]
+	}
+	if i := strings.IndexByte(u, '?'); i >= 0 {
+		u, query = u[:i], u[i+1:]
+	}
+	return u, query, fragment
+}
+
+// stripTracking removes tracking parameters from a raw query, keeping the
+// order and encoding of the rest.
+func stripTracking(query string) string {
+	var kept []string
+	for _, p := range strings.Split(query, "&") {
+		key, _, _ := strings.Cut(p, "=")
+		key = strings.ToLower(key)
+		if p == "" || strings.HasPrefix(key, "utm_") || trackingParams[key] {
+			continue
+		}
+		kept = append(kept, p)
+	}
+	return strings.Join(kept, "&")
+}
+
+// upgradeable reports whether base is an http URL for a host in o.hosts.
+func (o *options) upgradeable(base string) bool {
+	if !strings.HasPrefix(strings.ToLower(base), "http://") {
+		return false
+	}
+	host, _, _ := strings.Cut(base[len("http://"):], "/")
+	host = strings.ToLower(host)
+	if i := strings.LastIndexByte(host, '@'); i >= 0 {
+		host = host[i+1:]
+	}
+	if h, _, hasPort := strings.Cut(host, ":"); hasPort {
+		host = h
+	}
+	for _, known := range o.hosts {
+		if host == known || strings.HasSuffix(host, "."+known) {
+			return true
+		}
+	}
+	return false
+}
+
+// canonicalSlash applies -slash to the path of base. The root path is left
+// alone.
+func (o *options) canonicalSlash(base string) string {
+	scheme := strings.Index(base, "://") + len("://")
+	i := strings.IndexByte(base[scheme:], '/')
+	if i < 0 {
+		return base
+	}
+	p := base[scheme+i:]
+	switch {
+	case p == "/":
+		return base
+	case *o.slash == "strip":
+		return strings.TrimRight(base, "/")
+	case *o.slash == "add" && !strings.HasSuffix(p, "/") && path.Ext(p) == "":
+		return base + "/"
+	}
+	return base
+}
+
+// client follows redirects for -resolve.
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// follow returns the URL that u finally redirects to, or u if the request
+// fails or doesn't redirect.
+func follow(u string) string {
+	resp, err := client.Head(u)
+	if err == nil && resp.StatusCode == http.StatusMethodNotAllowed {
+		resp.Body.Close()
+		resp, err = client.Get(u)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mdurl: %v\n", err)
+		return u
+	}
+	resp.Body.Close()
+	// The final request carries the redirect response that caused it; the
+	// first one doesn't.
+	if resp.StatusCode >= 400 || resp.Request.Response == nil {
+		return u
+	}
+	final := resp.Request.URL.String()
+	if resp.Request.URL.Fragment == "" {
+		if _, _, fragment := split(u); fragment != "" {
+			final += "#" + fragment
+		}
+	}
+	return final
+}
@@ -0,0 +1,327 @@
+// Package mdwrap wraps Markdown paragraphs to a specified width (default 60),
+// or with width 0, joins them onto one line.
+package mdwrap
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/markdown"
+)
+
+// Flags defines mdwrap's flags on fs. Once fs is parsed, the function it
+// returns checks them and returns the transform.
+func Flags(fs *flag.FlagSet) func() (cli.TransformFunc, error) {
+	setup := StreamFlags(fs)
+	return func() (cli.TransformFunc, error) {
+		transform, _, err := setup()
+		return transform, err
+	}
+}
+
+// StreamFlags is Flags for a command that wraps its input as a stream, so
+// files larger than memory can be wrapped. The stream's output is the same
+// as the transform's.
+func StreamFlags(fs *flag.FlagSet) func() (cli.TransformFunc, cli.StreamFunc, error) {
+	o := &options{
+		width:     fs.Int("c", 60, "column width to wrap to, or 0 to join each paragraph onto one line"),
+		footnotes: fs.Bool("f", false, "wrap footnote bodies, indenting continuation lines 4 spaces"),
+		breaks:    fs.String("breaks", markdown.BreakKeep, "write hard line breaks as `style`: keep, spaces (two trailing spaces), or backslash"),
+		widows:    fs.Bool("widows", false, "avoid widows: move a word down so that no paragraph ends with a line of one word"),
+	}
+	fs.IntVar(o.width, "width", 60, "the same as -c")
+	return func() (cli.TransformFunc, cli.StreamFunc, error) {
+		if *o.width < 0 {
+			return nil, nil, fmt.Errorf("-c and -width must be 0 or more")
+		}
+		if err := markdown.CheckHardBreaks(*o.breaks); err != nil {
+			return nil, nil, err
+		}
+		return o.transform, o.stream, nil
+	}
+}
+
+// options holds mdwrap's flags.
+type options struct {
+	width     *int
+	footnotes *bool
+	breaks    *string
+	widows    *bool
+
+	off bool // the document's frontmatter turns wrapping off
+}
+
+// footnoteIndent prefixes continuation lines of a wrapped footnote. Four spaces
+// keeps the continuation parsable as part of the footnote in strict engines.
+const footnoteIndent = "    "
+
+func (o *options) transform(content string) string {
+	return markdown.Transform(content, o.handlers())
+}
+
+func (o *options) stream(r io.Reader, w io.Writer) error {
+	return markdown.TransformStream(r, w, o.handlers())
+}
+
+// handlers returns the handlers for one document, with options of its own
+// for its frontmatter to change.
+func (o *options) handlers() markdown.Handlers {
+	width := *o.width
+	d := &options{width: &width, footnotes: o.footnotes, breaks: o.breaks, widows: o.widows}
+	h := markdown.Handlers{
+		Paragraph:   d.unlessOff(d.wrapParagraph),
+		Blockquote:  d.unlessOff(d.wrapBlockquote),
+		ListItem:    d.unlessOff(d.wrapListItem),
+		Frontmatter: d.configure,
+		HardBreaks:  *o.breaks,
+
+		LinkDefinition: d.unlessOff(d.wrapLinkDefinition),
+	}
+	if *o.footnotes {
+		h.Footnote = d.unlessOff(d.wrapFootnote)
+	}
+	return h
+}
+
+// configure applies the wrap setting in the md-tools field of a document's
+// frontmatter, as in "md-tools: {wrap: 100}": a width, which overrides -c
+// and .editorconfig, or off, which leaves the document's lines as they are.
+// Other values are ignored.
+func (o *options) configure(lines []string) {
+	fields, _, err := markdown.ParseFrontmatter(lines)
+	if err != nil {
+		return
+	}
+	settings, _ := fields["md-tools"].(map[string]any)
+	switch wrap := settings["wrap"].(type) {
+	case float64:
+		if wrap >= 0 && wrap == math.Trunc(wrap) {
+			*o.width = int(wrap)
+		}
+	case string:
+		o.off = wrap == "off"
+	case bool:
+		o.off = !wrap
+	}
+}
+
+// unlessOff returns a handler that runs f, or passes lines through when the
+// document turns wrapping off.
+func (o *options) unlessOff(f func([]string) []string) func([]string) []string {
+	return func(lines []string) []string {
+		if o.off {
+			return lines
+		}
+		return f(lines)
+	}
+}
+
+// wrapFootnote wraps a footnote definition's body to the column width, keeping
+// the "[^label]: " marker on the first line and indenting continuation lines.
+func (o *options) wrapFootnote(lines []string) []string {
+	idx := strings.Index(lines[0], "]:")
+	prefix := lines[0][:idx+2] + " "
+	body := append([]string{strings.TrimLeft(lines[0][idx+2:], " \t")}, lines[1:]...)
+	return o.hang(prefix, footnoteIndent, body)
+}
+
+// wrapLinkDefinition moves the title of a link reference definition too long
+// for one line onto continuation lines, wrapped and indented like a
+// footnote's. The label and destination can't be broken, so they stay on the
+// first line. Definitions that fit, or have no title, are joined onto one.
+func (o *options) wrapLinkDefinition(lines []string) []string {
+	trimmed := make([]string, len(lines))
+	for i, line := range lines {
+		trimmed[i] = strings.TrimSpace(line)
+	}
+	head, title, ok := markdown.CutLinkTitle(strings.Join(trimmed, " "))
+	switch {
+	case !ok: // a title that never closes isn't one, so leave it as written
+		return lines
+	case title == "":
+		return trimmed
+	}
+	if line := head + " " + title; *o.width == 0 || utf8.RuneCountInString(line) <= *o.width {
+		return []string{line}
+	}
+	return append([]string{head}, o.hang(footnoteIndent, footnoteIndent, []string{title})...)
+}
+
+// wrapListItem wraps a list item's text to the column width, keeping its
+// marker and any task box on the first line and indenting continuation lines
+// to align under its content, however deeply the item is nested.
+func (o *options) wrapListItem(lines []string) []string {
+	prefix := markdown.ListItemLead(lines[0])
+	first := prefix + taskBoxRe.FindString(lines[0][len(prefix):])
+	body := append([]string{lines[0][len(first):]}, lines[1:]...)
+	return o.hang(first, strings.Repeat(" ", len(prefix)), body)
+}
+
+// taskBoxRe matches a task list item's box, such as "[ ] " or "[x] ".
+var taskBoxRe = regexp.MustCompile(`^\[[ xX]\](?: +|$)`)
+
+// hang wraps lines to the column width after first on the first line and
+// after indent on the rest. A hard line break ends its line, and wrapping
+// starts again after it.
+func (o *options) hang(first, indent string, lines []string) []string {
+	var result []string
+	start := 0
+	for i, line := range lines {
+		text, brk := markdown.CutHardBreak(line)
+		if brk == "" && i < len(lines)-1 {
+			continue
+		}
+		words := wrapWords(strings.Join(append(lines[start:i:i], text), " "))
+		start = i + 1
+		if len(words) == 0 {
+			if len(result) == 0 {
+				result = append(result, strings.TrimRight(first, " ")+brk)
+			}
+			continue
+		}
+		prefix, width := indent, o.within(len(indent))
+		if len(result) == 0 {
+			prefix = first
+		}
+		for _, l := range o.fill(words, o.within(utf8.RuneCountInString(prefix)), width) {
+			result = append(result, prefix+l)
+			prefix = indent
+		}
+		result[len(result)-1] += brk
+	}
+	return result
+}
+
+func (o *options) wrapParagraph(lines []string) []string {
+	return o.fill(wrapWords(strings.Join(lines, " ")), *o.width, *o.width)
+}
+
+// wrapBlockquote wraps blockquote lines, accounting for the "> " prefix in width.
+func (o *options) wrapBlockquote(lines []string) []string {
+	const prefix = "> "
+	contentWidth := o.within(len(prefix))
+	return markdown.TransformBlockquote(lines, func(content []string) []string {
+		var out []string
+		for _, w := range o.fill(wrapWords(strings.Join(content, " ")), contentWidth, contentWidth) {
+			out = append(out, prefix+w)
+		}
+		return out
+	})
+}
+
+// within returns the width left for text after a prefix of n columns: at
+// least 1, or 0 for no limit.
+func (o *options) within(n int) int {
+	if *o.width == 0 {
+		return 0
+	}
+	return max(*o.width-n, 1)
+}
+
+// fill breaks words into lines greedily, each as long as fits in width, or
+// in first for the first line; 0 is no limit. A word that would start a block
+// at the start of a line stays on the line before it, even past the width.
+// With -widows, a last line of one word takes the last word of the line
+// before it too, if both fit and that line keeps a word.
+func (o *options) fill(words []string, first, width int) []string {
+	var lines [][]string
+	n := 0 // the current line's length
+	for _, word := range words {
+		limit := width
+		if len(lines) == 1 {
+			limit = first
+		}
+		size := utf8.RuneCountInString(word)
+		if len(lines) == 0 || limit != 0 && n+1+size > limit && !markdown.StartsBlock(word) {
+			lines = append(lines, []string{word})
+			n = size
+			continue
+		}
+		lines[len(lines)-1] = append(lines[len(lines)-1], word)
+		n += 1 + size
+	}
+
+	if k := len(lines) - 1; *o.widows && k > 0 && len(lines[k]) == 1 && len(lines[k-1]) > 1 {
+		prev := lines[k-1]
+		moved := prev[len(prev)-1]
+		if joined := moved + " " + lines[k][0]; !markdown.StartsBlock(moved) && (width == 0 || utf8.RuneCountInString(joined) <= width) {
+			lines[k-1], lines[k] = prev[:len(prev)-1], []string{moved, lines[k][0]}
+		}
+	}
+
+	result := make([]string, len(lines))
+	for i, line := range lines {
+		result[i] = strings.Join(line, " ")
+	}
+	return result
+}
+
+// wrapWords splits text into the units that wrapping may break between:
+// words, except that inline math and an Obsidian comment (%%…%%) are one
+// unit each and a trailing block ID (^id) stays with the word before it.
+func wrapWords(text string) []string {
+	var words []string
+	fields := mathFields(text)
+	for i := 0; i < len(fields); i++ {
+		word := fields[i]
+		if strings.HasPrefix(word, "%%") && (len(word) < 4 || !strings.HasSuffix(word, "%%")) {
+			for i+1 < len(fields) && !strings.Contains(word[2:], "%%") {
+				i++
+				word += " " + fields[i]
+			}
+		}
+		words = append(words, word)
+	}
+	if n := len(words); n > 1 && markdown.IsBlockID(words[n-1]) {
+		words = append(words[:n-2], words[n-2]+" "+words[n-1])
+	}
+	return words
+}
+
+// mathFields splits text at spaces, as strings.Fields does, except inside
+// inline math ($…$, \(…\), and the like), which MathJax and KaTeX can't render
+// once it's broken across lines. A math span's spaces are collapsed to one
+// instead. A $ in a code span or escaped with a backslash isn't math.
+func mathFields(text string) []string {
+	var fields []string
+	var field strings.Builder
+	code := 0 // the end of the code span text[i] is in, if any
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			if field.Len() > 0 {
+				fields = append(fields, field.String())
+				field.Reset()
+			}
+			i++
+			continue
+		case i < code:
+		case c == '`':
+			code, _ = markdown.SkipLiteral(text, i)
+		case c == '$' || c == '\\':
+			if end := markdown.MathEnd(text, i); end > i {
+				field.WriteString(strings.Join(strings.Fields(text[i:end]), " "))
+				i = end
+				continue
+			}
+			if c == '\\' && i+1 < len(text) && !strings.ContainsRune(" \t\n", rune(text[i+1])) {
+				field.WriteString(text[i : i+2])
+				i += 2
+				continue
+			}
+		}
+		field.WriteByte(c)
+		i++
+	}
+	if field.Len() > 0 {
+		fields = append(fields, field.String())
+	}
+	return fields
+}
@@ -0,0 +1,217 @@
+// Package tools runs the filter tools in-process, configured by options
+// instead of command-line flags.
+package tools
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/tools/mdattr"
+	"github.com/dbh/md-tools/internal/tools/mdcase"
+	"github.com/dbh/md-tools/internal/tools/mdcomments"
+	"github.com/dbh/md-tools/internal/tools/mdconvert"
+	"github.com/dbh/md-tools/internal/tools/mdcritic"
+	"github.com/dbh/md-tools/internal/tools/mddraft"
+	"github.com/dbh/md-tools/internal/tools/mdemph"
+	"github.com/dbh/md-tools/internal/tools/mdextlink"
+	"github.com/dbh/md-tools/internal/tools/mdfence"
+	"github.com/dbh/md-tools/internal/tools/mdfnt"
+	"github.com/dbh/md-tools/internal/tools/mdfootnote"
+	"github.com/dbh/md-tools/internal/tools/mdinline"
+	"github.com/dbh/md-tools/internal/tools/mdjoin"
+	"github.com/dbh/md-tools/internal/tools/mdlist"
+	"github.com/dbh/md-tools/internal/tools/mdmath"
+	"github.com/dbh/md-tools/internal/tools/mdpaste"
+	"github.com/dbh/md-tools/internal/tools/mdreading"
+	"github.com/dbh/md-tools/internal/tools/mdref"
+	"github.com/dbh/md-tools/internal/tools/mdsidenote"
+	"github.com/dbh/md-tools/internal/tools/mdsmart"
+	"github.com/dbh/md-tools/internal/tools/mdsplit"
+	"github.com/dbh/md-tools/internal/tools/mdtable"
+	"github.com/dbh/md-tools/internal/tools/mdtoadoc"
+	"github.com/dbh/md-tools/internal/tools/mdtodjot"
+	"github.com/dbh/md-tools/internal/tools/mdtorst"
+	"github.com/dbh/md-tools/internal/tools/mdunattr"
+	"github.com/dbh/md-tools/internal/tools/mdunwrap"
+	"github.com/dbh/md-tools/internal/tools/mdurl"
+	"github.com/dbh/md-tools/internal/tools/mdwrap"
+)
+
+// FlagsFunc defines a tool's flags on fs. Once fs is parsed, the function it
+// returns checks them and returns the transform.
+type FlagsFunc func(fs *flag.FlagSet) func() (cli.TransformFunc, error)
+
+// registry holds the tools that transform one document without side effects.
+// mdexec is left out: it reports through its exit status and runs the code it
+// finds.
+var registry = map[string]FlagsFunc{
+	"mdattr":     mdattr.Flags,
+	"mdcase":     mdcase.Flags,
+	"mdcomments": mdcomments.Flags,
+	"mdconvert":  mdconvert.Flags,
+	"mdcritic":   mdcritic.Flags,
+	"mddraft":    mddraft.Flags,
+	"mdemph":     mdemph.Flags,
+	"mdextlink":  mdextlink.Flags,
+	"mdfence":    mdfence.Flags,
+	"mdfnt":      mdfnt.Flags,
+	"mdfootnote": mdfootnote.Flags,
+	"mdinline":   mdinline.Flags,
+	"mdjoin":     mdjoin.Flags,
+	"mdlist":     mdlist.Flags,
+	"mdmath":     mdmath.Flags,
+	"mdpaste":    mdpaste.Flags,
+	"mdreading":  mdreading.Flags,
+	"mdref":      mdref.Flags,
+	"mdsidenote": mdsidenote.Flags,
+	"mdsmart":    mdsmart.Flags,
+	"mdsplit":    mdsplit.Flags,
+	"mdtable":    mdtable.Flags,
+	"mdtoadoc":   mdtoadoc.Flags,
+	"mdtodjot":   mdtodjot.Flags,
+	"mdtorst":    mdtorst.Flags,
+	"mdunattr":   mdunattr.Flags,
+	"mdunwrap":   mdunwrap.Flags,
+	"mdurl":      mdurl.Flags,
+	"mdwrap":     mdwrap.Flags,
+}
+
+// StreamFlagsFunc is FlagsFunc for a tool that can also transform its input
+// as a stream.
+type StreamFlagsFunc func(fs *flag.FlagSet) func() (cli.TransformFunc, cli.StreamFunc, error)
+
+// streams holds the registry tools that can transform a stream without
+// reading it whole.
+var streams = map[string]StreamFlagsFunc{
+	"mdwrap": mdwrap.StreamFlags,
+}
+
+// Names returns the names of the tools, sorted.
+func Names() []string {
+	var names []string
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Lookup returns the named tool's FlagsFunc. The "md" prefix is optional, so
+// "wrap" finds mdwrap.
+func Lookup(name string) (FlagsFunc, bool) {
+	f, ok := registry[toolName(name)]
+	return f, ok
+}
+
+// toolName adds the "md" prefix to name if it's missing.
+func toolName(name string) string {
+	if !strings.HasPrefix(name, "md") {
+		name = "md" + name
+	}
+	return name
+}
+
+// New returns the named tool's transform with options set as if they had
+// been given as flags. Option values are strings, numbers, or booleans, as
+// decoding the JSON object {"c": 72, "f": true} produces.
+func New(name string, options map[string]any) (cli.TransformFunc, error) {
+	flags, ok := Lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown tool %q", name)
+	}
+	fs := newFlagSet(name)
+	setup := flags(fs)
+	if err := setOptions(fs, name, options); err != nil {
+		return nil, err
+	}
+	return setup()
+}
+
+// NewStream is New for a stream: the StreamFunc it returns reads the
+// document from r and writes the result to w. Tools that can transform a
+// stream hold little of it in memory; the rest read it whole before
+// writing any of it.
+func NewStream(name string, options map[string]any) (cli.StreamFunc, error) {
+	flags, ok := streams[toolName(name)]
+	if !ok {
+		transform, err := New(name, options)
+		if err != nil {
+			return nil, err
+		}
+		return func(r io.Reader, w io.Writer) error {
+			data, err := io.ReadAll(r)
+			if err != nil {
+				return err
+			}
+			_, err = io.WriteString(w, transform(string(data)))
+			return err
+		}, nil
+	}
+	fs := newFlagSet(name)
+	setup := flags(fs)
+	if err := setOptions(fs, name, options); err != nil {
+		return nil, err
+	}
+	_, stream, err := setup()
+	return stream, err
+}
+
+// Transform runs the named tool, configured by options as for New, on the
+// document read from r and writes the result to w.
+func Transform(name string, r io.Reader, w io.Writer, options map[string]any) error {
+	stream, err := NewStream(name, options)
+	if err != nil {
+		return err
+	}
+	return stream(r, w)
+}
+
+// newFlagSet returns an empty flag set for the named tool that reports
+// errors without printing them.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+// setOptions sets the flags on fs that options name.
+func setOptions(fs *flag.FlagSet, name string, options map[string]any) error {
+	keys := make([]string, 0, len(options))
+	for key := range options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if fs.Lookup(key) == nil {
+			return fmt.Errorf("%s has no option %q", name, key)
+		}
+		s, err := optionString(options[key])
+		if err == nil {
+			err = fs.Set(key, s)
+		}
+		if err != nil {
+			return fmt.Errorf("option %q: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// optionString formats an option value the way it would be written as a flag.
+func optionString(v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case int:
+		return strconv.Itoa(v), nil
+	}
+	return "", fmt.Errorf("unsupported value %v", v)
+}
@@ -0,0 +1,47 @@
+// Package mdtools runs the md-tools filters from Go programs, configured by
+// options instead of command-line flags:
+//
+//	err := mdtools.Transform("wrap", r, w, map[string]any{"c": 72, "f": true})
+//
+// Tool names are those of the binaries, with the "md" prefix optional, and
+// options are their flags by name.
+package mdtools
+
+import (
+	"io"
+
+	"github.com/dbh/md-tools/internal/cli"
+	"github.com/dbh/md-tools/internal/tools"
+)
+
+// TransformFunc returns the transformed document.
+type TransformFunc = cli.TransformFunc
+
+// StreamFunc reads a document from r and writes the transformed document to
+// w.
+type StreamFunc = cli.StreamFunc
+
+// Names returns the names of the tools, sorted.
+func Names() []string {
+	return tools.Names()
+}
+
+// New returns the named tool's transform with options set as if they had
+// been given as flags. Option values are strings, numbers, or booleans, as
+// decoding the JSON object {"c": 72, "f": true} produces.
+func New(name string, options map[string]any) (TransformFunc, error) {
+	return tools.New(name, options)
+}
+
+// NewStream is New for a stream. Tools that can transform a stream, like
+// mdwrap, hold little of it in memory; the rest read it whole before
+// writing any of it.
+func NewStream(name string, options map[string]any) (StreamFunc, error) {
+	return tools.NewStream(name, options)
+}
+
+// Transform runs the named tool, configured by options as for New, on the
+// document read from r and writes the result to w.
+func Transform(name string, r io.Reader, w io.Writer, options map[string]any) error {
+	return tools.Transform(name, r, w, options)
+}
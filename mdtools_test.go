@@ -0,0 +1,402 @@
+package fixtures_test
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// mdtoolsRepo returns a git repository with files, the path of mdtools, and
+// an environment whose $PATH has mdtools and the tools it runs.
+func mdtoolsRepo(t *testing.T, files map[string]string, tools ...string) (string, string, []string) {
+	t.Helper()
+	bin := t.TempDir()
+	for _, tool := range append([]string{"mdtools"}, tools...) {
+		if err := os.Rename(buildTool(t, tool), filepath.Join(bin, tool)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	env := append(os.Environ(), "PATH="+bin+string(os.PathListSeparator)+os.Getenv("PATH"),
+		"GIT_CONFIG_GLOBAL="+os.DevNull, "GIT_CONFIG_NOSYSTEM=1",
+		"GIT_AUTHOR_NAME=a", "GIT_AUTHOR_EMAIL=a@example.com",
+		"GIT_COMMITTER_NAME=a", "GIT_COMMITTER_EMAIL=a@example.com")
+	root := writeTree(t, files)
+	cmd := exec.Command("git", "init", "-q")
+	cmd.Dir, cmd.Env = root, env
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v\n%s", err, out)
+	}
+	return root, filepath.Join(bin, "mdtools"), env
+}
+
+// runIn runs name with args in dir and returns its combined output and exit
+// status.
+func runIn(t *testing.T, dir string, env []string, name string, args ...string) (string, int) {
+	t.Helper()
+	cmd := exec.Command(name, args...)
+	cmd.Dir, cmd.Env = dir, env
+	out, err := cmd.CombinedOutput()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return string(out), exitErr.ExitCode()
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return string(out), 0
+}
+
+// TestMergeDriver verifies mdtools merge-driver merges paragraphs sentence by
+// sentence regardless of wrapping, keeps a side as written when only it
+// changed, and marks conflicting sentences.
+func TestMergeDriver(t *testing.T) {
+	binary := buildTool(t, "mdtools")
+	cases := []struct {
+		name   string
+		base   string
+		ours   string
+		theirs string
+		want   string
+		status int
+	}{
+		{
+			name:   "rewrapped and edited",
+			base:   "# Title\n\nThe first sentence is here. The second one\nfollows it. The third sentence ends.\n",
+			ours:   "# Title\n\nThe first sentence is changed.\nThe second one follows it.\nThe third sentence ends.\n",
+			theirs: "# Title\n\nThe first sentence is here. The second one follows it. The third sentence is\nedited by them.\n",
+			want:   "# Title\n\nThe first sentence is changed.\nThe second one follows it.\nThe third sentence is edited by them.\n",
+		},
+		{
+			name:   "only rewrapped",
+			base:   "One sentence. Another\nsentence.\n\nMore.\n",
+			ours:   "One sentence.\nAnother sentence.\n\nMore.\n",
+			theirs: "One sentence. Another\nsentence.\n\nMore text.\n",
+			want:   "One sentence. Another\nsentence.\n\nMore text.\n",
+		},
+		{
+			name:   "code kept",
+			base:   "Intro.\n\n```\na. b.\n```\n",
+			ours:   "Intro changed.\n\n```\na. b.\n```\n",
+			theirs: "Intro.\n\n```\na. b.\nc.\n```\n",
+			want:   "Intro changed.\n\n```\na. b.\nc.\n```\n",
+		},
+		{
+			name:   "conflict",
+			base:   "# T\n\nOne. Two.\n",
+			ours:   "# T\n\nUno. Two.\n",
+			theirs: "# T\n\nEin.\nTwo.\n",
+			want:   "# T\n\n<<<<<<< ours\nUno.\n=======\nEin.\n>>>>>>> theirs\nTwo.\n",
+			status: 1,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			var paths []string
+			for _, f := range []struct{ name, content string }{{"base", tc.base}, {"ours", tc.ours}, {"theirs", tc.theirs}} {
+				p := filepath.Join(dir, f.name)
+				if err := os.WriteFile(p, []byte(f.content), 0644); err != nil {
+					t.Fatal(err)
+				}
+				paths = append(paths, p)
+			}
+			out, err := exec.Command(binary, append([]string{"merge-driver"}, paths...)...).CombinedOutput()
+			status := 0
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				status = exitErr.ExitCode()
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if status != tc.status {
+				t.Fatalf("expected exit status %d, got %d\n%s", tc.status, status, out)
+			}
+			got, err := os.ReadFile(paths[1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("--- expected\n%s\n--- actual\n%s", tc.want, got)
+			}
+		})
+	}
+}
+
+// TestNormalize verifies mdtools normalize gives documents that differ only in
+// wrapping and link style the same canonical form.
+func TestNormalize(t *testing.T) {
+	binary := buildTool(t, "mdtools")
+	want := "# Notes\n\nSee [the docs](https://example.com \"Docs\") for more.\nIt is wrapped.\n\n```\n[x][d] stays. As is.\n```\n"
+	inputs := []string{
+		"# Notes\n\nSee [the docs][d] for more. It is\nwrapped.\n\n```\n[x][d] stays. As is.\n```\n\n[d]: https://example.com \"Docs\"\n",
+		"# Notes\n\nSee [the docs](https://example.com \"Docs\") for more.\nIt is wrapped.\n\n```\n[x][d] stays. As is.\n```\n",
+	}
+	for i, input := range inputs {
+		p := filepath.Join(t.TempDir(), "doc.md")
+		if err := os.WriteFile(p, []byte(input), 0644); err != nil {
+			t.Fatal(err)
+		}
+		out, err := exec.Command(binary, "normalize", p).Output()
+		if err != nil {
+			t.Fatalf("input %d: %v", i, err)
+		}
+		if string(out) != want {
+			t.Errorf("input %d:\n--- expected\n%s\n--- actual\n%s", i, want, out)
+		}
+	}
+}
+
+// TestPipe verifies mdtools pipe runs the steps in .mdtools.toml over stdin
+// and files, with -check and -w.
+func TestPipe(t *testing.T) {
+	root, mdtools, env := mdtoolsRepo(t, map[string]string{
+		".mdtools.toml": "# Sentences, then references.\n[pipe]\nsteps = [\n  \"mdsplit\",\n  \"mdref\",  # numbered\n]\n",
+		"a.md":          "See [x](https://x.org). Then more.\n",
+		"sub/b.md":      "Done.\n",
+	}, "mdsplit", "mdref")
+	want := "See [x][1].\nThen more.\n\n[1]: https://x.org\n"
+
+	cmd := exec.Command(mdtools, "pipe")
+	cmd.Dir, cmd.Env = filepath.Join(root, "sub"), env
+	cmd.Stdin = strings.NewReader("See [x](https://x.org). Then more.\n")
+	if out, err := cmd.Output(); err != nil || string(out) != want {
+		t.Errorf("stdin: %v\n--- expected\n%s\n--- actual\n%s", err, want, out)
+	}
+
+	if out, status := runIn(t, root, env, mdtools, "pipe", "-check", "a.md", "sub/b.md"); status != 1 || out != "a.md\n" {
+		t.Errorf("expected -check to list a.md with status 1, got %d:\n%s", status, out)
+	}
+	if out, status := runIn(t, root, env, mdtools, "pipe", "-w", "a.md"); status != 0 {
+		t.Fatalf("-w failed with status %d:\n%s", status, out)
+	}
+	if got := readTree(t, root, "a.md"); got != want {
+		t.Errorf("a.md:\n--- expected\n%s\n--- actual\n%s", want, got)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, ".mdtools.toml"), []byte("[pipe]\nstep = [\"mdsplit\"]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if out, status := runIn(t, root, env, mdtools, "pipe", "a.md"); status != 2 || !strings.Contains(out, "unknown key pipe.step") {
+		t.Errorf("expected an unknown key error, got %d:\n%s", status, out)
+	}
+}
+
+// TestDoctor verifies mdtools doctor lists the configuration files and
+// pipeline it finds, and reports a width that disagrees with .editorconfig
+// and a step it can't run with status 1.
+func TestDoctor(t *testing.T) {
+	root, mdtools, env := mdtoolsRepo(t, map[string]string{
+		".mdtools.toml":       "[pipe]\nsteps = [\"mdwrap -c 72\"]\n",
+		".editorconfig":       "root = true\n\n[*.md]\nmax_line_length = 72\n",
+		"notes/.editorconfig": "[*.md]\nend_of_line = crlf\n",
+		"notes/a.md":          "Text.\n",
+	}, "mdwrap")
+
+	out, status := runIn(t, root, env, mdtools, "doctor", "notes/a.md")
+	for _, want := range []string{
+		filepath.Join(root, ".mdtools.toml"),
+		filepath.Join(root, "notes", ".editorconfig"),
+		"-breaks=keep -c=72 -f=false",
+		"end_of_line               crlf",
+		"No problems found.",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in:\n%s", want, out)
+		}
+	}
+	if status != 0 {
+		t.Errorf("expected status 0, got %d", status)
+	}
+
+	os.WriteFile(filepath.Join(root, ".mdtools.toml"), []byte("[pipe]\nsteps = [\"mdwrap\", \"mdnope\"]\n"), 0644)
+	out, status = runIn(t, root, env, mdtools, "doctor", "notes/a.md")
+	for _, want := range []string{
+		`pipeline step "mdwrap" wraps notes/a.md to 60, but its .editorconfig max_line_length, which mdwrap -w uses, is 72`,
+		"mdnope: mdnope is not installed",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in:\n%s", want, out)
+		}
+	}
+	if status != 1 {
+		t.Errorf("expected status 1, got %d", status)
+	}
+}
+
+// TestInit verifies mdtools init writes a configuration whose pipeline
+// keeps the files it surveyed as they are, and won't replace one without
+// -force.
+func TestInit(t *testing.T) {
+	root, mdtools, env := mdtoolsRepo(t, map[string]string{
+		"a.md": "Markdown files written by hand drift\napart over time, which is why a\n[pipeline][1] helps keep them in\nline.[^1]\n\n" +
+			"* first item\n* second\n\n[^1]: A note.\n\n[1]: https://example.com\n",
+		"sub/b.md": "Another paragraph that is also wrapped,\nso that the survey has more to go on.\n\n* one\n* two\n",
+	}, "mdlist", "mdref", "mdfnt", "mdwrap")
+
+	if out, status := runIn(t, root, env, mdtools, "init"); status != 0 {
+		t.Fatalf("init failed with status %d:\n%s", status, out)
+	}
+	got := readTree(t, root, ".mdtools.toml")
+	for _, want := range []string{
+		"# Lists: 4 of 4 bullets are \"*\".",
+		"# Paragraphs: 2 of 2 are hard wrapped, at most 39 characters wide.",
+		"steps = [\"mdlist -bullet *\", \"mdref\", \"mdfnt\", \"mdwrap -c 39\"]",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in:\n%s", want, got)
+		}
+	}
+	if out, status := runIn(t, root, env, mdtools, "pipe", "-check", "a.md", "sub/b.md"); status != 0 {
+		t.Errorf("expected the pipeline to keep the files, got %d:\n%s", status, out)
+	}
+
+	if out, status := runIn(t, root, env, mdtools, "init"); status != 2 || !strings.Contains(out, "use -force") {
+		t.Errorf("expected init to refuse to replace the configuration, got %d:\n%s", status, out)
+	}
+}
+
+// TestInstallHooks verifies mdtools install-hooks writes a pre-commit hook
+// that rejects staged files the pipeline would change, and that -drivers
+// registers the merge and diff drivers once.
+func TestInstallHooks(t *testing.T) {
+	root, mdtools, env := mdtoolsRepo(t, map[string]string{
+		"a.md": "One. Two.\n",
+	}, "mdsplit")
+	if out, status := runIn(t, root, env, mdtools, "install-hooks"); status != 2 || !strings.Contains(out, "no .mdtools.toml found") {
+		t.Errorf("expected install-hooks to need a config, got %d:\n%s", status, out)
+	}
+	if err := os.WriteFile(filepath.Join(root, ".mdtools.toml"), []byte("[pipe]\nfiles = [\"*.md\"]\nsteps = [\"mdsplit\"]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if out, status := runIn(t, root, env, mdtools, "install-hooks", "-drivers"); status != 0 {
+			t.Fatalf("install-hooks failed with status %d:\n%s", status, out)
+		}
+	}
+	if got, want := readTree(t, root, ".gitattributes"), "*.md merge=markdown diff=markdown\n"; got != want {
+		t.Errorf(".gitattributes:\n--- expected\n%s\n--- actual\n%s", want, got)
+	}
+	if out, _ := runIn(t, root, env, "git", "config", "diff.markdown.textconv"); out != "mdtools normalize\n" {
+		t.Errorf("expected the textconv driver to be set, got %q", out)
+	}
+
+	runIn(t, root, env, "git", "add", ".")
+	if out, status := runIn(t, root, env, "git", "commit", "-q", "-m", "unsplit"); status == 0 || !strings.Contains(out, "a.md") {
+		t.Errorf("expected the hook to reject a.md, got %d:\n%s", status, out)
+	}
+	runIn(t, root, env, mdtools, "pipe", "-w", "a.md")
+	runIn(t, root, env, "git", "add", "a.md")
+	if out, status := runIn(t, root, env, "git", "commit", "-q", "-m", "split"); status != 0 {
+		t.Errorf("expected the commit to pass the hook, got %d:\n%s", status, out)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, ".git", "hooks", "pre-commit"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if out, status := runIn(t, root, env, mdtools, "install-hooks"); status != 2 || !strings.Contains(out, "-force") {
+		t.Errorf("expected install-hooks to keep a foreign hook, got %d:\n%s", status, out)
+	}
+}
+
+// pluginSource is a plugin that replaces the "from" option with "to" and
+// appends its args and path, or fails when asked to.
+const pluginSource = `package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+)
+
+func main() {
+	var req struct {
+		Version int
+		Path    string
+		Content string
+		Args    []string
+		Options map[string]string
+	}
+	json.NewDecoder(os.Stdin).Decode(&req)
+	resp := map[string]string{}
+	if len(req.Args) > 0 && req.Args[0] == "fail" {
+		resp["error"] = "asked to fail"
+	} else {
+		resp["content"] = strings.ReplaceAll(req.Content, req.Options["from"], req.Options["to"]) +
+			strings.Join(append(os.Args[1:], req.Args...), " ") + " " + req.Path + "\n"
+	}
+	json.NewEncoder(os.Stdout).Encode(resp)
+}
+`
+
+// TestPlugins verifies mdtools pipe runs plugins declared in .mdtools.toml
+// over the JSON protocol, alongside tools.
+func TestPlugins(t *testing.T) {
+	root, mdtools, env := mdtoolsRepo(t, map[string]string{
+		".mdtools.toml":  "[pipe]\nsteps = [\"mdsplit\", \"fix -x\"]\n\n[plugins.fix]\ncommand = \"plugins/fix\"\nargs = [\"--strict\"]\n\n[plugins.fix.options]\nfrom = \"teh\"\nto = \"the\"\n",
+		"plugins/fix.go": pluginSource,
+		"a.md":           "Fix teh text. Done.\n",
+	}, "mdsplit")
+	if out, status := runIn(t, filepath.Join(root, "plugins"), env, "go", "build", "-o", "fix", "fix.go"); status != 0 {
+		t.Fatalf("building the plugin failed:\n%s", out)
+	}
+
+	out, status := runIn(t, root, env, mdtools, "pipe", "a.md")
+	if want := "Fix the text.\nDone.\n--strict -x a.md\n"; status != 0 || out != want {
+		t.Errorf("status %d:\n--- expected\n%s\n--- actual\n%s", status, want, out)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, ".mdtools.toml"), []byte("[pipe]\nsteps = [\"fix fail\"]\n\n[plugins.fix]\ncommand = \"plugins/fix\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if out, status := runIn(t, root, env, mdtools, "pipe", "a.md"); status != 2 || !strings.Contains(out, "fix fail: asked to fail") {
+		t.Errorf("expected the plugin's error, got %d:\n%s", status, out)
+	}
+}
+
+func TestServer(t *testing.T) {
+	mdtools := buildTool(t, "mdtools")
+	mdwrap := buildTool(t, "mdwrap")
+	content := "# A title\n\nSome prose that goes on for long enough to need wrapping at twenty columns.\n"
+	cmd := exec.Command(mdwrap, "-c", "20")
+	cmd.Stdin = strings.NewReader(content)
+	wrapped, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := strings.Join([]string{
+		`{"id": 1, "tool": "wrap", "content": ` + mustMarshal(t, content) + `, "options": {"c": 20}}`,
+		`[{"id": "a", "tool": "mdcase", "content": "# a title\n", "options": {"style": "sentence"}}, {"id": "b", "tool": "exec"}]`,
+		`{"id": 2, "tool": "fence", "options": {"style": "wavy"}}`,
+		`{"id": 3, "tool": "wrap", "options": {"columns": 20}}`,
+		`{"id": 4, "tool": "sidenote", "options": {"sourcemap": "map.json"}}`,
+		`not json`,
+	}, "\n")
+	cmd = exec.Command(mdtools, "server")
+	cmd.Stdin = strings.NewReader(input)
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`{"id":1,"content":` + mustMarshal(t, string(wrapped)) + `}`,
+		`[{"id":"a","content":"# A title\n"},{"id":"b","error":"unknown tool \"exec\""}]`,
+		`{"id":2,"error":"unknown -style \"wavy\" (want backtick or tilde)"}`,
+		`{"id":3,"error":"wrap has no option \"columns\""}`,
+		`{"id":4,"error":"sidenote has no option \"sourcemap\""}`,
+		`{"error":"invalid character 'o' in literal null (expecting 'u')"}`,
+	}
+	got := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n")
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("--- expected\n%s\n--- actual\n%s", strings.Join(want, "\n"), out)
+	}
+}
+
+func mustMarshal(t *testing.T, v any) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}